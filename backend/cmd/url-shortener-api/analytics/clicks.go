@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"github.com/google/uuid"
+)
+
+// NewClickEvent builds the click record for a redirect of urlMapping.
+// It must be called while the request is still being served.
+func NewClickEvent(r *http.Request, urlMapping models.UrlMapping) models.ClickEvent {
+	ip := utils.ClientIP(r)
+	country, region := lookupGeo(ip)
+	query := r.URL.Query()
+
+	return models.ClickEvent{
+		ClickID:      uuid.New().String(),
+		UrlMappingID: urlMapping.ID,
+		CreatedAt:    time.Now(),
+		IPAddress:    ip,
+		UserAgent:    truncate(r.UserAgent(), 512),
+		Referrer:     r.Referer(),
+		ReferrerHost: referrerHost(r.Referer()),
+		UTMSource:    truncate(query.Get("utm_source"), 255),
+		UTMMedium:    truncate(query.Get("utm_medium"), 255),
+		UTMCampaign:  truncate(query.Get("utm_campaign"), 255),
+		Country:      country,
+		Region:       region,
+		IsBot:        IsBot(r.UserAgent()),
+	}
+}
+
+// referrerHost reduces a Referer header to a lowercase host without "www.".
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	parsedURL, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return truncate(strings.TrimPrefix(strings.ToLower(parsedURL.Hostname()), "www."), 255)
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"strings"
+
+	"github.com/mssola/useragent"
+)
+
+// Device classes reported by ParseDevice.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// DeviceInfo is what a User-Agent string tells us about the visitor.
+type DeviceInfo struct {
+	Browser     string
+	OS          string
+	DeviceClass string
+}
+
+// ParseDevice extracts the browser, operating system and device class from
+// a User-Agent string.
+func ParseDevice(userAgent string) DeviceInfo {
+	if userAgent == "" {
+		return DeviceInfo{Browser: "Unknown", OS: "Unknown", DeviceClass: DeviceUnknown}
+	}
+
+	ua := useragent.New(userAgent)
+	browser, _ := ua.Browser()
+	info := DeviceInfo{
+		Browser: browser,
+		OS:      ua.OSInfo().Name,
+	}
+	if info.Browser == "" {
+		info.Browser = "Unknown"
+	}
+	if info.OS == "" {
+		info.OS = "Unknown"
+	}
+
+	switch {
+	case IsBot(userAgent):
+		info.DeviceClass = DeviceBot
+	case isTablet(userAgent):
+		info.DeviceClass = DeviceTablet
+	case ua.Mobile():
+		info.DeviceClass = DeviceMobile
+	default:
+		info.DeviceClass = DeviceDesktop
+	}
+	return info
+}
+
+// botMarkers catch crawlers and link-preview fetchers that the User-Agent
+// parser doesn't recognize as bots. Chat apps and social networks fetch a
+// link as soon as it is posted, which would otherwise count as a click.
+var botMarkers = []string{
+	"googlebot",
+	"bingbot",
+	"applebot",
+	"duckduckbot",
+	"yandexbot",
+	"slackbot",
+	"twitterbot",
+	"linkedinbot",
+	"discordbot",
+	"telegrambot",
+	"redditbot",
+	"pinterestbot",
+	"crawler",
+	"spider",
+	"facebookexternalhit",
+	"facebookcatalog",
+	"embedly",
+	"iframely",
+	"skypeuripreview",
+	"whatsapp",
+	"bitlybot",
+	"vkshare",
+	"google-pagerenderer",
+	"headlesschrome",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"go-http-client",
+}
+
+// IsBot reports whether a User-Agent string belongs to a crawler, link-preview
+// fetcher or scripted client rather than a person. An empty User-Agent counts
+// as a bot.
+func IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	if useragent.New(userAgent).Bot() {
+		return true
+	}
+	lower := strings.ToLower(userAgent)
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// constrainedBrowserMarkers identify proxy browsers, legacy Internet Explorer
+// and feature phones, which handle modern pages and scripts poorly.
+var constrainedBrowserMarkers = []string{
+	"opera mini",
+	"msie ",
+	"kaios",
+	"symbianos",
+	"series40",
+	"nokia",
+	"blackberry",
+	"windows phone os 7",
+	"j2me",
+	"midp",
+	"up.browser",
+	"netfront",
+	"ucbrowser",
+}
+
+// IsConstrainedBrowser reports whether a User-Agent string looks like a very
+// old or constrained browser that should get a plain-HTML page.
+func IsConstrainedBrowser(userAgent string) bool {
+	lower := strings.ToLower(userAgent)
+	for _, marker := range constrainedBrowserMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTablet catches the common tablet signatures the parser lumps in with phones.
+func isTablet(userAgent string) bool {
+	lower := strings.ToLower(userAgent)
+	if strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet") {
+		return true
+	}
+	// Android tablets omit "Mobile" from their User-Agent
+	return strings.Contains(lower, "android") && !strings.Contains(lower, "mobile")
+}
@@ -0,0 +1,23 @@
+package analytics
+
+import (
+	_ "embed"
+	"time"
+)
+
+// ClickIDParam is the query parameter that carries the click ID to destinations.
+const ClickIDParam = "usc_click"
+
+// bounceThreshold is how long a visitor must stay, absent any interaction,
+// for the visit not to count as a bounce.
+const bounceThreshold = 10 * time.Second
+
+// EngagementScript is served to destination sites to report post-click engagement.
+//
+//go:embed engagement.js
+var EngagementScript []byte
+
+// IsBounce reports whether a visit of the given length counts as a bounce.
+func IsBounce(duration time.Duration, interacted bool) bool {
+	return !interacted && duration < bounceThreshold
+}
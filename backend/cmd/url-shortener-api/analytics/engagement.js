@@ -0,0 +1,47 @@
+(function () {
+  "use strict";
+
+  var param = "usc_click";
+  var match = new RegExp("[?&]" + param + "=([^&#]+)").exec(window.location.search);
+  if (!match) {
+    return;
+  }
+
+  var clickId = decodeURIComponent(match[1]);
+  var script = document.currentScript;
+  var endpoint = new URL("/collect", script ? script.src : window.location.href).href;
+  var start = Date.now();
+  var interacted = false;
+  var sent = false;
+
+  function markInteracted() {
+    interacted = true;
+  }
+  ["click", "scroll", "keydown", "touchstart"].forEach(function (type) {
+    window.addEventListener(type, markInteracted, { once: true, passive: true });
+  });
+
+  function send() {
+    if (sent) {
+      return;
+    }
+    sent = true;
+    var payload = JSON.stringify({
+      click_id: clickId,
+      duration_ms: Date.now() - start,
+      interacted: interacted
+    });
+    if (navigator.sendBeacon) {
+      navigator.sendBeacon(endpoint, payload);
+    } else {
+      fetch(endpoint, { method: "POST", body: payload, keepalive: true, mode: "no-cors" });
+    }
+  }
+
+  document.addEventListener("visibilitychange", function () {
+    if (document.visibilityState === "hidden") {
+      send();
+    }
+  });
+  window.addEventListener("pagehide", send);
+})();
@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var geoReader *geoip2.Reader
+
+// OpenGeoIP loads a MaxMind GeoLite2/GeoIP2 City database used to enrich clicks.
+func OpenGeoIP(path string) error {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return err
+	}
+	geoReader = reader
+	return nil
+}
+
+// lookupGeo returns the country code and region for ip, or empty strings
+// when no database is loaded or the address isn't found.
+func lookupGeo(ip string) (country, region string) {
+	if geoReader == nil {
+		return "", ""
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return "", ""
+	}
+
+	record, err := geoReader.City(parsedIP)
+	if err != nil {
+		return "", ""
+	}
+
+	country = record.Country.IsoCode
+	if len(record.Subdivisions) > 0 {
+		region = record.Subdivisions[0].Names["en"]
+	}
+	return country, region
+}
@@ -0,0 +1,137 @@
+package analytics
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"math/rand"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// Ingestion counters, published via expvar so the trade-offs made under
+// load are visible.
+var (
+	clicksEnqueued      = expvar.NewInt("clicks_enqueued")
+	clicksWritten       = expvar.NewInt("clicks_written")
+	clicksDroppedFull   = expvar.NewInt("clicks_dropped_buffer_full")
+	clicksDroppedSample = expvar.NewInt("clicks_dropped_sampled")
+	clicksDroppedWrite  = expvar.NewInt("clicks_dropped_write_error")
+	clicksDroppedBot    = expvar.NewInt("clicks_dropped_bot")
+)
+
+var (
+	clickQueue     chan models.ClickEvent
+	sampleHighMark int
+	sampleRate     float64
+	dropBots       bool
+
+	stopWriter    chan struct{}
+	writerStopped chan struct{}
+)
+
+// StartClickWriter creates the click buffer and starts the goroutine that
+// drains it into the database in batches. It must be called before any
+// clicks are enqueued.
+func StartClickWriter(cfg config.Config) {
+	clickQueue = make(chan models.ClickEvent, cfg.ClickBufferSize)
+	sampleHighMark = int(float64(cfg.ClickBufferSize) * cfg.ClickSampleHighWater)
+	sampleRate = cfg.ClickSampleRate
+	dropBots = cfg.ClickBotPolicy == "drop"
+
+	stopWriter = make(chan struct{})
+	writerStopped = make(chan struct{})
+	go writeClicks(cfg.ClickBatchSize, cfg.ClickFlushInterval)
+}
+
+// StopClickWriter writes out the clicks still buffered and stops the
+// writer, waiting until it's done or ctx expires. Clicks enqueued after it
+// is called aren't written.
+func StopClickWriter(ctx context.Context) error {
+	close(stopWriter)
+	select {
+	case <-writerStopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BufferedClicks returns how many clicks are waiting to be written.
+func BufferedClicks() int {
+	return len(clickQueue)
+}
+
+// EnqueueClick hands a click to the background writer without blocking.
+// Once the buffer passes its high-water mark only a sample of clicks is
+// kept, and when it is full clicks are dropped; the redirect is never held up.
+// Live subscribers see every click, sampled or not. Bot clicks are
+// discarded entirely when the bot policy is "drop".
+func EnqueueClick(click models.ClickEvent) {
+	if click.IsBot && dropBots {
+		clicksDroppedBot.Add(1)
+		return
+	}
+
+	publishClick(click)
+
+	if len(clickQueue) >= sampleHighMark && rand.Float64() >= sampleRate {
+		clicksDroppedSample.Add(1)
+		return
+	}
+
+	select {
+	case clickQueue <- click:
+		clicksEnqueued.Add(1)
+	default:
+		clicksDroppedFull.Add(1)
+	}
+}
+
+func writeClicks(batchSize int, flushInterval time.Duration) {
+	defer close(writerStopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := db.DB.CreateInBatches(batch, batchSize).Error; err != nil {
+			log.Printf("Error writing %d clicks: %v", len(batch), err)
+			clicksDroppedWrite.Add(int64(len(batch)))
+		} else {
+			clicksWritten.Add(int64(len(batch)))
+		}
+		batch = make([]models.ClickEvent, 0, batchSize)
+	}
+
+	for {
+		select {
+		case click := <-clickQueue:
+			batch = append(batch, click)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stopWriter:
+			for {
+				select {
+				case click := <-clickQueue:
+					batch = append(batch, click)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package analytics
+
+import (
+	"expvar"
+	"sync"
+
+	"url-shortener/models"
+)
+
+// streamBufferSize is how many clicks a live subscriber may fall behind by
+// before further clicks are dropped for it.
+const streamBufferSize = 64
+
+var clicksDroppedStream = expvar.NewInt("clicks_dropped_stream_slow")
+
+var (
+	streamMu    sync.RWMutex
+	subscribers = make(map[uint]map[chan models.ClickEvent]struct{})
+)
+
+// streamsClosed is closed on shutdown to end every live stream.
+var (
+	streamsClosed    = make(chan struct{})
+	closeStreamsOnce sync.Once
+)
+
+// StreamsClosed is closed when the server starts shutting down, so
+// long-lived streams can end instead of holding the shutdown up.
+func StreamsClosed() <-chan struct{} {
+	return streamsClosed
+}
+
+// CloseStreams ends every live stream. It's safe to call more than once.
+func CloseStreams() {
+	closeStreamsOnce.Do(func() { close(streamsClosed) })
+}
+
+// SubscribeClicks registers for live clicks on the given link. The returned
+// function must be called to unsubscribe once the caller stops reading.
+func SubscribeClicks(urlMappingID uint) (<-chan models.ClickEvent, func()) {
+	ch := make(chan models.ClickEvent, streamBufferSize)
+
+	streamMu.Lock()
+	if subscribers[urlMappingID] == nil {
+		subscribers[urlMappingID] = make(map[chan models.ClickEvent]struct{})
+	}
+	subscribers[urlMappingID][ch] = struct{}{}
+	streamMu.Unlock()
+
+	return ch, func() {
+		streamMu.Lock()
+		delete(subscribers[urlMappingID], ch)
+		if len(subscribers[urlMappingID]) == 0 {
+			delete(subscribers, urlMappingID)
+		}
+		streamMu.Unlock()
+	}
+}
+
+// publishClick fans a click out to the link's live subscribers without
+// blocking; a subscriber that isn't keeping up misses clicks instead.
+func publishClick(click models.ClickEvent) {
+	streamMu.RLock()
+	defer streamMu.RUnlock()
+
+	for ch := range subscribers[click.UrlMappingID] {
+		select {
+		case ch <- click:
+		default:
+			clicksDroppedStream.Add(1)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package blocklist
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// refreshInterval is how often the rules are reloaded, so changes made
+// through other instances take effect everywhere.
+const refreshInterval = time.Minute
+
+var cache struct {
+	sync.Mutex
+	rules    map[string]string // domain -> action
+	loadedAt time.Time
+}
+
+// Invalidate makes the next lookup reload the rules. Call it after changing them.
+func Invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.rules = nil
+}
+
+// Blocked reports whether rawURL's host is covered by a block rule that no
+// more specific allow rule overrides, along with the rule's domain.
+func Blocked(rawURL string) (string, bool) {
+	domain, action := matchingRule(rawURL)
+	return domain, action == models.DomainBlock
+}
+
+// Allowed reports whether rawURL's host is covered by an allow rule that no
+// more specific block rule overrides.
+func Allowed(rawURL string) bool {
+	_, action := matchingRule(rawURL)
+	return action == models.DomainAllow
+}
+
+// matchingRule returns the most specific rule covering rawURL's host, and
+// its action, or empty strings if none does.
+func matchingRule(rawURL string) (string, string) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", ""
+	}
+	host := NormalizeDomain(parsedURL.Hostname())
+	if host == "" {
+		return "", ""
+	}
+
+	rules := currentRules()
+	// Walk from the full host up through its parent domains
+	for domain := host; domain != ""; {
+		if action, ok := rules[domain]; ok {
+			return domain, action
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+	return "", ""
+}
+
+// NormalizeDomain lowercases domain and strips any trailing dot.
+func NormalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+func currentRules() map[string]string {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.rules != nil && time.Since(cache.loadedAt) < refreshInterval {
+		return cache.rules
+	}
+
+	var domains []models.BlockedDomain
+	if err := db.DB.Select("domain", "action").Find(&domains).Error; err != nil {
+		// Keep enforcing the last rules we had rather than none
+		log.Println("Error loading domain rules:", err)
+		if cache.rules == nil {
+			return map[string]string{}
+		}
+		return cache.rules
+	}
+
+	rules := make(map[string]string, len(domains))
+	for _, domain := range domains {
+		rules[domain.Domain] = domain.Action
+	}
+	cache.rules = rules
+	cache.loadedAt = time.Now()
+	return rules
+}
@@ -0,0 +1,33 @@
+// Package chaos injects latency and failures into the database, caches and
+// outbound checks for resilience testing. Faults can only be configured in
+// binaries built with the "chaos" build tag; in normal builds every hook is
+// a no-op.
+package chaos
+
+import (
+	"errors"
+	"time"
+)
+
+// Injection points.
+const (
+	TargetDB       = "db"
+	TargetCache    = "cache"
+	TargetOutbound = "outbound"
+)
+
+var (
+	ErrDisabled      = errors.New("chaos mode is not compiled into this binary")
+	ErrUnknownTarget = errors.New("unknown chaos target")
+	ErrInjected      = errors.New("chaos: injected failure")
+)
+
+// Fault describes what to inject at one target.
+type Fault struct {
+	Latency   time.Duration
+	ErrorRate float64 // 0..1 probability of failing
+}
+
+func validTarget(target string) bool {
+	return target == TargetDB || target == TargetCache || target == TargetOutbound
+}
@@ -0,0 +1,18 @@
+//go:build !chaos
+
+package chaos
+
+// Enabled reports whether fault injection is compiled in.
+const Enabled = false
+
+// Inject is a no-op without the chaos build tag.
+func Inject(target string) error { return nil }
+
+// Set always fails without the chaos build tag.
+func Set(target string, fault Fault) error { return ErrDisabled }
+
+// Clear is a no-op without the chaos build tag.
+func Clear() {}
+
+// Faults is always empty without the chaos build tag.
+func Faults() map[string]Fault { return map[string]Fault{} }
@@ -0,0 +1,68 @@
+//go:build chaos
+
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Enabled reports whether fault injection is compiled in.
+const Enabled = true
+
+var (
+	mu     sync.RWMutex
+	faults = make(map[string]Fault)
+)
+
+// Inject applies the configured fault for target: it sleeps for the fault's
+// latency and then fails with the configured probability.
+func Inject(target string) error {
+	mu.RLock()
+	fault, ok := faults[target]
+	mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if fault.Latency > 0 {
+		time.Sleep(fault.Latency)
+	}
+	if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+		return fmt.Errorf("%w at %s", ErrInjected, target)
+	}
+	return nil
+}
+
+// Set configures the fault for target, replacing any existing one.
+func Set(target string, fault Fault) error {
+	if !validTarget(target) {
+		return fmt.Errorf("%w: %s", ErrUnknownTarget, target)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	faults[target] = fault
+	return nil
+}
+
+// Clear removes all configured faults.
+func Clear() {
+	mu.Lock()
+	defer mu.Unlock()
+	faults = make(map[string]Fault)
+}
+
+// Faults returns a copy of the configured faults.
+func Faults() map[string]Fault {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	snapshot := make(map[string]Fault, len(faults))
+	for target, fault := range faults {
+		snapshot[target] = fault
+	}
+	return snapshot
+}
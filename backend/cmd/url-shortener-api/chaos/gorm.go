@@ -0,0 +1,37 @@
+package chaos
+
+import (
+	"gorm.io/gorm"
+)
+
+// RegisterGormCallbacks makes every query through db pass through the "db"
+// injection point. It does nothing unless chaos mode is compiled in.
+func RegisterGormCallbacks(db *gorm.DB) error {
+	if !Enabled {
+		return nil
+	}
+
+	inject := func(tx *gorm.DB) {
+		if err := Inject(TargetDB); err != nil {
+			tx.AddError(err)
+		}
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("chaos:create", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("chaos:query", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("chaos:update", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("chaos:delete", inject); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("chaos:row", inject); err != nil {
+		return err
+	}
+	return callbacks.Raw().Before("gorm:raw").Register("chaos:raw", inject)
+}
@@ -1,36 +1,837 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Tier is the set of limits applied to a class of shortening clients.
+type Tier struct {
+	MaxExpiry        time.Duration // longest allowed lifetime of a link; zero is unlimited
+	ShortenPerMinute int           // shorten requests per minute per client; zero is unlimited
+	CustomAliases    bool          // whether links may be given a chosen short code
+	ProxyContent     bool          // whether links may serve their destination's content instead of redirecting
+}
+
+// RateLimit is a per-client token bucket: RPS requests per second with bursts
+// of up to Burst. Zero RPS disables the limit.
+type RateLimit struct {
+	RPS   float64
+	Burst int
+}
+
+// RateLimits are the per-client limits for each class of route.
+type RateLimits struct {
+	API      RateLimit            // writes and management
+	Redirect RateLimit            // short link redirects and the tracking calls they trigger
+	APIKey   RateLimit            // default per-key limit on API routes for keys without their own
+	Routes   map[string]RateLimit // overrides keyed by route template, e.g. "/shorten"
+	Bypass   []string             // IPs and CIDR ranges, such as health checkers, that aren't limited
+}
+
 type Config struct {
 	Port               string
 	SafeBrowsingAPIKey string
 	DBConnectionString string
+
+	// URLEncryptionKey is a base64-encoded 32-byte key that encrypts
+	// destination URLs, webhook secrets and password hashes in the
+	// database. The destination URLs include localized ones, malicious URL
+	// logs, and the webhook payloads and import row errors that quote them.
+	// Empty stores them in plaintext, and `migrate seal` encrypts what was
+	// stored before a key was set. Links cached in Redis are kept
+	// decrypted.
+	URLEncryptionKey string
+
+	// LinkStore is "database" or "memory". The memory store loses every
+	// link on restart and is meant for demos; pair it with DB_DRIVER=sqlite
+	// for an instance that needs no external services. Only redirects and
+	// link CRUD see its links: jobs, takedowns, feeds and the dashboard
+	// summary don't.
+	LinkStore string
+
+	// RedisURL enables a Redis read-through cache of redirect lookups, with
+	// entries kept for RedisCacheTTL. Empty disables it.
+	RedisURL      string
+	RedisCacheTTL time.Duration
+
+	// With Redis on, the CacheWarmLinks links clicked most over the past
+	// CacheWarmWindow are reloaded into it every CacheWarmInterval.
+	CacheWarmInterval time.Duration
+	CacheWarmLinks    int
+	CacheWarmWindow   time.Duration
+
+	// MaintenanceMode starts the server refusing writes with 503, asking
+	// clients to retry after MaintenanceRetryAfter, while redirects and
+	// other reads carry on. Admins can turn it on and off at runtime.
+	MaintenanceMode       bool
+	MaintenanceRetryAfter time.Duration
+
+	// OpenAPIDocsUI serves Swagger UI for /openapi.json at /docs. The page
+	// loads its scripts from a CDN.
+	OpenAPIDocsUI bool
+
+	// AccessLogFormat is "combined" for Apache's combined log format or
+	// "json" for one JSON object per request.
+	AccessLogFormat string
+
+	// MetricsToken, when set, is the bearer token Prometheus must send to
+	// scrape /metrics. Empty leaves the endpoint open.
+	MetricsToken string
+
+	// The server terminates TLS itself when TLSCertFile and TLSKeyFile are
+	// set, or gets certificates from Let's Encrypt for AutocertDomains and
+	// verified custom domains, caching them in AutocertCacheDir. PORT is
+	// then the HTTPS port, and HTTPRedirectPort, unless empty, redirects
+	// plain HTTP to it and answers ACME challenges.
+	TLSCertFile      string
+	TLSKeyFile       string
+	AutocertDomains  []string
+	AutocertEmail    string
+	AutocertCacheDir string
+	HTTPRedirectPort string
+
+	// ConfigWatchInterval is how often the config file, if there is one, is
+	// checked for changes to reload; zero only reloads on SIGHUP.
+	ConfigWatchInterval time.Duration
+
+	// RequestTimeout bounds how long a request may take, including the
+	// database queries and outbound checks it makes; streams and exports are
+	// exempt. ReadHeaderTimeout and IdleTimeout stop slow or idle clients
+	// holding connections open. MaxRequestBodyBytes caps what /shorten reads.
+	RequestTimeout      time.Duration
+	ReadHeaderTimeout   time.Duration
+	IdleTimeout         time.Duration
+	MaxRequestBodyBytes int
+
+	// ShutdownTimeout bounds how long a SIGINT or SIGTERM waits for
+	// in-flight requests, running jobs and buffered clicks to finish.
+	ShutdownTimeout time.Duration
+
+	// Background jobs run on their own intervals, each wait spread by up to
+	// JobJitter of it either way. Jobs named in DisabledJobs don't run.
+	JobJitter    float64
+	DisabledJobs []string
+
+	// DBDriver is "postgres" or "sqlite". SQLite is meant for local
+	// development and CI; DB_CONNECTION_STRING is then a file path, and the
+	// binary must be built with cgo.
+	DBDriver string
+
+	// DBReplicaConnectionString points redirects and stats at a read-only
+	// Postgres replica; writes always go to DBConnectionString.
+	DBReplicaConnectionString string
+
+	// Connection pool limits for the database. Zero leaves a limit off,
+	// except DBMaxIdleConns, where it keeps no idle connections.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+
+	// DBConnectAttempts is how many times startup tries to reach the
+	// database, waiting DBConnectRetryDelay after the first failure and
+	// doubling the wait after each one.
+	DBConnectAttempts   int
+	DBConnectRetryDelay time.Duration
+
+	// DBAutoMigrate applies pending schema migrations at startup. Turn it
+	// off to run them separately with the migrate subcommand.
+	DBAutoMigrate bool
+
+	// SafeBrowsingCacheTTL controls how long verdicts are reused; zero disables caching.
+	SafeBrowsingCacheTTL time.Duration
+
+	// URLScanners lists the threat-intel providers URLs are checked against:
+	// "safebrowsing" and "virustotal". URLScanAggregation is "any" to treat a
+	// URL as unsafe when one provider says so, or "all" to need every one.
+	URLScanners        []string
+	URLScanAggregation string
+
+	VirusTotalAPIKey        string
+	VirusTotalTimeout       time.Duration
+	VirusTotalCacheTTL      time.Duration
+	VirusTotalMinDetections int // engines that must call a URL malicious
+
+	// SafeBrowsingTimeout bounds Safe Browsing lookups; those that time out
+	// let the URL through.
+	SafeBrowsingTimeout time.Duration
+
+	// OutboundBlockedNetworks are IP ranges that destination checks and
+	// proxied fetches may not connect to, guarding against SSRF; by default
+	// private, loopback, link-local (including cloud metadata services) and
+	// other internal ranges. OutboundAllowedNetworks carves out exceptions.
+	OutboundBlockedNetworks []string
+	OutboundAllowedNetworks []string
+
+	// ShortLinkHosts are the hosts this service's short links are served on;
+	// links back to them are refused since they'd redirect in a loop.
+	ShortLinkHosts []string
+
+	// LinkDomains are extra hosts, each a host or host:port, that links can
+	// be bound to. A bound link only redirects on its domain, and unbound
+	// links don't redirect on any of them. Links back to them are refused
+	// like those to ShortLinkHosts.
+	LinkDomains []string
+
+	// Users may each claim up to CustomDomainsPerUser domains of their own
+	// (none when zero), which the verification job checks for their DNS TXT
+	// challenge every CustomDomainVerifyInterval, zero disabling it, using
+	// the DNS server at CustomDomainResolver (host:port) or the system's if
+	// empty. Claims not verified within CustomDomainClaimDays are dropped;
+	// zero keeps them.
+	CustomDomainsPerUser       int
+	CustomDomainVerifyInterval time.Duration
+	CustomDomainResolver       string
+	CustomDomainClaimDays      int
+
+	// Abuse reports are emailed to AbuseNotifyEmails, or to every admin if
+	// empty.
+	AbuseNotifyEmails []string
+
+	// CaptchaProvider is "recaptcha" or "turnstile" to require a solved
+	// CAPTCHA from anonymous shortening requests; empty disables it.
+	// CaptchaMinScore only applies to reCAPTCHA v3 tokens.
+	CaptchaProvider string
+	CaptchaSecret   string
+	CaptchaMinScore float64
+
+	// Preview tokens let stakeholders follow links before they go live.
+	PreviewTokenSecret string
+	PreviewTokenTTL    time.Duration
+
+	// NotLiveStatusCode is returned (404 or 410) for links before their live date.
+	NotLiveStatusCode     int
+	LiveDateCheckInterval time.Duration
+
+	// AsyncValidation creates links as pending and checks their destinations
+	// on ValidationWorkers background workers, so shortening doesn't wait on
+	// them. Once ValidationQueueSize links are waiting, checks run inline.
+	AsyncValidation     bool
+	ValidationWorkers   int
+	ValidationQueueSize int
+
+	// Bulk link imports read files of up to ImportMaxBytes and ImportMaxRows
+	// rows, and create their links ImportBatchSize at a time, recording
+	// progress after each batch.
+	ImportMaxBytes  int
+	ImportMaxRows   int
+	ImportBatchSize int
+
+	// MaxRedirectHops is how many redirects are followed to find a
+	// destination's final URL; longer chains are rejected.
+	MaxRedirectHops int
+
+	// Live and inactive links are re-checked every CheckInterval hours; the
+	// worker looks for due links this often, zero disabling it.
+	LinkRecheckInterval  time.Duration
+	LinkRecheckBatchSize int
+
+	// InterstitialTemplatePath optionally overrides the built-in countdown page.
+	InterstitialTemplatePath string
+	MaxInterstitialSeconds   int
+
+	// GeoIPDatabasePath points at a MaxMind City database used to enrich clicks.
+	GeoIPDatabasePath string
+
+	// Click ingestion buffering and load-shedding.
+	ClickBufferSize      int
+	ClickBatchSize       int
+	ClickFlushInterval   time.Duration
+	ClickSampleHighWater float64 // buffer fill ratio at which sampling starts
+	ClickSampleRate      float64 // fraction of clicks kept while sampling
+
+	// ClickBotPolicy is "tag" to record bot clicks but leave them out of stats,
+	// or "drop" to not record them at all.
+	ClickBotPolicy string
+
+	// ClickRetentionDays is how long raw clicks are kept before being folded
+	// into daily rollups; zero keeps them forever.
+	ClickRetentionDays  int
+	ClickRollupInterval time.Duration
+
+	// On Postgres, raw clicks are partitioned by month. ClickPartitionsAhead
+	// months are created in advance; partitions that ended more than
+	// ClickPartitionRetentionMonths ago are dropped outright, so it must
+	// outlast ClickRetentionDays when rollups are on. Zero keeps them.
+	ClickPartitionsAhead          int
+	ClickPartitionRetentionMonths int
+
+	// DeletedLinkRetentionDays is how long deleted links can be restored
+	// before they're purged with their clicks; zero keeps them forever.
+	DeletedLinkRetentionDays int
+
+	// Links past their intended expiry date are marked expired this often,
+	// zero disabling it. Those expired for ExpiredLinkArchiveDays are moved
+	// to the archive, freeing their short codes; zero never archives them.
+	LinkExpiryInterval     time.Duration
+	ExpiredLinkArchiveDays int
+
+	// ExpiryNoticeDays is how long before a link's expiry date its owner is
+	// emailed about it; zero sends no advance notice.
+	ExpiryNoticeDays int
+
+	// Proxy mode limits for links that serve content instead of redirecting.
+	// Fetched content is cached for ProxyCacheTTL, up to ProxyCacheMaxBytes
+	// in all.
+	ProxyMaxBytes      int64
+	ProxyAllowedTypes  []string
+	ProxyCacheTTL      time.Duration
+	ProxyCacheMaxBytes int64
+
+	// JWTSecret signs user access tokens; empty disables user accounts.
+	JWTSecret       string
+	JWTTTL          time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Social login client credentials; a provider is enabled when its client ID is set.
+	GoogleClientID       string
+	GoogleClientSecret   string
+	GitHubClientID       string
+	GitHubClientSecret   string
+	OAuthRedirectBaseURL string // public base URL for callbacks; derived from the request if empty
+	OAuthSuccessURL      string // frontend page that receives the token; JSON response if empty
+
+	// Generic OIDC single sign-on, enabled when the discovery URL is set.
+	// OIDCGroupRoles maps IdP group names to user roles; when set, each login
+	// resets the user's role from their groups.
+	OIDCDiscoveryURL string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCScopes       []string
+	OIDCGroupsClaim  string
+	OIDCGroupRoles   map[string]string
+	OIDCTrustEmail   bool // treat emails as verified when the IdP omits email_verified
+
+	// Organization invitations; the token is appended to InviteAcceptURL as
+	// ?token=, or the link points at the API if it's empty.
+	InviteTTL       time.Duration
+	InviteAcceptURL string
+
+	// Operator alerts for malicious detections, sent to a Slack incoming
+	// webhook and/or by email. A spike alert fires when AlertSpikeThreshold
+	// detections happen within AlertSpikeWindow; zero disables it.
+	AlertSlackWebhookURL string
+	AlertEmails          []string
+	AlertSpikeThreshold  int
+	AlertSpikeWindow     time.Duration
+
+	// SlackSigningSecret turns on the /integrations/slack slash command
+	// endpoint, which rejects requests not signed with it.
+	SlackSigningSecret string
+
+	// Outbound webhooks. Pending deliveries are sent every
+	// WebhookDeliveryInterval, zero disabling it, and a failed one is retried
+	// after WebhookRetryBackoff, doubling each time, until it has been tried
+	// WebhookMaxAttempts times. A link.click_threshold event is raised when a
+	// link's human clicks pass one of WebhookClickThresholds.
+	WebhookDeliveryInterval time.Duration
+	WebhookTimeout          time.Duration
+	WebhookMaxAttempts      int
+	WebhookRetryBackoff     time.Duration
+	WebhookClickThresholds  []int64
+
+	// Export of per-link daily clicks to a Google Sheet, on when
+	// GoogleSheetsSpreadsheetID is set. Each finished UTC day is appended,
+	// a row per link, to the sheet GoogleSheetsRange names, checking every
+	// GoogleSheetsExportInterval. GoogleSheetsCredentialsFile is the JSON key
+	// of a service account the spreadsheet is shared with.
+	GoogleSheetsSpreadsheetID   string
+	GoogleSheetsRange           string
+	GoogleSheetsCredentialsFile string
+	GoogleSheetsExportInterval  time.Duration
+
+	// Outgoing mail; messages are logged instead when SMTPHost is empty.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// Default API key quotas on shorten calls, in UTC days and months; zero is unlimited.
+	APIKeyDailyQuota   int
+	APIKeyMonthlyQuota int
+
+	// Limits for anonymous clients and for signed-in users.
+	AnonymousTier     Tier
+	AuthenticatedTier Tier
+
+	// RateLimits apply per client IP and are reloaded from the environment
+	// and .env on SIGHUP.
+	RateLimits RateLimits
+
+	// TrustedProxies are the IPs or CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header identifies the client.
+	TrustedProxies []string
+
+	// AdminAPIToken is the bearer token for /api/admin routes; empty disables them.
+	AdminAPIToken string
+
+	// parseErr holds the values that couldn't be parsed, which Validate
+	// reports with the other problems.
+	parseErr error
 }
 
-func LoadConfig() Config {
+// LoadConfig reads the settings from the environment and from the config
+// file at path, or at CONFIG_FILE if path is empty. The environment wins
+// where both set a value.
+func LoadConfig(path string) Config {
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("No .env file found, relying on environment variables")
 	}
 
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path); err != nil {
+			log.Fatalf("Failed to read config file %s: %v", path, err)
+		}
+		log.Printf("Read config file %s", path)
+	}
+
 	config := Config{
 		Port:               getEnv("PORT", "8080"),
 		SafeBrowsingAPIKey: getEnv("SAFE_BROWSING_API_KEY", ""),
 		DBConnectionString: getEnv("DB_CONNECTION_STRING", ""),
+		DBDriver:           getEnv("DB_DRIVER", "postgres"),
+		DBAutoMigrate:      getEnvBool("DB_AUTO_MIGRATE", true),
+
+		DBReplicaConnectionString: getEnv("DB_REPLICA_CONNECTION_STRING", ""),
+
+		DBMaxOpenConns:      getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:      getEnvInt("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime:   getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		DBConnMaxIdleTime:   getEnvDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		DBConnectAttempts:   getEnvInt("DB_CONNECT_ATTEMPTS", 10),
+		DBConnectRetryDelay: getEnvDuration("DB_CONNECT_RETRY_DELAY", time.Second),
+
+		URLEncryptionKey: getEnv("URL_ENCRYPTION_KEY", ""),
+
+		LinkStore:     getEnv("LINK_STORE", "database"),
+		RedisURL:      getEnv("REDIS_URL", ""),
+		RedisCacheTTL: getEnvDuration("REDIS_CACHE_TTL", 5*time.Minute),
+
+		CacheWarmInterval: getEnvDuration("CACHE_WARM_INTERVAL", time.Minute),
+		CacheWarmLinks:    getEnvInt("CACHE_WARM_LINKS", 100),
+		CacheWarmWindow:   getEnvDuration("CACHE_WARM_WINDOW", time.Hour),
+
+		MaintenanceMode:       getEnvBool("MAINTENANCE_MODE", false),
+		MaintenanceRetryAfter: getEnvDuration("MAINTENANCE_RETRY_AFTER", 5*time.Minute),
+
+		OpenAPIDocsUI: getEnvBool("OPENAPI_DOCS_UI", false),
+
+		AccessLogFormat: getEnv("ACCESS_LOG_FORMAT", "combined"),
+
+		MetricsToken: getEnv("METRICS_TOKEN", ""),
+
+		TLSCertFile:      getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:       getEnv("TLS_KEY_FILE", ""),
+		AutocertDomains:  getEnvList("AUTOCERT_DOMAINS", nil),
+		AutocertEmail:    getEnv("AUTOCERT_EMAIL", ""),
+		AutocertCacheDir: getEnv("AUTOCERT_CACHE_DIR", "autocert-cache"),
+		HTTPRedirectPort: getEnv("HTTP_REDIRECT_PORT", "80"),
+
+		ConfigWatchInterval: getEnvDuration("CONFIG_WATCH_INTERVAL", 10*time.Second),
+
+		RequestTimeout:      getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+		ReadHeaderTimeout:   getEnvDuration("READ_HEADER_TIMEOUT", 10*time.Second),
+		IdleTimeout:         getEnvDuration("IDLE_TIMEOUT", 2*time.Minute),
+		MaxRequestBodyBytes: getEnvInt("MAX_REQUEST_BODY_BYTES", 1<<20),
+
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		JobJitter:    getEnvFloat("JOB_JITTER", 0.1),
+		DisabledJobs: getEnvList("DISABLED_JOBS", nil),
+
+		SafeBrowsingCacheTTL: getEnvDuration("SAFE_BROWSING_CACHE_TTL", time.Hour),
+
+		SafeBrowsingTimeout: getEnvDuration("SAFE_BROWSING_TIMEOUT", 3*time.Second),
+
+		URLScanners:        getEnvList("URL_SCANNERS", []string{"safebrowsing"}),
+		URLScanAggregation: getEnv("URL_SCAN_AGGREGATION", "any"),
+
+		VirusTotalAPIKey:        getEnv("VIRUSTOTAL_API_KEY", ""),
+		VirusTotalTimeout:       getEnvDuration("VIRUSTOTAL_TIMEOUT", 5*time.Second),
+		VirusTotalCacheTTL:      getEnvDuration("VIRUSTOTAL_CACHE_TTL", 6*time.Hour),
+		VirusTotalMinDetections: getEnvInt("VIRUSTOTAL_MIN_DETECTIONS", 2),
+
+		OutboundBlockedNetworks: getEnvList("OUTBOUND_BLOCKED_NETWORKS", []string{
+			"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+			"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4",
+			"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+		}),
+		OutboundAllowedNetworks: getEnvList("OUTBOUND_ALLOWED_NETWORKS", nil),
+
+		ShortLinkHosts: getEnvList("SHORT_LINK_HOSTS", nil),
+		LinkDomains:    getEnvList("LINK_DOMAINS", nil),
+
+		CustomDomainsPerUser:       getEnvInt("CUSTOM_DOMAINS_PER_USER", 5),
+		CustomDomainVerifyInterval: getEnvDuration("CUSTOM_DOMAIN_VERIFY_INTERVAL", 5*time.Minute),
+		CustomDomainResolver:       getEnv("CUSTOM_DOMAIN_RESOLVER", ""),
+		CustomDomainClaimDays:      getEnvInt("CUSTOM_DOMAIN_CLAIM_DAYS", 7),
+
+		AbuseNotifyEmails: getEnvList("ABUSE_NOTIFY_EMAILS", nil),
+
+		CaptchaProvider: getEnv("CAPTCHA_PROVIDER", ""),
+		CaptchaSecret:   getEnv("CAPTCHA_SECRET", ""),
+		CaptchaMinScore: getEnvFloat("CAPTCHA_MIN_SCORE", 0.5),
+
+		PreviewTokenSecret: getEnv("PREVIEW_TOKEN_SECRET", ""),
+		PreviewTokenTTL:    getEnvDuration("PREVIEW_TOKEN_TTL", 24*time.Hour),
+
+		NotLiveStatusCode:     getEnvInt("NOT_LIVE_STATUS", 404),
+		LiveDateCheckInterval: getEnvDuration("LIVE_DATE_CHECK_INTERVAL", time.Minute),
+
+		AsyncValidation:     getEnvBool("ASYNC_VALIDATION", false),
+		ValidationWorkers:   getEnvInt("VALIDATION_WORKERS", 4),
+		ValidationQueueSize: getEnvInt("VALIDATION_QUEUE_SIZE", 1000),
+
+		ImportMaxBytes:  getEnvInt("IMPORT_MAX_BYTES", 10<<20),
+		ImportMaxRows:   getEnvInt("IMPORT_MAX_ROWS", 10000),
+		ImportBatchSize: getEnvInt("IMPORT_BATCH_SIZE", 100),
+
+		MaxRedirectHops: getEnvInt("MAX_REDIRECT_HOPS", 5),
+
+		LinkRecheckInterval:  getEnvDuration("LINK_RECHECK_INTERVAL", 5*time.Minute),
+		LinkRecheckBatchSize: getEnvInt("LINK_RECHECK_BATCH_SIZE", 50),
+
+		InterstitialTemplatePath: getEnv("INTERSTITIAL_TEMPLATE_PATH", ""),
+		MaxInterstitialSeconds:   getEnvInt("MAX_INTERSTITIAL_SECONDS", 30),
+
+		GeoIPDatabasePath: getEnv("GEOIP_DB_PATH", ""),
+
+		ClickBufferSize:      getEnvInt("CLICK_BUFFER_SIZE", 10000),
+		ClickBatchSize:       getEnvInt("CLICK_BATCH_SIZE", 200),
+		ClickFlushInterval:   getEnvDuration("CLICK_FLUSH_INTERVAL", time.Second),
+		ClickSampleHighWater: getEnvFloat("CLICK_SAMPLE_HIGH_WATER", 0.8),
+		ClickSampleRate:      getEnvFloat("CLICK_SAMPLE_RATE", 0.1),
+
+		ClickBotPolicy: getEnv("CLICK_BOT_POLICY", "tag"),
+
+		ClickRetentionDays:  getEnvInt("CLICK_RETENTION_DAYS", 0),
+		ClickRollupInterval: getEnvDuration("CLICK_ROLLUP_INTERVAL", time.Hour),
+
+		ClickPartitionsAhead:          getEnvInt("CLICK_PARTITIONS_AHEAD", 3),
+		ClickPartitionRetentionMonths: getEnvInt("CLICK_PARTITION_RETENTION_MONTHS", 0),
+
+		DeletedLinkRetentionDays: getEnvInt("DELETED_LINK_RETENTION_DAYS", 30),
+
+		LinkExpiryInterval:     getEnvDuration("LINK_EXPIRY_INTERVAL", time.Minute),
+		ExpiredLinkArchiveDays: getEnvInt("EXPIRED_LINK_ARCHIVE_DAYS", 0),
+
+		ExpiryNoticeDays: getEnvInt("EXPIRY_NOTICE_DAYS", 7),
+
+		ProxyMaxBytes:      int64(getEnvInt("PROXY_MAX_BYTES", 10<<20)),
+		ProxyAllowedTypes:  getEnvList("PROXY_ALLOWED_TYPES", []string{"application/pdf", "image/png", "image/jpeg", "image/gif", "text/plain"}),
+		ProxyCacheTTL:      getEnvDuration("PROXY_CACHE_TTL", 10*time.Minute),
+		ProxyCacheMaxBytes: int64(getEnvInt("PROXY_CACHE_MAX_BYTES", 100<<20)),
+
+		JWTSecret:       getEnv("JWT_SECRET", ""),
+		JWTTTL:          getEnvDuration("JWT_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		GoogleClientID:       getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:   getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GitHubClientID:       getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret:   getEnv("GITHUB_CLIENT_SECRET", ""),
+		OAuthRedirectBaseURL: getEnv("OAUTH_REDIRECT_BASE_URL", ""),
+		OAuthSuccessURL:      getEnv("OAUTH_SUCCESS_URL", ""),
+
+		OIDCDiscoveryURL: getEnv("OIDC_DISCOVERY_URL", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCScopes:       getEnvList("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+		OIDCGroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCGroupRoles:   getEnvMap("OIDC_GROUP_ROLES"),
+		OIDCTrustEmail:   getEnvBool("OIDC_TRUST_EMAIL", false),
+
+		InviteTTL:       getEnvDuration("INVITE_TTL", 7*24*time.Hour),
+		InviteAcceptURL: getEnv("INVITE_ACCEPT_URL", ""),
+
+		AlertSlackWebhookURL: getEnv("ALERT_SLACK_WEBHOOK_URL", ""),
+		AlertEmails:          getEnvList("ALERT_EMAILS", nil),
+		AlertSpikeThreshold:  getEnvInt("ALERT_SPIKE_THRESHOLD", 20),
+		AlertSpikeWindow:     getEnvDuration("ALERT_SPIKE_WINDOW", 10*time.Minute),
+
+		SlackSigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+
+		WebhookDeliveryInterval: getEnvDuration("WEBHOOK_DELIVERY_INTERVAL", 10*time.Second),
+		WebhookTimeout:          getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:      getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookRetryBackoff:     getEnvDuration("WEBHOOK_RETRY_BACKOFF", 30*time.Second),
+		WebhookClickThresholds:  getEnvInts("WEBHOOK_CLICK_THRESHOLDS", []int64{100, 1000, 10000}),
+
+		GoogleSheetsSpreadsheetID:   getEnv("GOOGLE_SHEETS_SPREADSHEET_ID", ""),
+		GoogleSheetsRange:           getEnv("GOOGLE_SHEETS_RANGE", "Sheet1"),
+		GoogleSheetsCredentialsFile: getEnv("GOOGLE_SHEETS_CREDENTIALS_FILE", ""),
+		GoogleSheetsExportInterval:  getEnvDuration("GOOGLE_SHEETS_EXPORT_INTERVAL", time.Hour),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnvInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@localhost"),
+
+		APIKeyDailyQuota:   getEnvInt("API_KEY_DAILY_QUOTA", 1000),
+		APIKeyMonthlyQuota: getEnvInt("API_KEY_MONTHLY_QUOTA", 20000),
+
+		AnonymousTier: Tier{
+			MaxExpiry:        getEnvDuration("ANON_MAX_EXPIRY", 30*24*time.Hour),
+			ShortenPerMinute: getEnvInt("ANON_SHORTEN_PER_MINUTE", 5),
+			CustomAliases:    getEnvBool("ANON_CUSTOM_ALIASES", false),
+			ProxyContent:     getEnvBool("ANON_PROXY_CONTENT", false),
+		},
+		AuthenticatedTier: Tier{
+			MaxExpiry:        getEnvDuration("AUTH_MAX_EXPIRY", 0),
+			ShortenPerMinute: getEnvInt("AUTH_SHORTEN_PER_MINUTE", 60),
+			CustomAliases:    getEnvBool("AUTH_CUSTOM_ALIASES", true),
+			ProxyContent:     getEnvBool("AUTH_PROXY_CONTENT", true),
+		},
+
+		RateLimits: getRateLimits(),
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES", nil),
+
+		AdminAPIToken: getEnv("ADMIN_API_TOKEN", ""),
+	}
+
+	initial := getFeatures()
+	features.Store(&initial)
+	config.parseErr = takeParseProblems()
+
+	// Fail at startup, listing every problem, rather than on first use
+	err = errors.Join(config.Validate(), initial.validate())
+	if unknown := unknownFileKeys(); len(unknown) > 0 {
+		err = errors.Join(err, fmt.Errorf("%s has unknown settings: %s", path, strings.Join(unknown, ", ")))
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
 	return config
 }
 
+// Reload re-reads the settings that can change while running, the rate
+// limits and the features, letting values in .env override the process
+// environment so they can be edited in place. The config file is re-read
+// too. If anything is invalid, Reload changes nothing and returns why;
+// otherwise the new features take effect and the rate limits are returned
+// for the limiter.
+func Reload() (RateLimits, error) {
+	if err := godotenv.Overload(); err != nil {
+		log.Println("No .env file found, reloading settings from environment variables")
+	}
+	if configFile != "" {
+		if err := loadFile(configFile); err != nil {
+			return RateLimits{}, fmt.Errorf("reading %s: %w", configFile, err)
+		}
+	}
+
+	parseProblems = nil
+	limits, updated := getRateLimits(), getFeatures()
+	if err := errors.Join(takeParseProblems(), limits.validate(), updated.validate()); err != nil {
+		return RateLimits{}, err
+	}
+	features.Store(&updated)
+	return limits, nil
+}
+
+func getRateLimits() RateLimits {
+	return RateLimits{
+		API: RateLimit{
+			RPS:   getEnvFloat("RATE_LIMIT_RPS", 1),
+			Burst: getEnvInt("RATE_LIMIT_BURST", 3),
+		},
+		Redirect: RateLimit{
+			RPS:   getEnvFloat("RATE_LIMIT_REDIRECT_RPS", 50),
+			Burst: getEnvInt("RATE_LIMIT_REDIRECT_BURST", 100),
+		},
+		APIKey: RateLimit{
+			RPS:   getEnvFloat("API_KEY_RATE_LIMIT_RPS", 10),
+			Burst: getEnvInt("API_KEY_RATE_LIMIT_BURST", 20),
+		},
+		Routes: getRouteRateLimits(),
+		Bypass: getEnvList("RATE_LIMIT_BYPASS", nil),
+	}
+}
+
+// getRouteRateLimits parses RATE_LIMIT_ROUTES, e.g. "/shorten=0.5:5;/{shortCode}=20:40".
+func getRouteRateLimits() map[string]RateLimit {
+	limits := make(map[string]RateLimit)
+	for route, value := range getEnvMap("RATE_LIMIT_ROUTES") {
+		rps, burst, found := strings.Cut(value, ":")
+		limit := RateLimit{}
+		var rpsErr, burstErr error
+		limit.RPS, rpsErr = strconv.ParseFloat(rps, 64)
+		limit.Burst, burstErr = strconv.Atoi(burst)
+		if !found || rpsErr != nil || burstErr != nil || limit.RPS < 0 || limit.Burst < 0 {
+			parseProblem("RATE_LIMIT_ROUTES must give %s a limit like 0.5:5, got %q", route, value)
+			continue
+		}
+		limits[route] = limit
+	}
+	return limits
+}
+
+// parseProblems collects the values the getEnv functions couldn't parse
+// while settings are read, so they're reported with the other invalid
+// settings rather than replaced with defaults.
+var parseProblems []error
+
+func parseProblem(format string, args ...interface{}) {
+	parseProblems = append(parseProblems, fmt.Errorf(format, args...))
+}
+
+// takeParseProblems returns the parse problems found since it was last
+// called, and forgets them.
+func takeParseProblems() error {
+	err := errors.Join(parseProblems...)
+	parseProblems = nil
+	return err
+}
+
 func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookupEnv(key); exists {
 		return value
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	if value, exists := lookupEnv(key); exists {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			parseProblem("%s must be an integer, got %q", key, value)
+			return fallback
+		}
+		return i
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, exists := lookupEnv(key); exists {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			parseProblem("%s must be a number, got %q", key, value)
+			return fallback
+		}
+		return f
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, exists := lookupEnv(key); exists {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			parseProblem("%s must be a boolean, got %q", key, value)
+			return fallback
+		}
+		return b
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, exists := lookupEnv(key); exists {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			parseProblem("%s must be a duration, got %q", key, value)
+			return fallback
+		}
+		return d
+	}
+	return fallback
+}
+
+func getEnvList(key string, fallback []string) []string {
+	value, exists := lookupEnv(key)
+	if !exists {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvInts parses a comma-separated list of integers.
+func getEnvInts(key string, fallback []int64) []int64 {
+	value, exists := lookupEnv(key)
+	if !exists {
+		return fallback
+	}
+
+	var list []int64
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		i, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			parseProblem("%s must be a comma-separated list of integers, got %q", key, value)
+			return fallback
+		}
+		list = append(list, i)
+	}
+	return list
+}
+
+// getEnvHeaders parses "Name: value; Other-Name: value" into a header map.
+func getEnvHeaders(key string) map[string]string {
+	headers := make(map[string]string)
+	value, exists := lookupEnv(key)
+	if !exists {
+		return headers
+	}
+
+	for _, pair := range strings.Split(value, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, headerValue, found := strings.Cut(pair, ":")
+		if !found {
+			parseProblem("%s must be \"Name: value\" pairs, got %q", key, pair)
+			continue
+		}
+		headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(headerValue)
+	}
+	return headers
+}
+
+// getEnvMap parses "key=value;key=value" pairs.
+func getEnvMap(key string) map[string]string {
+	pairs := make(map[string]string)
+	value, exists := lookupEnv(key)
+	if !exists {
+		return pairs
+	}
+
+	for _, pair := range strings.Split(value, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, pairValue, found := strings.Cut(pair, "=")
+		if !found {
+			parseProblem("%s must be key=value pairs, got %q", key, pair)
+			continue
+		}
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(pairValue)
+	}
+	return pairs
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Features are the switches and policies that can be changed while the
+// server runs. Reload swaps them all at once, so read them through
+// CurrentFeatures each time they're needed rather than keeping a copy.
+type Features struct {
+	// SafeBrowsingAction is "reject" to refuse unsafe URLs when shortening,
+	// or "flag" to store them as flagged links that don't redirect.
+	SafeBrowsingAction string
+
+	// Heuristic phishing scores (0-100) at which new links are flagged or
+	// rejected outright; zero disables the threshold.
+	PhishingFlagScore  int
+	PhishingBlockScore int
+
+	// ShortenerLinkPolicy decides what happens to links to other URL
+	// shorteners: "resolve" stores where they lead instead, "reject" refuses
+	// them and "allow" keeps them as they are.
+	ShortenerLinkPolicy string
+
+	// FlaggedLinkWarning shows visitors of flagged links a warning page
+	// instead of a bare 410, and FlaggedLinkProceed lets them continue past it.
+	FlaggedLinkWarning bool
+	FlaggedLinkProceed bool
+
+	// DownloadWarning shows a confirmation page before redirecting to
+	// destinations that download executables or archives.
+	DownloadWarning bool
+
+	// AbuseAutoDisableReports is how many different visitors must report a
+	// link before it's disabled pending triage; zero never disables.
+	AbuseAutoDisableReports int
+
+	// FallbackRedirectURL is where unknown short codes are sent instead of a 404.
+	FallbackRedirectURL string
+
+	// ForwardQueryDefault applies to links that don't set forward_query themselves.
+	ForwardQueryDefault bool
+
+	// RedirectHeaders are sent with every redirect; per-link headers override them.
+	RedirectHeaders map[string]string
+}
+
+var features atomic.Pointer[Features]
+
+// CurrentFeatures returns the features in effect. They must not be modified.
+func CurrentFeatures() *Features {
+	return features.Load()
+}
+
+func getFeatures() Features {
+	f := Features{
+		SafeBrowsingAction:      getEnv("SAFE_BROWSING_ACTION", "reject"),
+		PhishingFlagScore:       getEnvInt("PHISHING_FLAG_SCORE", 50),
+		PhishingBlockScore:      getEnvInt("PHISHING_BLOCK_SCORE", 80),
+		ShortenerLinkPolicy:     getEnv("SHORTENER_LINK_POLICY", "resolve"),
+		FlaggedLinkWarning:      getEnvBool("FLAGGED_LINK_WARNING", true),
+		FlaggedLinkProceed:      getEnvBool("FLAGGED_LINK_PROCEED", true),
+		DownloadWarning:         getEnvBool("DOWNLOAD_WARNING", false),
+		AbuseAutoDisableReports: getEnvInt("ABUSE_AUTO_DISABLE_REPORTS", 5),
+		FallbackRedirectURL:     getEnv("FALLBACK_REDIRECT_URL", ""),
+		ForwardQueryDefault:     getEnvBool("FORWARD_QUERY_DEFAULT", false),
+		RedirectHeaders:         getEnvHeaders("REDIRECT_HEADERS"),
+	}
+	return f
+}
+
+// validate checks the features, which are also re-checked on reload.
+func (f Features) validate() error {
+	var problems []error
+	if f.SafeBrowsingAction != "reject" && f.SafeBrowsingAction != "flag" {
+		problems = append(problems, fmt.Errorf("SAFE_BROWSING_ACTION must be reject or flag, got %q", f.SafeBrowsingAction))
+	}
+	if f.ShortenerLinkPolicy != "resolve" && f.ShortenerLinkPolicy != "reject" && f.ShortenerLinkPolicy != "allow" {
+		problems = append(problems, fmt.Errorf("SHORTENER_LINK_POLICY must be resolve, reject or allow, got %q", f.ShortenerLinkPolicy))
+	}
+	if !validURL(f.FallbackRedirectURL) {
+		problems = append(problems, errors.New("FALLBACK_REDIRECT_URL must be an absolute http or https URL"))
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A config file holds the same settings as the environment, keyed by their
+// variable names in any case, so complex ones can be written as YAML:
+//
+//	port: 8080
+//	short_link_hosts: [sho.rt, go.example.com]
+//	rate_limit_routes:
+//	  /shorten: {rps: 0.5, burst: 5}
+//	redirect_headers:
+//	  X-Robots-Tag: noindex
+//
+// or, in a file named *.toml, as TOML:
+//
+//	port = 8080
+//	short_link_hosts = ["sho.rt", "go.example.com"]
+//	rate_limit_routes = { "/shorten" = { rps = 0.5, burst = 5 } }
+//
+//	[redirect_headers]
+//	X-Robots-Tag = "noindex"
+//
+// Lists become comma-separated values and mappings "key=value" pairs, as
+// their variables expect. Environment variables, including those from .env,
+// take precedence over the file.
+
+var (
+	configFile   string
+	fileModTime  time.Time
+	fileValues   map[string]string
+	fileKeysRead map[string]bool
+)
+
+// loadFile reads the config file at path, replacing any values read before.
+func loadFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Even a broken file counts as read, so a watcher doesn't retry it
+	// until it changes again
+	configFile, fileModTime = path, info.ModTime()
+
+	var settings map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		settings, err = parseTOML(contents)
+	} else {
+		err = yaml.Unmarshal(contents, &settings)
+	}
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(settings))
+	for key, value := range settings {
+		key = strings.ToUpper(key)
+		formatted, err := formatFileValue(key, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.ToLower(key), err)
+		}
+		values[key] = formatted
+	}
+	fileValues = values
+	fileKeysRead = make(map[string]bool)
+	return nil
+}
+
+// FileChanged reports whether the config file has been modified since it
+// was last read. It's false without a config file.
+func FileChanged() bool {
+	if configFile == "" {
+		return false
+	}
+	info, err := os.Stat(configFile)
+	return err == nil && !info.ModTime().Equal(fileModTime)
+}
+
+// lookupEnv returns the environment variable key, or the config file's value
+// for it.
+func lookupEnv(key string) (string, bool) {
+	if fileKeysRead != nil {
+		fileKeysRead[key] = true
+	}
+	if value, exists := os.LookupEnv(key); exists {
+		return value, true
+	}
+	value, exists := fileValues[key]
+	return value, exists
+}
+
+// unknownFileKeys returns the config file's keys that no setting read,
+// likely typos.
+func unknownFileKeys() []string {
+	var unknown []string
+	for key := range fileValues {
+		if !fileKeysRead[key] {
+			unknown = append(unknown, strings.ToLower(key))
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// formatFileValue encodes a value from the file the way key's environment
+// variable is written.
+func formatFileValue(key string, value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			formatted, err := formatScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = formatted
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		pairs := make([]string, len(names))
+		for i, name := range names {
+			formatted, err := formatPairValue(key, value[name])
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			separator := "="
+			if key == "REDIRECT_HEADERS" {
+				separator = ": "
+			}
+			pairs[i] = name + separator + formatted
+		}
+		return strings.Join(pairs, ";"), nil
+	default:
+		return formatScalar(value)
+	}
+}
+
+// formatPairValue encodes one value of a mapping. Route rate limits may be
+// written as {rps: 0.5, burst: 5} as well as "0.5:5".
+func formatPairValue(key string, value interface{}) (string, error) {
+	if limit, ok := value.(map[string]interface{}); ok && key == "RATE_LIMIT_ROUTES" {
+		rps, err := formatScalar(limit["rps"])
+		if err != nil {
+			return "", err
+		}
+		burst, err := formatScalar(limit["burst"])
+		if err != nil {
+			return "", err
+		}
+		return rps + ":" + burst, nil
+	}
+	return formatScalar(value)
+}
+
+func formatScalar(value interface{}) (string, error) {
+	switch value.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(value), nil
+	case nil:
+		return "", fmt.Errorf("missing value")
+	default:
+		return "", fmt.Errorf("expected a single value, got %T", value)
+	}
+}
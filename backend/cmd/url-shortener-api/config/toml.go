@@ -0,0 +1,359 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML reads the part of TOML a config file needs: tables, dotted and
+// quoted keys, strings, numbers, booleans, arrays and inline tables. Dates,
+// multi-line strings and arrays of tables are rejected, since no setting
+// takes them.
+func parseTOML(contents []byte) (map[string]interface{}, error) {
+	p := &tomlParser{src: string(contents)}
+	settings, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", p.line(), err)
+	}
+	return settings, nil
+}
+
+type tomlParser struct {
+	src string
+	pos int
+}
+
+func (p *tomlParser) parse() (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.src) {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return nil, fmt.Errorf("arrays of tables aren't supported")
+			}
+			path, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume(']') {
+				return nil, fmt.Errorf("expected ] after table name")
+			}
+			if table, err = tomlTable(root, path); err != nil {
+				return nil, err
+			}
+		} else if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+
+		p.skipBlank(false)
+		if p.pos < len(p.src) && !p.consume('\n') && !p.consumeString("\r\n") {
+			return nil, fmt.Errorf("unexpected %q after value", p.peek())
+		}
+	}
+}
+
+// keyValue reads "key = value" into table.
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if !p.consume('=') {
+		return fmt.Errorf("expected = after %s", strings.Join(path, "."))
+	}
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(path, "."), err)
+	}
+
+	parent, err := tomlTable(table, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	name := path[len(path)-1]
+	if _, exists := parent[name]; exists {
+		return fmt.Errorf("%s is set twice", strings.Join(path, "."))
+	}
+	parent[name] = value
+	return nil
+}
+
+// key reads a possibly dotted key, each part bare or quoted.
+func (p *tomlParser) key() ([]string, error) {
+	var path []string
+	for {
+		p.skipBlank(false)
+		var part string
+		switch p.peek() {
+		case '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		case '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		default:
+			start := p.pos
+			for p.pos < len(p.src) && isBareKeyChar(p.src[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a key")
+			}
+			part = p.src[start:p.pos]
+		}
+		path = append(path, part)
+
+		p.skipBlank(false)
+		if !p.consume('.') {
+			return path, nil
+		}
+	}
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	switch p.peek() {
+	case '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return nil, fmt.Errorf("multi-line strings aren't supported")
+		}
+		return p.basicString()
+	case '\'':
+		if strings.HasPrefix(p.src[p.pos:], "'''") {
+			return nil, fmt.Errorf("multi-line strings aren't supported")
+		}
+		return p.literalString()
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && isBareValueChar(p.src[p.pos]) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	switch token {
+	case "":
+		return nil, fmt.Errorf("expected a value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	number := strings.ReplaceAll(token, "_", "")
+	base := 10
+	if len(number) > 1 && number[0] == '0' && strings.ContainsRune("xob", rune(number[1])) {
+		base = 0 // 0x, 0o and 0b prefixes
+	}
+	if n, err := strconv.ParseInt(number, base, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	if strings.ContainsAny(token, "-:") && token[0] >= '0' && token[0] <= '9' {
+		return nil, fmt.Errorf("dates aren't supported; quote %s", token)
+	}
+	return nil, fmt.Errorf("invalid value %q", token)
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++ // [
+	items := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.consume(']') {
+			return items, nil
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		p.skipBlank(true)
+		if p.consume(']') {
+			return items, nil
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++ // {
+	table := make(map[string]interface{})
+	p.skipBlank(false)
+	if p.consume('}') {
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.consume('}') {
+			return table, nil
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++ // "
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\n':
+			return "", fmt.Errorf("unterminated string")
+		case c == '\\':
+			if p.pos+1 >= len(p.src) {
+				return "", fmt.Errorf("unterminated string")
+			}
+			escape := p.src[p.pos+1]
+			p.pos += 2
+			switch escape {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(escape)
+			case 'u', 'U':
+				digits := 4
+				if escape == 'U' {
+					digits = 8
+				}
+				if p.pos+digits > len(p.src) {
+					return "", fmt.Errorf("invalid \\%c escape", escape)
+				}
+				code, err := strconv.ParseUint(p.src[p.pos:p.pos+digits], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return "", fmt.Errorf("invalid \\%c escape", escape)
+				}
+				b.WriteRune(rune(code))
+				p.pos += digits
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", escape)
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++ // '
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines too if newlines
+// is set.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case newlines && (c == '\n' || c == '\r'):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) consume(c byte) bool {
+	if p.peek() != c {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *tomlParser) consumeString(s string) bool {
+	if !strings.HasPrefix(p.src[p.pos:], s) {
+		return false
+	}
+	p.pos += len(s)
+	return true
+}
+
+// line is the line the parser has reached, counting from 1.
+func (p *tomlParser) line() int {
+	return 1 + strings.Count(p.src[:p.pos], "\n")
+}
+
+// tomlTable returns the table at path under root, creating any missing.
+func tomlTable(root map[string]interface{}, path []string) (map[string]interface{}, error) {
+	table := root
+	for i, name := range path {
+		switch next := table[name].(type) {
+		case nil:
+			created := make(map[string]interface{})
+			table[name] = created
+			table = created
+		case map[string]interface{}:
+			table = next
+		default:
+			return nil, fmt.Errorf("%s is not a table", strings.Join(path[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func isBareValueChar(c byte) bool {
+	return isBareKeyChar(c) || c == '+' || c == '.' || c == ':'
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readConfigFile loads contents as a config file named name and returns the
+// values it holds for each variable.
+func readConfigFile(t *testing.T, name, contents string) (map[string]string, error) {
+	t.Helper()
+	previousFile, previousModTime, previousValues, previousKeys := configFile, fileModTime, fileValues, fileKeysRead
+	t.Cleanup(func() {
+		configFile, fileModTime, fileValues, fileKeysRead = previousFile, previousModTime, previousValues, previousKeys
+	})
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadFile(path); err != nil {
+		return nil, err
+	}
+	return fileValues, nil
+}
+
+func TestLoadFileReadsTOMLLikeYAML(t *testing.T) {
+	yamlValues, err := readConfigFile(t, "config.yaml", `
+port: 8080
+debug: true
+rate_limit_rps: 0.5
+short_link_hosts: [sho.rt, go.example.com]
+rate_limit_routes:
+  /shorten: {rps: 0.5, burst: 5}
+  /api/links: "2:10"
+redirect_headers:
+  X-Robots-Tag: noindex
+  Cache-Control: "private, max-age=0"
+smtp_from: "Links <links@example.com>"
+`)
+	if err != nil {
+		t.Fatalf("loadFile(yaml) error = %v", err)
+	}
+	tomlValues, err := readConfigFile(t, "config.toml", `
+# Same settings as the YAML file
+port = 8_080
+DEBUG = true
+rate_limit_rps = 0.5  # per second
+short_link_hosts = [
+  "sho.rt",
+  'go.example.com', # trailing commas are fine
+]
+smtp_from = "Links <links@example.com>"
+
+[rate_limit_routes]
+"/shorten" = { rps = 0.5, burst = 5 }
+"/api/links" = "2:10"
+
+[redirect_headers]
+X-Robots-Tag = "noindex"
+Cache-Control = "private, max-age=0"
+`)
+	if err != nil {
+		t.Fatalf("loadFile(toml) error = %v", err)
+	}
+	if !reflect.DeepEqual(tomlValues, yamlValues) {
+		t.Errorf("TOML values %v, want %v", tomlValues, yamlValues)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "missing equals", contents: "port 8080", wantErr: "line 1: expected = after port"},
+		{name: "set twice", contents: "port = 1\nPORT = 2\nport = 3", wantErr: "line 3: port is set twice"},
+		{name: "unterminated string", contents: "\nsmtp_from = \"links@example.com", wantErr: "line 2: smtp_from: unterminated string"},
+		{name: "bad escape", contents: `smtp_from = "\q"`, wantErr: `invalid escape \q`},
+		{name: "trailing text", contents: "port = 8080 8081", wantErr: "unexpected '8' after value"},
+		{name: "unclosed array", contents: "short_link_hosts = [\"a\" \"b\"]", wantErr: "expected , or ] in array"},
+		{name: "date", contents: "start = 2024-01-02", wantErr: "dates aren't supported"},
+		{name: "bare word", contents: "debug = yes", wantErr: `invalid value "yes"`},
+		{name: "multi-line string", contents: `motd = """hi"""`, wantErr: "multi-line strings aren't supported"},
+		{name: "array of tables", contents: "[[routes]]", wantErr: "arrays of tables aren't supported"},
+		{name: "value used as table", contents: "port = 1\n[port]", wantErr: "port is not a table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.contents))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTOML() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
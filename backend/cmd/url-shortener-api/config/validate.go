@@ -0,0 +1,272 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+)
+
+// Validate checks the settings that would otherwise only fail once the
+// server is running, such as on the first redirect, login or email. It
+// reports every problem it finds rather than stopping at the first.
+func (c Config) Validate() error {
+	var problems []error
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	checkPort := func(key, port string) {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			problem("%s must be a port number, got %q", key, port)
+		}
+	}
+	checkPort("PORT", c.Port)
+	problems = append(problems, c.parseErr)
+
+	// Connection strings and URLs can hold credentials, so neither they nor
+	// their parse errors, which can quote them, are repeated
+	switch c.DBDriver {
+	case "postgres":
+		if c.DBConnectionString == "" {
+			problem("DB_CONNECTION_STRING must be set with DB_DRIVER=postgres")
+		} else if _, err := pgconn.ParseConfig(c.DBConnectionString); err != nil {
+			problem("DB_CONNECTION_STRING is not a valid Postgres connection string")
+		}
+		if c.DBReplicaConnectionString != "" {
+			if _, err := pgconn.ParseConfig(c.DBReplicaConnectionString); err != nil {
+				problem("DB_REPLICA_CONNECTION_STRING is not a valid Postgres connection string")
+			}
+		}
+	case "sqlite":
+		if c.DBReplicaConnectionString != "" {
+			problem("DB_REPLICA_CONNECTION_STRING is only supported with DB_DRIVER=postgres")
+		}
+	default:
+		problem("DB_DRIVER must be postgres or sqlite, got %q", c.DBDriver)
+	}
+	if c.DBConnectAttempts < 1 {
+		problem("DB_CONNECT_ATTEMPTS must be at least 1")
+	}
+
+	if c.LinkStore != "database" && c.LinkStore != "memory" {
+		problem("LINK_STORE must be database or memory, got %q", c.LinkStore)
+	}
+	if c.RedisURL != "" {
+		if _, err := redis.ParseURL(c.RedisURL); err != nil {
+			problem("REDIS_URL is not a valid redis:// or rediss:// URL")
+		}
+	}
+
+	checkURL := func(key, value string) {
+		if !validURL(value) {
+			problem("%s must be an absolute http or https URL", key)
+		}
+	}
+	checkURL("OAUTH_REDIRECT_BASE_URL", c.OAuthRedirectBaseURL)
+	checkURL("OAUTH_SUCCESS_URL", c.OAuthSuccessURL)
+	checkURL("OIDC_DISCOVERY_URL", c.OIDCDiscoveryURL)
+	checkURL("INVITE_ACCEPT_URL", c.InviteAcceptURL)
+	checkURL("ALERT_SLACK_WEBHOOK_URL", c.AlertSlackWebhookURL)
+
+	problems = append(problems, c.RateLimits.validate())
+	if c.AnonymousTier.ShortenPerMinute < 0 || c.AuthenticatedTier.ShortenPerMinute < 0 {
+		problem("ANON_SHORTEN_PER_MINUTE and AUTH_SHORTEN_PER_MINUTE must not be negative")
+	}
+
+	for _, name := range c.URLScanners {
+		switch strings.ToLower(name) {
+		case "safebrowsing":
+		case "virustotal":
+			if c.VirusTotalAPIKey == "" {
+				problem("VIRUSTOTAL_API_KEY must be set to use the virustotal scanner")
+			}
+		default:
+			problem("URL_SCANNERS has unknown scanner %q", name)
+		}
+	}
+
+	if c.URLScanAggregation != "any" && c.URLScanAggregation != "all" {
+		problem("URL_SCAN_AGGREGATION must be any or all, got %q", c.URLScanAggregation)
+	}
+	if c.VirusTotalMinDetections < 1 {
+		problem("VIRUSTOTAL_MIN_DETECTIONS must be at least 1")
+	}
+
+	if c.CaptchaProvider != "" && ((c.CaptchaProvider != "recaptcha" && c.CaptchaProvider != "turnstile") || c.CaptchaSecret == "") {
+		problem("CAPTCHA_PROVIDER must be recaptcha or turnstile, with CAPTCHA_SECRET set")
+	}
+	if c.GoogleClientID != "" && c.GoogleClientSecret == "" {
+		problem("GOOGLE_CLIENT_SECRET must be set with GOOGLE_CLIENT_ID")
+	}
+	if c.GitHubClientID != "" && c.GitHubClientSecret == "" {
+		problem("GITHUB_CLIENT_SECRET must be set with GITHUB_CLIENT_ID")
+	}
+	if c.OIDCDiscoveryURL != "" && (c.OIDCClientID == "" || c.OIDCClientSecret == "") {
+		problem("OIDC_CLIENT_ID and OIDC_CLIENT_SECRET must be set with OIDC_DISCOVERY_URL")
+	}
+	if c.JWTSecret == "" && (c.GoogleClientID != "" || c.GitHubClientID != "" || c.OIDCDiscoveryURL != "") {
+		problem("JWT_SECRET must be set to sign in with Google, GitHub or OIDC")
+	}
+	if c.SMTPUsername != "" && c.SMTPHost == "" {
+		problem("SMTP_HOST must be set with SMTP_USERNAME")
+	}
+
+	if c.NotLiveStatusCode != 404 && c.NotLiveStatusCode != 410 {
+		problem("NOT_LIVE_STATUS must be 404 or 410, got %d", c.NotLiveStatusCode)
+	}
+	if c.ClickBotPolicy != "tag" && c.ClickBotPolicy != "drop" {
+		problem("CLICK_BOT_POLICY must be tag or drop, got %q", c.ClickBotPolicy)
+	}
+	if c.JobJitter < 0 || c.JobJitter >= 1 {
+		problem("JOB_JITTER must be at least 0 and below 1")
+	}
+
+	// Dropping a partition before its clicks are rolled up would lose them
+	if c.ClickPartitionRetentionMonths > 0 && c.ClickRetentionDays > 0 &&
+		c.ClickPartitionRetentionMonths*28 <= c.ClickRetentionDays {
+		problem("CLICK_PARTITION_RETENTION_MONTHS must outlast CLICK_RETENTION_DAYS")
+	}
+
+	if c.AsyncValidation && (c.ValidationWorkers < 1 || c.ValidationQueueSize < 1) {
+		problem("VALIDATION_WORKERS and VALIDATION_QUEUE_SIZE must be at least 1 with ASYNC_VALIDATION on")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problem("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSCertFile != "" && len(c.AutocertDomains) > 0 {
+		problem("Set either TLS_CERT_FILE and TLS_KEY_FILE or AUTOCERT_DOMAINS, not both")
+	}
+	if len(c.AutocertDomains) > 0 && c.AutocertCacheDir == "" {
+		problem("AUTOCERT_CACHE_DIR must be set with AUTOCERT_DOMAINS")
+	}
+	if (c.TLSCertFile != "" || len(c.AutocertDomains) > 0) && c.HTTPRedirectPort != "" {
+		checkPort("HTTP_REDIRECT_PORT", c.HTTPRedirectPort)
+		if c.HTTPRedirectPort == c.Port {
+			problem("HTTP_REDIRECT_PORT must differ from PORT")
+		}
+	}
+
+	for _, domain := range c.LinkDomains {
+		if !validHost(domain) {
+			problem("LINK_DOMAINS must be hosts, optionally with a port, got %q", domain)
+		}
+	}
+	if c.CustomDomainsPerUser < 0 || c.CustomDomainClaimDays < 0 {
+		problem("CUSTOM_DOMAINS_PER_USER and CUSTOM_DOMAIN_CLAIM_DAYS must not be negative")
+	}
+	if c.CustomDomainResolver != "" {
+		if _, _, err := net.SplitHostPort(c.CustomDomainResolver); err != nil {
+			problem("CUSTOM_DOMAIN_RESOLVER must be a host:port, got %q", c.CustomDomainResolver)
+		}
+	}
+
+	if c.RequestTimeout <= 0 || c.ReadHeaderTimeout <= 0 || c.IdleTimeout <= 0 {
+		problem("REQUEST_TIMEOUT, READ_HEADER_TIMEOUT and IDLE_TIMEOUT must be positive")
+	}
+	if c.MaxRequestBodyBytes < 1 {
+		problem("MAX_REQUEST_BODY_BYTES must be at least 1")
+	}
+	if c.ImportMaxBytes < 1 || c.ImportMaxRows < 1 || c.ImportBatchSize < 1 {
+		problem("IMPORT_MAX_BYTES, IMPORT_MAX_ROWS and IMPORT_BATCH_SIZE must be at least 1")
+	}
+	if c.MaintenanceRetryAfter <= 0 {
+		problem("MAINTENANCE_RETRY_AFTER must be positive")
+	}
+	if c.AccessLogFormat != "combined" && c.AccessLogFormat != "json" {
+		problem("ACCESS_LOG_FORMAT must be combined or json, got %q", c.AccessLogFormat)
+	}
+	if c.WebhookTimeout <= 0 || c.WebhookRetryBackoff <= 0 {
+		problem("WEBHOOK_TIMEOUT and WEBHOOK_RETRY_BACKOFF must be positive")
+	}
+	if c.WebhookMaxAttempts < 1 {
+		problem("WEBHOOK_MAX_ATTEMPTS must be at least 1")
+	}
+	for _, threshold := range c.WebhookClickThresholds {
+		if threshold < 1 {
+			problem("WEBHOOK_CLICK_THRESHOLDS must be positive, got %d", threshold)
+		}
+	}
+	if c.GoogleSheetsSpreadsheetID != "" {
+		if c.GoogleSheetsCredentialsFile == "" {
+			problem("GOOGLE_SHEETS_CREDENTIALS_FILE must be set with GOOGLE_SHEETS_SPREADSHEET_ID")
+		}
+		if c.GoogleSheetsRange == "" || c.GoogleSheetsExportInterval <= 0 {
+			problem("GOOGLE_SHEETS_RANGE must be set and GOOGLE_SHEETS_EXPORT_INTERVAL positive with GOOGLE_SHEETS_SPREADSHEET_ID")
+		}
+	}
+	if c.ShutdownTimeout <= 0 {
+		problem("SHUTDOWN_TIMEOUT must be positive")
+	}
+
+	return errors.Join(problems...)
+}
+
+// validate checks the rate limits, which are also re-checked on reload. A
+// zero rate means unlimited, but a burst below 1 would refuse everything.
+func (l RateLimits) validate() error {
+	var problems []error
+	checkRateLimit := func(prefix string, limit RateLimit) {
+		if limit.RPS < 0 {
+			problems = append(problems, fmt.Errorf("%s_RPS must not be negative", prefix))
+		}
+		if limit.RPS > 0 && limit.Burst < 1 {
+			problems = append(problems, fmt.Errorf("%s_BURST must be at least 1", prefix))
+		}
+	}
+	checkRateLimit("RATE_LIMIT", l.API)
+	checkRateLimit("RATE_LIMIT_REDIRECT", l.Redirect)
+	checkRateLimit("API_KEY_RATE_LIMIT", l.APIKey)
+	for _, route := range sortedRoutes(l.Routes) {
+		if limit := l.Routes[route]; limit.RPS > 0 && limit.Burst < 1 {
+			problems = append(problems, fmt.Errorf("RATE_LIMIT_ROUTES burst for %s must be at least 1", route))
+		}
+	}
+	for _, entry := range l.Bypass {
+		if !validNetwork(entry) {
+			problems = append(problems, fmt.Errorf("RATE_LIMIT_BYPASS must be IPs or CIDR ranges, got %q", entry))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// validNetwork reports whether entry is an IP address or CIDR range.
+func validNetwork(entry string) bool {
+	if strings.Contains(entry, "/") {
+		_, _, err := net.ParseCIDR(entry)
+		return err == nil
+	}
+	return net.ParseIP(entry) != nil
+}
+
+// validURL reports whether value is empty or an absolute http or https URL.
+func validURL(value string) bool {
+	if value == "" {
+		return true
+	}
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validHost reports whether value is a bare host or host:port, as sent in
+// a request's Host header.
+func validHost(value string) bool {
+	u, err := url.Parse("http://" + value)
+	return err == nil && u.Host == value && u.Hostname() != "" && len(value) <= 253
+}
+
+func sortedRoutes(limits map[string]RateLimit) []string {
+	routes := make([]string, 0, len(limits))
+	for route := range limits {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
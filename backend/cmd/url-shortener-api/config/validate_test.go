@@ -0,0 +1,54 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReloadRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		wantErr string
+	}{
+		{name: "valid", key: "RATE_LIMIT_RPS", value: "2.5"},
+		{name: "number", key: "RATE_LIMIT_RPS", value: "fast", wantErr: "RATE_LIMIT_RPS must be a number"},
+		{name: "integer", key: "RATE_LIMIT_BURST", value: "3.5", wantErr: "RATE_LIMIT_BURST must be an integer"},
+		{name: "boolean", key: "DOWNLOAD_WARNING", value: "yes please", wantErr: "DOWNLOAD_WARNING must be a boolean"},
+		{name: "route limit", key: "RATE_LIMIT_ROUTES", value: "/shorten=fast", wantErr: "RATE_LIMIT_ROUTES must give /shorten a limit"},
+		{name: "bypass", key: "RATE_LIMIT_BYPASS", value: "10.0.0.0/8, not-an-ip", wantErr: `RATE_LIMIT_BYPASS must be IPs or CIDR ranges, got "not-an-ip"`},
+		{name: "safe browsing action", key: "SAFE_BROWSING_ACTION", value: "flg", wantErr: "SAFE_BROWSING_ACTION must be reject or flag"},
+		{name: "shortener policy", key: "SHORTENER_LINK_POLICY", value: "block", wantErr: "SHORTENER_LINK_POLICY must be resolve, reject or allow"},
+		{name: "redirect headers", key: "REDIRECT_HEADERS", value: "X-Robots-Tag noindex", wantErr: "REDIRECT_HEADERS must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := Reload()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Reload() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Reload() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsParseProblems(t *testing.T) {
+	parseProblems = nil
+	t.Setenv("REQUEST_TIMEOUT", "30")
+	getEnvDuration("REQUEST_TIMEOUT", 0)
+
+	c := Config{parseErr: takeParseProblems()}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), `REQUEST_TIMEOUT must be a duration, got "30"`) {
+		t.Errorf("Validate() error = %v, want it to report REQUEST_TIMEOUT", err)
+	}
+	if parseProblems != nil {
+		t.Errorf("takeParseProblems() left %v", parseProblems)
+	}
+}
@@ -0,0 +1,395 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/blocklist"
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/mailer"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/store"
+	"url-shortener/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// ReportLinkRequest is a visitor's report of an abusive link.
+type ReportLinkRequest struct {
+	Reason  string `json:"reason"` // phishing, malware, spam, illegal or other
+	Details string `json:"details"`
+	Email   string `json:"email"` // optional, so admins can follow up
+}
+
+// AbuseReportResponse is one abuse report as seen by admins.
+type AbuseReportResponse struct {
+	ID            uint       `json:"id"`
+	ShortCode     string     `json:"short_code"`
+	OriginalURL   string     `json:"original_url"`
+	LinkStatus    string     `json:"link_status"`
+	Reason        string     `json:"reason"`
+	Details       string     `json:"details,omitempty"`
+	ReporterEmail string     `json:"reporter_email,omitempty"`
+	ReporterIP    string     `json:"reporter_ip,omitempty"`
+	Status        string     `json:"status"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ResolveReportRequest is an admin's decision on a reported link.
+type ResolveReportRequest struct {
+	Action string `json:"action"` // dismiss or disable
+}
+
+// ReportLink lets anyone report a link as abusive. Admins are emailed the
+// reports in batches, and once enough different visitors have open reports
+// against a link it's disabled until an admin triages it. Visitors are told
+// apart by IP address, or by /64 for IPv6.
+func ReportLink(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findURLMapping(w, r, mux.Vars(r)["shortCode"])
+		if !ok {
+			return
+		}
+
+		var req ReportLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if !models.ValidAbuseReason(req.Reason) {
+			respondWithError(w, "reason must be one of phishing, malware, spam, illegal or other", http.StatusBadRequest)
+			return
+		}
+		if len(req.Details) > 2000 {
+			respondWithError(w, "details must be at most 2000 characters", http.StatusBadRequest)
+			return
+		}
+		if req.Email != "" {
+			email, err := normalizeEmail(req.Email)
+			if err != nil {
+				respondWithError(w, "Invalid email address", http.StatusBadRequest)
+				return
+			}
+			req.Email = email
+		}
+
+		// One open report per visitor, so nobody can disable a link alone
+		reporterIP := utils.ClientIP(r)
+		reporters, err := openReporters(r.Context(), urlMapping.ID)
+		if err != nil {
+			log.Println("Error checking abuse reports:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+		if reporters[utils.ClientNetwork(reporterIP)] {
+			respondWithError(w, "You have already reported this link", http.StatusConflict)
+			return
+		}
+
+		report := models.AbuseReport{
+			UrlMappingID:  urlMapping.ID,
+			Reason:        req.Reason,
+			Details:       req.Details,
+			ReporterEmail: req.Email,
+			ReporterIP:    reporterIP,
+			Status:        models.ReportOpen,
+		}
+		if err := db.DB.WithContext(r.Context()).Create(&report).Error; err != nil {
+			log.Println("Error saving abuse report:", err)
+			respondWithError(w, "Error saving report. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Abuse report %d against %s: %s", report.ID, urlMapping.ShortCode, report.Reason)
+
+		disabled, err := disableIfReportedOften(r.Context(), urlMapping)
+		if err != nil {
+			log.Println("Error counting abuse reports:", err)
+		}
+		queueReportNotice(cfg, urlMapping, report, disabled)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Thanks, your report has been received."})
+	}
+}
+
+// ListAbuseReports returns abuse reports, newest first, a page at a time.
+// ?status= picks open (the default), dismissed, actioned or all.
+func ListAbuseReports() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		query := store.Paginate(db.DB.WithContext(r.Context()).Preload("UrlMapping"), "created_at", page.After)
+		switch status := r.URL.Query().Get("status"); status {
+		case "":
+			query = query.Where("status = ?", models.ReportOpen)
+		case "all":
+		case models.ReportOpen, models.ReportDismissed, models.ReportActioned:
+			query = query.Where("status = ?", status)
+		default:
+			respondWithError(w, "status must be open, dismissed, actioned or all", http.StatusBadRequest)
+			return
+		}
+
+		var reports []models.AbuseReport
+		if err := query.Limit(page.Limit).Find(&reports).Error; err != nil {
+			log.Println("Error listing abuse reports:", err)
+			respondWithError(w, "Error listing abuse reports.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]AbuseReportResponse, 0, len(reports))
+		for _, report := range reports {
+			response = append(response, AbuseReportResponse{
+				ID:            report.ID,
+				ShortCode:     report.UrlMapping.ShortCode,
+				OriginalURL:   report.UrlMapping.OriginalUrl,
+				LinkStatus:    report.UrlMapping.Status,
+				Reason:        report.Reason,
+				Details:       report.Details,
+				ReporterEmail: report.ReporterEmail,
+				ReporterIP:    report.ReporterIP,
+				Status:        report.Status,
+				ResolvedAt:    report.ResolvedAt,
+				CreatedAt:     report.CreatedAt,
+			})
+		}
+		if len(reports) > 0 {
+			last := reports[len(reports)-1]
+			page.setNext(w, len(reports), store.Cursor{Time: last.CreatedAt, ID: last.ID})
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// ResolveAbuseReport triages the link a report is about, resolving all of
+// its open reports. "disable" takes the link down; "dismiss" keeps it, and
+// brings it back live if reports had disabled it automatically.
+func ResolveAbuseReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ResolveReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if req.Action != "dismiss" && req.Action != "disable" {
+			respondWithError(w, "action must be dismiss or disable", http.StatusBadRequest)
+			return
+		}
+
+		var report models.AbuseReport
+		if err := db.DB.WithContext(r.Context()).Preload("UrlMapping").First(&report, mux.Vars(r)["id"]).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondWithError(w, "Abuse report not found.", http.StatusNotFound)
+				return
+			}
+			log.Println("Error retrieving abuse report:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{"status": models.ReportDismissed, "resolved_at": now}
+		if userID, ok := middlewares.UserID(r); ok {
+			updates["resolved_by_id"] = userID
+		}
+		urlMapping := report.UrlMapping
+		switch {
+		case req.Action == "disable":
+			updates["status"] = models.ReportActioned
+			urlMapping.Status = "disabled"
+		case urlMapping.Status == "disabled" && urlMapping.DisabledByReports:
+			urlMapping.Status = "live"
+		}
+
+		err := db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(&models.UrlMapping{}).Where("id = ?", urlMapping.ID).
+				Updates(map[string]interface{}{"status": urlMapping.Status, "disabled_by_reports": false}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&models.AbuseReport{}).
+				Where("url_mapping_id = ? AND status = ?", urlMapping.ID, models.ReportOpen).
+				Updates(updates).Error
+		})
+		if err != nil {
+			log.Println("Error resolving abuse report:", err)
+			respondWithError(w, "Error resolving report. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		store.Invalidate(urlMapping.ShortCode)
+		log.Printf("Abuse reports against %s resolved: %s", urlMapping.ShortCode, req.Action)
+
+		respondWithJSON(w, map[string]string{"short_code": urlMapping.ShortCode, "link_status": urlMapping.Status})
+	}
+}
+
+// disableIfReportedOften disables a link once open reports from
+// AbuseAutoDisableReports different visitors have piled up against it.
+// Links admins own and links to allowlisted domains are left for admins to
+// triage instead.
+func disableIfReportedOften(ctx context.Context, urlMapping models.UrlMapping) (bool, error) {
+	threshold := config.CurrentFeatures().AbuseAutoDisableReports
+	if threshold <= 0 || urlMapping.Status == "disabled" {
+		return false, nil
+	}
+
+	reporters, err := openReporters(ctx, urlMapping.ID)
+	if err != nil || len(reporters) < threshold {
+		return false, err
+	}
+	exempt, err := exemptFromAutoDisable(ctx, urlMapping)
+	if err != nil || exempt {
+		if exempt {
+			log.Printf("Left %s up despite abuse reports from %d visitors: it's admin-owned or allowlisted", urlMapping.ShortCode, len(reporters))
+		}
+		return false, err
+	}
+
+	err = db.DB.WithContext(ctx).Model(&models.UrlMapping{}).Where("id = ?", urlMapping.ID).
+		Updates(map[string]interface{}{"status": "disabled", "disabled_by_reports": true}).Error
+	if err != nil {
+		return false, err
+	}
+	store.Invalidate(urlMapping.ShortCode)
+	log.Printf("Disabled %s after abuse reports from %d visitors", urlMapping.ShortCode, len(reporters))
+	return true, nil
+}
+
+// openReporters returns the visitors with open reports against a link, as
+// utils.ClientNetwork identifies them.
+func openReporters(ctx context.Context, urlMappingID uint) (map[string]bool, error) {
+	var ips []string
+	err := db.DB.WithContext(ctx).Model(&models.AbuseReport{}).
+		Where("url_mapping_id = ? AND status = ?", urlMappingID, models.ReportOpen).
+		Pluck("reporter_ip", &ips).Error
+	if err != nil {
+		return nil, err
+	}
+	reporters := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		reporters[utils.ClientNetwork(ip)] = true
+	}
+	return reporters, nil
+}
+
+// exemptFromAutoDisable reports whether reports can't take a link down on
+// their own: an admin owns it, or its destination's domain is allowlisted.
+func exemptFromAutoDisable(ctx context.Context, urlMapping models.UrlMapping) (bool, error) {
+	if blocklist.Allowed(urlMapping.OriginalUrl) {
+		return true, nil
+	}
+	if urlMapping.OwnerID == nil {
+		return false, nil
+	}
+	var admins int64
+	err := db.DB.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND role = ?", *urlMapping.OwnerID, models.RoleAdmin).
+		Count(&admins).Error
+	return admins > 0, err
+}
+
+// reportNoticeDelay is how long a report waits before being emailed, so a
+// burst of reports reaches admins as one email. Reports that disable a link
+// are sent at once, along with any waiting.
+const reportNoticeDelay = 10 * time.Minute
+
+// maxReportsPerNotice caps how many reports one email lists.
+const maxReportsPerNotice = 50
+
+// reportNotice is a report waiting to be emailed to admins.
+type reportNotice struct {
+	urlMapping models.UrlMapping
+	report     models.AbuseReport
+	disabled   bool
+}
+
+var pendingReportNotices struct {
+	sync.Mutex
+	notices []reportNotice
+	timer   *time.Timer
+}
+
+// queueReportNotice adds a report to the next email to admins. Reports still
+// waiting when the server stops are only in the admin reports list.
+func queueReportNotice(cfg *config.Config, urlMapping models.UrlMapping, report models.AbuseReport, disabled bool) {
+	pending := &pendingReportNotices
+	pending.Lock()
+	defer pending.Unlock()
+	pending.notices = append(pending.notices, reportNotice{urlMapping: urlMapping, report: report, disabled: disabled})
+	switch {
+	case disabled:
+		if pending.timer != nil {
+			pending.timer.Stop()
+			pending.timer = nil
+		}
+		notices := pending.notices
+		pending.notices = nil
+		go notifyAdminsOfReports(cfg, notices)
+	case pending.timer == nil:
+		pending.timer = time.AfterFunc(reportNoticeDelay, func() { sendQueuedReportNotices(cfg) })
+	}
+}
+
+// sendQueuedReportNotices emails the reports waiting to be sent.
+func sendQueuedReportNotices(cfg *config.Config) {
+	pending := &pendingReportNotices
+	pending.Lock()
+	notices := pending.notices
+	pending.notices = nil
+	pending.timer = nil
+	pending.Unlock()
+	if len(notices) > 0 {
+		notifyAdminsOfReports(cfg, notices)
+	}
+}
+
+// notifyAdminsOfReports emails abuse reports to cfg.AbuseNotifyEmails, or
+// to every admin user if none are configured.
+func notifyAdminsOfReports(cfg *config.Config, notices []reportNotice) {
+	recipients := cfg.AbuseNotifyEmails
+	if len(recipients) == 0 {
+		if err := db.DB.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Pluck("email", &recipients).Error; err != nil {
+			log.Println("Error looking up admins to notify:", err)
+			return
+		}
+	}
+
+	subject := fmt.Sprintf("Abuse report: %s (%s)", notices[0].urlMapping.ShortCode, notices[0].report.Reason)
+	if len(notices) > 1 {
+		subject = fmt.Sprintf("%d abuse reports", len(notices))
+	}
+	var body strings.Builder
+	for i, notice := range notices {
+		if i == maxReportsPerNotice {
+			fmt.Fprintf(&body, "...and %d more; see the admin reports list.\n", len(notices)-i)
+			break
+		}
+		fmt.Fprintf(&body, "Link %s, pointing to %s, was reported for %s.\n\n%s\n",
+			notice.urlMapping.ShortCode, notice.urlMapping.OriginalUrl, notice.report.Reason, notice.report.Details)
+		if notice.disabled {
+			body.WriteString("\nThe link has been disabled automatically after repeated reports and is waiting for triage.\n")
+		}
+		body.WriteString("\n")
+	}
+
+	for _, to := range recipients {
+		if err := mailer.Send(to, subject, body.String()); err != nil {
+			log.Printf("Error emailing abuse reports to %s: %v", to, err)
+		}
+	}
+}
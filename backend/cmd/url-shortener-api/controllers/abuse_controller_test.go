@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"url-shortener/blocklist"
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+func TestDisableIfReportedOften(t *testing.T) {
+	tests := []struct {
+		name         string
+		destination  string
+		adminOwned   bool
+		reporterIPs  []string
+		wantDisabled bool
+	}{
+		{name: "different visitors", destination: "https://example.com/a", reporterIPs: []string{"192.0.2.1", "192.0.2.2"}, wantDisabled: true},
+		{name: "too few visitors", destination: "https://example.com/a", reporterIPs: []string{"192.0.2.1"}},
+		{name: "different IPv6 networks", destination: "https://example.com/a", reporterIPs: []string{"2001:db8:1:1::1", "2001:db8:1:2::1"}, wantDisabled: true},
+		{name: "one IPv6 network", destination: "https://example.com/a", reporterIPs: []string{"2001:db8:1:1::1", "2001:db8:1:1::2"}},
+		{name: "admin-owned", destination: "https://example.com/a", adminOwned: true, reporterIPs: []string{"192.0.2.1", "192.0.2.2"}},
+		{name: "allowlisted", destination: "https://docs.trusted.example/a", reporterIPs: []string{"192.0.2.1", "192.0.2.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ABUSE_AUTO_DISABLE_REPORTS", "2")
+			setupLinks(t)
+			blocklist.Invalidate()
+			t.Cleanup(blocklist.Invalidate)
+			if err := db.DB.Create(&models.BlockedDomain{Domain: "trusted.example", Action: models.DomainAllow}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			link := models.UrlMapping{ShortCode: "reported", OriginalUrl: tt.destination, Status: "live"}
+			if tt.adminOwned {
+				admin := models.User{Email: "admin@example.com", PasswordHash: "unused", Role: models.RoleAdmin}
+				if err := db.DB.Create(&admin).Error; err != nil {
+					t.Fatal(err)
+				}
+				link.OwnerID = &admin.ID
+			}
+			if err := db.DB.Create(&link).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, ip := range tt.reporterIPs {
+				report := models.AbuseReport{UrlMappingID: link.ID, Reason: "spam", ReporterIP: ip, Status: models.ReportOpen}
+				if err := db.DB.Create(&report).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			disabled, err := disableIfReportedOften(context.Background(), link)
+			if err != nil {
+				t.Fatalf("disableIfReportedOften() error = %v", err)
+			}
+			if disabled != tt.wantDisabled {
+				t.Errorf("disableIfReportedOften() = %v, want %v", disabled, tt.wantDisabled)
+			}
+			var status string
+			db.DB.Model(&models.UrlMapping{}).Where("id = ?", link.ID).Pluck("status", &status)
+			if (status == "disabled") != tt.wantDisabled {
+				t.Errorf("link status %q after %d reports", status, len(tt.reporterIPs))
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/mailer"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"gorm.io/gorm"
+)
+
+// accountDeletionTTL is how long the emailed confirmation token works.
+const accountDeletionTTL = 24 * time.Hour
+
+// DeleteAccountRequest asks for the signed-in user's account to be deleted.
+// Links says what happens to the links they own outside any organization:
+// delete, transfer into OrganizationID, or anonymize.
+type DeleteAccountRequest struct {
+	Links          string `json:"links"`
+	OrganizationID *uint  `json:"organization_id,omitempty"`
+}
+
+// ConfirmAccountDeletionRequest carries the token emailed for a deletion.
+type ConfirmAccountDeletionRequest struct {
+	Token string `json:"token"`
+}
+
+// AccountDeletionResponse is an account deletion as its user sees it.
+type AccountDeletionResponse struct {
+	ID             uint       `json:"id"`
+	Links          string     `json:"links"`
+	OrganizationID *uint      `json:"organization_id,omitempty"`
+	Status         string     `json:"status"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// RequestAccountDeletion starts deleting the signed-in user's account by
+// emailing them a token to confirm it with. Nothing is deleted until then.
+// Asking again replaces a pending request, so only the newest token works.
+// Users who are the last owner of an organization with other members must
+// hand it over first, and links can only be transferred to an organization
+// the user edits that keeps another owner.
+func RequestAccountDeletion(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		switch req.Links {
+		case models.LinksDelete, models.LinksAnonymize:
+			req.OrganizationID = nil
+		case models.LinksTransfer:
+			if req.OrganizationID == nil {
+				respondWithError(w, "organization_id is required to transfer links", http.StatusBadRequest)
+				return
+			}
+		default:
+			respondWithError(w, "links must be one of delete, transfer or anonymize", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := findCurrentUser(w, r)
+		if !ok {
+			return
+		}
+		if req.OrganizationID != nil && !canTransferLinksTo(w, r, user.ID, *req.OrganizationID) {
+			return
+		}
+		if !leavesOrganizationsOwned(w, r, user.ID) {
+			return
+		}
+
+		deletion := models.AccountDeletion{
+			UserID:         user.ID,
+			Email:          user.Email,
+			Links:          req.Links,
+			OrganizationID: req.OrganizationID,
+			Status:         models.DeletionPending,
+			ExpiresAt:      time.Now().Add(accountDeletionTTL).UTC().Truncate(time.Second),
+		}
+		err := db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ? AND status = ?", user.ID, models.DeletionPending).Delete(&models.AccountDeletion{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&deletion).Error
+		})
+		if err != nil {
+			log.Println("Error saving account deletion:", err)
+			respondWithError(w, "Error requesting account deletion. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		token, err := utils.GenerateAccountDeletionToken(cfg.JWTSecret, deletion.ID, deletion.ExpiresAt)
+		if err == nil {
+			err = sendAccountDeletionEmail(deletion, token)
+		}
+		if err != nil {
+			log.Println("Error sending account deletion email:", err)
+			db.DB.WithContext(r.Context()).Delete(&deletion)
+			respondWithError(w, "Error sending the confirmation email. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(newAccountDeletionResponse(deletion))
+	}
+}
+
+// ConfirmAccountDeletion confirms a pending account deletion with its
+// emailed token. The user is signed out everywhere, their API keys stop
+// working at once and they can't sign in or create keys again; the
+// delete-accounts job does the rest shortly after.
+func ConfirmAccountDeletion(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ConfirmAccountDeletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		deletionID, err := utils.ValidateAccountDeletionToken(cfg.JWTSecret, req.Token)
+		if errors.Is(err, utils.ErrDeletionTokenExpired) {
+			respondWithError(w, "This confirmation has expired; request the deletion again", http.StatusGone)
+			return
+		}
+		if err != nil {
+			respondWithError(w, "Invalid confirmation token", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := findCurrentUser(w, r)
+		if !ok {
+			return
+		}
+		var deletion models.AccountDeletion
+		err = db.DB.WithContext(r.Context()).Where("user_id = ? AND status = ?", user.ID, models.DeletionPending).First(&deletion, deletionID).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondWithError(w, "Account deletion not found; it may have been replaced by a newer request", http.StatusNotFound)
+			} else {
+				log.Println("Error retrieving account deletion:", err)
+				respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		now := time.Now()
+		err = db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&deletion).Updates(map[string]interface{}{"status": models.DeletionConfirmed, "confirmed_at": now}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+			keys := tx.Model(&models.APIKey{}).Select("id").Where("user_id = ?", user.ID)
+			if err := tx.Where("api_key_id IN (?)", keys).Delete(&models.APIKeyUsage{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error
+		})
+		if err != nil {
+			log.Println("Error confirming account deletion:", err)
+			respondWithError(w, "Error confirming account deletion. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d confirmed deleting their account, %s their links", user.ID, deletion.Links)
+
+		deletion.Status = models.DeletionConfirmed
+		deletion.ConfirmedAt = &now
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(newAccountDeletionResponse(deletion))
+	}
+}
+
+// notBeingDeleted checks the user hasn't confirmed deleting their account,
+// writing a 403 if they have, so they can't sign back in or mint API keys
+// before the delete-accounts job removes it.
+func notBeingDeleted(w http.ResponseWriter, r *http.Request, userID uint) bool {
+	var confirmed int64
+	err := db.DB.WithContext(r.Context()).Model(&models.AccountDeletion{}).
+		Where("user_id = ? AND status = ?", userID, models.DeletionConfirmed).
+		Count(&confirmed).Error
+	if err != nil {
+		log.Println("Error checking account deletions:", err)
+		respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		return false
+	}
+	if confirmed > 0 {
+		respondWithError(w, "This account is being deleted", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// canTransferLinksTo checks the user may move links into the organization
+// and that it keeps an owner once they are gone, writing an error if not.
+func canTransferLinksTo(w http.ResponseWriter, r *http.Request, userID, orgID uint) bool {
+	role, err := orgRole(r.Context(), userID, orgID)
+	if err != nil {
+		log.Println("Error retrieving membership:", err)
+		respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		return false
+	}
+	if role == "" {
+		respondWithError(w, "Organization not found.", http.StatusNotFound)
+		return false
+	}
+	if !models.OrgRoleAllows(role, models.OrgRoleEditor) {
+		respondWithError(w, "Only editors and owners can transfer links to an organization", http.StatusForbidden)
+		return false
+	}
+	return hasOtherOwner(w, r, orgID, userID)
+}
+
+// leavesOrganizationsOwned checks the user isn't the last owner of an
+// organization that has other members, writing a 409 if they are.
+// Organizations they are alone in are deleted with the account.
+func leavesOrganizationsOwned(w http.ResponseWriter, r *http.Request, userID uint) bool {
+	owned := db.DB.Model(&models.Membership{}).Select("organization_id").
+		Where("user_id = ? AND role = ?", userID, models.OrgRoleOwner)
+	otherOwners := db.DB.Model(&models.Membership{}).Select("organization_id").
+		Where("user_id <> ? AND role = ?", userID, models.OrgRoleOwner)
+	var orphaned []models.Organization
+	err := db.DB.WithContext(r.Context()).Where("id IN (?) AND id NOT IN (?)", owned, otherOwners).
+		Where("id IN (?)", db.DB.Model(&models.Membership{}).Select("organization_id").Where("user_id <> ?", userID)).
+		Find(&orphaned).Error
+	if err != nil {
+		log.Println("Error checking owned organizations:", err)
+		respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		return false
+	}
+	if len(orphaned) > 0 {
+		respondWithError(w, fmt.Sprintf("You are the last owner of %s; make another member an owner first", orphaned[0].Name), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+func sendAccountDeletionEmail(deletion models.AccountDeletion, token string) error {
+	fates := map[string]string{
+		models.LinksDelete:    "Your links and their click history will be deleted.",
+		models.LinksTransfer:  "Your links will be moved into the organization you chose.",
+		models.LinksAnonymize: "Your links will keep redirecting, owned by no one, until they expire.",
+	}
+	body := fmt.Sprintf("You asked to delete your account. %s Links you share with an organization stay with it.\n\nTo confirm, send this token to POST /api/me/deletion/confirm while signed in:\n%s\n\nIt expires on %s. If you didn't ask for this, ignore this email and change your password.\n",
+		fates[deletion.Links], token, deletion.ExpiresAt.Format("January 2, 2006 15:04 MST"))
+	return mailer.Send(deletion.Email, "Confirm deleting your account", body)
+}
+
+func newAccountDeletionResponse(deletion models.AccountDeletion) AccountDeletionResponse {
+	return AccountDeletionResponse{
+		ID:             deletion.ID,
+		Links:          deletion.Links,
+		OrganizationID: deletion.OrganizationID,
+		Status:         deletion.Status,
+		ExpiresAt:      deletion.ExpiresAt,
+		ConfirmedAt:    deletion.ConfirmedAt,
+		CreatedAt:      deletion.CreatedAt,
+	}
+}
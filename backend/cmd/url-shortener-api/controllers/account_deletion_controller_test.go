@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDeletingAccountLocksItOut(t *testing.T) {
+	tests := []struct {
+		name       string
+		deletion   string // status of the user's account deletion, if any
+		wantStatus int
+	}{
+		{name: "no deletion", wantStatus: http.StatusOK},
+		{name: "unconfirmed deletion", deletion: models.DeletionPending, wantStatus: http.StatusOK},
+		{name: "confirmed deletion", deletion: models.DeletionConfirmed, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLinks(t)
+			user, accessToken := createUser(t, "leaving@example.com")
+			hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.DB.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.deletion != "" {
+				deletion := models.AccountDeletion{
+					UserID:    user.ID,
+					Email:     user.Email,
+					Links:     models.LinksDelete,
+					Status:    tt.deletion,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}
+				if err := db.DB.Create(&deletion).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := config.Config{JWTSecret: testJWTSecret, JWTTTL: time.Hour, RefreshTokenTTL: time.Hour}
+
+			w := httptest.NewRecorder()
+			Login(&cfg).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login",
+				strings.NewReader(`{"email": "leaving@example.com", "password": "correct horse"}`)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Login() status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			// A session from before confirming, as if revoking it had raced
+			wantKey := tt.wantStatus
+			if wantKey == http.StatusOK {
+				wantKey = http.StatusCreated
+			}
+			r := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(`{"name": "ci"}`))
+			r.Header.Set("Authorization", "Bearer "+accessToken)
+			w = httptest.NewRecorder()
+			middlewares.AuthMiddleware(testJWTSecret)(CreateAPIKey(&cfg)).ServeHTTP(w, r)
+			if w.Code != wantKey {
+				t.Errorf("CreateAPIKey() status %d, want %d: %s", w.Code, wantKey, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"url-shortener/analytics"
+	"url-shortener/db"
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+// maxCollectBody bounds engagement beacons, which are a few dozen bytes.
+const maxCollectBody = 1024
+
+// CollectRequest is the beacon sent by the engagement script.
+type CollectRequest struct {
+	ClickID    string `json:"click_id"`
+	DurationMs int64  `json:"duration_ms"`
+	Interacted bool   `json:"interacted"`
+}
+
+// ServeAnalyticsScript serves the engagement script destination pages can include.
+func ServeAnalyticsScript() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(analytics.EngagementScript)
+	}
+}
+
+// CollectEngagement records time on page and bounce for a click.
+func CollectEngagement() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Beacons are cross-origin and their responses are never read
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		// sendBeacon posts text/plain, so decode the body regardless of Content-Type
+		var req CollectRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxCollectBody)).Decode(&req); err != nil || req.ClickID == "" || req.DurationMs < 0 {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		// Only accept engagement for clicks we actually recorded
+		var click models.ClickEvent
+		if err := db.DB.WithContext(r.Context()).Select("id").Where("click_id = ?", req.ClickID).First(&click).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Error retrieving click: %v", err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		duration := time.Duration(req.DurationMs) * time.Millisecond
+		event := models.EngagementEvent{
+			ClickID:    req.ClickID,
+			DurationMs: req.DurationMs,
+			Interacted: req.Interacted,
+			Bounced:    analytics.IsBounce(duration, req.Interacted),
+		}
+		if err := db.DB.WithContext(r.Context()).Create(&event).Error; err != nil {
+			log.Println("Error saving engagement event:", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
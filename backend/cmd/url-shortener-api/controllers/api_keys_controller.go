@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// usageHistoryDays is how many days of per-day usage the usage endpoint returns.
+const usageHistoryDays = 30
+
+// CreateAPIKeyRequest names a new API key.
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// APIKeyResponse describes an API key. Key is only set when the key is created.
+type APIKeyResponse struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix"`
+	Key            string     `json:"key,omitempty"`
+	DailyQuota     int        `json:"daily_quota"`    // 0 means unlimited
+	MonthlyQuota   int        `json:"monthly_quota"`  // 0 means unlimited
+	RateLimitRPS   float64    `json:"rate_limit_rps"` // 0 means unlimited
+	RateLimitBurst int        `json:"rate_limit_burst"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// SetQuotaRequest overrides an API key's quotas; null restores the default.
+type SetQuotaRequest struct {
+	DailyQuota   *int `json:"daily_quota"`
+	MonthlyQuota *int `json:"monthly_quota"`
+}
+
+// SetRateLimitRequest overrides an API key's request rate; null restores the default.
+type SetRateLimitRequest struct {
+	RateLimitRPS   *float64 `json:"rate_limit_rps"`
+	RateLimitBurst *int     `json:"rate_limit_burst"`
+}
+
+// UsagePeriod is the shorten-call count for one day or month against its quota.
+type UsagePeriod struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+	Quota int       `json:"quota"` // 0 means unlimited
+}
+
+// DailyUsage is the shorten-call count for one UTC day.
+type DailyUsage struct {
+	Day   time.Time `json:"day"`
+	Count int64     `json:"count"`
+}
+
+// APIKeyUsageResponse reports an API key's consumption.
+type APIKeyUsageResponse struct {
+	APIKeyID uint         `json:"api_key_id"`
+	Today    UsagePeriod  `json:"today"`
+	Month    UsagePeriod  `json:"month"`
+	History  []DailyUsage `json:"history"` // most recent days first, days without calls omitted
+}
+
+// CreateAPIKey issues a new API key for the current user. The key itself is
+// only ever returned here.
+func CreateAPIKey(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+
+		var req CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Name) > 100 {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if !notBeingDeleted(w, r, userID) {
+			return
+		}
+
+		key, prefix, hash, err := utils.GenerateAPIKey()
+		if err != nil {
+			log.Println("Error generating API key:", err)
+			respondWithError(w, "Error creating API key. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		apiKey := models.APIKey{UserID: userID, Name: req.Name, Prefix: prefix, KeyHash: hash}
+		if err := db.DB.WithContext(r.Context()).Create(&apiKey).Error; err != nil {
+			log.Println("Error saving API key:", err)
+			respondWithError(w, "Error creating API key. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		response := newAPIKeyResponse(cfg, apiKey)
+		response.Key = key
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// ListAPIKeys returns the current user's API keys.
+func ListAPIKeys(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+
+		var apiKeys []models.APIKey
+		if err := db.DB.WithContext(r.Context()).Where("user_id = ?", userID).Order("id").Find(&apiKeys).Error; err != nil {
+			log.Println("Error listing API keys:", err)
+			respondWithError(w, "Error listing API keys.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]APIKeyResponse, 0, len(apiKeys))
+		for _, apiKey := range apiKeys {
+			response = append(response, newAPIKeyResponse(cfg, apiKey))
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// DeleteAPIKey revokes one of the current user's API keys.
+func DeleteAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := findAPIKey(w, r)
+		if !ok {
+			return
+		}
+
+		err := db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("api_key_id = ?", apiKey.ID).Delete(&models.APIKeyUsage{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&apiKey).Error
+		})
+		if err != nil {
+			log.Println("Error deleting API key:", err)
+			respondWithError(w, "Error deleting API key. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetAPIKeyUsage reports an API key's shorten calls today, this month and
+// over recent days, alongside its quotas.
+func GetAPIKeyUsage(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := findAPIKey(w, r)
+		if !ok {
+			return
+		}
+
+		now := time.Now().UTC()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		historyStart := today.AddDate(0, 0, -(usageHistoryDays - 1))
+		since := monthStart
+		if historyStart.Before(since) {
+			since = historyStart
+		}
+
+		var rows []models.APIKeyUsage
+		err := db.DB.WithContext(r.Context()).Where("api_key_id = ? AND day >= ?", apiKey.ID, since).
+			Order("day DESC").
+			Find(&rows).Error
+		if err != nil {
+			log.Println("Error loading API key usage:", err)
+			respondWithError(w, "Error loading usage.", http.StatusInternalServerError)
+			return
+		}
+
+		daily, monthly := middlewares.EffectiveQuotas(apiKey, cfg.APIKeyDailyQuota, cfg.APIKeyMonthlyQuota)
+		response := APIKeyUsageResponse{
+			APIKeyID: apiKey.ID,
+			Today:    UsagePeriod{Start: today, Quota: daily},
+			Month:    UsagePeriod{Start: monthStart, Quota: monthly},
+			History:  []DailyUsage{},
+		}
+		for _, row := range rows {
+			day := row.Day.UTC()
+			if day.Equal(today) {
+				response.Today.Count = row.Count
+			}
+			if !day.Before(monthStart) {
+				response.Month.Count += row.Count
+			}
+			if !day.Before(historyStart) {
+				response.History = append(response.History, DailyUsage{Day: day, Count: row.Count})
+			}
+		}
+
+		respondWithJSON(w, response)
+	}
+}
+
+// SetAPIKeyQuota overrides the quotas of any API key.
+func SetAPIKeyQuota(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := findAPIKey(w, r)
+		if !ok {
+			return
+		}
+
+		var req SetQuotaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
+			(req.DailyQuota != nil && *req.DailyQuota < 0) || (req.MonthlyQuota != nil && *req.MonthlyQuota < 0) {
+			respondWithError(w, "Quotas must be zero or more, or null for the default", http.StatusBadRequest)
+			return
+		}
+
+		err := db.DB.WithContext(r.Context()).Model(&apiKey).Select("daily_quota", "monthly_quota").Updates(models.APIKey{
+			DailyQuota:   req.DailyQuota,
+			MonthlyQuota: req.MonthlyQuota,
+		}).Error
+		if err != nil {
+			log.Println("Error updating API key quota:", err)
+			respondWithError(w, "Error updating quota.", http.StatusInternalServerError)
+			return
+		}
+		apiKey.DailyQuota = req.DailyQuota
+		apiKey.MonthlyQuota = req.MonthlyQuota
+
+		respondWithJSON(w, newAPIKeyResponse(cfg, apiKey))
+	}
+}
+
+// SetAPIKeyRateLimit overrides the request rate of any API key. Changes
+// apply to the key's next request.
+func SetAPIKeyRateLimit(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := findAPIKey(w, r)
+		if !ok {
+			return
+		}
+
+		var req SetRateLimitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
+			(req.RateLimitRPS != nil && *req.RateLimitRPS < 0) || (req.RateLimitBurst != nil && *req.RateLimitBurst < 1) {
+			respondWithError(w, "rate_limit_rps must be zero or more and rate_limit_burst at least 1, or null for the default", http.StatusBadRequest)
+			return
+		}
+
+		err := db.DB.WithContext(r.Context()).Model(&apiKey).Select("rate_limit_rps", "rate_limit_burst").Updates(models.APIKey{
+			RateLimitRPS:   req.RateLimitRPS,
+			RateLimitBurst: req.RateLimitBurst,
+		}).Error
+		if err != nil {
+			log.Println("Error updating API key rate limit:", err)
+			respondWithError(w, "Error updating rate limit.", http.StatusInternalServerError)
+			return
+		}
+		apiKey.RateLimitRPS = req.RateLimitRPS
+		apiKey.RateLimitBurst = req.RateLimitBurst
+
+		respondWithJSON(w, newAPIKeyResponse(cfg, apiKey))
+	}
+}
+
+// findAPIKey loads the API key named in the route, writing a 404 if it
+// doesn't exist or, for non-admins, belongs to someone else.
+func findAPIKey(w http.ResponseWriter, r *http.Request) (models.APIKey, bool) {
+	var apiKey models.APIKey
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, "API key not found.", http.StatusNotFound)
+		return apiKey, false
+	}
+
+	query := db.DB.WithContext(r.Context())
+	if !middlewares.IsAdmin(r) {
+		userID, _ := middlewares.UserID(r)
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&apiKey, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondWithError(w, "API key not found.", http.StatusNotFound)
+		} else {
+			log.Printf("Error retrieving API key: %v", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		}
+		return apiKey, false
+	}
+	return apiKey, true
+}
+
+func newAPIKeyResponse(cfg *config.Config, apiKey models.APIKey) APIKeyResponse {
+	daily, monthly := middlewares.EffectiveQuotas(apiKey, cfg.APIKeyDailyQuota, cfg.APIKeyMonthlyQuota)
+	rateLimit := middlewares.EffectiveRateLimit(apiKey, cfg.RateLimits.APIKey)
+	return APIKeyResponse{
+		ID:             apiKey.ID,
+		Name:           apiKey.Name,
+		Prefix:         apiKey.Prefix,
+		DailyQuota:     daily,
+		MonthlyQuota:   monthly,
+		RateLimitRPS:   rateLimit.RPS,
+		RateLimitBurst: rateLimit.Burst,
+		LastUsedAt:     apiKey.LastUsedAt,
+		CreatedAt:      apiKey.CreatedAt,
+	}
+}
@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/store"
+	"url-shortener/utils"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Password length limits; bcrypt ignores anything past 72 bytes.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// CredentialsRequest is the payload for registering and logging in.
+type CredentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// UserResponse is the public view of a user account.
+type UserResponse struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenResponse carries a freshly issued access token and the refresh token
+// that can be exchanged for the next one.
+type TokenResponse struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshRequest exchanges a refresh token for new tokens.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Register creates a user account with an email and password.
+func Register() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CredentialsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		// Check email and password
+		email, err := normalizeEmail(req.Email)
+		if err != nil {
+			respondWithError(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+			respondWithError(w, "Password must be between 8 and 72 characters", http.StatusBadRequest)
+			return
+		}
+
+		var existing int64
+		if err := db.DB.WithContext(r.Context()).Model(&models.User{}).Where("email = ?", email).Count(&existing).Error; err != nil {
+			log.Println("Error checking for existing user:", err)
+			respondWithError(w, "Error creating account. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		if existing > 0 {
+			respondWithError(w, "An account with this email already exists", http.StatusConflict)
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Println("Error hashing password:", err)
+			respondWithError(w, "Error creating account. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		user := models.User{Email: email, PasswordHash: string(hash), Role: models.RoleUser}
+		if err := db.DB.WithContext(r.Context()).Create(&user).Error; err != nil {
+			log.Println("Error saving user:", err)
+			respondWithError(w, "Error creating account. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newUserResponse(user))
+	}
+}
+
+// Login exchanges an email and password for an access token.
+func Login(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CredentialsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		// Unknown emails and wrong passwords get the same answer
+		var user models.User
+		email, _ := normalizeEmail(req.Email)
+		if err := db.DB.WithContext(r.Context()).Where("email = ?", email).First(&user).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Println("Error retrieving user:", err)
+				respondWithError(w, "Error logging in. Please try again.", http.StatusInternalServerError)
+				return
+			}
+			respondWithError(w, "Invalid email or password", http.StatusUnauthorized)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+			respondWithError(w, "Invalid email or password", http.StatusUnauthorized)
+			return
+		}
+		if !notBeingDeleted(w, r, user.ID) {
+			return
+		}
+		sealPasswordHash(r.Context(), user)
+
+		tokens, err := startSession(r.Context(), cfg, user.ID)
+		if err != nil {
+			log.Println("Error starting session:", err)
+			respondWithError(w, "Error logging in. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithJSON(w, tokens)
+	}
+}
+
+// sealPasswordHash encrypts a password hash stored in plaintext, from before
+// URL_ENCRYPTION_KEY was set, since users rarely change their password.
+func sealPasswordHash(ctx context.Context, user models.User) {
+	if store.Seal(user.PasswordHash) == user.PasswordHash {
+		return
+	}
+	// user.PasswordHash was decrypted on load, so check the column itself
+	var stored string
+	err := db.DB.WithContext(ctx).Table("users").Select("password_hash").Where("id = ?", user.ID).Row().Scan(&stored)
+	if err != nil {
+		log.Printf("Error reading the password hash of user %d: %v", user.ID, err)
+		return
+	}
+	if store.IsSealed(stored) {
+		return
+	}
+	sealed := store.Seal(user.PasswordHash)
+	err = db.DB.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND password_hash = ?", user.ID, user.PasswordHash).
+		Update("password_hash", sealed).Error
+	if err != nil {
+		log.Printf("Error encrypting the password hash of user %d: %v", user.ID, err)
+	}
+}
+
+// RefreshToken exchanges a refresh token for a new access token. The refresh
+// token is rotated, so each one can only be used once.
+func RefreshToken(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		var session models.Session
+		err := db.DB.WithContext(r.Context()).Where("refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ?", utils.HashRefreshToken(req.RefreshToken), time.Now()).
+			First(&session).Error
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Println("Error retrieving session:", err)
+				respondWithError(w, "Error refreshing token. Please try again.", http.StatusInternalServerError)
+				return
+			}
+			respondWithError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+		if err != nil {
+			log.Println("Error generating refresh token:", err)
+			respondWithError(w, "Error refreshing token. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		// Only swap the hash if it hasn't changed, so two concurrent refreshes can't both win
+		result := db.DB.WithContext(r.Context()).Model(&models.Session{}).
+			Where("id = ? AND refresh_token_hash = ?", session.ID, session.RefreshTokenHash).
+			Updates(map[string]interface{}{"refresh_token_hash": refreshHash, "last_used_at": time.Now()})
+		if result.Error != nil {
+			log.Println("Error rotating refresh token:", result.Error)
+			respondWithError(w, "Error refreshing token. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondWithError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		accessToken, expiresAt, err := utils.GenerateAccessToken(cfg.JWTSecret, session.UserID, session.ID, cfg.JWTTTL)
+		if err != nil {
+			log.Println("Error issuing access token:", err)
+			respondWithError(w, "Error refreshing token. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithJSON(w, TokenResponse{
+			AccessToken:      accessToken,
+			TokenType:        "Bearer",
+			ExpiresAt:        expiresAt,
+			RefreshToken:     refreshToken,
+			RefreshExpiresAt: session.ExpiresAt,
+		})
+	}
+}
+
+// Logout revokes the session the request's access token belongs to.
+func Logout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, ok := middlewares.SessionID(r)
+		if !ok {
+			respondWithError(w, "Log out with an access token, not an API key", http.StatusBadRequest)
+			return
+		}
+
+		err := db.DB.WithContext(r.Context()).Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			log.Println("Error revoking session:", err)
+			respondWithError(w, "Error logging out. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// LogoutEverywhere revokes every session of the current user.
+func LogoutEverywhere() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+
+		result := db.DB.WithContext(r.Context()).Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			log.Println("Error revoking sessions:", result.Error)
+			respondWithError(w, "Error logging out. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Revoked %d sessions for user %d", result.RowsAffected, userID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// startSession records a new login for userID and issues its first tokens.
+func startSession(ctx context.Context, cfg *config.Config, userID uint) (TokenResponse, error) {
+	refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:           userID,
+		RefreshTokenHash: refreshHash,
+		ExpiresAt:        now.Add(cfg.RefreshTokenTTL).UTC().Truncate(time.Second),
+		LastUsedAt:       now,
+	}
+	if err := db.DB.WithContext(ctx).Create(&session).Error; err != nil {
+		return TokenResponse{}, err
+	}
+
+	accessToken, expiresAt, err := utils.GenerateAccessToken(cfg.JWTSecret, userID, session.ID, cfg.JWTTTL)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// GetCurrentUser returns the account the request's access token belongs to.
+func GetCurrentUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := findCurrentUser(w, r)
+		if !ok {
+			return
+		}
+		respondWithJSON(w, newUserResponse(user))
+	}
+}
+
+// findCurrentUser loads the signed-in user, writing an error response if
+// that fails.
+func findCurrentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	userID, _ := middlewares.UserID(r)
+
+	var user models.User
+	if err := db.DB.WithContext(r.Context()).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondWithError(w, "User not found.", http.StatusNotFound)
+			return user, false
+		}
+		log.Println("Error retrieving user:", err)
+		respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		return user, false
+	}
+	return user, true
+}
+
+// normalizeEmail validates a bare email address and lowercases it.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 255 {
+		return "", errors.New("invalid email address")
+	}
+	return strings.ToLower(email), nil
+}
+
+func newUserResponse(user models.User) UserResponse {
+	return UserResponse{ID: user.ID, Email: user.Email, Role: user.Role, CreatedAt: user.CreatedAt}
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"url-shortener/config"
+)
+
+// bitlyTimeLayout is how Bitly formats times, with a colonless UTC offset.
+const bitlyTimeLayout = "2006-01-02T15:04:05-0700"
+
+// BitlyShortenRequest is the body of Bitly's POST /v4/shorten. Domain may
+// name one of LINK_DOMAINS or a verified custom domain; Bitly's default,
+// bit.ly, means the default hosts as an empty one does. GroupGUID is
+// accepted so existing clients don't fail.
+type BitlyShortenRequest struct {
+	LongURL   string `json:"long_url"`
+	Domain    string `json:"domain,omitempty"`
+	GroupGUID string `json:"group_guid,omitempty"`
+}
+
+// BitlyLinkResponse is a link in the shape Bitly describes a bitlink. ID is
+// the short URL without its scheme, as Bitly's is.
+type BitlyLinkResponse struct {
+	CreatedAt      string   `json:"created_at"`
+	ID             string   `json:"id"`
+	Link           string   `json:"link"`
+	CustomBitlinks []string `json:"custom_bitlinks"`
+	LongURL        string   `json:"long_url"`
+	Archived       bool     `json:"archived"`
+	Tags           []string `json:"tags"`
+	Deeplinks      []string `json:"deeplinks"`
+}
+
+// BitlyErrorResponse is an error in Bitly's shape, where Message is a
+// machine-readable code and Description says what went wrong.
+type BitlyErrorResponse struct {
+	Message     string `json:"message"`
+	Resource    string `json:"resource"`
+	Description string `json:"description"`
+}
+
+// BitlyShorten mimics Bitly's POST /v4/shorten, so tools written for Bitly
+// work after changing only their base URL and token; API keys are taken as
+// the bearer token. Links go through the same creation pipeline as /shorten.
+// Bitly answers 200 with the existing bitlink for a URL already shortened;
+// destinations are encrypted at rest here, so every call makes a new link
+// and answers 201.
+func BitlyShorten(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req BitlyShortenRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithBitlyError(w, "REQUEST_TOO_LARGE", "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			respondWithBitlyError(w, "INVALID_BODY", "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if req.LongURL == "" {
+			respondWithBitlyError(w, "INVALID_ARG_LONG_URL", "long_url is required", http.StatusBadRequest)
+			return
+		}
+
+		if strings.EqualFold(req.Domain, "bit.ly") {
+			req.Domain = ""
+		}
+
+		creation := &LinkCreation{Config: cfg, Request: r, Link: &ShortenURLRequest{URL: req.LongURL, Domain: req.Domain}}
+		if err := runCreationPipeline(creation); err != nil {
+			var linkErr *linkError
+			if errors.As(err, &linkErr) {
+				respondWithBitlyError(w, bitlyErrorCode(linkErr.status), linkErr.message, linkErr.status)
+				return
+			}
+			log.Println("Error creating link:", err)
+			respondWithBitlyError(w, "UNKNOWN_ERROR", "Error creating shortened URL. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		urlMapping := creation.Mapping
+
+		shortURL := constructShortURL(r, *urlMapping)
+		tags := urlMapping.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		response := BitlyLinkResponse{
+			CreatedAt:      urlMapping.CreatedAt.UTC().Format(bitlyTimeLayout),
+			ID:             shortURL[strings.Index(shortURL, "://")+3:],
+			Link:           shortURL,
+			CustomBitlinks: []string{},
+			LongURL:        urlMapping.OriginalUrl,
+			Tags:           tags,
+			Deeplinks:      []string{},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// bitlyErrorCode returns the Bitly error code closest to a pipeline
+// rejection's status.
+func bitlyErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARG_LONG_URL"
+	case http.StatusForbidden:
+		return "FORBIDDEN"
+	case http.StatusConflict:
+		return "ALREADY_EXISTS"
+	case http.StatusServiceUnavailable:
+		return "TEMPORARILY_UNAVAILABLE"
+	default:
+		return "UNKNOWN_ERROR"
+	}
+}
+
+func respondWithBitlyError(w http.ResponseWriter, code, description string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(BitlyErrorResponse{Message: code, Resource: "bitlinks", Description: description})
+}
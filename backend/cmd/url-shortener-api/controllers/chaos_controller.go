@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"url-shortener/chaos"
+)
+
+// ChaosFaultRequest configures fault injection for one target.
+type ChaosFaultRequest struct {
+	Target    string  `json:"target"` // db, cache or outbound
+	LatencyMs int     `json:"latency_ms"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// ListChaosFaults returns the faults currently being injected.
+func ListChaosFaults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, chaosFaultList())
+	}
+}
+
+// SetChaosFault starts injecting latency and/or errors at a target.
+func SetChaosFault() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ChaosFaultRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if req.LatencyMs < 0 || req.ErrorRate < 0 || req.ErrorRate > 1 {
+			respondWithError(w, "latency_ms must be positive and error_rate between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		fault := chaos.Fault{
+			Latency:   time.Duration(req.LatencyMs) * time.Millisecond,
+			ErrorRate: req.ErrorRate,
+		}
+		if err := chaos.Set(req.Target, fault); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, chaos.ErrDisabled) {
+				status = http.StatusNotImplemented
+			}
+			respondWithError(w, err.Error(), status)
+			return
+		}
+
+		respondWithJSON(w, chaosFaultList())
+	}
+}
+
+// ClearChaosFaults stops all fault injection.
+func ClearChaosFaults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chaos.Clear()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func chaosFaultList() []ChaosFaultRequest {
+	faults := []ChaosFaultRequest{}
+	for target, fault := range chaos.Faults() {
+		faults = append(faults, ChaosFaultRequest{
+			Target:    target,
+			LatencyMs: int(fault.Latency / time.Millisecond),
+			ErrorRate: fault.ErrorRate,
+		})
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i].Target < faults[j].Target })
+	return faults
+}
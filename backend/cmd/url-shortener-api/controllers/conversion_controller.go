@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"url-shortener/analytics"
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/store"
+
+	"github.com/gorilla/mux"
+)
+
+// transparentGIF is a 1x1 transparent GIF.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// ConversionStats compares a link's clicks with the conversions reported for it.
+type ConversionStats struct {
+	Clicks         int64   `json:"clicks"`
+	Conversions    int64   `json:"conversions"`
+	ConversionRate float64 `json:"conversion_rate"` // conversions per click, 0 when there are no clicks
+}
+
+// TrackConversion records a conversion for a link and returns a tracking
+// pixel. Destination pages can pass the click ID they received in the
+// usc_click parameter to tie the conversion to its click; each click
+// converts at most once. The pixel is returned even when nothing is recorded
+// so the page never shows a broken image.
+func TrackConversion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer writePixel(w)
+
+		urlMapping, err := store.Links.GetByCode(r.Context(), mux.Vars(r)["shortCode"])
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				log.Printf("Error retrieving URL mapping: %v", err)
+			}
+			return
+		}
+
+		event := models.ConversionEvent{UrlMappingID: urlMapping.ID}
+
+		// Check the click belongs to this link and hasn't already converted
+		if clickID := r.URL.Query().Get(analytics.ClickIDParam); clickID != "" {
+			var clicks int64
+			if err := db.DB.WithContext(r.Context()).Model(&models.ClickEvent{}).Where("click_id = ? AND url_mapping_id = ?", clickID, urlMapping.ID).Count(&clicks).Error; err != nil {
+				log.Printf("Error retrieving click: %v", err)
+				return
+			}
+			if clicks > 0 {
+				var converted int64
+				if err := db.DB.WithContext(r.Context()).Model(&models.ConversionEvent{}).Where("click_id = ?", clickID).Count(&converted).Error; err != nil {
+					log.Printf("Error checking conversion: %v", err)
+					return
+				}
+				if converted > 0 {
+					return
+				}
+				event.ClickID = clickID
+			}
+		}
+
+		if err := db.DB.WithContext(r.Context()).Create(&event).Error; err != nil {
+			log.Println("Error saving conversion event:", err)
+		}
+	}
+}
+
+func writePixel(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(transparentGIF)
+}
+
+// GetConversionStats returns a link's clicks, conversions and conversion rate.
+func GetConversionStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+
+		var stats ConversionStats
+		err := clickHistory(r.Context(), urlMapping.ID, includeBots(r)).
+			Select("CAST(COALESCE(SUM(clicks), 0) AS bigint)").
+			Scan(&stats.Clicks).Error
+		if err != nil {
+			log.Println("Error counting clicks:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		err = db.DB.WithContext(r.Context()).Model(&models.ConversionEvent{}).
+			Where("url_mapping_id = ?", urlMapping.ID).
+			Count(&stats.Conversions).Error
+		if err != nil {
+			log.Println("Error counting conversions:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		if stats.Clicks > 0 {
+			stats.ConversionRate = float64(stats.Conversions) / float64(stats.Clicks)
+		}
+
+		respondWithJSON(w, stats)
+	}
+}
@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/blocklist"
+	"url-shortener/config"
+	"url-shortener/customdomains"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CustomDomainRequest claims a domain for the current user's links.
+type CustomDomainRequest struct {
+	Host string `json:"host"`
+}
+
+// CustomDomainResponse describes a claimed domain and how to verify it: a
+// TXT record named TXTRecordName holding TXTRecordValue. LastError says why
+// the last check didn't verify it.
+type CustomDomainResponse struct {
+	ID             uint       `json:"id"`
+	OwnerID        uint       `json:"owner_id"`
+	Host           string     `json:"host"`
+	Verified       bool       `json:"verified"`
+	VerifiedAt     *time.Time `json:"verified_at,omitempty"`
+	TXTRecordName  string     `json:"txt_record_name"`
+	TXTRecordValue string     `json:"txt_record_value"`
+	LastCheckedAt  *time.Time `json:"last_checked_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// CreateCustomDomain claims a domain for the current user. Links can be
+// made on it, by setting their domain, once the verification job has found
+// the returned token in the domain's DNS challenge record. The domain must
+// also point at this service for its links to redirect.
+func CreateCustomDomain(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+
+		var req CustomDomainRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		host := customdomains.NormalizeHost(req.Host)
+		if !validDomainName(host) {
+			respondWithError(w, "host must be a domain name such as links.example.com", http.StatusBadRequest)
+			return
+		}
+		if isLinkDomain(cfg, host) || utils.HostIn("https://"+host, cfg.ShortLinkHosts) {
+			respondWithError(w, "This domain already belongs to this service", http.StatusConflict)
+			return
+		}
+		if domain, blocked := blocklist.Blocked("https://" + host); blocked {
+			respondWithError(w, fmt.Sprintf("Links on %s are not allowed", domain), http.StatusBadRequest)
+			return
+		}
+		if ownerID, verified := customdomains.Verified(host); verified {
+			message := "This domain has already been verified by another account"
+			if ownerID == userID {
+				message = "You have already added this domain"
+			}
+			respondWithError(w, message, http.StatusConflict)
+			return
+		}
+
+		var claimed []models.CustomDomain
+		if err := db.DB.WithContext(r.Context()).Select("host").Where("owner_id = ?", userID).Find(&claimed).Error; err != nil {
+			log.Println("Error listing custom domains:", err)
+			respondWithError(w, "Error adding domain. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		for _, domain := range claimed {
+			if domain.Host == host {
+				respondWithError(w, "You have already added this domain", http.StatusConflict)
+				return
+			}
+		}
+		if len(claimed) >= cfg.CustomDomainsPerUser {
+			respondWithError(w, fmt.Sprintf("You can add at most %d domains", cfg.CustomDomainsPerUser), http.StatusForbidden)
+			return
+		}
+
+		token, err := customdomains.GenerateToken()
+		if err != nil {
+			log.Println("Error generating domain verification token:", err)
+			respondWithError(w, "Error adding domain. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		domain := models.CustomDomain{OwnerID: userID, Host: host, Token: token}
+		if err := db.DB.WithContext(r.Context()).Create(&domain).Error; err != nil {
+			log.Println("Error saving custom domain:", err)
+			respondWithError(w, "Error adding domain. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newCustomDomainResponse(domain))
+	}
+}
+
+// ListCustomDomains returns the current user's domains, or every user's
+// for admins.
+func ListCustomDomains() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := db.DB.WithContext(r.Context()).Order("host, id")
+		if !middlewares.IsAdmin(r) {
+			userID, _ := middlewares.UserID(r)
+			query = query.Where("owner_id = ?", userID)
+		}
+
+		var domains []models.CustomDomain
+		if err := query.Find(&domains).Error; err != nil {
+			log.Println("Error listing custom domains:", err)
+			respondWithError(w, "Error listing domains.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]CustomDomainResponse, 0, len(domains))
+		for _, domain := range domains {
+			response = append(response, newCustomDomainResponse(domain))
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// GetCustomDomain returns a domain, to follow its verification.
+func GetCustomDomain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, ok := findCustomDomain(w, r)
+		if !ok {
+			return
+		}
+		respondWithJSON(w, newCustomDomainResponse(domain))
+	}
+}
+
+// DeleteCustomDomain removes a domain. A verified domain can't be removed
+// while links, including deleted ones that could be restored, are bound to
+// it, since they'd otherwise pass to whoever verifies it next.
+func DeleteCustomDomain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, ok := findCustomDomain(w, r)
+		if !ok {
+			return
+		}
+
+		if domain.VerifiedAt != nil {
+			var links int64
+			if err := db.DB.WithContext(r.Context()).Unscoped().Model(&models.UrlMapping{}).Where("domain = ?", domain.Host).Count(&links).Error; err != nil {
+				log.Println("Error counting links on custom domain:", err)
+				respondWithError(w, "Error deleting domain. Please try again.", http.StatusInternalServerError)
+				return
+			}
+			if links > 0 {
+				respondWithError(w, "Links are still bound to this domain; move or purge them first", http.StatusConflict)
+				return
+			}
+		}
+
+		if err := db.DB.WithContext(r.Context()).Delete(&domain).Error; err != nil {
+			log.Println("Error deleting custom domain:", err)
+			respondWithError(w, "Error deleting domain. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		customdomains.Invalidate()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// checkLinkDomain returns a *linkError unless links can be made on domain:
+// the default hosts when it's empty, one of LINK_DOMAINS, or a custom
+// domain owner has verified. Admins may use anyone's verified domain; a
+// nil owner that isn't an admin is anonymous and can't use custom domains.
+func checkLinkDomain(cfg *config.Config, domain string, owner *uint, admin bool) error {
+	if domain == "" || isLinkDomain(cfg, domain) {
+		return nil
+	}
+	ownerID, verified := customdomains.Verified(domain)
+	if !verified || (!admin && (owner == nil || *owner != ownerID)) {
+		return &linkError{http.StatusBadRequest, fmt.Sprintf("Links can't be made on %s", domain)}
+	}
+	return nil
+}
+
+// findCustomDomain loads the domain named in the route, writing a 404 if it
+// doesn't exist or, for non-admins, belongs to someone else.
+func findCustomDomain(w http.ResponseWriter, r *http.Request) (models.CustomDomain, bool) {
+	var domain models.CustomDomain
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, "Domain not found.", http.StatusNotFound)
+		return domain, false
+	}
+
+	query := db.DB.WithContext(r.Context())
+	if !middlewares.IsAdmin(r) {
+		userID, _ := middlewares.UserID(r)
+		query = query.Where("owner_id = ?", userID)
+	}
+	if err := query.First(&domain, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondWithError(w, "Domain not found.", http.StatusNotFound)
+		} else {
+			log.Printf("Error retrieving custom domain: %v", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		}
+		return domain, false
+	}
+	return domain, true
+}
+
+// validDomainName reports whether host is a fully qualified domain name,
+// not an IP address and without a port.
+func validDomainName(host string) bool {
+	if len(host) > 253 || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func newCustomDomainResponse(domain models.CustomDomain) CustomDomainResponse {
+	return CustomDomainResponse{
+		ID:             domain.ID,
+		OwnerID:        domain.OwnerID,
+		Host:           domain.Host,
+		Verified:       domain.VerifiedAt != nil,
+		VerifiedAt:     domain.VerifiedAt,
+		TXTRecordName:  customdomains.ChallengeName(domain.Host),
+		TXTRecordValue: domain.Token,
+		LastCheckedAt:  domain.LastCheckedAt,
+		LastError:      domain.LastError,
+		CreatedAt:      domain.CreatedAt,
+	}
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"url-shortener/blocklist"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+
+	"github.com/gorilla/mux"
+)
+
+// DomainRuleRequest blocks or allows a domain and its subdomains.
+type DomainRuleRequest struct {
+	Domain string `json:"domain"`
+	Action string `json:"action"` // block (default) or allow
+	Reason string `json:"reason"`
+}
+
+// DomainRuleResponse is one blocklist or allowlist entry.
+type DomainRuleResponse struct {
+	ID        uint      `json:"id"`
+	Domain    string    `json:"domain"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListDomainRules returns every domain rule, optionally only those with the
+// action given in ?action=.
+func ListDomainRules() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := db.DB.WithContext(r.Context()).Order("domain")
+		if action := r.URL.Query().Get("action"); action != "" {
+			query = query.Where("action = ?", action)
+		}
+
+		var domains []models.BlockedDomain
+		if err := query.Find(&domains).Error; err != nil {
+			log.Println("Error listing domain rules:", err)
+			respondWithError(w, "Error listing domain rules.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]DomainRuleResponse, 0, len(domains))
+		for _, domain := range domains {
+			response = append(response, newDomainRuleResponse(domain))
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// PutDomainRule creates or replaces the rule for a domain. It takes effect
+// for new links at once and for redirects of existing links within a minute
+// on other instances.
+func PutDomainRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DomainRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		domain := blocklist.NormalizeDomain(req.Domain)
+		if domain == "" || len(domain) > 255 || strings.ContainsAny(domain, "/:@ ") || !strings.Contains(domain, ".") {
+			respondWithError(w, "domain must be a bare domain name such as example.com", http.StatusBadRequest)
+			return
+		}
+		if req.Action == "" {
+			req.Action = models.DomainBlock
+		}
+		if req.Action != models.DomainBlock && req.Action != models.DomainAllow {
+			respondWithError(w, "action must be block or allow", http.StatusBadRequest)
+			return
+		}
+
+		rule := models.BlockedDomain{Domain: domain}
+		if err := db.DB.WithContext(r.Context()).Where("domain = ?", domain).FirstOrInit(&rule).Error; err != nil {
+			log.Println("Error retrieving domain rule:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+		created := rule.ID == 0
+		rule.Action = req.Action
+		rule.Reason = req.Reason
+		if userID, ok := middlewares.UserID(r); ok {
+			rule.CreatedByID = &userID
+		}
+		if err := db.DB.WithContext(r.Context()).Save(&rule).Error; err != nil {
+			log.Println("Error saving domain rule:", err)
+			respondWithError(w, "Error saving domain rule. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		blocklist.Invalidate()
+		log.Printf("Domain rule for %s set to %s", domain, rule.Action)
+
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(newDomainRuleResponse(rule))
+	}
+}
+
+// DeleteDomainRule removes a domain rule.
+func DeleteDomainRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result := db.DB.WithContext(r.Context()).Delete(&models.BlockedDomain{}, mux.Vars(r)["id"])
+		if result.Error != nil {
+			log.Println("Error deleting domain rule:", result.Error)
+			respondWithError(w, "Error deleting domain rule. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondWithError(w, "Domain rule not found.", http.StatusNotFound)
+			return
+		}
+		blocklist.Invalidate()
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newDomainRuleResponse(domain models.BlockedDomain) DomainRuleResponse {
+	return DomainRuleResponse{
+		ID:        domain.ID,
+		Domain:    domain.Domain,
+		Action:    domain.Action,
+		Reason:    domain.Reason,
+		CreatedAt: domain.CreatedAt,
+	}
+}
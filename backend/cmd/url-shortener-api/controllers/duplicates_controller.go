@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/store"
+	"url-shortener/utils"
+
+	"gorm.io/gorm"
+)
+
+// duplicateScanBatch is how many links the duplicate scan loads at a time.
+const duplicateScanBatch = 500
+
+// DuplicateLink is one link of a group of duplicates.
+type DuplicateLink struct {
+	ShortCode   string    `json:"short_code"`
+	OriginalURL string    `json:"original_url"`
+	Clicks      int64     `json:"clicks"` // raw and rolled-up, bots included
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DuplicateGroup is a set of links, with the same owner, organization and
+// domain, whose destinations only differ in spelling.
+type DuplicateGroup struct {
+	NormalizedURL  string          `json:"normalized_url"`
+	OwnerID        *uint           `json:"owner_id,omitempty"`
+	OrganizationID *uint           `json:"organization_id,omitempty"`
+	Domain         string          `json:"domain,omitempty"`
+	Links          []DuplicateLink `json:"links"` // most clicked first
+}
+
+// MergeLinksRequest merges the Links into the link Into.
+type MergeLinksRequest struct {
+	Into  string   `json:"into"`
+	Links []string `json:"links"`
+}
+
+// MergeLinksResponse is the surviving link and every code that now
+// redirects through it.
+type MergeLinksResponse struct {
+	ShortCode string   `json:"short_code"`
+	Aliases   []string `json:"aliases"`
+	Clicks    int64    `json:"clicks"`
+}
+
+// duplicateKey groups links that can be merged: the same destination once
+// normalized, and the same owner, organization and domain, so merging never
+// moves a link or its stats between accounts.
+type duplicateKey struct {
+	url            string
+	ownerID        uint
+	organizationID uint
+	domain         string
+}
+
+// FindDuplicateLinks reports groups of links whose destinations are the
+// same once normalized (utils.NormalizeURL): http and https, trailing
+// slashes and utm_ parameters aside. Deleted links are left out.
+func FindDuplicateLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groups := map[duplicateKey][]models.UrlMapping{}
+		var batch []models.UrlMapping
+		err := db.DB.WithContext(r.Context()).Select("id", "short_code", "original_url", "owner_id", "organization_id", "domain", "created_at").
+			FindInBatches(&batch, duplicateScanBatch, func(*gorm.DB, int) error {
+				for _, link := range batch {
+					key := duplicateKeyOf(link)
+					groups[key] = append(groups[key], link)
+				}
+				return nil
+			}).Error
+		if err != nil {
+			log.Println("Error scanning links for duplicates:", err)
+			respondWithError(w, "Error finding duplicate links.", http.StatusInternalServerError)
+			return
+		}
+
+		var ids []uint
+		for key, links := range groups {
+			if len(links) < 2 {
+				delete(groups, key)
+				continue
+			}
+			for _, link := range links {
+				ids = append(ids, link.ID)
+			}
+		}
+		clicks, err := linkClicks(db.DB.WithContext(r.Context()), ids)
+		if err != nil {
+			log.Println("Error counting clicks of duplicate links:", err)
+			respondWithError(w, "Error finding duplicate links.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]DuplicateGroup, 0, len(groups))
+		for key, links := range groups {
+			group := DuplicateGroup{NormalizedURL: key.url, OwnerID: links[0].OwnerID, OrganizationID: links[0].OrganizationID, Domain: key.domain}
+			for _, link := range links {
+				group.Links = append(group.Links, DuplicateLink{ShortCode: link.ShortCode, OriginalURL: link.OriginalUrl, Clicks: clicks[link.ID], CreatedAt: link.CreatedAt})
+			}
+			sort.Slice(group.Links, func(i, j int) bool {
+				if group.Links[i].Clicks != group.Links[j].Clicks {
+					return group.Links[i].Clicks > group.Links[j].Clicks
+				}
+				return group.Links[i].CreatedAt.Before(group.Links[j].CreatedAt)
+			})
+			response = append(response, group)
+		}
+		sort.Slice(response, func(i, j int) bool { return response[i].NormalizedURL < response[j].NormalizedURL })
+		respondWithJSON(w, response)
+	}
+}
+
+// MergeLinks merges duplicate links into one. Their clicks, rollups,
+// conversions and abuse reports move to the surviving link, the duplicates
+// are deleted for good, and their short codes become aliases that keep
+// redirecting through it. Only links FindDuplicateLinks would group
+// together can be merged.
+func MergeLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req MergeLinksRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if req.Into == "" || len(req.Links) == 0 {
+			respondWithError(w, "into and links are required", http.StatusBadRequest)
+			return
+		}
+
+		survivor, err := store.Links.GetByCode(r.Context(), req.Into)
+		if err != nil {
+			respondWithLookupError(w, req.Into, err)
+			return
+		}
+		key := duplicateKeyOf(survivor)
+		var ids []uint
+		codes := []string{survivor.ShortCode}
+		seen := map[string]bool{survivor.ShortCode: true}
+		for _, shortCode := range req.Links {
+			if seen[shortCode] {
+				respondWithError(w, fmt.Sprintf("Link %s is listed twice or is the link merged into", shortCode), http.StatusBadRequest)
+				return
+			}
+			seen[shortCode] = true
+			link, err := store.Links.GetByCode(r.Context(), shortCode)
+			if err != nil {
+				respondWithLookupError(w, shortCode, err)
+				return
+			}
+			if duplicateKeyOf(link) != key {
+				respondWithError(w, fmt.Sprintf("Link %s isn't a duplicate of %s", shortCode, survivor.ShortCode), http.StatusConflict)
+				return
+			}
+			ids = append(ids, link.ID)
+			codes = append(codes, link.ShortCode)
+		}
+
+		err = db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			for _, model := range []interface{}{&models.ClickEvent{}, &models.ClickRollup{}, &models.ConversionEvent{}, &models.AbuseReport{}, &models.LinkAlias{}} {
+				if err := tx.Model(model).Where("url_mapping_id IN ?", ids).Update("url_mapping_id", survivor.ID).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Unscoped().Delete(&models.UrlMapping{}, ids).Error; err != nil {
+				return err
+			}
+			aliases := make([]models.LinkAlias, 0, len(ids))
+			for _, shortCode := range codes[1:] {
+				aliases = append(aliases, models.LinkAlias{ShortCode: shortCode, UrlMappingID: survivor.ID})
+			}
+			return tx.Omit("UrlMapping").Create(&aliases).Error
+		})
+		if err != nil {
+			log.Println("Error merging links:", err)
+			respondWithError(w, "Error merging links. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		store.Invalidate(codes...)
+		log.Printf("Merged links %v into %s", codes[1:], survivor.ShortCode)
+
+		response := MergeLinksResponse{ShortCode: survivor.ShortCode, Aliases: []string{}}
+		if err := db.DB.WithContext(r.Context()).Model(&models.LinkAlias{}).Where("url_mapping_id = ?", survivor.ID).Order("short_code").Pluck("short_code", &response.Aliases).Error; err != nil {
+			log.Println("Error listing link aliases:", err)
+		}
+		clicks, err := linkClicks(db.DB.WithContext(r.Context()), []uint{survivor.ID})
+		if err != nil {
+			log.Println("Error counting clicks of merged link:", err)
+		}
+		response.Clicks = clicks[survivor.ID]
+		respondWithJSON(w, response)
+	}
+}
+
+// lookupAlias returns the link an alias redirects through, or
+// store.ErrNotFound if shortCode isn't an alias.
+func lookupAlias(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	var target string
+	err := db.DB.WithContext(ctx).Model(&models.LinkAlias{}).
+		Joins("JOIN url_mappings ON url_mappings.id = link_aliases.url_mapping_id").
+		Where("link_aliases.short_code = ?", shortCode).
+		Limit(1).
+		Pluck("url_mappings.short_code", &target).Error
+	if err != nil {
+		return models.UrlMapping{}, err
+	}
+	if target == "" {
+		return models.UrlMapping{}, store.ErrNotFound
+	}
+	return store.Links.Lookup(ctx, target)
+}
+
+func duplicateKeyOf(link models.UrlMapping) duplicateKey {
+	key := duplicateKey{url: utils.NormalizeURL(link.OriginalUrl), domain: link.Domain}
+	if link.OwnerID != nil {
+		key.ownerID = *link.OwnerID
+	}
+	if link.OrganizationID != nil {
+		key.organizationID = *link.OrganizationID
+	}
+	return key
+}
+
+// linkClicks returns the raw and rolled-up clicks of each link.
+func linkClicks(tx *gorm.DB, ids []uint) (map[uint]int64, error) {
+	clicks := make(map[uint]int64, len(ids))
+	if len(ids) == 0 {
+		return clicks, nil
+	}
+	raw := tx.Model(&models.ClickEvent{}).Select("url_mapping_id, COUNT(*) AS clicks")
+	rollups := tx.Model(&models.ClickRollup{}).Select("url_mapping_id, CAST(SUM(clicks) AS bigint) AS clicks")
+	for _, query := range []*gorm.DB{raw, rollups} {
+		var rows []struct {
+			UrlMappingID uint
+			Clicks       int64
+		}
+		if err := query.Where("url_mapping_id IN ?", ids).Group("url_mapping_id").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			clicks[row.UrlMappingID] += row.Clicks
+		}
+	}
+	return clicks, nil
+}
+
+// respondWithLookupError writes a 404 for a missing link or a 500 for
+// anything else.
+func respondWithLookupError(w http.ResponseWriter, shortCode string, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		respondWithError(w, fmt.Sprintf("Link %s not found.", shortCode), http.StatusNotFound)
+		return
+	}
+	log.Printf("Error retrieving link %s: %v", shortCode, err)
+	respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+}
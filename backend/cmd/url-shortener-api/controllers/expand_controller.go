@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"url-shortener/blocklist"
+	"url-shortener/config"
+	"url-shortener/utils"
+)
+
+// ExpandResponse describes where a URL's redirects lead. Hops lists every
+// URL requested, the last being the destination. Error says why the chain
+// was cut short, in which case the last hop is as far as it got.
+type ExpandResponse struct {
+	URL          string              `json:"url"`
+	FinalURL     string              `json:"final_url"`
+	StatusCode   int                 `json:"status_code,omitempty"`
+	ContentType  string              `json:"content_type,omitempty"`
+	DownloadType string              `json:"download_type,omitempty"`
+	Hops         []utils.RedirectHop `json:"hops"`
+	Error        string              `json:"error,omitempty"`
+	Verdict      ExpandVerdict       `json:"verdict"`
+}
+
+// ExpandVerdict is the safety verdict on an expanded URL, judged by the
+// same domain rules, phishing heuristics and URL scanners as shortening.
+// Scan is omitted when no scanners are configured or none answered.
+type ExpandVerdict struct {
+	Safe          bool              `json:"safe"`
+	PhishingScore int               `json:"phishing_score"`
+	Reasons       []string          `json:"reasons"`
+	Scan          *utils.ScanResult `json:"scan,omitempty"`
+}
+
+// ExpandURL follows ?url='s redirects, up to MAX_REDIRECT_HOPS of them and
+// never to internal addresses, and reports each hop along with a safety
+// verdict on the destination, so third-party short links can be inspected
+// before they're visited. Nothing is stored.
+func ExpandURL(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rawURL := r.URL.Query().Get("url")
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			respondWithError(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+			return
+		}
+
+		resolved, err := utils.ResolveURL(r.Context(), rawURL, cfg.MaxRedirectHops)
+		response := ExpandResponse{
+			URL:          rawURL,
+			FinalURL:     resolved.FinalURL,
+			StatusCode:   resolved.StatusCode,
+			ContentType:  resolved.ContentType,
+			DownloadType: resolved.DownloadType,
+			Hops:         resolved.Chain,
+		}
+		if response.Hops == nil {
+			response.Hops = []utils.RedirectHop{}
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, utils.ErrBlockedAddress):
+			// Refused outright when it's the URL asked about, as when shortening
+			if len(resolved.Chain) == 0 {
+				respondWithError(w, "URL points to a private or internal address", http.StatusBadRequest)
+				return
+			}
+			response.Error = "Redirects to a private or internal address"
+		case errors.Is(err, utils.ErrTooManyRedirects):
+			response.Error = fmt.Sprintf("Redirects more than %d times", cfg.MaxRedirectHops)
+		case errors.Is(err, utils.ErrInvalidURLSyntax):
+			response.Error = "Redirects to an invalid URL"
+		case errors.Is(err, context.DeadlineExceeded):
+			response.Error = "Timed out following redirects"
+		default:
+			response.Error = "Couldn't reach " + resolved.FinalURL
+		}
+
+		response.Verdict = judgeExpandedURL(r.Context(), cfg, response)
+		if errors.Is(err, utils.ErrBlockedAddress) || errors.Is(err, utils.ErrTooManyRedirects) {
+			response.Verdict.Safe = false
+			response.Verdict.Reasons = append(response.Verdict.Reasons, response.Error)
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// judgeExpandedURL checks every hop against the domain blocklist and the
+// destination against the phishing heuristics and URL scanners.
+func judgeExpandedURL(ctx context.Context, cfg *config.Config, expanded ExpandResponse) ExpandVerdict {
+	features := config.CurrentFeatures()
+	verdict := ExpandVerdict{Safe: true, Reasons: []string{}}
+	unsafe := func(reason string) {
+		verdict.Safe = false
+		verdict.Reasons = append(verdict.Reasons, reason)
+	}
+
+	for _, hop := range expanded.Hops {
+		if domain, blocked := blocklist.Blocked(hop.URL); blocked {
+			unsafe(fmt.Sprintf("Goes through %s, which is blocked here", domain))
+		}
+	}
+
+	risk := utils.ScorePhishingRisk(expanded.FinalURL)
+	verdict.PhishingScore = risk.Score
+	if features.PhishingFlagScore > 0 && risk.Score >= features.PhishingFlagScore {
+		for _, reason := range risk.Reasons {
+			unsafe("Looks like phishing: " + reason)
+		}
+	}
+
+	if expanded.DownloadType == utils.DownloadRisky {
+		unsafe("Downloads a file type that can harm your computer")
+	}
+
+	scan, err := utils.ScanURL(ctx, *cfg, expanded.FinalURL)
+	switch {
+	case err == nil:
+		verdict.Scan = &scan
+		if !scan.IsSafe {
+			unsafe(scan.Message)
+		}
+	case !errors.Is(err, utils.ErrNoURLScanners):
+		log.Println("Error scanning URL:", err)
+	}
+	return verdict
+}
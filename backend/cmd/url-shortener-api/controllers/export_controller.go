@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/store"
+
+	"gorm.io/gorm"
+)
+
+// exportFlushEvery controls how many rows are buffered before flushing to the client.
+const exportFlushEvery = 500
+
+var clickExportHeader = []string{
+	"click_id", "timestamp", "ip_address", "user_agent", "referrer", "referrer_host",
+	"country", "region", "utm_source", "utm_medium", "utm_campaign", "is_bot",
+}
+
+// ExportClicks streams a link's raw click events as CSV, optionally limited
+// to the "from"/"to" range (RFC 3339 or YYYY-MM-DD). Only the link's owner,
+// members of its organization and admins may export its clicks.
+func ExportClicks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+		if !canViewLink(r, urlMapping) {
+			respondWithError(w, "URL not found.", http.StatusNotFound)
+			return
+		}
+
+		query := db.DB.WithContext(r.Context()).Model(&models.ClickEvent{}).Where("url_mapping_id = ?", urlMapping.ID)
+		if value := r.URL.Query().Get("from"); value != "" {
+			from, err := parseTimeParam(value)
+			if err != nil {
+				respondWithError(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+				return
+			}
+			query = query.Where("created_at >= ?", from)
+		}
+		if value := r.URL.Query().Get("to"); value != "" {
+			to, err := parseTimeParam(value)
+			if err != nil {
+				respondWithError(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+				return
+			}
+			query = query.Where("created_at < ?", to)
+		}
+
+		rows, err := query.Order("created_at, id").Rows()
+		if err != nil {
+			log.Println("Error exporting clicks:", err)
+			respondWithError(w, "Error exporting clicks.", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-clicks.csv"`, urlMapping.ShortCode))
+
+		writer := csv.NewWriter(w)
+		writer.Write(clickExportHeader)
+
+		// Headers are already sent, so errors from here on can only be logged
+		count := 0
+		for rows.Next() {
+			var click models.ClickEvent
+			if err := db.DB.ScanRows(rows, &click); err != nil {
+				log.Println("Error scanning click for export:", err)
+				return
+			}
+
+			writer.Write(csvRow(
+				click.ClickID,
+				click.CreatedAt.UTC().Format(time.RFC3339),
+				click.IPAddress,
+				click.UserAgent,
+				click.Referrer,
+				click.ReferrerHost,
+				click.Country,
+				click.Region,
+				click.UTMSource,
+				click.UTMMedium,
+				click.UTMCampaign,
+				strconv.FormatBool(click.IsBot),
+			))
+
+			count++
+			if count%exportFlushEvery == 0 {
+				writer.Flush()
+				if flusher, ok := w.(http.Flusher); ok {
+					flusher.Flush()
+				}
+			}
+		}
+		writer.Flush()
+
+		if err := writer.Error(); err != nil {
+			log.Println("Error writing click export:", err)
+		}
+		log.Printf("Exported %d clicks for %s", count, urlMapping.ShortCode)
+	}
+}
+
+// linkExportChunk is how many links an export reads, and flushes, at a time.
+const linkExportChunk = 500
+
+var linkExportHeader = []string{
+	"short_code", "short_url", "url", "status", "created_at",
+	"intended_live_date", "intended_expiry_date", "tags",
+}
+
+// LinkExportRecord is one line of an NDJSON link export. Stats is only set
+// when they were asked for.
+type LinkExportRecord struct {
+	LinkResource
+	Stats *LinkExportStats `json:"stats,omitempty"`
+}
+
+// LinkExportStats are a link's all-time click totals, raw and rolled up.
+type LinkExportStats struct {
+	Clicks    int64 `json:"clicks"`
+	BotClicks int64 `json:"bot_clicks"`
+}
+
+// ExportLinks streams every link the caller can list, or every link for
+// admins, newest first, as CSV or, with ?format=ndjson, one JSON link per
+// line. ?stats=true adds each link's click totals. Links are read a chunk at
+// a time, each starting after the last link of the one before, so exports of
+// any size use little memory and don't hold a query open.
+func ExportLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		if format != "csv" && format != "ndjson" {
+			respondWithError(w, "format must be csv or ndjson", http.StatusBadRequest)
+			return
+		}
+		withStats := r.URL.Query().Get("stats") == "true"
+
+		opts := store.ListOptions{Limit: linkExportChunk}
+		if !middlewares.IsAdmin(r) {
+			userID, _ := middlewares.UserID(r)
+			opts.VisibleTo = &userID
+		}
+		urlMappings, err := store.Links.List(r.Context(), opts)
+		if err != nil {
+			log.Println("Error exporting links:", err)
+			respondWithError(w, "Error exporting links.", http.StatusInternalServerError)
+			return
+		}
+
+		if format == "ndjson" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links.%s"`, format))
+
+		writer := csv.NewWriter(w)
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		header := linkExportHeader
+		if withStats {
+			header = append(header[:len(header):len(header)], "clicks", "bot_clicks")
+		}
+		if format == "csv" {
+			writer.Write(header)
+		}
+
+		// Headers are already sent, so errors from here on can only be logged
+		count := 0
+		for len(urlMappings) > 0 {
+			var stats map[uint]LinkExportStats
+			if withStats {
+				if stats, err = linkClickTotals(r.Context(), urlMappings); err != nil {
+					log.Println("Error totalling clicks for export:", err)
+					return
+				}
+			}
+
+			for _, urlMapping := range urlMappings {
+				link := newLinkResource(r, urlMapping)
+				if format == "ndjson" {
+					record := LinkExportRecord{LinkResource: link}
+					if withStats {
+						totals := stats[urlMapping.ID]
+						record.Stats = &totals
+					}
+					if err := encoder.Encode(record); err != nil {
+						log.Println("Error writing link export:", err)
+						return
+					}
+				} else {
+					row := []string{
+						link.ShortCode, link.ShortURL, link.URL, link.Status, link.CreatedAt.UTC().Format(time.RFC3339),
+						formatExportTime(link.IntendedLiveDate), formatExportTime(link.IntendedExpiryDate), strings.Join(link.Tags, ","),
+					}
+					if withStats {
+						totals := stats[urlMapping.ID]
+						row = append(row, strconv.FormatInt(totals.Clicks, 10), strconv.FormatInt(totals.BotClicks, 10))
+					}
+					writer.Write(csvRow(row...))
+				}
+				count++
+			}
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				log.Println("Error writing link export:", err)
+				return
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+
+			if len(urlMappings) < linkExportChunk {
+				break
+			}
+			last := urlMappings[len(urlMappings)-1]
+			opts.After = &store.Cursor{Time: last.CreatedAt, ID: last.ID}
+			if urlMappings, err = store.Links.List(r.Context(), opts); err != nil {
+				log.Println("Error exporting links:", err)
+				return
+			}
+		}
+		log.Printf("Exported %d links", count)
+	}
+}
+
+// csvRow escapes cells that a spreadsheet would read as a formula, such as
+// a user agent or URL starting with "=", by prefixing them with a quote.
+func csvRow(cells ...string) []string {
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cell = "'" + cell
+		}
+		row[i] = cell
+	}
+	return row
+}
+
+// linkClickTotals returns the all-time click totals of urlMappings, keyed
+// by ID, counting both raw clicks and the rollups of pruned ones.
+func linkClickTotals(ctx context.Context, urlMappings []models.UrlMapping) (map[uint]LinkExportStats, error) {
+	ids := make([]uint, 0, len(urlMappings))
+	for _, urlMapping := range urlMappings {
+		ids = append(ids, urlMapping.ID)
+	}
+
+	totals := make(map[uint]LinkExportStats, len(ids))
+	raw := db.DB.WithContext(ctx).Model(&models.ClickEvent{}).Select("url_mapping_id, is_bot, COUNT(*) AS clicks")
+	rollups := db.DB.WithContext(ctx).Model(&models.ClickRollup{}).Select("url_mapping_id, is_bot, CAST(SUM(clicks) AS bigint) AS clicks")
+	for _, query := range []*gorm.DB{raw, rollups} {
+		var rows []struct {
+			UrlMappingID uint
+			IsBot        bool
+			Clicks       int64
+		}
+		if err := query.Where("url_mapping_id IN ?", ids).Group("url_mapping_id, is_bot").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			total := totals[row.UrlMappingID]
+			if row.IsBot {
+				total.BotClicks += row.Clicks
+			} else {
+				total.Clicks += row.Clicks
+			}
+			totals[row.UrlMappingID] = total
+		}
+	}
+	return totals, nil
+}
+
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
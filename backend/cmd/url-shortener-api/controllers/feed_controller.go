@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/middlewares"
+	"url-shortener/store"
+
+	"github.com/gorilla/mux"
+)
+
+// feedSize is how many of a user's newest links their feed lists.
+const feedSize = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Links     []atomLink  `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// UserLinksFeed serves an Atom feed of a user's newest links, each linking
+// to its short URL with the destination as its content, for feeding new
+// campaign links into other tools. Users may only read their own feed, and
+// admins anyone's; feed readers that can't send headers can pass an API
+// key as ?key=.
+func UserLinksFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, "User not found.", http.StatusNotFound)
+			return
+		}
+		if userID, _ := middlewares.UserID(r); uint64(userID) != id && !middlewares.IsAdmin(r) {
+			respondWithError(w, "User not found.", http.StatusNotFound)
+			return
+		}
+
+		owner := uint(id)
+		urlMappings, err := store.Links.List(r.Context(), store.ListOptions{OwnedBy: &owner, Limit: feedSize})
+		if err != nil {
+			log.Println("Error listing links for feed:", err)
+			respondWithError(w, "Error listing links.", http.StatusInternalServerError)
+			return
+		}
+
+		// Atom requires an updated time even for an empty feed
+		self := requestBaseURL(r) + r.URL.Path
+		feed := atomFeed{
+			ID:      self,
+			Title:   fmt.Sprintf("Short links of user %d", id),
+			Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Rel: "self", Href: self}},
+		}
+		if len(urlMappings) > 0 {
+			feed.Updated = urlMappings[0].CreatedAt.UTC().Format(time.RFC3339)
+		}
+		for _, urlMapping := range urlMappings {
+			shortURL := constructShortURL(r, urlMapping)
+			created := urlMapping.CreatedAt.UTC().Format(time.RFC3339)
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:        shortURL,
+				Title:     urlMapping.ShortCode,
+				Updated:   created,
+				Published: created,
+				Links: []atomLink{
+					{Rel: "alternate", Href: shortURL},
+					{Rel: "related", Href: urlMapping.OriginalUrl},
+				},
+				Content: atomContent{Type: "text", Text: urlMapping.OriginalUrl},
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(feed); err != nil {
+			log.Println("Error writing links feed:", err)
+		}
+	}
+}
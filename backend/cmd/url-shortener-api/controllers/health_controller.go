@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/store"
+)
+
+// readinessTimeout bounds each dependency check, so a hung dependency
+// fails the probe instead of stalling it.
+const readinessTimeout = 2 * time.Second
+
+// ReadinessResponse reports whether the service can take traffic, with
+// the outcome of each check.
+type ReadinessResponse struct {
+	Status string            `json:"status"` // ready or not_ready
+	Checks map[string]string `json:"checks"` // check name -> ok, or why it failed
+}
+
+// Liveness answers as long as the process is serving requests. It checks
+// no dependencies, so an outage elsewhere doesn't get the pod restarted.
+func Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, map[string]string{"status": "ok"})
+	}
+}
+
+// Readiness checks the database, the read replica and Redis when they're
+// configured, and that no migrations are pending. It answers 503 if any
+// check fails, so load balancers stop sending traffic until it passes.
+func Readiness(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]func(ctx context.Context) error{
+			"database": func(ctx context.Context) error { return db.Ping(ctx, db.DB) },
+			"migrations": func(context.Context) error {
+				pending, err := db.PendingMigrations(cfg.DBDriver)
+				if err != nil {
+					return err
+				}
+				if pending > 0 {
+					return fmt.Errorf("%d pending", pending)
+				}
+				return nil
+			},
+		}
+		if db.Replica != db.DB {
+			checks["replica"] = func(ctx context.Context) error { return db.Ping(ctx, db.Replica) }
+		}
+		if cfg.RedisURL != "" {
+			checks["redis"] = store.Ping
+		}
+
+		response := ReadinessResponse{Status: "ready", Checks: make(map[string]string, len(checks))}
+		for name, check := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			err := check(ctx)
+			cancel()
+			if err != nil {
+				response.Status = "not_ready"
+				response.Checks[name] = err.Error()
+				continue
+			}
+			response.Checks[name] = "ok"
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if response.Status != "ready" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		respondWithJSON(w, response)
+	}
+}
@@ -0,0 +1,442 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// LinkImportResponse reports an import's progress. Errors lists the rows
+// processed so far that didn't become links.
+type LinkImportResponse struct {
+	ID         uint                     `json:"id"`
+	Status     string                   `json:"status"`
+	Format     string                   `json:"format"`
+	TotalRows  int                      `json:"total_rows"`
+	Processed  int                      `json:"processed"`
+	Succeeded  int                      `json:"succeeded"`
+	Failed     int                      `json:"failed"`
+	Errors     []models.LinkImportError `json:"errors"`
+	Error      string                   `json:"error,omitempty"`
+	CreatedAt  time.Time                `json:"created_at"`
+	StartedAt  *time.Time               `json:"started_at,omitempty"`
+	FinishedAt *time.Time               `json:"finished_at,omitempty"`
+}
+
+// importRow is one link to create from an import file. Err is set when the
+// row itself couldn't be read, so it's reported without being tried.
+type importRow struct {
+	Row  int
+	Link ShortenURLRequest
+	Err  string
+}
+
+// maxConcurrentImports is how many imports run at once; the rest stay
+// queued until one finishes.
+const maxConcurrentImports = 2
+
+var (
+	importSlots    = make(chan struct{}, maxConcurrentImports)
+	stopImports    = make(chan struct{})
+	runningImports sync.WaitGroup
+)
+
+// ImportLinks accepts a CSV or JSON file of links to create, for moving
+// links over from another shortener, and creates them in the background.
+// The file is the request body or, in a multipart form, its "file" field.
+// Each row uses up one call of an API key's quota, and files with more rows
+// than the key has calls left are refused. It responds 202 with the import,
+// to be polled at the Location header.
+func ImportLinks(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.ImportMaxBytes))
+
+		file, format, err := importFile(r)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var rows []importRow
+		if format == "json" {
+			rows, err = readJSONImport(file, cfg.ImportMaxRows)
+		} else {
+			rows, err = readCSVImport(file, cfg.ImportMaxRows)
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, fmt.Sprintf("Import files can be at most %d bytes", cfg.ImportMaxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(rows) == 0 {
+			respondWithError(w, "The file has no rows to import", http.StatusBadRequest)
+			return
+		}
+		if !middlewares.ChargeAPIKeyQuota(w, r, len(rows), cfg.APIKeyDailyQuota, cfg.APIKeyMonthlyQuota) {
+			return
+		}
+
+		job := models.LinkImport{Format: format, Status: models.ImportQueued, TotalRows: len(rows)}
+		if userID, ok := middlewares.UserID(r); ok {
+			job.OwnerID = &userID
+		}
+		if err := db.DB.WithContext(r.Context()).Create(&job).Error; err != nil {
+			log.Println("Error saving link import:", err)
+			respondWithError(w, "Error starting import. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		// The rows are created as whoever uploaded them, after this request
+		// has finished
+		background := r.Clone(context.WithoutCancel(r.Context()))
+		runningImports.Add(1)
+		go func() {
+			defer runningImports.Done()
+			runImport(cfg, background, job, rows)
+		}()
+
+		w.Header().Set("Location", fmt.Sprintf("/api/links/import/%d", job.ID))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(newLinkImportResponse(job))
+	}
+}
+
+// GetLinkImport reports the progress of an import and the rows that have
+// failed so far.
+func GetLinkImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, "Import not found.", http.StatusNotFound)
+			return
+		}
+
+		query := db.DB.WithContext(r.Context())
+		if !middlewares.IsAdmin(r) {
+			userID, _ := middlewares.UserID(r)
+			query = query.Where("owner_id = ?", userID)
+		}
+		var job models.LinkImport
+		if err := query.First(&job, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondWithError(w, "Import not found.", http.StatusNotFound)
+			} else {
+				log.Printf("Error retrieving link import: %v", err)
+				respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			}
+			return
+		}
+		respondWithJSON(w, newLinkImportResponse(job))
+	}
+}
+
+// StopImports stops running imports after their current batch, marking
+// them failed, and waits for them or for ctx to expire. Imports still
+// running when the process dies without it are left running.
+func StopImports(ctx context.Context) error {
+	close(stopImports)
+
+	done := make(chan struct{})
+	go func() {
+		runningImports.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runImport creates the import's links through the creation pipeline, as
+// if each had been shortened by r's user, saving progress after every
+// batch.
+func runImport(cfg *config.Config, r *http.Request, job models.LinkImport, rows []importRow) {
+	select {
+	case importSlots <- struct{}{}:
+		defer func() { <-importSlots }()
+	case <-stopImports:
+		finishImport(&job, "Stopped by a server shutdown before it started; import the file again")
+		return
+	}
+
+	now := time.Now()
+	job.Status = models.ImportRunning
+	job.StartedAt = &now
+	saveImport(&job)
+
+	for start := 0; start < len(rows); start += cfg.ImportBatchSize {
+		select {
+		case <-stopImports:
+			finishImport(&job, fmt.Sprintf("Stopped by a server shutdown after %d of %d rows; import the rest again", job.Processed, job.TotalRows))
+			return
+		default:
+		}
+
+		end := start + cfg.ImportBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		for i := start; i < end; i++ {
+			row := &rows[i]
+			if message := importLink(cfg, r, row); message != "" {
+				job.Failed++
+				job.RowErrors = append(job.RowErrors, models.LinkImportError{Row: row.Row, URL: row.Link.URL, Alias: row.Link.Alias, Message: message})
+			} else {
+				job.Succeeded++
+			}
+			job.Processed++
+		}
+		saveImport(&job)
+	}
+	finishImport(&job, "")
+}
+
+// importLink creates one row's link, returning why it failed, if it did.
+func importLink(cfg *config.Config, r *http.Request, row *importRow) string {
+	if row.Err != "" {
+		return row.Err
+	}
+	err := runCreationPipeline(&LinkCreation{Config: cfg, Request: r, Link: &row.Link})
+	if err == nil {
+		return ""
+	}
+	var linkErr *linkError
+	if errors.As(err, &linkErr) {
+		return linkErr.message
+	}
+	log.Println("Error importing link:", err)
+	return "Error creating shortened URL."
+}
+
+// finishImport marks the import completed, or failed with reason.
+func finishImport(job *models.LinkImport, reason string) {
+	now := time.Now()
+	job.Status = models.ImportCompleted
+	if reason != "" {
+		job.Status = models.ImportFailed
+		job.Error = reason
+	}
+	job.FinishedAt = &now
+	saveImport(job)
+}
+
+func saveImport(job *models.LinkImport) {
+	err := db.DB.Model(job).
+		Select("status", "processed", "succeeded", "failed", "row_errors", "error", "started_at", "finished_at").
+		Updates(job).Error
+	if err != nil {
+		log.Printf("Error saving progress of link import %d: %v", job.ID, err)
+	}
+}
+
+// importFile returns the file to import and whether it's csv or json, going
+// by ?format=, then the file's content type, then its name.
+func importFile(r *http.Request) (io.Reader, string, error) {
+	var file io.Reader = r.Body
+	contentType := r.Header.Get("Content-Type")
+	fileName := ""
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		parts, err := r.MultipartReader()
+		if err != nil {
+			return nil, "", fmt.Errorf("Invalid multipart form: %v", err)
+		}
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				return nil, "", errors.New("The form has no file field")
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("Invalid multipart form: %v", err)
+			}
+			if part.FormName() == "file" {
+				file, contentType, fileName = part, part.Header.Get("Content-Type"), part.FileName()
+				break
+			}
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch {
+		case mediaType == "application/json":
+			format = "json"
+		case mediaType == "text/csv":
+			format = "csv"
+		case strings.EqualFold(filepath.Ext(fileName), ".json"):
+			format = "json"
+		case strings.EqualFold(filepath.Ext(fileName), ".csv"):
+			format = "csv"
+		default:
+			return nil, "", errors.New("Can't tell whether the file is CSV or JSON; set ?format=csv or ?format=json")
+		}
+	}
+	if format != "csv" && format != "json" {
+		return nil, "", errors.New("format must be csv or json")
+	}
+	return file, format, nil
+}
+
+// readCSVImport reads a CSV file whose header row names a url column and,
+// optionally, custom_alias, expiry and tags columns. Tags are separated by
+// commas or semicolons within their cell.
+func readCSVImport(in io.Reader, maxRows int) ([]importRow, error) {
+	records := csv.NewReader(in)
+	records.FieldsPerRecord = -1
+	header, err := records.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, csvImportError(err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("The header row has no url column")
+	}
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+
+	var rows []importRow
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, csvImportError(err)
+		}
+		if len(rows) == maxRows {
+			return nil, fmt.Errorf("Imports can have at most %d rows", maxRows)
+		}
+		tags := strings.FieldsFunc(field(record, "tags"), func(r rune) bool { return r == ',' || r == ';' })
+		rows = append(rows, newImportRow(len(rows)+1, field(record, "url"),
+			field(record, "custom_alias", "alias", "short_code"), field(record, "expiry", "intended_expiry_date"), tags))
+	}
+}
+
+// csvImportError describes a CSV syntax error, passing size errors through.
+func csvImportError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("Invalid CSV on line %d: %v", parseErr.Line, parseErr.Err)
+	}
+	return err
+}
+
+// readJSONImport reads a JSON array of objects with url and, optionally,
+// custom_alias, expiry and tags keys.
+func readJSONImport(in io.Reader, maxRows int) ([]importRow, error) {
+	decoder := json.NewDecoder(in)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return nil, jsonImportError(err, "The file must hold a JSON array")
+	}
+
+	var rows []importRow
+	for decoder.More() {
+		if len(rows) == maxRows {
+			return nil, fmt.Errorf("Imports can have at most %d rows", maxRows)
+		}
+		var entry struct {
+			URL         string   `json:"url"`
+			CustomAlias string   `json:"custom_alias"`
+			Alias       string   `json:"alias"`
+			Expiry      string   `json:"expiry"`
+			Tags        []string `json:"tags"`
+		}
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, jsonImportError(err, fmt.Sprintf("Invalid JSON in row %d", len(rows)+1))
+		}
+		alias := entry.CustomAlias
+		if alias == "" {
+			alias = entry.Alias
+		}
+		rows = append(rows, newImportRow(len(rows)+1, strings.TrimSpace(entry.URL), strings.TrimSpace(alias), strings.TrimSpace(entry.Expiry), entry.Tags))
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, jsonImportError(err, "The file must hold a JSON array")
+	}
+	return rows, nil
+}
+
+// jsonImportError returns message as an error, passing size errors through.
+func jsonImportError(err error, message string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return errors.New(message)
+}
+
+func newImportRow(row int, rawURL, alias, expiry string, tags []string) importRow {
+	imported := importRow{Row: row, Link: ShortenURLRequest{URL: rawURL, Alias: alias, Tags: tags}}
+	if rawURL == "" {
+		imported.Err = "url is required"
+		return imported
+	}
+	if expiry != "" {
+		date, err := parseTimeParam(expiry)
+		if err != nil {
+			imported.Err = fmt.Sprintf("expiry %q must be an RFC 3339 time or YYYY-MM-DD date", expiry)
+			return imported
+		}
+		imported.Link.IntendedExpiryDate = &date
+	}
+	return imported
+}
+
+func newLinkImportResponse(job models.LinkImport) LinkImportResponse {
+	rowErrors := job.RowErrors
+	if rowErrors == nil {
+		rowErrors = []models.LinkImportError{}
+	}
+	return LinkImportResponse{
+		ID:         job.ID,
+		Status:     job.Status,
+		Format:     job.Format,
+		TotalRows:  job.TotalRows,
+		Processed:  job.Processed,
+		Succeeded:  job.Succeeded,
+		Failed:     job.Failed,
+		Errors:     rowErrors,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
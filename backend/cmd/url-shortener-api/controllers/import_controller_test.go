@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+func TestReadImport(t *testing.T) {
+	type row struct {
+		URL, Alias, Err string
+		Tags            []string
+	}
+	tests := []struct {
+		name     string
+		read     func(in io.Reader, maxRows int) ([]importRow, error)
+		file     string
+		maxRows  int
+		maxBytes int64 // limits the file as ImportMaxBytes does, when set
+		want     []row
+		wantErr  string
+	}{
+		{
+			name: "csv",
+			read: readCSVImport,
+			file: "url,custom_alias,tags\nhttps://example.com/a,launch,\"a,b\"\nhttps://example.com/b,,c;d\n",
+			want: []row{
+				{URL: "https://example.com/a", Alias: "launch", Tags: []string{"a", "b"}},
+				{URL: "https://example.com/b", Tags: []string{"c", "d"}},
+			},
+		},
+		{
+			name: "csv with a byte order mark",
+			read: readCSVImport,
+			file: "\ufeffURL, Alias\nhttps://example.com/a,launch\n",
+			want: []row{{URL: "https://example.com/a", Alias: "launch"}},
+		},
+		{
+			name: "csv short_code column",
+			read: readCSVImport,
+			file: "short_code,url\nlaunch,https://example.com/a\n",
+			want: []row{{URL: "https://example.com/a", Alias: "launch"}},
+		},
+		{
+			name: "csv custom_alias wins over alias",
+			read: readCSVImport,
+			file: "url,alias,custom_alias\nhttps://example.com/a,old,new\n",
+			want: []row{{URL: "https://example.com/a", Alias: "new"}},
+		},
+		{
+			name: "csv bad rows",
+			read: readCSVImport,
+			file: "url,expiry\n,\nhttps://example.com/a,soon\n",
+			want: []row{
+				{Err: "url is required"},
+				{URL: "https://example.com/a", Err: `expiry "soon" must be an RFC 3339 time or YYYY-MM-DD date`},
+			},
+		},
+		{
+			name:    "csv without a url column",
+			read:    readCSVImport,
+			file:    "link\nhttps://example.com/a\n",
+			wantErr: "The header row has no url column",
+		},
+		{name: "empty csv", read: readCSVImport, file: ""},
+		{
+			name:    "csv at the row limit",
+			read:    readCSVImport,
+			file:    "url\nhttps://example.com/a\nhttps://example.com/b\n",
+			maxRows: 2,
+			want:    []row{{URL: "https://example.com/a"}, {URL: "https://example.com/b"}},
+		},
+		{
+			name:    "csv over the row limit",
+			read:    readCSVImport,
+			file:    "url\nhttps://example.com/a\nhttps://example.com/b\n",
+			maxRows: 1,
+			wantErr: "Imports can have at most 1 rows",
+		},
+		{
+			name:     "csv over the size limit",
+			read:     readCSVImport,
+			file:     "url\nhttps://example.com/a\nhttps://example.com/b\n",
+			maxBytes: 20,
+			wantErr:  "http: request body too large",
+		},
+		{
+			name: "json",
+			read: readJSONImport,
+			file: `[{"url": " https://example.com/a ", "custom_alias": "launch", "tags": ["a"]}, {"url": "https://example.com/b", "alias": "old"}]`,
+			want: []row{
+				{URL: "https://example.com/a", Alias: "launch", Tags: []string{"a"}},
+				{URL: "https://example.com/b", Alias: "old"},
+			},
+		},
+		{
+			name: "json custom_alias wins over alias",
+			read: readJSONImport,
+			file: `[{"url": "https://example.com/a", "alias": "old", "custom_alias": "new"}]`,
+			want: []row{{URL: "https://example.com/a", Alias: "new"}},
+		},
+		{name: "json object", read: readJSONImport, file: `{"url": "https://example.com/a"}`, wantErr: "The file must hold a JSON array"},
+		{name: "json bad row", read: readJSONImport, file: `[{"url": 1}]`, wantErr: "Invalid JSON in row 1"},
+		{name: "unterminated json", read: readJSONImport, file: `[{"url": "https://example.com/a"}`, wantErr: "Invalid JSON in row 2"},
+		{
+			name:    "json over the row limit",
+			read:    readJSONImport,
+			file:    `[{"url": "https://example.com/a"}, {"url": "https://example.com/b"}]`,
+			maxRows: 1,
+			wantErr: "Imports can have at most 1 rows",
+		},
+		{
+			name:     "json over the size limit",
+			read:     readJSONImport,
+			file:     `[{"url": "https://example.com/a"}, {"url": "https://example.com/b"}]`,
+			maxBytes: 40,
+			wantErr:  "http: request body too large",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in io.Reader = strings.NewReader(tt.file)
+			if tt.maxBytes > 0 {
+				in = http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(in), tt.maxBytes)
+			}
+			maxRows := tt.maxRows
+			if maxRows == 0 {
+				maxRows = 100
+			}
+
+			rows, err := tt.read(in, maxRows)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				// ImportLinks answers 413 for these, so they must come through as they are
+				var tooLarge *http.MaxBytesError
+				if tt.maxBytes > 0 && !errors.As(err, &tooLarge) {
+					t.Errorf("error %v isn't an *http.MaxBytesError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			var got []row
+			for i, imported := range rows {
+				if imported.Row != i+1 {
+					t.Errorf("rows[%d].Row = %d, want %d", i, imported.Row, i+1)
+				}
+				got = append(got, row{URL: imported.Link.URL, Alias: imported.Link.Alias, Err: imported.Err})
+				if len(imported.Link.Tags) > 0 {
+					got[i].Tags = imported.Link.Tags
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunImportSavesEachBatch(t *testing.T) {
+	links := setupLinks(t)
+	validationQueue = make(chan validationTask, 10)
+	t.Cleanup(func() { validationQueue = nil })
+	taken := models.UrlMapping{ShortCode: "taken", OriginalUrl: "https://example.com/taken"}
+	if err := links.Create(context.Background(), &taken); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := readCSVImport(strings.NewReader(
+		"url,alias\n"+
+			"https://example.com/1,one\n"+
+			"https://example.com/2,taken\n"+
+			",\n"+
+			"https://example.com/4,\n"+
+			"https://example.com/5,five\n"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := models.LinkImport{Format: "csv", Status: models.ImportQueued, TotalRows: len(rows)}
+	if err := db.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Record the progress each save of the import writes
+	var saved []int
+	err = db.DB.Callback().Update().After("gorm:update").Register("test:import_progress", func(tx *gorm.DB) {
+		if progress, ok := tx.Statement.Dest.(*models.LinkImport); ok {
+			saved = append(saved, progress.Processed)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Imports run as whoever uploaded the file; here that's the admin, who may pick aliases
+	var r *http.Request
+	capture := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) { r = req })
+	upload := httptest.NewRequest(http.MethodPost, "/api/links/import", nil)
+	upload.Header.Set("Authorization", "Bearer "+testAdminToken)
+	middlewares.AdminTokenMiddleware(testAdminToken)(capture).ServeHTTP(httptest.NewRecorder(), upload)
+
+	cfg := config.Config{
+		AsyncValidation:   true,
+		AuthenticatedTier: config.Tier{CustomAliases: true},
+		ImportBatchSize:   2,
+	}
+	runImport(&cfg, r, job, rows)
+
+	// Once on starting, after each of the three batches, and once on finishing
+	if want := []int{0, 2, 4, 5, 5}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("progress saved = %v, want %v", saved, want)
+	}
+	if err := db.DB.First(&job, job.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.ImportCompleted || job.Processed != 5 || job.Succeeded != 3 || job.Failed != 2 || job.FinishedAt == nil {
+		t.Errorf("import %+v, want completed with 3 of 5 rows succeeded", job)
+	}
+	var failedRows []int
+	for _, rowErr := range job.RowErrors {
+		failedRows = append(failedRows, rowErr.Row)
+	}
+	if want := []int{2, 3}; !reflect.DeepEqual(failedRows, want) {
+		t.Errorf("failed rows = %v (%+v), want %v", failedRows, job.RowErrors, want)
+	}
+	for _, code := range []string{"one", "five"} {
+		if _, err := links.GetByCode(context.Background(), code); err != nil {
+			t.Errorf("GetByCode(%s) error = %v", code, err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/mailer"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateInviteRequest invites someone by email to join an organization.
+type CreateInviteRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// InviteResponse is a pending invitation as seen by the organization's owners.
+type InviteResponse struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InviteDetailsResponse is what the holder of an invite link is told about it.
+type InviteDetailsResponse struct {
+	Organization string    `json:"organization"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// CreateInvite emails a signed invite link to join the organization with the
+// chosen role. Only owners may invite. Inviting an address again replaces its
+// pending invite, so only the newest link works.
+func CreateInvite(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleOwner)
+		if !ok {
+			return
+		}
+
+		var req CreateInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		email, err := normalizeEmail(req.Email)
+		if err != nil {
+			respondWithError(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		if !models.ValidOrgRole(req.Role) {
+			respondWithError(w, "role must be one of owner, editor or viewer", http.StatusBadRequest)
+			return
+		}
+
+		// Don't invite people who are already in
+		var existing int64
+		err = db.DB.WithContext(r.Context()).Model(&models.Membership{}).
+			Joins("JOIN users ON users.id = memberships.user_id").
+			Where("memberships.organization_id = ? AND users.email = ?", orgID, email).
+			Count(&existing).Error
+		if err != nil {
+			log.Println("Error checking membership:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+		if existing > 0 {
+			respondWithError(w, "User is already a member", http.StatusConflict)
+			return
+		}
+
+		var org models.Organization
+		if err := db.DB.WithContext(r.Context()).First(&org, orgID).Error; err != nil {
+			log.Println("Error retrieving organization:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+
+		invite := models.Invitation{
+			OrganizationID: orgID,
+			Email:          email,
+			Role:           req.Role,
+			ExpiresAt:      time.Now().Add(cfg.InviteTTL).UTC().Truncate(time.Second),
+		}
+		if userID, ok := middlewares.UserID(r); ok {
+			invite.InvitedByID = &userID
+		}
+
+		err = db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("organization_id = ? AND email = ? AND accepted_at IS NULL", orgID, email).Delete(&models.Invitation{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&invite).Error
+		})
+		if err != nil {
+			log.Println("Error saving invitation:", err)
+			respondWithError(w, "Error creating invitation. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		token, err := utils.GenerateInviteToken(cfg.JWTSecret, invite.ID, invite.ExpiresAt)
+		if err == nil {
+			err = sendInviteEmail(invite, org, inviteURL(cfg, r, token))
+		}
+		if err != nil {
+			// An invite nobody received is useless, so drop it and let the owner retry
+			log.Println("Error sending invitation:", err)
+			db.DB.WithContext(r.Context()).Delete(&invite)
+			respondWithError(w, "Error sending invitation. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newInviteResponse(invite))
+	}
+}
+
+// ListInvites returns an organization's pending invitations to its owners.
+func ListInvites() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleOwner)
+		if !ok {
+			return
+		}
+
+		var invites []models.Invitation
+		err := db.DB.WithContext(r.Context()).Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", orgID, time.Now()).
+			Order("id").
+			Find(&invites).Error
+		if err != nil {
+			log.Println("Error listing invitations:", err)
+			respondWithError(w, "Error listing invitations.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]InviteResponse, 0, len(invites))
+		for _, invite := range invites {
+			response = append(response, newInviteResponse(invite))
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// RevokeInvite withdraws a pending invitation so its link stops working.
+func RevokeInvite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleOwner)
+		if !ok {
+			return
+		}
+
+		result := db.DB.WithContext(r.Context()).Where("id = ? AND organization_id = ? AND accepted_at IS NULL", mux.Vars(r)["inviteID"], orgID).
+			Delete(&models.Invitation{})
+		if result.Error != nil {
+			log.Println("Error revoking invitation:", result.Error)
+			respondWithError(w, "Error revoking invitation. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			respondWithError(w, "Invitation not found.", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetInvite describes the invitation an invite link names, so the recipient
+// can see what they're joining before signing in to accept.
+func GetInvite(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invite, ok := findInvite(w, r, cfg, mux.Vars(r)["token"])
+		if !ok {
+			return
+		}
+
+		respondWithJSON(w, InviteDetailsResponse{
+			Organization: invite.Organization.Name,
+			Email:        invite.Email,
+			Role:         invite.Role,
+			ExpiresAt:    invite.ExpiresAt,
+		})
+	}
+}
+
+// AcceptInvite adds the signed-in user to the organization with the invited
+// role. The account's email must match the address the invite was sent to.
+func AcceptInvite(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+
+		invite, ok := findInvite(w, r, cfg, mux.Vars(r)["token"])
+		if !ok {
+			return
+		}
+
+		var user models.User
+		if err := db.DB.WithContext(r.Context()).First(&user, userID).Error; err != nil {
+			log.Println("Error retrieving user:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+		if user.Email != invite.Email {
+			respondWithError(w, "This invitation was sent to a different email address", http.StatusForbidden)
+			return
+		}
+
+		have, err := orgRole(r.Context(), userID, invite.OrganizationID)
+		if err != nil {
+			log.Println("Error retrieving membership:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+		if have != "" {
+			respondWithError(w, "You are already a member of this organization", http.StatusConflict)
+			return
+		}
+
+		// Claim the invite and join in one go, so a link can only be used once
+		membership := models.Membership{OrganizationID: invite.OrganizationID, UserID: userID, Role: invite.Role}
+		err = db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.Invitation{}).
+				Where("id = ? AND accepted_at IS NULL", invite.ID).
+				Update("accepted_at", time.Now())
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errInviteUsed
+			}
+			return tx.Create(&membership).Error
+		})
+		if errors.Is(err, errInviteUsed) {
+			respondWithError(w, "This invitation has already been used", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Println("Error accepting invitation:", err)
+			respondWithError(w, "Error accepting invitation. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithJSON(w, OrganizationResponse{
+			ID:        invite.Organization.ID,
+			Name:      invite.Organization.Name,
+			Role:      membership.Role,
+			CreatedAt: invite.Organization.CreatedAt,
+		})
+	}
+}
+
+var errInviteUsed = errors.New("invitation already accepted")
+
+// findInvite checks an invite token and loads the pending invitation it
+// names, writing an error if the link can't be used.
+func findInvite(w http.ResponseWriter, r *http.Request, cfg *config.Config, token string) (models.Invitation, bool) {
+	var invite models.Invitation
+
+	inviteID, err := utils.ValidateInviteToken(cfg.JWTSecret, token)
+	if errors.Is(err, utils.ErrInviteTokenExpired) {
+		respondWithError(w, "This invitation has expired", http.StatusGone)
+		return invite, false
+	}
+	if err != nil {
+		respondWithError(w, "Invitation not found.", http.StatusNotFound)
+		return invite, false
+	}
+
+	// Revoked and superseded invites are deleted, so they're simply not found
+	if err := db.DB.WithContext(r.Context()).Preload("Organization").First(&invite, inviteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondWithError(w, "Invitation not found.", http.StatusNotFound)
+		} else {
+			log.Println("Error retrieving invitation:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		}
+		return invite, false
+	}
+	if invite.AcceptedAt != nil {
+		respondWithError(w, "This invitation has already been used", http.StatusConflict)
+		return invite, false
+	}
+	if time.Now().After(invite.ExpiresAt) {
+		respondWithError(w, "This invitation has expired", http.StatusGone)
+		return invite, false
+	}
+	return invite, true
+}
+
+// inviteURL is the link emailed to the invitee.
+func inviteURL(cfg *config.Config, r *http.Request, token string) string {
+	if cfg.InviteAcceptURL != "" {
+		return cfg.InviteAcceptURL + "?token=" + url.QueryEscape(token)
+	}
+	return requestBaseURL(r) + "/api/invites/" + url.PathEscape(token)
+}
+
+func sendInviteEmail(invite models.Invitation, org models.Organization, link string) error {
+	subject := fmt.Sprintf("You're invited to join %s", org.Name)
+	body := fmt.Sprintf("You've been invited to join %s as %s.\n\nSign in with this email address and accept the invitation here:\n%s\n\nThis invitation expires on %s.\n",
+		org.Name, invite.Role, link, invite.ExpiresAt.Format("January 2, 2006 15:04 MST"))
+	return mailer.Send(invite.Email, subject, body)
+}
+
+func newInviteResponse(invite models.Invitation) InviteResponse {
+	return InviteResponse{
+		ID:        invite.ID,
+		Email:     invite.Email,
+		Role:      invite.Role,
+		ExpiresAt: invite.ExpiresAt,
+		CreatedAt: invite.CreatedAt,
+	}
+}
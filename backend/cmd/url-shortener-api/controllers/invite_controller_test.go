@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAcceptInvite(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string        // the signed-in user's
+		member     bool          // whether they're already in the organization
+		accepted   bool          // whether the invite was used before
+		expiresIn  time.Duration // from now
+		token      string        // overrides the invite's token
+		wantStatus int
+	}{
+		{name: "accepted", email: "invitee@example.com", expiresIn: time.Hour, wantStatus: http.StatusOK},
+		{name: "other email", email: "someone@example.com", expiresIn: time.Hour, wantStatus: http.StatusForbidden},
+		{name: "already a member", email: "invitee@example.com", member: true, expiresIn: time.Hour, wantStatus: http.StatusConflict},
+		{name: "already used", email: "invitee@example.com", accepted: true, expiresIn: time.Hour, wantStatus: http.StatusConflict},
+		{name: "expired", email: "invitee@example.com", expiresIn: -time.Minute, wantStatus: http.StatusGone},
+		{name: "bad token", email: "invitee@example.com", expiresIn: time.Hour, token: "not-a-token", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLinks(t)
+			user, accessToken := createUser(t, tt.email)
+			org := models.Organization{Name: "Acme"}
+			if err := db.DB.Create(&org).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.member {
+				if err := db.DB.Create(&models.Membership{OrganizationID: org.ID, UserID: user.ID, Role: models.OrgRoleViewer}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			invite := models.Invitation{
+				OrganizationID: org.ID,
+				Email:          "invitee@example.com",
+				Role:           models.OrgRoleEditor,
+				ExpiresAt:      time.Now().Add(tt.expiresIn),
+			}
+			if tt.accepted {
+				now := time.Now()
+				invite.AcceptedAt = &now
+			}
+			if err := db.DB.Create(&invite).Error; err != nil {
+				t.Fatal(err)
+			}
+			token := tt.token
+			if token == "" {
+				var err error
+				if token, err = utils.GenerateInviteToken(testJWTSecret, invite.ID, invite.ExpiresAt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg := config.Config{JWTSecret: testJWTSecret}
+			handler := middlewares.AuthMiddleware(testJWTSecret)(middlewares.RequireUser(AcceptInvite(&cfg)))
+			r := httptest.NewRequest(http.MethodPost, "/api/invites/"+token+"/accept", nil)
+			r.Header.Set("Authorization", "Bearer "+accessToken)
+			r = mux.SetURLVars(r, map[string]string{"token": token})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var role string
+			db.DB.Model(&models.Membership{}).Where("organization_id = ? AND user_id = ?", org.ID, user.ID).Pluck("role", &role)
+			switch {
+			case tt.wantStatus == http.StatusOK && role != models.OrgRoleEditor:
+				t.Errorf("membership role %q, want the invited role %q", role, models.OrgRoleEditor)
+			case tt.wantStatus != http.StatusOK && !tt.member && role != "":
+				t.Errorf("membership role %q, want no membership", role)
+			}
+		})
+	}
+}
+
+func TestAcceptInviteOnlyOnce(t *testing.T) {
+	setupLinks(t)
+	_, accessToken := createUser(t, "invitee@example.com")
+	org := models.Organization{Name: "Acme"}
+	if err := db.DB.Create(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+	invite := models.Invitation{OrganizationID: org.ID, Email: "invitee@example.com", Role: models.OrgRoleViewer, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.DB.Create(&invite).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, err := utils.GenerateInviteToken(testJWTSecret, invite.ID, invite.ExpiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{JWTSecret: testJWTSecret}
+	handler := middlewares.AuthMiddleware(testJWTSecret)(middlewares.RequireUser(AcceptInvite(&cfg)))
+	for i, want := range []int{http.StatusOK, http.StatusConflict} {
+		r := httptest.NewRequest(http.MethodPost, "/api/invites/"+token+"/accept", nil)
+		r.Header.Set("Authorization", "Bearer "+accessToken)
+		r = mux.SetURLVars(r, map[string]string{"token": token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("attempt %d: status %d, want %d: %s", i+1, w.Code, want, w.Body)
+		}
+	}
+
+	var memberships int64
+	db.DB.Model(&models.Membership{}).Where("organization_id = ?", org.ID).Count(&memberships)
+	if memberships != 1 {
+		t.Errorf("%d memberships, want 1", memberships)
+	}
+}
@@ -0,0 +1,455 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/store"
+
+	"github.com/gorilla/mux"
+)
+
+// Outcomes of applying a desired link state.
+const (
+	linkCreated   = "created"
+	linkUpdated   = "updated"
+	linkUnchanged = "unchanged"
+)
+
+// LinkResource is the full representation of a link, as returned by the
+// link management endpoints.
+type LinkResource struct {
+	ID                uint       `json:"id"`
+	OwnerID           *uint      `json:"owner_id,omitempty"`
+	ShortCode         string     `json:"short_code"`
+	ShortURL          string     `json:"short_url"`
+	Status            string     `json:"status"`
+	PendingValidation bool       `json:"pending_validation,omitempty"`
+	FinalURL          string     `json:"final_url,omitempty"`
+	ContentType       string     `json:"content_type,omitempty"`
+	DownloadType      string     `json:"download_type,omitempty"`
+	Managed           bool       `json:"managed"`
+	CreatedAt         time.Time  `json:"created_at"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+	ShortenURLRequest
+}
+
+// ReconcileLink is one desired link in a reconcile request.
+type ReconcileLink struct {
+	ShortCode string `json:"short_code"`
+	ShortenURLRequest
+}
+
+// ReconcileRequest is the complete desired set of managed links.
+type ReconcileRequest struct {
+	Links []ReconcileLink `json:"links"`
+	// Prune deletes managed links that are missing from Links.
+	Prune bool `json:"prune"`
+}
+
+// ReconcileError reports a link that couldn't be reconciled.
+type ReconcileError struct {
+	ShortCode string `json:"short_code"`
+	Message   string `json:"message"`
+}
+
+// ReconcileResponse summarizes what a reconcile changed.
+type ReconcileResponse struct {
+	Created   []string         `json:"created"`
+	Updated   []string         `json:"updated"`
+	Unchanged []string         `json:"unchanged"`
+	Deleted   []string         `json:"deleted"`
+	Errors    []ReconcileError `json:"errors"`
+}
+
+// linkError carries an HTTP status alongside a client-facing message.
+type linkError struct {
+	status  int
+	message string
+}
+
+func (e *linkError) Error() string { return e.message }
+
+// ListLinks returns the caller's links, newest first, a page at a time.
+// Admins see every link.
+func ListLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		opts := store.ListOptions{Limit: page.Limit, After: page.After}
+		if !middlewares.IsAdmin(r) {
+			userID, _ := middlewares.UserID(r)
+			opts.VisibleTo = &userID
+		}
+		urlMappings, err := store.Links.List(r.Context(), opts)
+		if err != nil {
+			log.Println("Error listing links:", err)
+			respondWithError(w, "Error listing links.", http.StatusInternalServerError)
+			return
+		}
+
+		links := make([]LinkResource, 0, len(urlMappings))
+		for _, urlMapping := range urlMappings {
+			links = append(links, newLinkResource(r, urlMapping))
+		}
+		if len(urlMappings) > 0 {
+			last := urlMappings[len(urlMappings)-1]
+			page.setNext(w, len(urlMappings), store.Cursor{Time: last.CreatedAt, ID: last.ID})
+		}
+		respondWithJSON(w, links)
+	}
+}
+
+// GetLink returns the full state of a link, to those who can see it.
+func GetLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+		respondWithJSON(w, newLinkResource(r, urlMapping))
+	}
+}
+
+// PutLink creates or fully replaces the link with the given alias. Repeating
+// the same request is a no-op, so it is safe for declarative tooling. Users
+// may only replace their own links; admins may replace any.
+func PutLink(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alias := mux.Vars(r)["shortCode"]
+
+		var req ShortenURLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		urlMapping, outcome, err := upsertLink(r, cfg, alias, &req)
+		if err != nil {
+			var linkErr *linkError
+			if errors.As(err, &linkErr) {
+				respondWithError(w, linkErr.message, linkErr.status)
+				return
+			}
+			log.Printf("Error saving link %s: %v", alias, err)
+			respondWithError(w, "Error saving link. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if outcome == linkCreated {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(newLinkResource(r, urlMapping))
+	}
+}
+
+// DeleteLink deletes a link. Its short code and click history are kept, so
+// an admin can restore it, until it's purged after DELETED_LINK_RETENTION_DAYS.
+// Users may only delete their own links; admins may delete any.
+func DeleteLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findURLMapping(w, r, mux.Vars(r)["shortCode"])
+		if !ok {
+			return
+		}
+		if !ownsLink(r, urlMapping) {
+			respondWithError(w, "URL not found.", http.StatusNotFound)
+			return
+		}
+
+		if err := store.Links.Delete(r.Context(), urlMapping); err != nil {
+			log.Printf("Error deleting link %s: %v", urlMapping.ShortCode, err)
+			respondWithError(w, "Error deleting link. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListDeletedLinks returns deleted links that can still be restored, most
+// recently deleted first, a page at a time.
+func ListDeletedLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		urlMappings, err := store.Links.List(r.Context(), store.ListOptions{Deleted: true, Limit: page.Limit, After: page.After})
+		if err != nil {
+			log.Println("Error listing deleted links:", err)
+			respondWithError(w, "Error listing deleted links.", http.StatusInternalServerError)
+			return
+		}
+
+		links := make([]LinkResource, 0, len(urlMappings))
+		for _, urlMapping := range urlMappings {
+			links = append(links, newLinkResource(r, urlMapping))
+		}
+		if len(urlMappings) > 0 {
+			last := urlMappings[len(urlMappings)-1]
+			page.setNext(w, len(urlMappings), store.Cursor{Time: last.DeletedAt.Time, ID: last.ID})
+		}
+		respondWithJSON(w, links)
+	}
+}
+
+// RestoreLink undeletes a link, bringing back its click history.
+func RestoreLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shortCode := mux.Vars(r)["shortCode"]
+		urlMapping, err := store.Links.Restore(r.Context(), shortCode)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				respondWithError(w, "Deleted link not found.", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error restoring link %s: %v", shortCode, err)
+			respondWithError(w, "Error restoring link. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Restored deleted link %s", shortCode)
+		respondWithJSON(w, newLinkResource(r, urlMapping))
+	}
+}
+
+// ReconcileLinks applies a complete desired set of managed links, creating
+// and updating as needed and optionally pruning managed links not listed.
+func ReconcileLinks(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ReconcileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		response := ReconcileResponse{
+			Created:   []string{},
+			Updated:   []string{},
+			Unchanged: []string{},
+			Deleted:   []string{},
+			Errors:    []ReconcileError{},
+		}
+
+		desired := make(map[string]bool, len(req.Links))
+		for i := range req.Links {
+			link := &req.Links[i]
+			desired[link.ShortCode] = true
+
+			if link.URL == "" {
+				response.Errors = append(response.Errors, ReconcileError{ShortCode: link.ShortCode, Message: "url is required"})
+				continue
+			}
+
+			_, outcome, err := upsertLink(r, cfg, link.ShortCode, &link.ShortenURLRequest)
+			if err != nil {
+				message := "Error saving link."
+				var linkErr *linkError
+				if errors.As(err, &linkErr) {
+					message = linkErr.message
+				} else {
+					log.Printf("Error reconciling link %s: %v", link.ShortCode, err)
+				}
+				response.Errors = append(response.Errors, ReconcileError{ShortCode: link.ShortCode, Message: message})
+				continue
+			}
+
+			switch outcome {
+			case linkCreated:
+				response.Created = append(response.Created, link.ShortCode)
+			case linkUpdated:
+				response.Updated = append(response.Updated, link.ShortCode)
+			default:
+				response.Unchanged = append(response.Unchanged, link.ShortCode)
+			}
+		}
+
+		// Pruning only ever touches links created through this API, and is
+		// skipped if anything failed so a bad request can't wipe out links
+		if req.Prune && len(response.Errors) == 0 {
+			managedOnly := true
+			managed, err := store.Links.List(r.Context(), store.ListOptions{Managed: &managedOnly})
+			if err != nil {
+				log.Println("Error listing managed links:", err)
+				respondWithError(w, "Error pruning links.", http.StatusInternalServerError)
+				return
+			}
+			for _, urlMapping := range managed {
+				if desired[urlMapping.ShortCode] {
+					continue
+				}
+				if err := store.Links.Delete(r.Context(), urlMapping); err != nil {
+					log.Printf("Error pruning link %s: %v", urlMapping.ShortCode, err)
+					response.Errors = append(response.Errors, ReconcileError{ShortCode: urlMapping.ShortCode, Message: "Error deleting link."})
+					continue
+				}
+				response.Deleted = append(response.Deleted, urlMapping.ShortCode)
+			}
+		}
+
+		respondWithJSON(w, response)
+	}
+}
+
+// upsertLink brings the link with the given alias to the state described by
+// req through the creation pipeline, and reads it back from the database.
+// Users may only replace links they can edit, and new links are given to
+// them; admins may replace anything, and the links they create are ownerless
+// and marked as managed so a reconcile can prune them.
+func upsertLink(r *http.Request, cfg *config.Config, alias string, req *ShortenURLRequest) (models.UrlMapping, string, error) {
+	admin := middlewares.IsAdmin(r)
+	userID, _ := middlewares.UserID(r)
+
+	// The alias comes from the path, not the body
+	req.Alias = ""
+	outcome := linkUpdated
+	urlMapping, err := store.Links.GetByCode(r.Context(), alias)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		// The persist stage refuses aliases of deleted links
+		outcome = linkCreated
+	case err != nil:
+		return urlMapping, "", err
+	case !admin && !userCanEdit(r.Context(), userID, urlMapping):
+		return urlMapping, "", &linkError{http.StatusConflict, "Alias is already taken"}
+	case urlMapping.Managed == (urlMapping.OwnerID == nil) && reflect.DeepEqual(linkSpec(urlMapping), *req):
+		return urlMapping, linkUnchanged, nil
+	}
+
+	req.Alias = alias
+	creation := &LinkCreation{Config: cfg, Request: r, Link: req, Managed: admin}
+	if outcome == linkUpdated {
+		creation.Replacing = &urlMapping
+	}
+	if err := runCreationPipeline(creation); err != nil {
+		return urlMapping, "", err
+	}
+
+	// Read back what was stored so callers see exactly what GET will return
+	urlMapping, err = store.Links.GetByCode(r.Context(), alias)
+	if err != nil {
+		return urlMapping, "", err
+	}
+	return urlMapping, outcome, nil
+}
+
+// ownsLink reports whether the request may modify urlMapping.
+func ownsLink(r *http.Request, urlMapping models.UrlMapping) bool {
+	if middlewares.IsAdmin(r) {
+		return true
+	}
+	userID, ok := middlewares.UserID(r)
+	return ok && userCanEdit(r.Context(), userID, urlMapping)
+}
+
+// canViewLink reports whether the request may see urlMapping and its
+// clicks: its owner, members of its organization and admins can.
+func canViewLink(r *http.Request, urlMapping models.UrlMapping) bool {
+	if middlewares.IsAdmin(r) {
+		return true
+	}
+	userID, ok := middlewares.UserID(r)
+	if !ok {
+		return false
+	}
+	return (urlMapping.OwnerID != nil && *urlMapping.OwnerID == userID) ||
+		userHasOrgRole(r.Context(), userID, urlMapping.OrganizationID, models.OrgRoleViewer)
+}
+
+// userCanEdit reports whether userID owns urlMapping or is an editor of the
+// organization it belongs to.
+func userCanEdit(ctx context.Context, userID uint, urlMapping models.UrlMapping) bool {
+	if urlMapping.OwnerID != nil && *urlMapping.OwnerID == userID {
+		return true
+	}
+	return userHasOrgRole(ctx, userID, urlMapping.OrganizationID, models.OrgRoleEditor)
+}
+
+// userHasOrgRole reports whether userID has at least role in orgID.
+func userHasOrgRole(ctx context.Context, userID uint, orgID *uint, role string) bool {
+	if orgID == nil {
+		return false
+	}
+	have, err := orgRole(ctx, userID, *orgID)
+	if err != nil {
+		log.Println("Error retrieving membership:", err)
+		return false
+	}
+	return models.OrgRoleAllows(have, role)
+}
+
+// checkOrgAssignment makes sure userID may put a link in orgID.
+func checkOrgAssignment(ctx context.Context, userID uint, orgID *uint) error {
+	if orgID != nil && !userHasOrgRole(ctx, userID, orgID, models.OrgRoleEditor) {
+		return &linkError{http.StatusForbidden, "You must be an editor of the organization to add links to it"}
+	}
+	return nil
+}
+
+// findVisibleLink loads the link named in the route for reading. Links
+// with an owner or organization are only visible to the owner, members of
+// the organization and admins; others get a 404.
+func findVisibleLink(w http.ResponseWriter, r *http.Request) (models.UrlMapping, bool) {
+	urlMapping, ok := findURLMapping(w, r, mux.Vars(r)["shortCode"])
+	if !ok || (urlMapping.OwnerID == nil && urlMapping.OrganizationID == nil) || canViewLink(r, urlMapping) {
+		return urlMapping, ok
+	}
+	respondWithError(w, "URL not found.", http.StatusNotFound)
+	return urlMapping, false
+}
+
+// linkSpec is the user-controlled state of urlMapping, in request form.
+func linkSpec(urlMapping models.UrlMapping) ShortenURLRequest {
+	return ShortenURLRequest{
+		URL:                 urlMapping.OriginalUrl,
+		Domain:              urlMapping.Domain,
+		OrganizationID:      urlMapping.OrganizationID,
+		IntendedLiveDate:    urlMapping.IntendedLiveDate,
+		IntendedExpiryDate:  urlMapping.IntendedExpiryDate,
+		ForwardQuery:        urlMapping.ForwardQuery,
+		InterstitialSeconds: urlMapping.InterstitialSeconds,
+		LanguageTargets:     urlMapping.LanguageTargets,
+		ResponseHeaders:     urlMapping.ResponseHeaders,
+		HideReferrer:        urlMapping.HideReferrer,
+		ProxyContent:        urlMapping.ProxyContent,
+		TrackEngagement:     urlMapping.TrackEngagement,
+		PrintCampaign:       urlMapping.PrintCampaign,
+		Tags:                urlMapping.Tags,
+	}
+}
+
+func newLinkResource(r *http.Request, urlMapping models.UrlMapping) LinkResource {
+	var deletedAt *time.Time
+	if urlMapping.DeletedAt.Valid {
+		deletedAt = &urlMapping.DeletedAt.Time
+	}
+	return LinkResource{
+		ID:                urlMapping.ID,
+		OwnerID:           urlMapping.OwnerID,
+		ShortCode:         urlMapping.ShortCode,
+		ShortURL:          constructShortURL(r, urlMapping),
+		Status:            urlMapping.Status,
+		PendingValidation: urlMapping.PendingValidation,
+		FinalURL:          urlMapping.FinalUrl,
+		ContentType:       urlMapping.ContentType,
+		DownloadType:      urlMapping.DownloadType,
+		Managed:           urlMapping.Managed,
+		CreatedAt:         urlMapping.CreatedAt,
+		DeletedAt:         deletedAt,
+		ShortenURLRequest: linkSpec(urlMapping),
+	}
+}
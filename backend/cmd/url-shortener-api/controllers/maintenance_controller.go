@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"url-shortener/middlewares"
+)
+
+// MaintenanceStatus says whether this instance is in maintenance mode.
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// GetMaintenance reports whether this instance is in maintenance mode.
+func GetMaintenance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, MaintenanceStatus{Enabled: middlewares.InMaintenance()})
+	}
+}
+
+// SetMaintenance turns maintenance mode on or off for this instance. Other
+// instances need the request too, or MAINTENANCE_MODE set when they start.
+func SetMaintenance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req MaintenanceStatus
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		middlewares.SetMaintenance(req.Enabled)
+		if req.Enabled {
+			log.Println("Maintenance mode on; writes are refused")
+		} else {
+			log.Println("Maintenance mode off")
+		}
+		respondWithJSON(w, req)
+	}
+}
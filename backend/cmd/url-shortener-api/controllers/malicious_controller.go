@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/store"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// MaliciousLogResponse is one unsafe URL detection.
+type MaliciousLogResponse struct {
+	ID         uint       `json:"id"`
+	URL        string     `json:"url"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	RiskScore  int        `json:"risk_score"`
+	Details    string     `json:"details"`
+	LiveLinks  int64      `json:"live_links"` // links to the URL that still redirect
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TakedownResponse lists the links a takedown disabled.
+type TakedownResponse struct {
+	Disabled []string `json:"disabled"`
+}
+
+// ListMaliciousLogs returns unsafe URL detections, newest first, a page at
+// a time. They can be
+// filtered with ?min_score= and ?max_score=, and ?pending=true leaves out
+// those already taken down.
+func ListMaliciousLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		query := store.Paginate(db.DB.WithContext(r.Context()), "created_at", page.After)
+		for _, filter := range []struct{ param, condition string }{
+			{"min_score", "risk_score >= ?"},
+			{"max_score", "risk_score <= ?"},
+		} {
+			param := filter.param
+			value := r.URL.Query().Get(param)
+			if value == "" {
+				continue
+			}
+			score, err := strconv.Atoi(value)
+			if err != nil {
+				respondWithError(w, fmt.Sprintf("%s must be a number", param), http.StatusBadRequest)
+				return
+			}
+			query = query.Where(filter.condition, score)
+		}
+		if r.URL.Query().Get("pending") == "true" {
+			query = query.Where("disabled_at IS NULL")
+		}
+
+		var entries []models.MaliciousLog
+		if err := query.Limit(page.Limit).Find(&entries).Error; err != nil {
+			log.Println("Error listing malicious logs:", err)
+			respondWithError(w, "Error listing malicious logs.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]MaliciousLogResponse, 0, len(entries))
+		for _, entry := range entries {
+			var liveLinks int64
+			err := db.DB.WithContext(r.Context()).Model(&models.UrlMapping{}).
+				Where("original_url IN ? AND status <> ?", store.URLColumnValues(entry.URL), "disabled").
+				Count(&liveLinks).Error
+			if err != nil {
+				log.Println("Error counting links for malicious log:", err)
+				respondWithError(w, "Error listing malicious logs.", http.StatusInternalServerError)
+				return
+			}
+			response = append(response, MaliciousLogResponse{
+				ID:         entry.ID,
+				URL:        entry.URL,
+				UserAgent:  entry.UserAgent,
+				IPAddress:  entry.IPAddress,
+				RiskScore:  entry.RiskScore,
+				Details:    entry.Details,
+				LiveLinks:  liveLinks,
+				DisabledAt: entry.DisabledAt,
+				CreatedAt:  entry.CreatedAt,
+			})
+		}
+		if len(entries) > 0 {
+			last := entries[len(entries)-1]
+			page.setNext(w, len(entries), store.Cursor{Time: last.CreatedAt, ID: last.ID})
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// DisableMaliciousLinks takes down every link to the URL of a malicious log
+// entry. Disabled links stop redirecting and aren't revived by re-checks.
+func DisableMaliciousLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var entry models.MaliciousLog
+		if err := db.DB.WithContext(r.Context()).First(&entry, mux.Vars(r)["id"]).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondWithError(w, "Malicious log entry not found.", http.StatusNotFound)
+				return
+			}
+			log.Println("Error retrieving malicious log:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+
+		response := TakedownResponse{Disabled: []string{}}
+		err := db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			var urlMappings []models.UrlMapping
+			if err := tx.Select("id", "short_code").Where("original_url IN ? AND status <> ?", store.URLColumnValues(entry.URL), "disabled").Find(&urlMappings).Error; err != nil {
+				return err
+			}
+			for _, urlMapping := range urlMappings {
+				response.Disabled = append(response.Disabled, urlMapping.ShortCode)
+			}
+
+			if err := tx.Model(&models.UrlMapping{}).Where("original_url IN ?", store.URLColumnValues(entry.URL)).
+				Updates(map[string]interface{}{"status": "disabled", "disabled_by_reports": false}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.MaliciousLog{}).Where("url IN ? AND disabled_at IS NULL", store.URLColumnValues(entry.URL)).Update("disabled_at", time.Now()).Error
+		})
+		if err != nil {
+			log.Println("Error disabling malicious links:", err)
+			respondWithError(w, "Error disabling links. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		store.Invalidate(response.Disabled...)
+		log.Printf("Disabled %d links to %s", len(response.Disabled), entry.URL)
+
+		respondWithJSON(w, response)
+	}
+}
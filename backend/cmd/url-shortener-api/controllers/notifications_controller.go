@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// NotificationPreferences are the emails a user gets about the links they
+// own. Both are on for new accounts.
+type NotificationPreferences struct {
+	ExpiringLinks bool `json:"expiring_links"` // before and when a link expires
+	DeadLinks     bool `json:"dead_links"`     // when a re-check finds a destination dead
+}
+
+// UpdateNotificationPreferencesRequest changes notification preferences;
+// those left out are kept.
+type UpdateNotificationPreferencesRequest struct {
+	ExpiringLinks *bool `json:"expiring_links"`
+	DeadLinks     *bool `json:"dead_links"`
+}
+
+// GetNotificationPreferences returns the signed-in user's notification
+// preferences.
+func GetNotificationPreferences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := findCurrentUser(w, r)
+		if !ok {
+			return
+		}
+		respondWithJSON(w, newNotificationPreferences(user))
+	}
+}
+
+// UpdateNotificationPreferences changes the signed-in user's notification
+// preferences.
+func UpdateNotificationPreferences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateNotificationPreferencesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := findCurrentUser(w, r)
+		if !ok {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.ExpiringLinks != nil {
+			updates["notify_expiring"] = *req.ExpiringLinks
+			user.NotifyExpiring = *req.ExpiringLinks
+		}
+		if req.DeadLinks != nil {
+			updates["notify_dead_links"] = *req.DeadLinks
+			user.NotifyDeadLinks = *req.DeadLinks
+		}
+		if len(updates) > 0 {
+			if err := db.DB.WithContext(r.Context()).Model(&user).Updates(updates).Error; err != nil {
+				log.Println("Error updating notification preferences:", err)
+				respondWithError(w, "Error updating notification preferences.", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		respondWithJSON(w, newNotificationPreferences(user))
+	}
+}
+
+func newNotificationPreferences(user models.User) NotificationPreferences {
+	return NotificationPreferences{ExpiringLinks: user.NotifyExpiring, DeadLinks: user.NotifyDeadLinks}
+}
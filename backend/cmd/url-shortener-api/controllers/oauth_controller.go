@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/oauth"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// oauthStateTTL is how long a user has to complete a provider's login page.
+const oauthStateTTL = 10 * time.Minute
+
+// OAuthLogin starts a social login by redirecting to the provider with a
+// fresh state value, which is also kept in a short-lived cookie.
+func OAuthLogin(cfg *config.Config, providers map[string]*oauth.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := providers[mux.Vars(r)["provider"]]
+		if !ok {
+			respondWithError(w, "Unknown login provider.", http.StatusNotFound)
+			return
+		}
+
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Println("Error generating OAuth state:", err)
+			respondWithError(w, "Error starting login. Please try again.", http.StatusInternalServerError)
+			return
+		}
+		state := base64.RawURLEncoding.EncodeToString(buf)
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie(provider.Name),
+			Value:    state,
+			Path:     "/api/auth/",
+			MaxAge:   int(oauthStateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		oauthConfig := provider.Config
+		oauthConfig.RedirectURL = oauthRedirectURL(cfg, r, provider.Name)
+		http.Redirect(w, r, oauthConfig.AuthCodeURL(state), http.StatusFound)
+	}
+}
+
+// OAuthCallback completes a social or SSO login. The provider account is
+// matched to a user by its provider ID, then by verified email (linking the
+// two), and a new user is created if neither matches.
+func OAuthCallback(cfg *config.Config, providers map[string]*oauth.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := providers[mux.Vars(r)["provider"]]
+		if !ok {
+			respondWithError(w, "Unknown login provider.", http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("error") != "" {
+			respondWithError(w, "Login was cancelled or denied.", http.StatusBadRequest)
+			return
+		}
+
+		// Check the state matches the one we handed this browser
+		cookie, err := r.Cookie(oauthStateCookie(provider.Name))
+		state := query.Get("state")
+		if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+			respondWithError(w, "Invalid or expired login state. Please try again.", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:   oauthStateCookie(provider.Name),
+			Path:   "/api/auth/",
+			MaxAge: -1,
+		})
+
+		profile, err := provider.Exchange(r.Context(), oauthRedirectURL(cfg, r, provider.Name), query.Get("code"))
+		if err != nil {
+			log.Printf("Error completing %s login: %v", provider.Name, err)
+			respondWithError(w, "Error completing login. Please try again.", http.StatusBadGateway)
+			return
+		}
+
+		user, err := findOrCreateOAuthUser(r.Context(), provider.Name, profile)
+		if err != nil {
+			if errors.Is(err, oauth.ErrEmailNotVerified) {
+				respondWithError(w, "Your account needs a verified email address to log in.", http.StatusForbidden)
+				return
+			}
+			log.Printf("Error saving %s login: %v", provider.Name, err)
+			respondWithError(w, "Error completing login. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		// The IdP's groups decide the role when the provider maps them
+		if role, ok := provider.RoleFor(profile.Groups); ok && role != user.Role {
+			if err := db.DB.WithContext(r.Context()).Model(&user).Update("role", role).Error; err != nil {
+				log.Printf("Error updating role from %s groups: %v", provider.Name, err)
+				respondWithError(w, "Error completing login. Please try again.", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Set role of user %d to %s from %s groups", user.ID, role, provider.Name)
+		}
+		if !notBeingDeleted(w, r, user.ID) {
+			return
+		}
+
+		tokens, err := startSession(r.Context(), cfg, user.ID)
+		if err != nil {
+			log.Println("Error starting session:", err)
+			respondWithError(w, "Error logging in. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		// Hand the tokens to the frontend in the fragment so they never reach server logs
+		if cfg.OAuthSuccessURL != "" {
+			fragment := url.Values{}
+			fragment.Set("access_token", tokens.AccessToken)
+			fragment.Set("expires_at", tokens.ExpiresAt.Format(time.RFC3339))
+			fragment.Set("refresh_token", tokens.RefreshToken)
+			fragment.Set("refresh_expires_at", tokens.RefreshExpiresAt.Format(time.RFC3339))
+			http.Redirect(w, r, cfg.OAuthSuccessURL+"#"+fragment.Encode(), http.StatusFound)
+			return
+		}
+		respondWithJSON(w, tokens)
+	}
+}
+
+// findOrCreateOAuthUser returns the user a provider account belongs to,
+// linking or creating one as needed. Anyone can register a password account
+// under an email they don't own, so linking to one whose email no provider
+// has vouched for yet takes it over: its password, sessions and API keys are
+// revoked, leaving only whoever controls the email able to sign in.
+func findOrCreateOAuthUser(ctx context.Context, provider string, profile oauth.Profile) (models.User, error) {
+	var user models.User
+	takenOver := false
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Preload("User").Where("provider = ? AND subject = ?", provider, profile.Subject).First(&identity).Error
+		if err == nil {
+			user = identity.User
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Only a verified email is safe to link an existing account by
+		if !profile.EmailVerified || profile.Email == "" {
+			return oauth.ErrEmailNotVerified
+		}
+		email := strings.ToLower(profile.Email)
+
+		now := time.Now()
+		err = tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = models.User{Email: email, Role: models.RoleUser, EmailVerifiedAt: &now}
+			err = tx.Create(&user).Error
+		case err == nil && user.EmailVerifiedAt == nil:
+			takenOver = true
+			err = takeOverUnverifiedUser(tx, &user, now)
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  profile.Subject,
+			Email:    email,
+		}).Error
+	})
+	if err == nil && takenOver {
+		log.Printf("Verified user %d's email through %s; revoked its password, sessions and API keys", user.ID, provider)
+	}
+	return user, err
+}
+
+// takeOverUnverifiedUser marks user's email as verified as of now and
+// revokes every other way into the account.
+func takeOverUnverifiedUser(tx *gorm.DB, user *models.User, now time.Time) error {
+	user.PasswordHash = ""
+	user.EmailVerifiedAt = &now
+	if err := tx.Model(user).Select("password_hash", "email_verified_at").Updates(user).Error; err != nil {
+		return err
+	}
+	err := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	apiKeys := tx.Model(&models.APIKey{}).Select("id").Where("user_id = ?", user.ID)
+	if err := tx.Where("api_key_id IN (?)", apiKeys).Delete(&models.APIKeyUsage{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", user.ID).Delete(&models.APIKey{}).Error
+}
+
+// oauthRedirectURL is the callback URL registered with the provider.
+func oauthRedirectURL(cfg *config.Config, r *http.Request, provider string) string {
+	base := cfg.OAuthRedirectBaseURL
+	if base == "" {
+		base = requestBaseURL(r)
+	}
+	return strings.TrimSuffix(base, "/") + "/api/auth/" + provider + "/callback"
+}
+
+// requestBaseURL is the scheme and host the request was made to.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func oauthStateCookie(provider string) string {
+	return "oauth_state_" + provider
+}
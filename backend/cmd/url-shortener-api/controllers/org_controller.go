@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateOrganizationRequest names a new organization.
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+// OrganizationResponse is an organization along with the caller's role in it.
+type OrganizationResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddMemberRequest adds an existing user to an organization.
+type AddMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// MemberResponse is one member of an organization.
+type MemberResponse struct {
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateOrganization creates an organization with the caller as its owner.
+func CreateOrganization() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+
+		var req CreateOrganizationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 100 {
+			respondWithError(w, "Name must be between 1 and 100 characters", http.StatusBadRequest)
+			return
+		}
+
+		org := models.Organization{Name: req.Name}
+		err := db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&org).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.Membership{OrganizationID: org.ID, UserID: userID, Role: models.OrgRoleOwner}).Error
+		})
+		if err != nil {
+			log.Println("Error creating organization:", err)
+			respondWithError(w, "Error creating organization. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(OrganizationResponse{ID: org.ID, Name: org.Name, Role: models.OrgRoleOwner, CreatedAt: org.CreatedAt})
+	}
+}
+
+// ListOrganizations returns the organizations the caller belongs to.
+func ListOrganizations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+
+		var memberships []models.Membership
+		if err := db.DB.WithContext(r.Context()).Preload("Organization").Where("user_id = ?", userID).Order("organization_id").Find(&memberships).Error; err != nil {
+			log.Println("Error listing organizations:", err)
+			respondWithError(w, "Error listing organizations.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]OrganizationResponse, 0, len(memberships))
+		for _, membership := range memberships {
+			response = append(response, OrganizationResponse{
+				ID:        membership.Organization.ID,
+				Name:      membership.Organization.Name,
+				Role:      membership.Role,
+				CreatedAt: membership.Organization.CreatedAt,
+			})
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// ListMembers returns the members of an organization to any of its members.
+func ListMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleViewer)
+		if !ok {
+			return
+		}
+
+		var memberships []models.Membership
+		if err := db.DB.WithContext(r.Context()).Preload("User").Where("organization_id = ?", orgID).Order("id").Find(&memberships).Error; err != nil {
+			log.Println("Error listing members:", err)
+			respondWithError(w, "Error listing members.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]MemberResponse, 0, len(memberships))
+		for _, membership := range memberships {
+			response = append(response, newMemberResponse(membership))
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// AddMember adds an existing user to an organization. Only owners may add members.
+func AddMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleOwner)
+		if !ok {
+			return
+		}
+
+		var req AddMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !models.ValidOrgRole(req.Role) {
+			respondWithError(w, "role must be one of owner, editor or viewer", http.StatusBadRequest)
+			return
+		}
+
+		var user models.User
+		if err := db.DB.WithContext(r.Context()).Where("email = ?", strings.ToLower(strings.TrimSpace(req.Email))).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondWithError(w, "User not found.", http.StatusNotFound)
+				return
+			}
+			log.Println("Error retrieving user:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+
+		var existing int64
+		if err := db.DB.WithContext(r.Context()).Model(&models.Membership{}).Where("organization_id = ? AND user_id = ?", orgID, user.ID).Count(&existing).Error; err != nil {
+			log.Println("Error checking membership:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+		if existing > 0 {
+			respondWithError(w, "User is already a member", http.StatusConflict)
+			return
+		}
+
+		membership := models.Membership{OrganizationID: orgID, UserID: user.ID, User: user, Role: req.Role}
+		if err := db.DB.WithContext(r.Context()).Omit("User").Create(&membership).Error; err != nil {
+			log.Println("Error adding member:", err)
+			respondWithError(w, "Error adding member. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newMemberResponse(membership))
+	}
+}
+
+// SetMemberRole changes a member's role. Only owners may change roles, and
+// the last owner can't be demoted.
+func SetMemberRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleOwner)
+		if !ok {
+			return
+		}
+
+		var req SetRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !models.ValidOrgRole(req.Role) {
+			respondWithError(w, "role must be one of owner, editor or viewer", http.StatusBadRequest)
+			return
+		}
+
+		membership, ok := findMembership(w, r, orgID)
+		if !ok {
+			return
+		}
+
+		if membership.Role == models.OrgRoleOwner && req.Role != models.OrgRoleOwner && !hasOtherOwner(w, r, orgID, membership.UserID) {
+			return
+		}
+
+		if err := db.DB.WithContext(r.Context()).Model(&membership).Update("role", req.Role).Error; err != nil {
+			log.Println("Error updating member role:", err)
+			respondWithError(w, "Error updating role.", http.StatusInternalServerError)
+			return
+		}
+		membership.Role = req.Role
+
+		respondWithJSON(w, newMemberResponse(membership))
+	}
+}
+
+// RemoveMember removes a member from an organization. Owners may remove
+// anyone but the last owner; any member may remove themselves.
+func RemoveMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middlewares.UserID(r)
+		minRole := models.OrgRoleOwner
+		if mux.Vars(r)["userID"] == strconv.FormatUint(uint64(userID), 10) {
+			minRole = models.OrgRoleViewer
+		}
+
+		orgID, ok := requireOrgRole(w, r, minRole)
+		if !ok {
+			return
+		}
+
+		membership, ok := findMembership(w, r, orgID)
+		if !ok {
+			return
+		}
+
+		if membership.Role == models.OrgRoleOwner && !hasOtherOwner(w, r, orgID, membership.UserID) {
+			return
+		}
+
+		if err := db.DB.WithContext(r.Context()).Delete(&membership).Error; err != nil {
+			log.Println("Error removing member:", err)
+			respondWithError(w, "Error removing member. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// requireOrgRole checks the caller has at least role in the organization
+// named in the route, writing a 404 if not so organizations aren't revealed
+// to outsiders. Admins pass regardless of membership.
+func requireOrgRole(w http.ResponseWriter, r *http.Request, role string) (uint, bool) {
+	orgID, err := strconv.ParseUint(mux.Vars(r)["orgID"], 10, 64)
+	if err != nil {
+		respondWithError(w, "Organization not found.", http.StatusNotFound)
+		return 0, false
+	}
+
+	if middlewares.IsAdmin(r) {
+		var count int64
+		if err := db.DB.WithContext(r.Context()).Model(&models.Organization{}).Where("id = ?", orgID).Count(&count).Error; err != nil || count == 0 {
+			respondWithError(w, "Organization not found.", http.StatusNotFound)
+			return 0, false
+		}
+		return uint(orgID), true
+	}
+
+	userID, _ := middlewares.UserID(r)
+	have, err := orgRole(r.Context(), userID, uint(orgID))
+	if err != nil {
+		log.Println("Error retrieving membership:", err)
+		respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		return 0, false
+	}
+	if have == "" {
+		respondWithError(w, "Organization not found.", http.StatusNotFound)
+		return 0, false
+	}
+	if !models.OrgRoleAllows(have, role) {
+		respondWithError(w, "Your role in this organization doesn't allow that.", http.StatusForbidden)
+		return 0, false
+	}
+	return uint(orgID), true
+}
+
+// orgRole returns userID's role in orgID, or "" if they aren't a member.
+func orgRole(ctx context.Context, userID, orgID uint) (string, error) {
+	var membership models.Membership
+	err := db.DB.WithContext(ctx).Select("role").Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return membership.Role, err
+}
+
+// findMembership loads the membership of the user named in the route.
+func findMembership(w http.ResponseWriter, r *http.Request, orgID uint) (models.Membership, bool) {
+	var membership models.Membership
+	err := db.DB.WithContext(r.Context()).Preload("User").Where("organization_id = ? AND user_id = ?", orgID, mux.Vars(r)["userID"]).First(&membership).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondWithError(w, "Member not found.", http.StatusNotFound)
+		} else {
+			log.Println("Error retrieving membership:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		}
+		return membership, false
+	}
+	return membership, true
+}
+
+// hasOtherOwner checks the organization keeps an owner besides userID,
+// writing a 409 if it wouldn't.
+func hasOtherOwner(w http.ResponseWriter, r *http.Request, orgID, userID uint) bool {
+	var owners int64
+	err := db.DB.WithContext(r.Context()).Model(&models.Membership{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", orgID, models.OrgRoleOwner, userID).
+		Count(&owners).Error
+	if err != nil {
+		log.Println("Error counting owners:", err)
+		respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		return false
+	}
+	if owners == 0 {
+		respondWithError(w, "An organization must keep at least one owner", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+func newMemberResponse(membership models.Membership) MemberResponse {
+	return MemberResponse{
+		UserID:    membership.UserID,
+		Email:     membership.User.Email,
+		Role:      membership.Role,
+		CreatedAt: membership.CreatedAt,
+	}
+}
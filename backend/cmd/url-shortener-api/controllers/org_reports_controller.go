@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// OrgReportResponse is a monthly usage report available for download.
+type OrgReportResponse struct {
+	Month     string    `json:"month"` // YYYY-MM
+	Size      int       `json:"size"`  // of the PDF, in bytes
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListOrgReports lists the organization's monthly usage reports, newest
+// first. Any member may see them.
+func ListOrgReports() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleViewer)
+		if !ok {
+			return
+		}
+
+		var reports []struct {
+			Month     time.Time
+			Size      int
+			CreatedAt time.Time
+		}
+		err := db.DB.WithContext(r.Context()).Model(&models.OrgReport{}).
+			Select("month, LENGTH(pdf) AS size, created_at").
+			Where("organization_id = ?", orgID).
+			Order("month DESC").
+			Scan(&reports).Error
+		if err != nil {
+			log.Println("Error listing organization reports:", err)
+			respondWithError(w, "Error listing reports.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]OrgReportResponse, 0, len(reports))
+		for _, report := range reports {
+			response = append(response, OrgReportResponse{Month: report.Month.Format("2006-01"), Size: report.Size, CreatedAt: report.CreatedAt})
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// GetOrgReport downloads the organization's usage report for a month, as
+// a PDF. Any member may download it.
+func GetOrgReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID, ok := requireOrgRole(w, r, models.OrgRoleViewer)
+		if !ok {
+			return
+		}
+		month, err := time.Parse("2006-01", mux.Vars(r)["month"])
+		if err != nil {
+			respondWithError(w, "Report not found.", http.StatusNotFound)
+			return
+		}
+
+		var report models.OrgReport
+		if err := db.DB.WithContext(r.Context()).Where("organization_id = ? AND month = ?", orgID, month).First(&report).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondWithError(w, "Report not found.", http.StatusNotFound)
+			} else {
+				log.Println("Error retrieving organization report:", err)
+				respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="org-%d-%s.pdf"`, orgID, month.Format("2006-01")))
+		w.Header().Set("Content-Length", strconv.Itoa(len(report.PDF)))
+		w.Write(report.PDF)
+	}
+}
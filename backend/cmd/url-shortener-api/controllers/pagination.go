@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"url-shortener/store"
+)
+
+// Page size limits for list endpoints.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// nextCursorHeader carries the ?cursor= token for the next page of a list.
+// It's left out on the last page.
+const nextCursorHeader = "X-Next-Cursor"
+
+// page is the ?limit= and ?cursor= of a list request.
+type page struct {
+	Limit int
+	After *store.Cursor
+}
+
+// parsePage reads the page a list request asks for. It responds with 400
+// and returns false when the parameters are invalid.
+func parsePage(w http.ResponseWriter, r *http.Request) (page, bool) {
+	p := page{Limit: defaultListLimit}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxListLimit {
+			respondWithError(w, fmt.Sprintf("limit must be between 1 and %d", maxListLimit), http.StatusBadRequest)
+			return p, false
+		}
+		p.Limit = parsed
+	}
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err := store.DecodeCursor(token)
+		if err != nil {
+			respondWithError(w, "cursor is invalid", http.StatusBadRequest)
+			return p, false
+		}
+		p.After = &cursor
+	}
+	return p, true
+}
+
+// setNext points the client at the page after last, if this page was full
+// and so may not be the last one.
+func (p page) setNext(w http.ResponseWriter, count int, last store.Cursor) {
+	if count == p.Limit {
+		w.Header().Set(nextCursorHeader, store.EncodeCursor(last))
+	}
+}
@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/notifier"
+	"url-shortener/store"
+	"url-shortener/utils"
+)
+
+// Names of the built-in link creation stages, in the order they run.
+const (
+	StageNormalize = "normalize"
+	StageTier      = "tier"
+	StagePolicy    = "policy"
+	StageScan      = "scan"
+	StagePersist   = "persist"
+)
+
+// LinkCreation is the state passed through the creation pipeline. Stages
+// before persist may adjust Link; Status, Destination and Mapping are filled
+// in by the scan and persist stages. Destination is empty when Deferred.
+//
+// Replacing is the link a PUT or reconcile is replacing, or nil when a new
+// link is being made. Managed new links are stored without an owner, so a
+// reconcile can prune them.
+type LinkCreation struct {
+	Config      *config.Config
+	Request     *http.Request
+	Link        *ShortenURLRequest
+	Replacing   *models.UrlMapping
+	Managed     bool
+	Status      string
+	Destination utils.ResolvedURL // where Link.URL's redirects lead
+	Deferred    bool              // destination checks left to the validation workers
+	Mapping     *models.UrlMapping
+}
+
+// CreationStage is one named step of the creation pipeline. Returning an
+// error stops the pipeline; use RejectLink for errors the client should see.
+type CreationStage struct {
+	Name string
+	Run  func(c *LinkCreation) error
+}
+
+// CreationHook runs after a link has been stored, whether new or replacing
+// c.Replacing. Hooks can't fail the request; they should log their own
+// errors.
+type CreationHook func(c *LinkCreation)
+
+var creationStages = []CreationStage{
+	{Name: StageNormalize, Run: normalizeStage},
+	{Name: StageTier, Run: tierStage},
+	{Name: StagePolicy, Run: policyStage},
+	{Name: StageScan, Run: scanStage},
+	{Name: StagePersist, Run: persistStage},
+}
+
+var creationHooks []CreationHook
+
+// RegisterCreationStage inserts a custom stage directly after the stage
+// named after. It must be called before the server starts handling requests.
+func RegisterCreationStage(after string, stage CreationStage) error {
+	for i, existing := range creationStages {
+		if existing.Name == after {
+			creationStages = append(creationStages[:i+1], append([]CreationStage{stage}, creationStages[i+1:]...)...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no creation stage named %q", after)
+}
+
+// RegisterCreationHook adds a hook to run after every link is created or
+// replaced. It must be called before the server starts handling requests.
+func RegisterCreationHook(hook CreationHook) {
+	creationHooks = append(creationHooks, hook)
+}
+
+// RejectLink returns an error that stops the pipeline and is reported to the
+// client with the given status code and message.
+func RejectLink(status int, message string) error {
+	return &linkError{status: status, message: message}
+}
+
+// runCreationPipeline runs every stage in order and then the post-create hooks.
+func runCreationPipeline(c *LinkCreation) error {
+	for _, stage := range creationStages {
+		if err := stage.Run(c); err != nil {
+			return err
+		}
+	}
+	if c.Mapping == nil {
+		return errors.New("creation pipeline finished without storing the link")
+	}
+
+	for _, hook := range creationHooks {
+		hook(c)
+	}
+	return nil
+}
+
+func normalizeStage(c *LinkCreation) error {
+	c.Link.URL = strings.TrimSpace(c.Link.URL)
+	return nil
+}
+
+// tierStage applies the anonymous or authenticated tier's limits, giving
+// links without an expiry date the longest one the tier allows. Admins get
+// the authenticated tier even when signed in with the admin token, which
+// AdminTokenMiddleware recognizes.
+func tierStage(c *LinkCreation) error {
+	tier := c.Config.AnonymousTier
+	if _, ok := middlewares.UserID(c.Request); ok || middlewares.IsAdmin(c.Request) {
+		tier = c.Config.AuthenticatedTier
+	}
+
+	if c.Link.Alias != "" && !tier.CustomAliases {
+		return RejectLink(http.StatusForbidden, "Custom aliases require an account")
+	}
+	// Proxied links serve other sites' content from our origin
+	if c.Link.ProxyContent && !tier.ProxyContent {
+		return RejectLink(http.StatusForbidden, "Proxied links require an account")
+	}
+
+	if tier.MaxExpiry > 0 {
+		latest := time.Now().Add(tier.MaxExpiry)
+		if c.Link.IntendedExpiryDate == nil {
+			c.Link.IntendedExpiryDate = &latest
+		} else if c.Link.IntendedExpiryDate.After(latest) {
+			return RejectLink(http.StatusBadRequest, fmt.Sprintf("Expiry date can be at most %s from now", tier.MaxExpiry))
+		}
+	}
+	return nil
+}
+
+func policyStage(c *LinkCreation) error {
+	if c.Link.OrganizationID != nil {
+		userID, ok := middlewares.UserID(c.Request)
+		if !ok {
+			return RejectLink(http.StatusForbidden, "Organization links require an account")
+		}
+		if err := checkOrgAssignment(c.Request.Context(), userID, c.Link.OrganizationID); err != nil {
+			return err
+		}
+	}
+
+	if c.Link.Alias != "" {
+		if err := utils.ValidateAlias(c.Link.Alias); err != nil {
+			return RejectLink(http.StatusBadRequest, err.Error())
+		}
+	}
+	if err := validateLinkRequest(c.Config, c.Link); err != nil {
+		return RejectLink(http.StatusBadRequest, err.Error())
+	}
+
+	var owner *uint
+	if userID, ok := middlewares.UserID(c.Request); ok {
+		owner = &userID
+	}
+	return checkLinkDomain(c.Config, c.Link.Domain, owner, middlewares.IsAdmin(c.Request))
+}
+
+// scanStage works out the link's starting status by checking its
+// destination. With async validation on and room in the queue, the checks
+// are left to the validation workers instead and the link starts pending.
+func scanStage(c *LinkCreation) error {
+	if c.Config.AsyncValidation && validationQueueHasRoom() {
+		c.Status = "pending"
+		c.Deferred = true
+		return nil
+	}
+
+	status, destination, err := checkDestination(c.Request.Context(), c.Config, c.Link, requesterOf(c.Request))
+	if err != nil {
+		var linkErr *linkError
+		if errors.As(err, &linkErr) {
+			return err
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return RejectLink(http.StatusServiceUnavailable, "Checking the URL took too long. Please try again.")
+		}
+		log.Println("Error checking URL status:", err)
+		return RejectLink(http.StatusInternalServerError, "Error checking URL status. Please try again.")
+	}
+	c.Status = status
+	c.Destination = destination
+	return nil
+}
+
+// requester identifies who submitted a link, for the malicious log.
+type requester struct {
+	UserAgent string
+	IPAddress string
+}
+
+func requesterOf(r *http.Request) requester {
+	userAgent := r.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	return requester{UserAgent: userAgent, IPAddress: utils.ClientIP(r)}
+}
+
+// checkDestination follows link's redirects to work out its starting
+// status, then scores both the submitted and final URLs for phishing and
+// checks them with the configured URL scanners. A *linkError means the link
+// must be rejected.
+func checkDestination(ctx context.Context, cfg *config.Config, link *ShortenURLRequest, from requester) (string, utils.ResolvedURL, error) {
+	status, destination, err := initialLinkStatus(ctx, cfg, link)
+	if err != nil {
+		return "", destination, err
+	}
+
+	checked := []string{link.URL}
+	if destination.FinalURL != link.URL {
+		checked = append(checked, destination.FinalURL)
+	}
+
+	features := config.CurrentFeatures()
+	for _, inputURL := range checked {
+		risk := utils.ScorePhishingRisk(inputURL)
+		blocked := features.PhishingBlockScore > 0 && risk.Score >= features.PhishingBlockScore
+		flagged := features.PhishingFlagScore > 0 && risk.Score >= features.PhishingFlagScore
+		if blocked || flagged {
+			logMaliciousURL(ctx, from, link.URL, risk.Score, fmt.Sprintf("Phishing heuristics for %s: %s", inputURL, strings.Join(risk.Reasons, "; ")))
+		}
+		if blocked {
+			return "", destination, RejectLink(http.StatusBadRequest, "This URL looks like phishing and can't be shortened")
+		}
+		if flagged {
+			status = "flagged"
+		}
+	}
+
+	for _, inputURL := range checked {
+		verdict, err := utils.ScanURL(ctx, *cfg, inputURL)
+		if err != nil {
+			if !errors.Is(err, utils.ErrNoURLScanners) {
+				// Don't hold up shortening while the scanners are unreachable
+				log.Println("Error scanning URL:", err)
+			}
+			continue
+		}
+		if !verdict.IsSafe {
+			logMaliciousURL(ctx, from, link.URL, verdict.RiskScore, verdict.Message)
+			if features.SafeBrowsingAction == "reject" {
+				return "", destination, RejectLink(http.StatusBadRequest, "This URL has been flagged as unsafe")
+			}
+			return "flagged", destination, nil
+		}
+	}
+	return status, destination, nil
+}
+
+// logMaliciousURL records an unsafe URL someone tried to shorten and alerts
+// operators about it.
+func logMaliciousURL(ctx context.Context, from requester, inputURL string, riskScore int, details string) {
+	entry := models.MaliciousLog{
+		URL:       inputURL,
+		UserAgent: from.UserAgent,
+		IPAddress: from.IPAddress,
+		RiskScore: riskScore,
+		Details:   details,
+	}
+	if err := db.DB.WithContext(ctx).Create(&entry).Error; err != nil {
+		log.Println("Error writing malicious log:", err)
+	}
+	notifier.MaliciousDetected(inputURL, riskScore, details)
+}
+
+func persistStage(c *LinkCreation) error {
+	if c.Replacing != nil {
+		return replaceLink(c)
+	}
+
+	shortCode := c.Link.Alias
+	if shortCode == "" {
+		shortCode = generateShortCode()
+	} else {
+		// Deleted links count, since they may still be restored
+		taken, err := store.Links.Taken(c.Request.Context(), shortCode)
+		if err != nil {
+			log.Println("Error checking alias:", err)
+			return RejectLink(http.StatusInternalServerError, "Error creating shortened URL. Please try again.")
+		}
+		if taken {
+			return RejectLink(http.StatusConflict, "Alias is already taken")
+		}
+	}
+
+	urlMapping := models.UrlMapping{ShortCode: shortCode}
+	applyLinkRequest(&urlMapping, c.Link, c.Status, c.Destination)
+	urlMapping.PendingValidation = c.Deferred
+	urlMapping.Managed = c.Managed
+	if userID, ok := middlewares.UserID(c.Request); ok && !c.Managed {
+		urlMapping.OwnerID = &userID
+	}
+
+	if err := store.Links.Create(c.Request.Context(), &urlMapping); err != nil {
+		log.Println("Error saving URL mapping:", err)
+		return RejectLink(http.StatusInternalServerError, "Error creating shortened URL. Please try again.")
+	}
+	c.Mapping = &urlMapping
+	if c.Deferred {
+		enqueueValidation(validationTask{ShortCode: shortCode, From: requesterOf(c.Request)})
+	}
+	return nil
+}
+
+// replaceLink stores c.Link over the link being replaced, which keeps its
+// owner. A disabled or flagged link stays that way unless an admin replaces
+// it, so editing a link can't undo moderation.
+func replaceLink(c *LinkCreation) error {
+	urlMapping := *c.Replacing
+	applyLinkRequest(&urlMapping, c.Link, c.Status, c.Destination)
+	urlMapping.PendingValidation = c.Deferred
+	if middlewares.IsAdmin(c.Request) {
+		urlMapping.DisabledByReports = false
+	} else {
+		urlMapping.Status = keepModeration(c.Replacing.Status, urlMapping.Status)
+	}
+	urlMapping.Managed = urlMapping.OwnerID == nil
+
+	if err := store.Links.Update(c.Request.Context(), &urlMapping); err != nil {
+		log.Println("Error saving URL mapping:", err)
+		return RejectLink(http.StatusInternalServerError, "Error saving link. Please try again.")
+	}
+	c.Mapping = &urlMapping
+	if c.Deferred {
+		enqueueValidation(validationTask{ShortCode: urlMapping.ShortCode, From: requesterOf(c.Request)})
+	}
+	return nil
+}
+
+// keepModeration returns the status a link checked as status should have
+// when it was previous before: disabled links stay disabled, and flagged
+// ones stay flagged unless the check rejects them outright.
+func keepModeration(previous, status string) string {
+	switch {
+	case previous == "disabled":
+		return previous
+	case previous == "flagged" && status != "rejected":
+		return previous
+	}
+	return status
+}
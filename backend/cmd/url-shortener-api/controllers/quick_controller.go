@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"url-shortener/config"
+	"url-shortener/templates"
+)
+
+// QuickShorten shortens ?url= (with ?alias= as its short code, if given)
+// for bookmarklets and shell one-liners, answering with just the short URL
+// as plain text or, with ?format=html or an Accept header preferring HTML,
+// a tiny page with it selected for copying.
+func QuickShorten(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format == "" {
+			format = "text"
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				format = "html"
+			}
+		}
+		if format != "text" && format != "html" {
+			http.Error(w, "format must be text or html", http.StatusBadRequest)
+			return
+		}
+		respond := func(status int, data templates.QuickData) {
+			if format == "text" {
+				if data.Error != "" {
+					http.Error(w, data.Error, status)
+					return
+				}
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Write([]byte(data.ShortURL + "\n"))
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(status)
+			if err := templates.RenderQuick(w, data); err != nil {
+				log.Println("Error rendering quick shorten page:", err)
+			}
+		}
+
+		longURL := query.Get("url")
+		if longURL == "" {
+			respond(http.StatusBadRequest, templates.QuickData{Error: "url is required"})
+			return
+		}
+
+		creation := &LinkCreation{Config: cfg, Request: r, Link: &ShortenURLRequest{URL: longURL, Alias: query.Get("alias")}}
+		if err := runCreationPipeline(creation); err != nil {
+			var linkErr *linkError
+			if errors.As(err, &linkErr) {
+				respond(linkErr.status, templates.QuickData{Destination: longURL, Error: linkErr.message})
+				return
+			}
+			log.Println("Error creating link:", err)
+			respond(http.StatusInternalServerError, templates.QuickData{Destination: longURL, Error: "Error creating shortened URL. Please try again."})
+			return
+		}
+		respond(http.StatusOK, templates.QuickData{
+			ShortURL:    constructShortURL(r, *creation.Mapping),
+			Destination: creation.Mapping.OriginalUrl,
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/middlewares"
+	"url-shortener/utils"
+)
+
+const (
+	slackSignatureHeader = "X-Slack-Signature"
+	slackTimestampHeader = "X-Slack-Request-Timestamp"
+
+	// slackMaxSkew is how old, or far in the future, a signed request may
+	// be, so captured requests can't be replayed later.
+	slackMaxSkew = 5 * time.Minute
+
+	// slackReplyWithin is how long a slash command waits for its link
+	// before answering and sending it to the response URL instead; Slack
+	// gives up on commands that take 3 seconds.
+	slackReplyWithin = 2500 * time.Millisecond
+)
+
+const slackUsage = "Usage: `/shorten <url>` posts a short link to the channel."
+
+// SlackMessage is a slash command reply, sent either as the response or to
+// the command's response URL.
+type SlackMessage struct {
+	ResponseType    string       `json:"response_type"` // in_channel or ephemeral
+	Text            string       `json:"text"`
+	Blocks          []slackBlock `json:"blocks,omitempty"`
+	UnfurlLinks     bool         `json:"unfurl_links,omitempty"`
+	ReplaceOriginal bool         `json:"replace_original,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+var slackClient = &http.Client{Timeout: 10 * time.Second, Transport: utils.OutboundTransport}
+
+// SlackCommand handles the /shorten slash command, posting the new short
+// link to the channel with a preview of its destination. Requests must be
+// signed with the app's signing secret. Links are made anonymously, under
+// the anonymous tier's limits, with its shortening rate applied to each
+// Slack user rather than to Slack's servers. A link that takes too long to
+// check is posted to the command's response URL once it's ready.
+func SlackCommand(cfg *config.Config) http.HandlerFunc {
+	perUser := middlewares.NewCallerRateLimit(cfg.AnonymousTier.ShortenPerMinute)
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if !validSlackSignature(cfg.SlackSigningSecret, r.Header, body, time.Now()) {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		words := strings.Fields(form.Get("text"))
+		if len(words) != 1 || words[0] == "help" {
+			respondWithJSON(w, slackEphemeral(slackUsage))
+			return
+		}
+		longURL := slackURL(words[0])
+		if ok, retryAfter := perUser.Take(form.Get("team_id")+"/"+form.Get("user_id"), "shorten_tier"); !ok {
+			respondWithJSON(w, slackEphemeral(fmt.Sprintf(":hourglass: You're shortening links too quickly. Try again in %s.", retryAfter)))
+			return
+		}
+
+		// The reply may outlive this request, so the link is made without it
+		replies := make(chan SlackMessage, 1)
+		background := r.Clone(context.WithoutCancel(r.Context()))
+		go func() {
+			replies <- shortenForSlack(cfg, background, longURL, form.Get("user_id"))
+		}()
+
+		select {
+		case reply := <-replies:
+			respondWithJSON(w, reply)
+		case <-time.After(slackReplyWithin):
+			respondWithJSON(w, slackEphemeral(fmt.Sprintf("Shortening %s…", longURL)))
+			responseURL := form.Get("response_url")
+			go func() {
+				reply := <-replies
+				reply.ReplaceOriginal = true
+				if err := postSlackReply(responseURL, reply); err != nil {
+					log.Println("Error sending Slack reply:", err)
+				}
+			}()
+		}
+	}
+}
+
+// shortenForSlack creates the link and describes it, or why it couldn't be
+// made, for Slack.
+func shortenForSlack(cfg *config.Config, r *http.Request, longURL, userID string) SlackMessage {
+	creation := &LinkCreation{Config: cfg, Request: r, Link: &ShortenURLRequest{URL: longURL}}
+	if err := runCreationPipeline(creation); err != nil {
+		var linkErr *linkError
+		if errors.As(err, &linkErr) {
+			return slackEphemeral(fmt.Sprintf(":warning: Couldn't shorten %s: %s", longURL, linkErr.message))
+		}
+		log.Println("Error creating link:", err)
+		return slackEphemeral(":warning: Error creating shortened URL. Please try again.")
+	}
+
+	urlMapping := creation.Mapping
+	shortURL := constructShortURL(r, *urlMapping)
+	footer := fmt.Sprintf("Status: %s", urlMapping.Status)
+	if userID != "" {
+		footer = fmt.Sprintf("Shortened by <@%s> · %s", userID, footer)
+	}
+	// Slack unfurls the short link by following it, which previews the
+	// destination page
+	return SlackMessage{
+		ResponseType: "in_channel",
+		Text:         fmt.Sprintf("%s → %s", shortURL, urlMapping.OriginalUrl),
+		Blocks: []slackBlock{
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf("*<%s>*\n%s", shortURL, urlMapping.OriginalUrl)}},
+			{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: footer}}},
+		},
+		UnfurlLinks: true,
+	}
+}
+
+// validSlackSignature checks a request's signature, the hex HMAC-SHA256 of
+// "v0:", its timestamp, ":" and the body, against the signing secret.
+func validSlackSignature(secret string, header http.Header, body []byte, now time.Time) bool {
+	timestamp := header.Get(slackTimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > slackMaxSkew || skew < -slackMaxSkew {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get(slackSignatureHeader)))
+}
+
+// slackURL unwraps a URL Slack has formatted as <url> or <url|label>.
+func slackURL(text string) string {
+	if strings.HasPrefix(text, "<") && strings.HasSuffix(text, ">") {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "<"), ">")
+		text, _, _ = strings.Cut(text, "|")
+	}
+	return text
+}
+
+func slackEphemeral(text string) SlackMessage {
+	return SlackMessage{ResponseType: "ephemeral", Text: text}
+}
+
+// postSlackReply sends reply to a slash command's response URL, which must
+// be on slack.com so the command can't be used to make arbitrary requests.
+func postSlackReply(responseURL string, reply SlackMessage) error {
+	parsed, err := url.Parse(responseURL)
+	if err != nil || parsed.Scheme != "https" || (parsed.Hostname() != "slack.com" && !strings.HasSuffix(parsed.Hostname(), ".slack.com")) {
+		return fmt.Errorf("response URL %q is not a Slack URL", responseURL)
+	}
+
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	resp, err := slackClient.Post(responseURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack returned status %d", resp.StatusCode)
+	}
+	return nil
+}
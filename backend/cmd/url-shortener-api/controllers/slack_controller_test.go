@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+)
+
+const testSlackSecret = "slack-secret"
+
+// signSlack sets the headers Slack signs body with at timestamp.
+func signSlack(header http.Header, secret string, body string, timestamp time.Time) {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":" + body))
+	header.Set(slackTimestampHeader, ts)
+	header.Set(slackSignatureHeader, "v0="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestValidSlackSignature(t *testing.T) {
+	const body = "command=%2Fshorten&text=https%3A%2F%2Fexample.com"
+	now := time.Now()
+	tests := []struct {
+		name   string
+		header func(h http.Header)
+		want   bool
+	}{
+		{name: "valid", header: func(h http.Header) { signSlack(h, testSlackSecret, body, now) }, want: true},
+		{name: "slightly skewed", header: func(h http.Header) { signSlack(h, testSlackSecret, body, now.Add(-4*time.Minute)) }, want: true},
+		{name: "wrong secret", header: func(h http.Header) { signSlack(h, "other-secret", body, now) }},
+		{name: "other body", header: func(h http.Header) { signSlack(h, testSlackSecret, body+"&x=1", now) }},
+		{
+			name: "tampered MAC",
+			header: func(h http.Header) {
+				signSlack(h, testSlackSecret, body, now)
+				h.Set(slackSignatureHeader, strings.Replace(h.Get(slackSignatureHeader), "v0=", "v1=", 1))
+			},
+		},
+		{name: "too old", header: func(h http.Header) { signSlack(h, testSlackSecret, body, now.Add(-6*time.Minute)) }},
+		{name: "in the future", header: func(h http.Header) { signSlack(h, testSlackSecret, body, now.Add(6*time.Minute)) }},
+		{
+			name: "no signature",
+			header: func(h http.Header) {
+				signSlack(h, testSlackSecret, body, now)
+				h.Del(slackSignatureHeader)
+			},
+		},
+		{
+			name: "no timestamp",
+			header: func(h http.Header) {
+				signSlack(h, testSlackSecret, body, now)
+				h.Del(slackTimestampHeader)
+			},
+		},
+		{
+			name: "timestamp not a number",
+			header: func(h http.Header) {
+				signSlack(h, testSlackSecret, body, now)
+				h.Set(slackTimestampHeader, "yesterday")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			tt.header(header)
+			if got := validSlackSignature(testSlackSecret, header, []byte(body), now); got != tt.want {
+				t.Errorf("validSlackSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlackCommandLimitsEachUser(t *testing.T) {
+	setupLinks(t)
+	validationQueue = make(chan validationTask, 10)
+	t.Cleanup(func() { validationQueue = nil })
+
+	// Async validation keeps the handler from fetching the destination
+	cfg := config.Config{
+		AsyncValidation:    true,
+		SlackSigningSecret: testSlackSecret,
+		AnonymousTier:      config.Tier{ShortenPerMinute: 1},
+	}
+	handler := SlackCommand(&cfg)
+	command := func(teamID, userID string) SlackMessage {
+		t.Helper()
+		body := url.Values{
+			"team_id": {teamID},
+			"user_id": {userID},
+			"text":    {"https://example.com/page"},
+		}.Encode()
+		r := httptest.NewRequest(http.MethodPost, "/integrations/slack", strings.NewReader(body))
+		signSlack(r.Header, testSlackSecret, body, time.Now())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var reply SlackMessage
+		if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	if reply := command("T1", "U1"); reply.ResponseType != "in_channel" {
+		t.Fatalf("first command got %q, want a link", reply.Text)
+	}
+	if reply := command("T1", "U1"); !strings.Contains(reply.Text, "too quickly") {
+		t.Errorf("second command from the same user got %q, want it throttled", reply.Text)
+	}
+	// Everyone's commands come from Slack's servers, but other users, and
+	// the same user ID in another workspace, have limits of their own
+	if reply := command("T1", "U2"); reply.ResponseType != "in_channel" {
+		t.Errorf("command from another user got %q, want a link", reply.Text)
+	}
+	if reply := command("T2", "U1"); reply.ResponseType != "in_channel" {
+		t.Errorf("command from another workspace got %q, want a link", reply.Text)
+	}
+}
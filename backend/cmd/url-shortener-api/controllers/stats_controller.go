@@ -0,0 +1,537 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"url-shortener/analytics"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/store"
+
+	"gorm.io/gorm"
+)
+
+// maxBreakdownRows caps the number of groups returned by breakdown reports.
+const maxBreakdownRows = 100
+
+// summaryListSize is how many links the dashboard summary lists in each section.
+const summaryListSize = 10
+
+// maxTimeSeriesBuckets caps how many points a single time-series request may produce.
+const maxTimeSeriesBuckets = 1000
+
+// defaultStatsWindow is the range used when a stats request gives no "from".
+const defaultStatsWindow = 30 * 24 * time.Hour
+
+// ReferrerStat is the click count for one referring domain.
+type ReferrerStat struct {
+	Referrer string `json:"referrer"` // empty for direct traffic
+	Clicks   int64  `json:"clicks"`
+}
+
+// UTMStat is the click count for one combination of inbound UTM parameters.
+type UTMStat struct {
+	Source   string `json:"utm_source"`
+	Medium   string `json:"utm_medium"`
+	Campaign string `json:"utm_campaign"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// CountStat is the click count for one named group.
+type CountStat struct {
+	Name   string `json:"name"`
+	Clicks int64  `json:"clicks"`
+}
+
+// DeviceStats breaks a link's clicks down by browser, OS and device class.
+type DeviceStats struct {
+	Browsers         []CountStat `json:"browsers"`
+	OperatingSystems []CountStat `json:"operating_systems"`
+	DeviceClasses    []CountStat `json:"device_classes"`
+}
+
+// LinkSummary is the short form of a link used in dashboard listings.
+type LinkSummary struct {
+	ShortCode string    `json:"short_code"`
+	ShortURL  string    `json:"short_url"`
+	URL       string    `json:"url"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LinkClicks is a link with its total click count.
+type LinkClicks struct {
+	LinkSummary
+	Clicks int64 `json:"clicks"`
+}
+
+// SummaryResponse is the overview shown on the dashboard homepage.
+type SummaryResponse struct {
+	TotalLinks     int64         `json:"total_links"`
+	ClicksToday    int64         `json:"clicks_today"`
+	ClicksThisWeek int64         `json:"clicks_this_week"`
+	TopLinks       []LinkClicks  `json:"top_links"`
+	RecentLinks    []LinkSummary `json:"recent_links"`
+}
+
+// TimeSeriesPoint is the click count for one bucket, keyed by the bucket's start.
+type TimeSeriesPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Clicks int64     `json:"clicks"`
+}
+
+// TimeSeriesResponse is a bucketed click history for charting.
+type TimeSeriesResponse struct {
+	Interval string            `json:"interval"`
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Points   []TimeSeriesPoint `json:"points"`
+}
+
+// GetReferrerStats aggregates a link's clicks by referring domain.
+func GetReferrerStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+
+		stats := []ReferrerStat{}
+		err := clickHistory(r.Context(), urlMapping.ID, includeBots(r), "referrer_host").
+			Select("referrer_host AS referrer, CAST(SUM(clicks) AS bigint) AS clicks").
+			Group("referrer_host").
+			Order("clicks DESC").
+			Limit(maxBreakdownRows).
+			Scan(&stats).Error
+		if err != nil {
+			log.Println("Error aggregating referrers:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithJSON(w, stats)
+	}
+}
+
+// GetUTMStats aggregates a link's clicks by inbound utm_source, utm_medium and utm_campaign.
+func GetUTMStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+
+		stats := []UTMStat{}
+		err := clickHistory(r.Context(), urlMapping.ID, includeBots(r), "utm_source, utm_medium, utm_campaign").
+			Select("utm_source AS source, utm_medium AS medium, utm_campaign AS campaign, CAST(SUM(clicks) AS bigint) AS clicks").
+			Group("utm_source, utm_medium, utm_campaign").
+			Order("clicks DESC").
+			Limit(maxBreakdownRows).
+			Scan(&stats).Error
+		if err != nil {
+			log.Println("Error aggregating UTM parameters:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithJSON(w, stats)
+	}
+}
+
+// GetDeviceStats parses the User-Agents of a link's clicks and aggregates
+// them by browser, operating system and device class.
+func GetDeviceStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+
+		// Parse each distinct User-Agent once rather than every click
+		var rows []struct {
+			UserAgent string
+			Clicks    int64
+		}
+		err := excludeBots(db.Replica.WithContext(r.Context()).Model(&models.ClickEvent{}), includeBots(r)).
+			Select("user_agent, COUNT(*) AS clicks").
+			Where("url_mapping_id = ?", urlMapping.ID).
+			Group("user_agent").
+			Scan(&rows).Error
+		if err != nil {
+			log.Println("Error aggregating user agents:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		// Rolled-up clicks were parsed when they were aggregated
+		var rollups []struct {
+			Browser     string
+			OS          string
+			DeviceClass string
+			Clicks      int64
+		}
+		err = excludeBots(db.Replica.WithContext(r.Context()).Model(&models.ClickRollup{}), includeBots(r)).
+			Select("browser, os, device_class, CAST(SUM(clicks) AS bigint) AS clicks").
+			Where("url_mapping_id = ?", urlMapping.ID).
+			Group("browser, os, device_class").
+			Scan(&rollups).Error
+		if err != nil {
+			log.Println("Error aggregating device rollups:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		browsers := make(map[string]int64)
+		operatingSystems := make(map[string]int64)
+		deviceClasses := make(map[string]int64)
+		for _, row := range rows {
+			device := analytics.ParseDevice(row.UserAgent)
+			browsers[device.Browser] += row.Clicks
+			operatingSystems[device.OS] += row.Clicks
+			deviceClasses[device.DeviceClass] += row.Clicks
+		}
+		for _, row := range rollups {
+			browsers[row.Browser] += row.Clicks
+			operatingSystems[row.OS] += row.Clicks
+			deviceClasses[row.DeviceClass] += row.Clicks
+		}
+
+		respondWithJSON(w, DeviceStats{
+			Browsers:         sortedCounts(browsers),
+			OperatingSystems: sortedCounts(operatingSystems),
+			DeviceClasses:    sortedCounts(deviceClasses),
+		})
+	}
+}
+
+// clickHistory returns a query, run with ctx, over all of a link's clicks,
+// or every link's when urlMappingID is zero, combining raw click events with
+// the daily rollups of older ones. Each row carries created_at,
+// url_mapping_id, the requested columns and a "clicks" count to SUM. Rolled-up
+// clicks are dated at midnight UTC, so hourly series show them in the day's
+// first hour. Postgres sums bigints as numeric, so totals are cast back.
+func clickHistory(ctx context.Context, urlMappingID uint, withBots bool, columns ...string) *gorm.DB {
+	selected := "created_at, url_mapping_id"
+	rolledUp := "day AS created_at, url_mapping_id"
+	for _, column := range columns {
+		selected += ", " + column
+		rolledUp += ", " + column
+	}
+
+	raw := excludeBots(db.Replica.Model(&models.ClickEvent{}), withBots).
+		Select(selected + ", 1 AS clicks")
+	rollups := excludeBots(db.Replica.Model(&models.ClickRollup{}), withBots).
+		Select(rolledUp + ", clicks")
+	if urlMappingID != 0 {
+		raw = raw.Where("url_mapping_id = ?", urlMappingID)
+		rollups = rollups.Where("url_mapping_id = ?", urlMappingID)
+	}
+	return db.Replica.WithContext(ctx).Table("(? UNION ALL ?) AS history", raw, rollups)
+}
+
+// listedLinks limits query, over url_mappings, to the links r's caller can
+// list: their own and their organizations', or every link for admins.
+func listedLinks(r *http.Request, query *gorm.DB) *gorm.DB {
+	if middlewares.IsAdmin(r) {
+		return query
+	}
+	userID, _ := middlewares.UserID(r)
+	memberOf := db.Replica.Model(&models.Membership{}).Select("organization_id").Where("user_id = ?", userID)
+	return query.Where("owner_id = ? OR organization_id IN (?)", userID, memberOf)
+}
+
+// includeBots reports whether a stats request asked for bot clicks to be
+// counted with "include_bots=true".
+func includeBots(r *http.Request) bool {
+	return r.URL.Query().Get("include_bots") == "true"
+}
+
+// excludeBots filters bot clicks out of query unless withBots is set.
+func excludeBots(query *gorm.DB, withBots bool) *gorm.DB {
+	if withBots {
+		return query
+	}
+	return query.Where("is_bot = ?", false)
+}
+
+// sortedCounts turns a name->count map into a list ordered by count, largest first.
+func sortedCounts(counts map[string]int64) []CountStat {
+	stats := make([]CountStat, 0, len(counts))
+	for name, clicks := range counts {
+		stats = append(stats, CountStat{Name: name, Clicks: clicks})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clicks != stats[j].Clicks {
+			return stats[i].Clicks > stats[j].Clicks
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	if len(stats) > maxBreakdownRows {
+		stats = stats[:maxBreakdownRows]
+	}
+	return stats
+}
+
+// GetTimeSeriesStats returns a link's clicks bucketed by hour, day or week
+// between "from" and "to", with empty buckets filled in as zero.
+func GetTimeSeriesStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+
+		interval := r.URL.Query().Get("interval")
+		if interval == "" {
+			interval = "day"
+		}
+		if interval != "hour" && interval != "day" && interval != "week" {
+			respondWithError(w, "interval must be one of hour, day or week", http.StatusBadRequest)
+			return
+		}
+
+		from, to, err := parseTimeRange(r)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		buckets := timeBuckets(interval, from, to)
+		if len(buckets) > maxTimeSeriesBuckets {
+			respondWithError(w, fmt.Sprintf("Range too large for interval %s (max %d buckets)", interval, maxTimeSeriesBuckets), http.StatusBadRequest)
+			return
+		}
+
+		var rows []struct {
+			Bucket int64 // Unix seconds
+			Clicks int64
+		}
+		err = clickHistory(r.Context(), urlMapping.ID, includeBots(r)).
+			Select(store.BucketStartExpr(db.Replica, interval)+" AS bucket, CAST(SUM(clicks) AS bigint) AS clicks").
+			Where("created_at >= ? AND created_at < ?", from, to).
+			Group("bucket").
+			Scan(&rows).Error
+		if err != nil {
+			log.Println("Error aggregating time series:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		counts := make(map[int64]int64, len(rows))
+		for _, row := range rows {
+			counts[row.Bucket] = row.Clicks
+		}
+
+		points := make([]TimeSeriesPoint, 0, len(buckets))
+		for _, bucket := range buckets {
+			points = append(points, TimeSeriesPoint{Bucket: bucket, Clicks: counts[bucket.Unix()]})
+		}
+
+		respondWithJSON(w, TimeSeriesResponse{
+			Interval: interval,
+			From:     from,
+			To:       to,
+			Points:   points,
+		})
+	}
+}
+
+// GetSummaryStats returns the totals, top links and recent links shown on
+// the dashboard homepage, over the links the caller can list, or every link
+// for admins. Days and weeks are in UTC; weeks start on Monday.
+func GetSummaryStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC()
+		today := truncateTime("day", now)
+		thisWeek := truncateTime("week", now)
+		withBots := includeBots(r)
+
+		links := func() *gorm.DB {
+			return listedLinks(r, db.Replica.WithContext(r.Context()).Model(&models.UrlMapping{}))
+		}
+		clicks := func() *gorm.DB {
+			history := clickHistory(r.Context(), 0, withBots)
+			if !middlewares.IsAdmin(r) {
+				history = history.Where("url_mapping_id IN (?)", links().Select("id"))
+			}
+			return history
+		}
+
+		response := SummaryResponse{
+			TopLinks:    []LinkClicks{},
+			RecentLinks: []LinkSummary{},
+		}
+
+		if err := links().Count(&response.TotalLinks).Error; err != nil {
+			log.Println("Error counting links:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		var totals struct {
+			Today    int64
+			ThisWeek int64
+		}
+		err := clicks().
+			Select("CAST(COALESCE(SUM(clicks) FILTER (WHERE created_at >= ?), 0) AS bigint) AS today, "+
+				"CAST(COALESCE(SUM(clicks), 0) AS bigint) AS this_week", today).
+			Where("created_at >= ?", thisWeek).
+			Scan(&totals).Error
+		if err != nil {
+			log.Println("Error summing recent clicks:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+		response.ClicksToday = totals.Today
+		response.ClicksThisWeek = totals.ThisWeek
+
+		var top []struct {
+			UrlMappingID uint
+			Clicks       int64
+		}
+		err = clicks().
+			Select("url_mapping_id, CAST(SUM(clicks) AS bigint) AS clicks").
+			Group("url_mapping_id").
+			Order("clicks DESC").
+			Limit(summaryListSize).
+			Scan(&top).Error
+		if err != nil {
+			log.Println("Error ranking links:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]uint, 0, len(top))
+		for _, row := range top {
+			ids = append(ids, row.UrlMappingID)
+		}
+		var topMappings []models.UrlMapping
+		if len(ids) > 0 {
+			topMappings, err = store.Links.List(r.Context(), store.ListOptions{IDs: ids})
+			if err != nil {
+				log.Println("Error loading top links:", err)
+				respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+				return
+			}
+		}
+		mappingsByID := make(map[uint]models.UrlMapping, len(topMappings))
+		for _, urlMapping := range topMappings {
+			mappingsByID[urlMapping.ID] = urlMapping
+		}
+		for _, row := range top {
+			urlMapping, ok := mappingsByID[row.UrlMappingID]
+			if !ok {
+				continue
+			}
+			response.TopLinks = append(response.TopLinks, LinkClicks{
+				LinkSummary: newLinkSummary(r, urlMapping),
+				Clicks:      row.Clicks,
+			})
+		}
+
+		opts := store.ListOptions{Limit: summaryListSize}
+		if !middlewares.IsAdmin(r) {
+			userID, _ := middlewares.UserID(r)
+			opts.VisibleTo = &userID
+		}
+		recent, err := store.Links.List(r.Context(), opts)
+		if err != nil {
+			log.Println("Error loading recent links:", err)
+			respondWithError(w, "Error loading stats.", http.StatusInternalServerError)
+			return
+		}
+		for _, urlMapping := range recent {
+			response.RecentLinks = append(response.RecentLinks, newLinkSummary(r, urlMapping))
+		}
+
+		respondWithJSON(w, response)
+	}
+}
+
+func newLinkSummary(r *http.Request, urlMapping models.UrlMapping) LinkSummary {
+	return LinkSummary{
+		ShortCode: urlMapping.ShortCode,
+		ShortURL:  constructShortURL(r, urlMapping),
+		URL:       urlMapping.OriginalUrl,
+		Status:    urlMapping.Status,
+		CreatedAt: urlMapping.CreatedAt,
+	}
+}
+
+// parseTimeRange reads the "from" and "to" query parameters (RFC 3339 or
+// YYYY-MM-DD, in UTC). "to" defaults to now and "from" to 30 days before it.
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := parseTimeParam(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %v", err)
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultStatsWindow)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := parseTimeParam(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %v", err)
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// timeBuckets lists the start of every bucket overlapping [from, to),
+// truncated the same way as Postgres' date_trunc.
+func timeBuckets(interval string, from, to time.Time) []time.Time {
+	var buckets []time.Time
+	for bucket := truncateTime(interval, from); bucket.Before(to); bucket = nextBucket(interval, bucket) {
+		buckets = append(buckets, bucket)
+		if len(buckets) > maxTimeSeriesBuckets {
+			break
+		}
+	}
+	return buckets
+}
+
+func truncateTime(interval string, t time.Time) time.Time {
+	t = t.UTC()
+	switch interval {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		// date_trunc('week') starts weeks on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func nextBucket(interval string, t time.Time) time.Time {
+	switch interval {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"url-shortener/analytics"
+)
+
+// streamHeartbeatInterval keeps idle click streams from being closed by proxies.
+const streamHeartbeatInterval = 15 * time.Second
+
+// ClickStreamEvent is one click as pushed to live dashboards. Visitor IPs and
+// full User-Agents are left out; they are available via the CSV export.
+type ClickStreamEvent struct {
+	ClickID      string    `json:"click_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	ReferrerHost string    `json:"referrer_host"`
+	UTMSource    string    `json:"utm_source"`
+	UTMMedium    string    `json:"utm_medium"`
+	UTMCampaign  string    `json:"utm_campaign"`
+	Country      string    `json:"country"`
+	Region       string    `json:"region"`
+	Browser      string    `json:"browser"`
+	OS           string    `json:"os"`
+	DeviceClass  string    `json:"device_class"`
+	IsBot        bool      `json:"is_bot"`
+}
+
+// StreamClicks pushes a link's clicks to the client as Server-Sent Events
+// while the connection stays open.
+func StreamClicks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlMapping, ok := findVisibleLink(w, r)
+		if !ok {
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondWithError(w, "Streaming is not supported.", http.StatusInternalServerError)
+			return
+		}
+
+		clicks, unsubscribe := analytics.SubscribeClicks(urlMapping.ID)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-analytics.StreamsClosed():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case click := <-clicks:
+				device := analytics.ParseDevice(click.UserAgent)
+				payload, err := json.Marshal(ClickStreamEvent{
+					ClickID:      click.ClickID,
+					Timestamp:    click.CreatedAt.UTC(),
+					ReferrerHost: click.ReferrerHost,
+					UTMSource:    click.UTMSource,
+					UTMMedium:    click.UTMMedium,
+					UTMCampaign:  click.UTMCampaign,
+					Country:      click.Country,
+					Region:       click.Region,
+					Browser:      device.Browser,
+					OS:           device.OS,
+					DeviceClass:  device.DeviceClass,
+					IsBot:        click.IsBot,
+				})
+				if err != nil {
+					log.Println("Error encoding click for stream:", err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: click\ndata: %s\n\n", click.ClickID, payload)
+			}
+			flusher.Flush()
+		}
+	}
+}
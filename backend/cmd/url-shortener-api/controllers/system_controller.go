@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"url-shortener/analytics"
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/scheduler"
+	"url-shortener/store"
+	"url-shortener/version"
+)
+
+// largestTables is how many tables the system stats list by size.
+const largestTables = 10
+
+// startedAt is when the process started, for uptime.
+var startedAt = time.Now()
+
+// SystemStats is an overview of the service for operators.
+type SystemStats struct {
+	Links    LinkCounts   `json:"links"`
+	Clicks   ClickVolume  `json:"clicks"`
+	Database DatabaseSize `json:"database"`
+	Cache    CacheStats   `json:"cache"`
+	Jobs     JobBacklog   `json:"jobs"`
+	Build    version.Info `json:"build"`
+	Uptime   int64        `json:"uptime_seconds"`
+}
+
+// LinkCounts counts links, not counting deleted ones, by status.
+type LinkCounts struct {
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"by_status"`
+}
+
+// ClickVolume counts recent clicks, bots included, and those still
+// buffered in memory.
+type ClickVolume struct {
+	Last24Hours int64 `json:"last_24_hours"`
+	Last7Days   int64 `json:"last_7_days"`
+	Buffered    int   `json:"buffered"`
+}
+
+// DatabaseSize estimates the space the database takes on disk.
+type DatabaseSize struct {
+	Driver        string         `json:"driver"`
+	Bytes         int64          `json:"bytes"`
+	LargestTables []db.TableSize `json:"largest_tables,omitempty"`
+}
+
+// CacheStats reports Redis link lookups since startup. HitRate is null until
+// there has been a lookup.
+type CacheStats struct {
+	Enabled bool     `json:"enabled"`
+	Hits    int64    `json:"hits"`
+	Misses  int64    `json:"misses"`
+	Errors  int64    `json:"errors"`
+	HitRate *float64 `json:"hit_rate"`
+}
+
+// JobBacklog is the work waiting to be done in the background.
+type JobBacklog struct {
+	PendingValidation int64                 `json:"pending_validation"`
+	QueuedValidations int                   `json:"queued_validations"`
+	Scheduled         []scheduler.JobStatus `json:"scheduled"`
+}
+
+// GetSystemStats returns link counts, click volume, database size, cache
+// hit rate, the background job backlog and build info, as a quick health
+// overview for operators.
+func GetSystemStats(cfg *config.Config, jobScheduler *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		replica := db.Replica.WithContext(r.Context())
+		stats := SystemStats{
+			Links:  LinkCounts{ByStatus: make(map[string]int64)},
+			Clicks: ClickVolume{Buffered: analytics.BufferedClicks()},
+			Jobs: JobBacklog{
+				QueuedValidations: queuedValidations(),
+				Scheduled:         jobScheduler.Jobs(),
+			},
+			Build:  version.Get(),
+			Uptime: int64(time.Since(startedAt).Seconds()),
+		}
+
+		var statuses []struct {
+			Status string
+			Links  int64
+		}
+		err := replica.Model(&models.UrlMapping{}).
+			Select("status, COUNT(*) AS links").
+			Group("status").
+			Scan(&statuses).Error
+		if err != nil {
+			log.Println("Error counting links by status:", err)
+			respondWithError(w, "Error loading system stats.", http.StatusInternalServerError)
+			return
+		}
+		for _, row := range statuses {
+			stats.Links.ByStatus[row.Status] = row.Links
+			stats.Links.Total += row.Links
+		}
+
+		err = replica.Model(&models.UrlMapping{}).
+			Where("pending_validation = ?", true).
+			Count(&stats.Jobs.PendingValidation).Error
+		if err != nil {
+			log.Println("Error counting links pending validation:", err)
+			respondWithError(w, "Error loading system stats.", http.StatusInternalServerError)
+			return
+		}
+
+		// Only raw clicks are this recent, so the rollups needn't be read
+		now := time.Now()
+		err = replica.Model(&models.ClickEvent{}).
+			Select("COUNT(*) FILTER (WHERE created_at >= ?) AS last24_hours, COUNT(*) AS last7_days", now.Add(-24*time.Hour)).
+			Where("created_at >= ?", now.AddDate(0, 0, -7)).
+			Scan(&stats.Clicks).Error
+		if err != nil {
+			log.Println("Error counting recent clicks:", err)
+			respondWithError(w, "Error loading system stats.", http.StatusInternalServerError)
+			return
+		}
+
+		stats.Database.Driver = cfg.DBDriver
+		stats.Database.Bytes, stats.Database.LargestTables, err = db.Size(r.Context(), largestTables)
+		if err != nil {
+			// The rest of the overview is still worth having
+			log.Println("Error estimating database size:", err)
+		}
+
+		if cfg.RedisURL != "" {
+			hits, misses, failures := store.CacheLookups()
+			stats.Cache = CacheStats{Enabled: true, Hits: int64(hits), Misses: int64(misses), Errors: int64(failures)}
+			if lookups := hits + misses + failures; lookups > 0 {
+				hitRate := hits / lookups
+				stats.Cache.HitRate = &hitRate
+			}
+		}
+
+		respondWithJSON(w, stats)
+	}
+}
@@ -1,37 +1,68 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"url-shortener/analytics"
+	"url-shortener/blocklist"
 	"url-shortener/config"
-	"url-shortener/db"
+	"url-shortener/customdomains"
+	"url-shortener/metrics"
 	"url-shortener/models"
+	"url-shortener/proxy"
+	"url-shortener/store"
+	"url-shortener/templates"
 	"url-shortener/utils"
 
 	"github.com/google/uuid"
-	"gorm.io/gorm"
+	"github.com/gorilla/mux"
 )
 
 // ShortenURLRequest represents the expected payload for shortening URLs.
 type ShortenURLRequest struct {
-	URL                string     `json:"url"`
-	IntendedLiveDate   *time.Time `json:"intended_live_date,omitempty"`
-	IntendedExpiryDate *time.Time `json:"intended_expiry_date,omitempty"`
+	URL                 string            `json:"url"`
+	Alias               string            `json:"alias,omitempty"`  // custom short code; only used when shortening
+	Domain              string            `json:"domain,omitempty"` // LINK_DOMAINS or verified custom domain to serve the link on; the default hosts if empty
+	OrganizationID      *uint             `json:"organization_id,omitempty"`
+	IntendedLiveDate    *time.Time        `json:"intended_live_date,omitempty"`
+	IntendedExpiryDate  *time.Time        `json:"intended_expiry_date,omitempty"`
+	ForwardQuery        *bool             `json:"forward_query,omitempty"`
+	InterstitialSeconds int               `json:"interstitial_seconds,omitempty"`
+	LanguageTargets     map[string]string `json:"language_targets,omitempty"`
+	ResponseHeaders     map[string]string `json:"response_headers,omitempty"`
+	HideReferrer        bool              `json:"hide_referrer,omitempty"`
+	ProxyContent        bool              `json:"proxy_content,omitempty"`
+	TrackEngagement     bool              `json:"track_engagement,omitempty"`
+	PrintCampaign       bool              `json:"print_campaign,omitempty"`
+	Tags                []string          `json:"tags,omitempty"`
 }
 
 // ShortenURLResponse represents the response payload.
 type ShortenURLResponse struct {
 	ShortURL           string     `json:"short_url"`
 	Status             string     `json:"status"`
+	PendingValidation  bool       `json:"pending_validation,omitempty"`
+	FinalURL           string     `json:"final_url,omitempty"`
+	ContentType        string     `json:"content_type,omitempty"`
+	DownloadType       string     `json:"download_type,omitempty"`
 	IntendedLiveDate   *time.Time `json:"intended_live_date,omitempty"`
 	IntendedExpiryDate *time.Time `json:"intended_expiry_date,omitempty"`
 }
 
+// PreviewTokenResponse represents a freshly issued preview link.
+type PreviewTokenResponse struct {
+	PreviewURL string    `json:"preview_url"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
 // ErrorResponse represents an error response.
 type ErrorResponse struct {
 	Message string `json:"message"`
@@ -42,69 +73,40 @@ func ShortenURL(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req ShortenURLRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
-		if err != nil || req.URL == "" {
-			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
 			return
 		}
-
-		// Validate URL Syntax and HTTPS
-		if err := utils.ValidateURLSyntax(req.URL); err != nil {
-			respondWithError(w, fmt.Sprintf("Invalid URL: %v", err), http.StatusBadRequest)
-			return
-		}
-
-		// Check URL status
-		urlCheckResult, err := utils.CheckURLStatus(req.URL)
-		if err != nil {
-			log.Println("Error checking URL status:", err)
-			respondWithError(w, "Error checking URL status. Please try again.", http.StatusInternalServerError)
-			return
-		}
-
-		// Determine if the URL is live based on the status code
-		isLive := urlCheckResult.StatusCode >= 200 && urlCheckResult.StatusCode < 300
-		status := "live"
-		if !isLive {
-			status = "inactive"
-		}
-
-		// Validate dates
-		now := time.Now()
-		if req.IntendedExpiryDate != nil && req.IntendedExpiryDate.Before(now) {
-			respondWithError(w, "Expiry date cannot be in the past", http.StatusBadRequest)
-			return
-		}
-		if req.IntendedLiveDate != nil && req.IntendedExpiryDate != nil && req.IntendedLiveDate.After(*req.IntendedExpiryDate) {
-			respondWithError(w, "Live date cannot be after expiry date", http.StatusBadRequest)
+		if err != nil || req.URL == "" {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
 			return
 		}
 
-		// Proceed to shorten the URL
-		shortCode := generateShortCode()
-
-		// Save to database
-		urlMapping := models.UrlMapping{
-			ShortCode:          shortCode,
-			OriginalUrl:        req.URL,
-			IntendedLiveDate:   req.IntendedLiveDate,
-			IntendedExpiryDate: req.IntendedExpiryDate,
-			Status:             status,
-			LastCheckedAt:      time.Now(),
-		}
-
-		if err := db.DB.Create(&urlMapping).Error; err != nil {
-			log.Println("Error saving URL mapping:", err)
+		creation := &LinkCreation{Config: cfg, Request: r, Link: &req}
+		if err := runCreationPipeline(creation); err != nil {
+			var linkErr *linkError
+			if errors.As(err, &linkErr) {
+				respondWithError(w, linkErr.message, linkErr.status)
+				return
+			}
+			log.Println("Error creating link:", err)
 			respondWithError(w, "Error creating shortened URL. Please try again.", http.StatusInternalServerError)
 			return
 		}
+		urlMapping := creation.Mapping
 
 		// Construct the shortened URL
-		shortURL := constructShortURL(r, shortCode)
+		shortURL := constructShortURL(r, *urlMapping)
 
 		// Respond with the shortened URL and additional information
 		response := ShortenURLResponse{
 			ShortURL:           shortURL,
-			Status:             status,
+			Status:             urlMapping.Status,
+			PendingValidation:  urlMapping.PendingValidation,
+			FinalURL:           urlMapping.FinalUrl,
+			ContentType:        urlMapping.ContentType,
+			DownloadType:       urlMapping.DownloadType,
 			IntendedLiveDate:   urlMapping.IntendedLiveDate,
 			IntendedExpiryDate: urlMapping.IntendedExpiryDate,
 		}
@@ -113,14 +115,174 @@ func ShortenURL(cfg *config.Config) http.HandlerFunc {
 	}
 }
 
+// validateLinkRequest checks everything about a link request that doesn't
+// involve contacting the destination. The returned error is safe to show to
+// the client. Response headers are canonicalized and tags and the domain
+// normalized in place.
+func validateLinkRequest(cfg *config.Config, req *ShortenURLRequest) error {
+	// Validate URL Syntax and HTTPS
+	if err := utils.ValidateURLSyntax(req.URL); err != nil {
+		return fmt.Errorf("Invalid URL: %v", err)
+	}
+
+	// Check the destinations against the domain blocklist and for shortener loops
+	destinations := []string{req.URL}
+	for _, target := range req.LanguageTargets {
+		destinations = append(destinations, target)
+	}
+	for _, destination := range destinations {
+		if domain, blocked := blocklist.Blocked(destination); blocked {
+			return fmt.Errorf("Links to %s are not allowed", domain)
+		}
+		if isShortenerHost(cfg, destination) {
+			return errors.New("Links to this URL shortener are not allowed")
+		}
+		if config.CurrentFeatures().ShortenerLinkPolicy == "reject" && utils.IsURLShortener(destination) {
+			return errors.New("Links to other URL shorteners are not allowed")
+		}
+	}
+
+	// Whether the domain can be used depends on who's asking; see checkLinkDomain
+	req.Domain = customdomains.NormalizeHost(req.Domain)
+
+	// Validate link options
+	if req.InterstitialSeconds < 0 || req.InterstitialSeconds > cfg.MaxInterstitialSeconds {
+		return fmt.Errorf("Interstitial seconds must be between 0 and %d", cfg.MaxInterstitialSeconds)
+	}
+
+	if req.ProxyContent && (req.InterstitialSeconds > 0 || len(req.LanguageTargets) > 0) {
+		return errors.New("Proxied links cannot use interstitials or language targets")
+	}
+
+	if err := utils.ValidateLanguageTargets(req.LanguageTargets); err != nil {
+		return fmt.Errorf("Invalid language targets: %v", err)
+	}
+
+	responseHeaders, err := utils.ValidateResponseHeaders(req.ResponseHeaders)
+	if err != nil {
+		return fmt.Errorf("Invalid response headers: %v", err)
+	}
+	req.ResponseHeaders = responseHeaders
+
+	tags, err := utils.NormalizeTags(req.Tags)
+	if err != nil {
+		return fmt.Errorf("Invalid tags: %v", err)
+	}
+	req.Tags = tags
+
+	// Validate dates
+	if req.IntendedExpiryDate != nil && req.IntendedExpiryDate.Before(time.Now()) {
+		return errors.New("Expiry date cannot be in the past")
+	}
+	if req.IntendedLiveDate != nil && req.IntendedExpiryDate != nil && req.IntendedLiveDate.After(*req.IntendedExpiryDate) {
+		return errors.New("Live date cannot be after expiry date")
+	}
+
+	return nil
+}
+
+// initialLinkStatus follows the destination's redirects and works out the
+// status a link for req should start in. The final URL is held to the same
+// rules as the submitted one, so a bad site can't hide behind a benign
+// intermediate; a *linkError is returned if it breaks them. Links to other
+// shorteners are replaced by where they lead under the "resolve" policy.
+func initialLinkStatus(ctx context.Context, cfg *config.Config, req *ShortenURLRequest) (string, utils.ResolvedURL, error) {
+	resolved, err := utils.ResolveURL(ctx, req.URL, cfg.MaxRedirectHops)
+	if errors.Is(err, utils.ErrTooManyRedirects) {
+		return "", resolved, &linkError{http.StatusBadRequest, fmt.Sprintf("URL redirects more than %d times", cfg.MaxRedirectHops)}
+	}
+	if errors.Is(err, utils.ErrBlockedAddress) {
+		return "", resolved, &linkError{http.StatusBadRequest, "URL points to a private or internal address"}
+	}
+	if err != nil {
+		return "", resolved, err
+	}
+
+	if resolved.FinalURL != req.URL {
+		if err := utils.ValidateURLSyntax(resolved.FinalURL); err != nil {
+			return "", resolved, &linkError{http.StatusBadRequest, fmt.Sprintf("URL redirects to an invalid destination: %v", err)}
+		}
+		if domain, blocked := blocklist.Blocked(resolved.FinalURL); blocked {
+			return "", resolved, &linkError{http.StatusBadRequest, fmt.Sprintf("URL redirects to %s, which is not allowed", domain)}
+		}
+		if isShortenerHost(cfg, resolved.FinalURL) {
+			return "", resolved, &linkError{http.StatusBadRequest, "URL redirects back to this URL shortener"}
+		}
+		if config.CurrentFeatures().ShortenerLinkPolicy == "reject" && utils.IsURLShortener(resolved.FinalURL) {
+			return "", resolved, &linkError{http.StatusBadRequest, "URL redirects to another URL shortener"}
+		}
+	}
+
+	// Unwrap links to other shorteners so the stored destination is the real one
+	if config.CurrentFeatures().ShortenerLinkPolicy == "resolve" && utils.IsURLShortener(req.URL) && resolved.FinalURL != req.URL {
+		req.URL = resolved.FinalURL
+	}
+
+	// Determine if the URL is live based on the status code
+	isLive := resolved.StatusCode >= 200 && resolved.StatusCode < 300
+	if !isLive {
+		return "inactive", resolved, nil
+	}
+
+	// Embargoed links stay pending until the live date passes
+	if req.IntendedLiveDate != nil && req.IntendedLiveDate.After(time.Now()) {
+		return "pending", resolved, nil
+	}
+	return "live", resolved, nil
+}
+
+// applyLinkRequest copies the settings in req onto urlMapping, replacing
+// whatever was there before.
+func applyLinkRequest(urlMapping *models.UrlMapping, req *ShortenURLRequest, status string, resolved utils.ResolvedURL) {
+	urlMapping.OriginalUrl = req.URL
+	urlMapping.Domain = req.Domain
+	urlMapping.FinalUrl = resolved.FinalURL
+	urlMapping.ContentType = resolved.ContentType
+	urlMapping.DownloadType = resolved.DownloadType
+	urlMapping.OrganizationID = req.OrganizationID
+	urlMapping.IntendedLiveDate = req.IntendedLiveDate
+	if !sameTime(urlMapping.IntendedExpiryDate, req.IntendedExpiryDate) {
+		urlMapping.ExpiryNoticeSentAt = nil // warn the owner again about the new date
+	}
+	urlMapping.IntendedExpiryDate = req.IntendedExpiryDate
+	urlMapping.ForwardQuery = req.ForwardQuery
+	urlMapping.InterstitialSeconds = req.InterstitialSeconds
+	urlMapping.LanguageTargets = req.LanguageTargets
+	urlMapping.ResponseHeaders = req.ResponseHeaders
+	urlMapping.HideReferrer = req.HideReferrer
+	urlMapping.ProxyContent = req.ProxyContent
+	urlMapping.TrackEngagement = req.TrackEngagement
+	urlMapping.PrintCampaign = req.PrintCampaign
+	urlMapping.Tags = req.Tags
+	urlMapping.Status = status
+	urlMapping.PendingValidation = false
+	urlMapping.LastCheckedAt = time.Now()
+}
+
+var redirectLookups = metrics.NewCounter("redirect_lookups_total",
+	"Short codes looked up for redirects, by whether a link was found (hit) or not (miss).", "result")
+
 // RedirectURL handles redirection from short URLs to original URLs.
-func RedirectURL() http.HandlerFunc {
+func RedirectURL(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		shortCode := r.URL.Path[1:] // Remove the leading '/'
+		features := config.CurrentFeatures()
 
-		var urlMapping models.UrlMapping
-		if err := db.DB.Where("short_code = ?", shortCode).First(&urlMapping).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
+		urlMapping, err := store.Links.Lookup(r.Context(), shortCode)
+		if errors.Is(err, store.ErrNotFound) {
+			urlMapping, err = lookupAlias(r.Context(), shortCode)
+		}
+		if err == nil && !servedOn(cfg, urlMapping, r.Host) {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				redirectLookups.Inc("miss")
+				// Send unknown codes to the configured landing page, if any
+				if features.FallbackRedirectURL != "" {
+					http.Redirect(w, r, features.FallbackRedirectURL, http.StatusFound)
+					return
+				}
 				http.Error(w, "URL not found.", http.StatusNotFound)
 			} else {
 				log.Printf("Error retrieving URL mapping: %v", err)
@@ -128,6 +290,7 @@ func RedirectURL() http.HandlerFunc {
 			}
 			return
 		}
+		redirectLookups.Inc("hit")
 
 		// Check if the URL has expired
 		if urlMapping.IntendedExpiryDate != nil && time.Now().After(*urlMapping.IntendedExpiryDate) {
@@ -135,32 +298,355 @@ func RedirectURL() http.HandlerFunc {
 			return
 		}
 
+		// A valid preview token only lifts the live date, so the link can be
+		// tried before launch; preview hits are never counted
+		preview := false
+		if token := r.URL.Query().Get("preview"); token != "" {
+			if err := utils.ValidatePreviewToken(cfg.PreviewTokenSecret, shortCode, token); err != nil {
+				http.Error(w, "Invalid or expired preview token.", http.StatusForbidden)
+				return
+			}
+			preview = true
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		recordClick := func() string {
+			if preview {
+				return ""
+			}
+			click := analytics.NewClickEvent(r, urlMapping)
+			analytics.EnqueueClick(click)
+			return click.ClickID
+		}
+
+		// Check if the URL has reached its live date
+		if !preview && urlMapping.IntendedLiveDate != nil && time.Now().Before(*urlMapping.IntendedLiveDate) {
+			http.Error(w, "This URL is not yet live.", cfg.NotLiveStatusCode)
+			return
+		}
+
+		// Flagged links get a warning page, which may let the visitor carry on
+		if urlMapping.Status == "flagged" && features.FlaggedLinkWarning {
+			if !features.FlaggedLinkProceed || r.URL.Query().Get(proceedParam) == "" {
+				serveWarning(w, r, features, urlMapping)
+				return
+			}
+			serveRedirect(w, r, cfg, urlMapping, recordClick())
+			return
+		}
+
 		// Check if the URL is live
-		if urlMapping.Status != "live" {
+		if !isLive(urlMapping) && !(preview && awaitingLiveDate(urlMapping)) {
 			http.Error(w, "This URL is not currently live.", http.StatusGone)
 			return
 		}
 
-		http.Redirect(w, r, urlMapping.OriginalUrl, http.StatusFound)
+		// Executables and archives wait for the visitor to confirm the download
+		if features.DownloadWarning && urlMapping.DownloadType == utils.DownloadRisky && r.URL.Query().Get(proceedParam) == "" {
+			serveDownloadWarning(w, r, urlMapping)
+			return
+		}
+
+		// Record the click without holding up the redirect
+		serveRedirect(w, r, cfg, urlMapping, recordClick())
+	}
+}
+
+// CreatePreviewToken issues a time-limited preview link for a link that is
+// waiting for its live date. Only those who may edit the link can issue
+// one, and disabled, flagged or otherwise unusable links can't be previewed.
+func CreatePreviewToken(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shortCode := mux.Vars(r)["shortCode"]
+
+		urlMapping, ok := findURLMapping(w, r, shortCode)
+		if !ok {
+			return
+		}
+		if !ownsLink(r, urlMapping) {
+			respondWithError(w, "URL not found.", http.StatusNotFound)
+			return
+		}
+
+		// Only unpublished links need a preview
+		isPublished := isLive(urlMapping) &&
+			(urlMapping.IntendedLiveDate == nil || !urlMapping.IntendedLiveDate.After(time.Now()))
+		if isPublished {
+			respondWithError(w, "URL is already live.", http.StatusConflict)
+			return
+		}
+		if !awaitingLiveDate(urlMapping) {
+			respondWithError(w, "Only links waiting for their live date can be previewed.", http.StatusConflict)
+			return
+		}
+
+		token, expiresAt, err := utils.GeneratePreviewToken(cfg.PreviewTokenSecret, shortCode, cfg.PreviewTokenTTL)
+		if err != nil {
+			log.Println("Error generating preview token:", err)
+			respondWithError(w, "Preview tokens are not available.", http.StatusServiceUnavailable)
+			return
+		}
+
+		response := PreviewTokenResponse{
+			PreviewURL: constructShortURL(r, urlMapping) + "?preview=" + token,
+			ExpiresAt:  expiresAt,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
 // Helper functions
+
+// findURLMapping loads the mapping for shortCode, writing a JSON error
+// response and returning false if it can't.
+func findURLMapping(w http.ResponseWriter, r *http.Request, shortCode string) (models.UrlMapping, bool) {
+	urlMapping, err := store.Links.GetByCode(r.Context(), shortCode)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			respondWithError(w, "URL not found.", http.StatusNotFound)
+		} else {
+			log.Printf("Error retrieving URL mapping: %v", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		}
+		return urlMapping, false
+	}
+	return urlMapping, true
+}
+
 func respondWithError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(ErrorResponse{Message: message})
 }
 
+// proceedParam on a short URL skips its flagged link or download warning page.
+const proceedParam = "proceed"
+
+// serveWarning shows the warning page for a flagged link, with a link that
+// continues to the destination if features allow it.
+func serveWarning(w http.ResponseWriter, r *http.Request, features *config.Features, urlMapping models.UrlMapping) {
+	data := templates.WarningData{ShortCode: urlMapping.ShortCode, Destination: urlMapping.OriginalUrl}
+	if features.FlaggedLinkProceed {
+		query := r.URL.Query()
+		query.Set(proceedParam, "1")
+		data.ProceedURL = "?" + query.Encode()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := templates.RenderWarning(w, data); err != nil {
+		log.Println("Error rendering warning page:", err)
+	}
+}
+
+// serveDownloadWarning asks the visitor to confirm a risky file download.
+func serveDownloadWarning(w http.ResponseWriter, r *http.Request, urlMapping models.UrlMapping) {
+	query := r.URL.Query()
+	query.Set(proceedParam, "1")
+	data := templates.WarningData{
+		ShortCode:   urlMapping.ShortCode,
+		Destination: urlMapping.OriginalUrl,
+		ProceedURL:  "?" + query.Encode(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := templates.RenderDownloadWarning(w, data); err != nil {
+		log.Println("Error rendering download warning page:", err)
+	}
+}
+
+// serveRedirect sends the visitor on to the link's destination, either
+// directly or via the link's countdown or referrer-hiding page.
+func serveRedirect(w http.ResponseWriter, r *http.Request, cfg *config.Config, urlMapping models.UrlMapping, clickID string) {
+	destination := destinationURL(cfg, r, urlMapping, clickID)
+
+	// Domains blocked after the link was made stop redirecting too
+	if domain, blocked := blocklist.Blocked(destination); blocked {
+		log.Printf("Refusing redirect of %s to blocked domain %s", urlMapping.ShortCode, domain)
+		http.Error(w, "This URL has been disabled.", http.StatusGone)
+		return
+	}
+
+	if len(urlMapping.LanguageTargets) > 0 {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	if urlMapping.PrintCampaign {
+		w.Header().Add("Vary", "User-Agent")
+	}
+	for name, value := range config.CurrentFeatures().RedirectHeaders {
+		w.Header().Set(name, value)
+	}
+	for name, value := range urlMapping.ResponseHeaders {
+		w.Header().Set(name, value)
+	}
+
+	if urlMapping.HideReferrer {
+		w.Header().Set("Referrer-Policy", "no-referrer")
+	}
+
+	// Proxied links serve the content itself, falling back to a redirect if it can't be fetched
+	if urlMapping.ProxyContent {
+		err := proxy.ServeContent(r.Context(), w, destination, cfg)
+		if err == nil {
+			return
+		}
+		log.Printf("Error proxying %s: %v", urlMapping.ShortCode, err)
+	}
+
+	// Printed links are often scanned on old phones, so give those a plain page to tap through
+	if urlMapping.PrintCampaign && analytics.IsConstrainedBrowser(r.UserAgent()) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := templates.FallbackData{Destination: destination, HideReferrer: urlMapping.HideReferrer}
+		if err := templates.RenderFallback(w, data); err != nil {
+			log.Printf("Error rendering fallback page: %v", err)
+		}
+		return
+	}
+
+	if urlMapping.InterstitialSeconds > 0 {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := templates.InterstitialData{
+			ShortCode:    urlMapping.ShortCode,
+			Destination:  destination,
+			Seconds:      urlMapping.InterstitialSeconds,
+			HideReferrer: urlMapping.HideReferrer,
+		}
+		if err := templates.RenderInterstitial(w, data); err != nil {
+			log.Printf("Error rendering interstitial: %v", err)
+		}
+		return
+	}
+
+	// A plain 302 leaks the referrer in some browsers, so hop through a page
+	if urlMapping.HideReferrer {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := templates.RenderDereferrer(w, templates.DereferrerData{Destination: destination}); err != nil {
+			log.Printf("Error rendering dereferrer: %v", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, destination, http.StatusFound)
+}
+
+// sameTime reports whether two optional times are both unset or equal.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// awaitingLiveDate reports whether urlMapping is a checked link held back
+// only by its live date, which is all a preview token may get past.
+func awaitingLiveDate(urlMapping models.UrlMapping) bool {
+	return urlMapping.Status == "pending" && !urlMapping.PendingValidation
+}
+
+// isLive reports whether urlMapping may be redirected to. Pending links whose
+// live date has passed count as live even before the activation job runs.
+func isLive(urlMapping models.UrlMapping) bool {
+	switch urlMapping.Status {
+	case "live":
+		return true
+	case "pending":
+		return !urlMapping.PendingValidation &&
+			urlMapping.IntendedLiveDate != nil && !time.Now().Before(*urlMapping.IntendedLiveDate)
+	default:
+		return false
+	}
+}
+
+// destinationURL returns where a redirect for urlMapping should point,
+// picking a localized target for the visitor's language, tagging it with
+// the click ID for engagement tracking and carrying over the short URL's
+// query string when passthrough is enabled.
+func destinationURL(cfg *config.Config, r *http.Request, urlMapping models.UrlMapping, clickID string) string {
+	destination := urlMapping.OriginalUrl
+	if target, ok := utils.MatchLanguageTarget(r.Header.Get("Accept-Language"), urlMapping.LanguageTargets); ok {
+		destination = target
+	}
+
+	if urlMapping.TrackEngagement && clickID != "" {
+		destination = utils.MergeQuery(destination, url.Values{analytics.ClickIDParam: {clickID}})
+	}
+
+	forward := config.CurrentFeatures().ForwardQueryDefault
+	if urlMapping.ForwardQuery != nil {
+		forward = *urlMapping.ForwardQuery
+	}
+	if !forward {
+		return destination
+	}
+
+	query := r.URL.Query()
+	query.Del("preview")
+	query.Del(proceedParam)
+	return utils.MergeQuery(destination, query)
+}
+
+func respondWithJSON(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Println("Error encoding response:", err)
+	}
+}
+
 func generateShortCode() string {
 	return uuid.New().String()[:8] // Example: use the first 8 characters of a UUID
 }
 
-func constructShortURL(r *http.Request, shortCode string) string {
+// constructShortURL returns urlMapping's short URL, on its domain if it's
+// bound to one and otherwise on the host the request was made to.
+func constructShortURL(r *http.Request, urlMapping models.UrlMapping) string {
 	scheme := "http"
 	if r.TLS != nil {
 		scheme = "https"
 	}
 	host := r.Host
-	return fmt.Sprintf("%s://%s/%s", scheme, host, shortCode)
+	if urlMapping.Domain != "" {
+		host = urlMapping.Domain
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, host, urlMapping.ShortCode)
+}
+
+// isLinkDomain reports whether host is one of the domains links can be
+// bound to.
+func isLinkDomain(cfg *config.Config, host string) bool {
+	for _, domain := range cfg.LinkDomains {
+		if strings.EqualFold(domain, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// servedOn reports whether urlMapping redirects on host. Links bound to a
+// domain only redirect there, and other links only on the default hosts,
+// so a domain's short codes can't be reached through another.
+func servedOn(cfg *config.Config, urlMapping models.UrlMapping, host string) bool {
+	host = customdomains.NormalizeHost(host)
+	if urlMapping.Domain != "" {
+		return host == urlMapping.Domain
+	}
+	_, custom := customdomains.Verified(host)
+	return !custom && !isLinkDomain(cfg, host)
+}
+
+// isShortenerHost reports whether rawURL is on one of this service's hosts,
+// including verified custom domains, where a link to it would redirect in
+// a loop.
+func isShortenerHost(cfg *config.Config, rawURL string) bool {
+	if utils.HostIn(rawURL, cfg.ShortLinkHosts) || utils.HostIn(rawURL, cfg.LinkDomains) {
+		return true
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	_, custom := customdomains.Verified(parsedURL.Hostname())
+	return custom
 }
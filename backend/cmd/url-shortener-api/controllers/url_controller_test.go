@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/store"
+	"url-shortener/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	testAdminToken = "admin-secret"
+	testJWTSecret  = "test-secret"
+)
+
+// setupLinks gives a test an empty memory store for links, with an SQLite
+// database behind the blocklist, custom domain and alias lookups the
+// handlers make directly.
+func setupLinks(t *testing.T) *store.MemoryStore {
+	t.Helper()
+	if _, err := config.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	db.Connect(config.Config{
+		DBDriver:           "sqlite",
+		DBConnectionString: filepath.Join(t.TempDir(), "links.db"),
+		DBConnectAttempts:  1,
+	})
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Migrate("sqlite"); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	links := store.NewMemoryStore(nil)
+	previous := store.Links
+	store.Links = links
+	t.Cleanup(func() { store.Links = previous })
+	return links
+}
+
+// createUser stores a user with a login session and returns them with an
+// access token for it, for requests passed through AuthMiddleware.
+func createUser(t *testing.T, email string) (models.User, string) {
+	t.Helper()
+	user := models.User{Email: email, PasswordHash: "unused", Role: models.RoleUser}
+	if err := db.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := models.Session{UserID: user.ID, RefreshTokenHash: utils.HashRefreshToken(email), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.DB.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := utils.GenerateAccessToken(testJWTSecret, user.ID, session.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+func TestShortenURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		admin      bool
+		wantStatus int
+		wantCode   string // the short code stored, when it's chosen
+	}{
+		{name: "new link", body: `{"url": "https://example.com/page"}`, wantStatus: http.StatusOK},
+		{name: "invalid payload", body: `{"url": `, wantStatus: http.StatusBadRequest},
+		{name: "missing URL", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "plain HTTP", body: `{"url": "http://example.com/page"}`, wantStatus: http.StatusBadRequest},
+		{name: "anonymous alias", body: `{"url": "https://example.com/page", "alias": "launch"}`, wantStatus: http.StatusForbidden},
+		{name: "admin alias", body: `{"url": "https://example.com/page", "alias": "launch"}`, admin: true, wantStatus: http.StatusOK, wantCode: "launch"},
+		{name: "taken alias", body: `{"url": "https://example.com/page", "alias": "taken"}`, admin: true, wantStatus: http.StatusConflict},
+		{name: "anonymous proxied link", body: `{"url": "https://example.com/page", "proxy_content": true}`, wantStatus: http.StatusForbidden},
+		{name: "admin proxied link", body: `{"url": "https://example.com/page", "proxy_content": true}`, admin: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := setupLinks(t)
+			validationQueue = make(chan validationTask, 1)
+			t.Cleanup(func() { validationQueue = nil })
+			taken := models.UrlMapping{ShortCode: "taken", OriginalUrl: "https://example.com/taken"}
+			if err := links.Create(context.Background(), &taken); err != nil {
+				t.Fatal(err)
+			}
+
+			// Async validation keeps the handler from fetching the destination
+			cfg := config.Config{
+				AsyncValidation:   true,
+				AuthenticatedTier: config.Tier{CustomAliases: true, ProxyContent: true},
+			}
+			handler := middlewares.AdminTokenMiddleware(testAdminToken)(ShortenURL(&cfg))
+			r := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(tt.body))
+			if tt.admin {
+				r.Header.Set("Authorization", "Bearer "+testAdminToken)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response ShortenURLResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Status != "pending" || !response.PendingValidation {
+				t.Errorf("response status %q, pending validation %v, want a link waiting for validation", response.Status, response.PendingValidation)
+			}
+			shortCode := strings.TrimPrefix(response.ShortURL, "http://example.com/")
+			if tt.wantCode != "" && shortCode != tt.wantCode {
+				t.Errorf("short URL %s, want code %s", response.ShortURL, tt.wantCode)
+			}
+
+			urlMapping, err := links.GetByCode(context.Background(), shortCode)
+			if err != nil {
+				t.Fatalf("GetByCode(%s) error = %v", shortCode, err)
+			}
+			if urlMapping.OriginalUrl != "https://example.com/page" {
+				t.Errorf("stored URL %q, want https://example.com/page", urlMapping.OriginalUrl)
+			}
+			if urlMapping.OwnerID != nil {
+				t.Errorf("stored link owner = %d, want none", *urlMapping.OwnerID)
+			}
+			select {
+			case task := <-validationQueue:
+				if task.ShortCode != shortCode {
+					t.Errorf("queued %s for validation, want %s", task.ShortCode, shortCode)
+				}
+			default:
+				t.Error("link wasn't queued for validation")
+			}
+		})
+	}
+}
+
+func TestRedirectURL(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name         string
+		link         *models.UrlMapping
+		deleted      bool
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "live link",
+			link:         &models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/page", Status: "live"},
+			path:         "/abc",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com/page",
+		},
+		{
+			name:         "live date passed",
+			link:         &models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/page", Status: "pending", IntendedLiveDate: &past},
+			path:         "/abc",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com/page",
+		},
+		{name: "unknown code", path: "/missing", wantStatus: http.StatusNotFound},
+		{
+			name:       "deleted link",
+			link:       &models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/page", Status: "live"},
+			deleted:    true,
+			path:       "/abc",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "expired",
+			link:       &models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/page", Status: "live", IntendedExpiryDate: &past},
+			path:       "/abc",
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:       "not live yet",
+			link:       &models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/page", Status: "pending", IntendedLiveDate: &future},
+			path:       "/abc",
+			wantStatus: http.StatusTooEarly,
+		},
+		{
+			name:       "disabled",
+			link:       &models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/page", Status: "disabled"},
+			path:       "/abc",
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:       "bound to another domain",
+			link:       &models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/page", Status: "live", Domain: "go.example.org"},
+			path:       "/abc",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := setupLinks(t)
+			if tt.link != nil {
+				if err := links.Create(context.Background(), tt.link); err != nil {
+					t.Fatal(err)
+				}
+				if tt.deleted {
+					if err := links.Delete(context.Background(), *tt.link); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			cfg := config.Config{NotLiveStatusCode: http.StatusTooEarly}
+			w := httptest.NewRecorder()
+			RedirectURL(&cfg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestCreatePreviewToken(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name       string
+		caller     string // "owner", "other", "admin" or "" for anonymous
+		status     string
+		pending    bool // still waiting for async validation
+		wantStatus int
+	}{
+		{name: "owner", caller: "owner", status: "pending", wantStatus: http.StatusOK},
+		{name: "admin", caller: "admin", status: "pending", wantStatus: http.StatusOK},
+		{name: "another user", caller: "other", status: "pending", wantStatus: http.StatusNotFound},
+		{name: "anonymous", status: "pending", wantStatus: http.StatusNotFound},
+		{name: "already live", caller: "owner", status: "live", wantStatus: http.StatusConflict},
+		{name: "awaiting validation", caller: "owner", status: "pending", pending: true, wantStatus: http.StatusConflict},
+		{name: "disabled", caller: "owner", status: "disabled", wantStatus: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := setupLinks(t)
+			owner, ownerToken := createUser(t, "owner@example.com")
+			_, otherToken := createUser(t, "other@example.com")
+			urlMapping := models.UrlMapping{
+				ShortCode:         "launch",
+				OriginalUrl:       "https://example.com/launch",
+				Status:            tt.status,
+				PendingValidation: tt.pending,
+				IntendedLiveDate:  &future,
+				OwnerID:           &owner.ID,
+			}
+			if err := links.Create(context.Background(), &urlMapping); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config.Config{PreviewTokenSecret: "preview-secret", PreviewTokenTTL: time.Hour, NotLiveStatusCode: http.StatusNotFound}
+			handler := middlewares.AdminTokenMiddleware(testAdminToken)(
+				middlewares.AuthMiddleware(testJWTSecret)(CreatePreviewToken(&cfg)))
+			r := httptest.NewRequest(http.MethodPost, "/api/links/launch/preview", nil)
+			switch tt.caller {
+			case "owner":
+				r.Header.Set("Authorization", "Bearer "+ownerToken)
+			case "other":
+				r.Header.Set("Authorization", "Bearer "+otherToken)
+			case "admin":
+				r.Header.Set("Authorization", "Bearer "+testAdminToken)
+			}
+			r = mux.SetURLVars(r, map[string]string{"shortCode": "launch"})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response PreviewTokenResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			previewURL, err := url.Parse(response.PreviewURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The preview link gets past the live date; a tampered one doesn't
+			redirect := RedirectURL(&cfg)
+			w = httptest.NewRecorder()
+			redirect.ServeHTTP(w, httptest.NewRequest(http.MethodGet, previewURL.RequestURI(), nil))
+			if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/launch" {
+				t.Errorf("preview redirect status %d to %q, want %d to the destination", w.Code, w.Header().Get("Location"), http.StatusFound)
+			}
+			w = httptest.NewRecorder()
+			redirect.ServeHTTP(w, httptest.NewRequest(http.MethodGet, previewURL.RequestURI()+"0", nil))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("tampered preview status %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"url-shortener/db"
+	"url-shortener/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// SetRoleRequest changes a user's role.
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// ListUsers returns every user account, oldest first.
+func ListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var users []models.User
+		if err := db.DB.WithContext(r.Context()).Order("id").Find(&users).Error; err != nil {
+			log.Println("Error listing users:", err)
+			respondWithError(w, "Error listing users.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]UserResponse, 0, len(users))
+		for _, user := range users {
+			response = append(response, newUserResponse(user))
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// SetUserRole promotes or demotes a user.
+func SetUserRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			respondWithError(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req SetRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !models.ValidRole(req.Role) {
+			respondWithError(w, "role must be one of user or admin", http.StatusBadRequest)
+			return
+		}
+
+		var user models.User
+		if err := db.DB.WithContext(r.Context()).First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondWithError(w, "User not found.", http.StatusNotFound)
+				return
+			}
+			log.Println("Error retrieving user:", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.DB.WithContext(r.Context()).Model(&user).Update("role", req.Role).Error; err != nil {
+			log.Println("Error updating user role:", err)
+			respondWithError(w, "Error updating role.", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Set role of user %d to %s", user.ID, req.Role)
+
+		respondWithJSON(w, newUserResponse(user))
+	}
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/store"
+	"url-shortener/webhooks"
+)
+
+// validationTask is a stored link whose destination checks were deferred.
+type validationTask struct {
+	ShortCode string
+	From      requester
+}
+
+var (
+	validationQueue   chan validationTask
+	stopValidation    chan struct{}
+	validationWorkers sync.WaitGroup
+)
+
+// StartValidationWorkers starts the workers that check the destinations of
+// links created with async validation, and queues any links left pending
+// validation by a previous run. The queue isn't drained on shutdown; its
+// links keep their PendingValidation flag and are picked up on restart.
+func StartValidationWorkers(cfg *config.Config) {
+	validationQueue = make(chan validationTask, cfg.ValidationQueueSize)
+	stopValidation = make(chan struct{})
+	for i := 0; i < cfg.ValidationWorkers; i++ {
+		validationWorkers.Add(1)
+		go func() {
+			defer validationWorkers.Done()
+			for {
+				select {
+				case <-stopValidation:
+					return
+				case task := <-validationQueue:
+					validateLink(cfg, task)
+				}
+			}
+		}()
+	}
+
+	var shortCodes []string
+	err := db.DB.Model(&models.UrlMapping{}).Where("pending_validation = ?", true).Pluck("short_code", &shortCodes).Error
+	if err != nil {
+		log.Println("Error finding links pending validation:", err)
+		return
+	}
+	if len(shortCodes) > 0 {
+		log.Printf("Queueing %d links left pending validation", len(shortCodes))
+		stop := stopValidation
+		go func() {
+			for _, shortCode := range shortCodes {
+				select {
+				case validationQueue <- validationTask{ShortCode: shortCode}:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// StopValidationWorkers stops the workers once their current links are
+// checked, waiting for them or for ctx to expire.
+func StopValidationWorkers(ctx context.Context) error {
+	if stopValidation == nil {
+		return nil
+	}
+	close(stopValidation)
+
+	done := make(chan struct{})
+	go func() {
+		validationWorkers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queuedValidations returns how many links are waiting for a worker to
+// check them.
+func queuedValidations() int {
+	return len(validationQueue)
+}
+
+// validationQueueHasRoom reports whether a link's checks can be deferred.
+// When the workers are behind, links are checked inline instead.
+func validationQueueHasRoom() bool {
+	return validationQueue != nil && len(validationQueue) < cap(validationQueue)
+}
+
+// enqueueValidation hands a stored link to the validation workers without
+// waiting. If the queue filled up since validationQueueHasRoom was checked,
+// or the workers have stopped, the link keeps its PendingValidation flag
+// and is checked after the next restart.
+func enqueueValidation(task validationTask) {
+	select {
+	case validationQueue <- task:
+	default:
+		log.Printf("Validation queue is full, leaving link %s pending until restart", task.ShortCode)
+	}
+}
+
+// validateLink runs the deferred destination checks for a link and stores
+// the outcome. Links the checks would have refused are marked rejected, and
+// those whose destination couldn't be reached are left inactive for the
+// re-check job to revive. Replaced links that were disabled or flagged stay
+// that way.
+func validateLink(cfg *config.Config, task validationTask) {
+	ctx := context.Background()
+	urlMapping, err := store.Links.GetByCode(ctx, task.ShortCode)
+	if errors.Is(err, store.ErrNotFound) {
+		return // deleted while queued
+	}
+	if err != nil {
+		log.Printf("Error loading link %s for validation: %v", task.ShortCode, err)
+		return
+	}
+	if !urlMapping.PendingValidation {
+		return // updated, and so checked, while queued
+	}
+
+	link := &ShortenURLRequest{URL: urlMapping.OriginalUrl, IntendedLiveDate: urlMapping.IntendedLiveDate}
+	status, destination, err := checkDestination(ctx, cfg, link, task.From)
+	var linkErr *linkError
+	switch {
+	case errors.As(err, &linkErr):
+		log.Printf("Link %s failed validation: %s", urlMapping.ShortCode, linkErr.message)
+		status = "rejected"
+	case err != nil:
+		log.Printf("Error checking destination of link %s: %v", urlMapping.ShortCode, err)
+		status = "inactive"
+	default:
+		urlMapping.OriginalUrl = link.URL // unwrapped under the "resolve" shortener policy
+		urlMapping.FinalUrl = destination.FinalURL
+		urlMapping.ContentType = destination.ContentType
+		urlMapping.DownloadType = destination.DownloadType
+	}
+	previous := urlMapping.Status
+	urlMapping.Status = keepModeration(previous, status)
+	urlMapping.PendingValidation = false
+	urlMapping.LastCheckedAt = time.Now()
+
+	if err := store.Links.Update(ctx, &urlMapping); err != nil {
+		log.Printf("Error saving validation result for link %s: %v", urlMapping.ShortCode, err)
+		return
+	}
+	if urlMapping.Status == "flagged" && previous != "flagged" {
+		webhooks.Raise(webhooks.LinkFlagged, urlMapping)
+	}
+}
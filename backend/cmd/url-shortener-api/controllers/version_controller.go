@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"net/http"
+
+	"url-shortener/version"
+)
+
+// GetVersion reports the version, commit and build time of the running
+// binary, so deployments can check what they're serving.
+func GetVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		respondWithJSON(w, version.Get())
+	}
+}
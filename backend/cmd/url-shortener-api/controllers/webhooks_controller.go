@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/store"
+	"url-shortener/webhooks"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateWebhookRequest subscribes a URL to link events. Fields narrows
+// the payloads sent to the listed fields, to keep out data the receiver
+// doesn't need; without it payloads are sent whole.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// UpdateWebhookRequest changes a subscription's events or fields or pauses
+// it; omitted fields are left as they are, and an empty fields list sends
+// payloads whole again.
+type UpdateWebhookRequest struct {
+	Events *[]string `json:"events"`
+	Fields *[]string `json:"fields"`
+	Active *bool     `json:"active"`
+}
+
+// WebhookResponse describes a webhook subscription. Secret is only set when
+// the subscription is created.
+type WebhookResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Fields    []string  `json:"fields,omitempty"`
+	Active    bool      `json:"active"`
+	AllLinks  bool      `json:"all_links"` // made with the admin token, so it covers every link
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDeliveryResponse is one entry of a subscription's delivery log.
+// NextAttemptAt is only set while the delivery is pending.
+type WebhookDeliveryResponse struct {
+	ID             uint            `json:"id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// CreateWebhook subscribes a URL to events about the current user's links,
+// or about every link when called with the admin token. The signing secret
+// is only ever returned here.
+func CreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if parsed, err := url.Parse(req.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			respondWithError(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+			return
+		}
+		if msg := validateWebhookEvents(req.Events); msg != "" {
+			respondWithError(w, msg, http.StatusBadRequest)
+			return
+		}
+		if msg := validateWebhookFields(req.Fields); msg != "" {
+			respondWithError(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			log.Println("Error generating webhook secret:", err)
+			respondWithError(w, "Error creating webhook. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		subscription := models.WebhookSubscription{URL: req.URL, Secret: secret, Events: req.Events, Fields: req.Fields, Active: true}
+		if userID, ok := middlewares.UserID(r); ok {
+			subscription.OwnerID = &userID
+		}
+		if err := db.DB.WithContext(r.Context()).Create(&subscription).Error; err != nil {
+			log.Println("Error saving webhook subscription:", err)
+			respondWithError(w, "Error creating webhook. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		response := newWebhookResponse(subscription)
+		response.Secret = secret
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// ListWebhooks returns the current user's webhook subscriptions, or every
+// subscription for admins.
+func ListWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := db.DB.WithContext(r.Context()).Order("id")
+		if !middlewares.IsAdmin(r) {
+			userID, _ := middlewares.UserID(r)
+			query = query.Where("owner_id = ?", userID)
+		}
+
+		var subscriptions []models.WebhookSubscription
+		if err := query.Find(&subscriptions).Error; err != nil {
+			log.Println("Error listing webhook subscriptions:", err)
+			respondWithError(w, "Error listing webhooks.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]WebhookResponse, 0, len(subscriptions))
+		for _, subscription := range subscriptions {
+			response = append(response, newWebhookResponse(subscription))
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// UpdateWebhook changes the events a subscription gets and the fields sent
+// with them, or turns it on or off. Events raised while it's off aren't delivered later.
+func UpdateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription, ok := findWebhook(w, r)
+		if !ok {
+			return
+		}
+
+		var req UpdateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if req.Events != nil {
+			if msg := validateWebhookEvents(*req.Events); msg != "" {
+				respondWithError(w, msg, http.StatusBadRequest)
+				return
+			}
+			subscription.Events = *req.Events
+		}
+		if req.Fields != nil {
+			if msg := validateWebhookFields(*req.Fields); msg != "" {
+				respondWithError(w, msg, http.StatusBadRequest)
+				return
+			}
+			subscription.Fields = *req.Fields
+		}
+		if req.Active != nil {
+			subscription.Active = *req.Active
+		}
+
+		if err := db.DB.WithContext(r.Context()).Model(&subscription).Select("events", "fields", "active").Updates(&subscription).Error; err != nil {
+			log.Println("Error updating webhook subscription:", err)
+			respondWithError(w, "Error updating webhook. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		respondWithJSON(w, newWebhookResponse(subscription))
+	}
+}
+
+// DeleteWebhook removes a webhook subscription along with its delivery log,
+// including deliveries not yet sent.
+func DeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription, ok := findWebhook(w, r)
+		if !ok {
+			return
+		}
+
+		err := db.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&subscription).Error
+		})
+		if err != nil {
+			log.Println("Error deleting webhook subscription:", err)
+			respondWithError(w, "Error deleting webhook. Please try again.", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListWebhookDeliveries returns a subscription's delivery log, newest
+// first. ?status= narrows it to pending, succeeded or failed deliveries.
+func ListWebhookDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription, ok := findWebhook(w, r)
+		if !ok {
+			return
+		}
+		page, ok := parsePage(w, r)
+		if !ok {
+			return
+		}
+
+		query := store.Paginate(db.DB.WithContext(r.Context()).Where("subscription_id = ?", subscription.ID), "created_at", page.After)
+		switch status := r.URL.Query().Get("status"); status {
+		case "":
+		case models.DeliveryPending, models.DeliverySucceeded, models.DeliveryFailed:
+			query = query.Where("status = ?", status)
+		default:
+			respondWithError(w, "status must be pending, succeeded or failed", http.StatusBadRequest)
+			return
+		}
+
+		var deliveries []models.WebhookDelivery
+		if err := query.Limit(page.Limit).Find(&deliveries).Error; err != nil {
+			log.Println("Error listing webhook deliveries:", err)
+			respondWithError(w, "Error listing deliveries.", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]WebhookDeliveryResponse, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			entry := WebhookDeliveryResponse{
+				ID:             delivery.ID,
+				Event:          delivery.Event,
+				Status:         delivery.Status,
+				Attempts:       delivery.Attempts,
+				LastStatusCode: delivery.LastStatusCode,
+				LastError:      delivery.LastError,
+				DeliveredAt:    delivery.DeliveredAt,
+				CreatedAt:      delivery.CreatedAt,
+				Payload:        json.RawMessage(delivery.Payload),
+			}
+			if delivery.Status == models.DeliveryPending {
+				nextAttemptAt := delivery.NextAttemptAt
+				entry.NextAttemptAt = &nextAttemptAt
+			}
+			response = append(response, entry)
+		}
+		if len(deliveries) > 0 {
+			last := deliveries[len(deliveries)-1]
+			page.setNext(w, len(deliveries), store.Cursor{Time: last.CreatedAt, ID: last.ID})
+		}
+		respondWithJSON(w, response)
+	}
+}
+
+// findWebhook loads the subscription named in the route, writing a 404 if
+// it doesn't exist or, for non-admins, belongs to someone else.
+func findWebhook(w http.ResponseWriter, r *http.Request) (models.WebhookSubscription, bool) {
+	var subscription models.WebhookSubscription
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, "Webhook not found.", http.StatusNotFound)
+		return subscription, false
+	}
+
+	query := db.DB.WithContext(r.Context())
+	if !middlewares.IsAdmin(r) {
+		userID, _ := middlewares.UserID(r)
+		query = query.Where("owner_id = ?", userID)
+	}
+	if err := query.First(&subscription, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondWithError(w, "Webhook not found.", http.StatusNotFound)
+		} else {
+			log.Printf("Error retrieving webhook subscription: %v", err)
+			respondWithError(w, "Internal server error.", http.StatusInternalServerError)
+		}
+		return subscription, false
+	}
+	return subscription, true
+}
+
+// validateWebhookEvents returns the message to reject events with, or ""
+// if they're all known and there is at least one.
+func validateWebhookEvents(events []string) string {
+	if len(events) == 0 {
+		return fmt.Sprintf("events must list at least one of %s", strings.Join(webhooks.Events, ", "))
+	}
+	for _, event := range events {
+		if !webhooks.ValidEvent(event) {
+			return fmt.Sprintf("Unknown event %q; events are %s", event, strings.Join(webhooks.Events, ", "))
+		}
+	}
+	return ""
+}
+
+// validateWebhookFields returns the message to reject fields with, or "" if
+// they're all payload fields a subscription can ask for.
+func validateWebhookFields(fields []string) string {
+	for _, field := range fields {
+		if !webhooks.ValidField(field) {
+			return fmt.Sprintf("Unknown field %q; fields are %s", field, strings.Join(webhooks.Fields, ", "))
+		}
+	}
+	return ""
+}
+
+func newWebhookResponse(subscription models.WebhookSubscription) WebhookResponse {
+	return WebhookResponse{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		Events:    subscription.Events,
+		Fields:    subscription.Fields,
+		Active:    subscription.Active,
+		AllLinks:  subscription.OwnerID == nil,
+		CreatedAt: subscription.CreatedAt,
+	}
+}
@@ -0,0 +1,131 @@
+package customdomains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// ChallengeLabel is prepended to a claimed host to name the DNS TXT record
+// that must hold its token.
+const ChallengeLabel = "_url-shortener-challenge"
+
+// refreshInterval is how often the verified domains are reloaded, so those
+// verified or removed through other instances take effect everywhere.
+const refreshInterval = time.Minute
+
+var cache struct {
+	sync.Mutex
+	owners   map[string]uint // verified host -> owner ID
+	loadedAt time.Time
+}
+
+// Invalidate makes the next lookup reload the verified domains. Call it
+// after verifying or removing one.
+func Invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.owners = nil
+}
+
+// Verified reports whether host is a verified custom domain, along with
+// the ID of the user it belongs to.
+func Verified(host string) (uint, bool) {
+	ownerID, ok := verifiedOwners()[NormalizeHost(host)]
+	return ownerID, ok
+}
+
+// NormalizeHost lowercases host and strips any trailing dot.
+func NormalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// ChallengeName is the name of the TXT record host's token must be put in.
+func ChallengeName(host string) string {
+	return ChallengeLabel + "." + host
+}
+
+// GenerateToken returns a new random challenge token.
+func GenerateToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "url-shortener-verification=" + hex.EncodeToString(buf), nil
+}
+
+// NewResolver returns a resolver that asks the DNS server at addr, a
+// host:port, or the system's resolver when addr is empty.
+func NewResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// CheckChallenge looks up host's challenge record, returning an error that
+// says what's wrong unless one of its TXT records is token. The error is
+// safe to show to the domain's owner.
+func CheckChallenge(ctx context.Context, resolver *net.Resolver, host, token string) error {
+	name := ChallengeName(host)
+	records, err := resolver.LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return fmt.Errorf("No TXT record found at %s", name)
+	case errors.As(err, &dnsErr):
+		// Leaves out the resolver's address, which the owner has no use for
+		return fmt.Errorf("Looking up %s failed: %s", name, dnsErr.Err)
+	case err != nil:
+		return fmt.Errorf("Looking up %s failed", name)
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == token {
+			return nil
+		}
+	}
+	return fmt.Errorf("The TXT record at %s doesn't hold the verification token", name)
+}
+
+func verifiedOwners() map[string]uint {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.owners != nil && time.Since(cache.loadedAt) < refreshInterval {
+		return cache.owners
+	}
+
+	var domains []models.CustomDomain
+	if err := db.DB.Select("host", "owner_id").Where("verified_at IS NOT NULL").Find(&domains).Error; err != nil {
+		// Keep serving the domains we knew of rather than none
+		log.Println("Error loading custom domains:", err)
+		if cache.owners == nil {
+			return map[string]uint{}
+		}
+		return cache.owners
+	}
+
+	owners := make(map[string]uint, len(domains))
+	for _, domain := range domains {
+		owners[domain.Host] = domain.OwnerID
+	}
+	cache.owners = owners
+	cache.loadedAt = time.Now()
+	return owners
+}
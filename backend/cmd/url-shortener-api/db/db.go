@@ -1,35 +1,134 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"log"
-	"os"
+	"strings"
+	"time"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
-	//Load project config and models
-	"url-shortener/models"
+	//Load project config
+	"url-shortener/chaos"
+	"url-shortener/config"
 )
 
 var DB *gorm.DB
 
-func InitDatabase() {
-	var err error
-	dbConnectionString := os.Getenv("DB_CONNECTION_STRING")
-	if dbConnectionString == "" {
-		log.Fatal("DB_CONNECTION_STRING environment variable is not set")
+// Replica serves read-heavy queries that can tolerate replication lag, such
+// as redirects and stats. It's DB itself unless a replica is configured.
+var Replica *gorm.DB
+
+// maxConnectRetryDelay caps the backoff between connection attempts.
+const maxConnectRetryDelay = 30 * time.Second
+
+// InitDatabase connects to the database and, unless DB_AUTO_MIGRATE is
+// off, brings its schema up to date.
+func InitDatabase(cfg config.Config) {
+	Connect(cfg)
+
+	if !cfg.DBAutoMigrate {
+		log.Println("Database connection established; migrations skipped (DB_AUTO_MIGRATE=false)")
+		return
+	}
+	if _, err := Migrate(cfg.DBDriver); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
+	log.Println("Database connection established and migrations completed")
+}
+
+// Connect opens the database configured by cfg, and its read replica if
+// one is set, without touching the schema.
+func Connect(cfg config.Config) {
+	// The driver and connection strings were checked by cfg.Validate
+	dbConnectionString := cfg.DBConnectionString
+	if cfg.DBDriver == "sqlite" && dbConnectionString == "" {
+		dbConnectionString = "url-shortener.db"
+	}
+
+	DB = open(cfg, dbConnectionString, "database")
+	Replica = DB
+	if cfg.DBReplicaConnectionString != "" {
+		Replica = open(cfg, cfg.DBReplicaConnectionString, "read replica")
 	}
+}
 
-	DB, err = gorm.Open(postgres.Open(dbConnectionString), &gorm.Config{})
+// Ping checks that conn's database answers within ctx.
+func Ping(ctx context.Context, conn *gorm.DB) error {
+	sqlDB, err := conn.DB()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return err
 	}
+	return sqlDB.PingContext(ctx)
+}
 
-	// Auto-migrate the models
-	err = DB.AutoMigrate(&models.UrlMapping{}, &models.MaliciousLog{})
+// Close closes the read replica's connection pool, if separate, and then
+// the primary's.
+func Close() error {
+	var errs []error
+	if Replica != nil && Replica != DB {
+		errs = append(errs, closePool(Replica))
+	}
+	if DB != nil {
+		errs = append(errs, closePool(DB))
+	}
+	return errors.Join(errs...)
+}
+
+func closePool(conn *gorm.DB) error {
+	sqlDB, err := conn.DB()
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return err
 	}
+	return sqlDB.Close()
+}
 
-	log.Println("Database connection established and migrations completed")
+// open connects to dsn with cfg's driver and pool settings, retrying while
+// the database comes up.
+func open(cfg config.Config, dsn, name string) *gorm.DB {
+	var dialector gorm.Dialector
+	if cfg.DBDriver == "sqlite" {
+		// Background jobs write alongside requests, so wait out locks
+		if !strings.Contains(dsn, "?") {
+			dsn += "?_busy_timeout=5000&_journal_mode=WAL"
+		}
+		dialector = sqlite.Open(dsn)
+	} else {
+		dialector = postgres.Open(dsn)
+	}
+
+	// The database may still be starting alongside us, so retry with backoff
+	var conn *gorm.DB
+	var err error
+	delay := cfg.DBConnectRetryDelay
+	for attempt := 1; ; attempt++ {
+		conn, err = gorm.Open(dialector, &gorm.Config{})
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.DBConnectAttempts {
+			log.Fatalf("Failed to connect to %s: %v", name, err)
+		}
+		log.Printf("The %s is not reachable (attempt %d of %d), retrying in %s: %v", name, attempt, cfg.DBConnectAttempts, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, maxConnectRetryDelay)
+	}
+
+	sqlDB, err := conn.DB()
+	if err != nil {
+		log.Fatalf("Failed to access %s connection pool: %v", name, err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	if err := chaos.RegisterGormCallbacks(conn); err != nil {
+		log.Fatal("Failed to register chaos callbacks:", err)
+	}
+	return conn
 }
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"database/sql"
+
+	"url-shortener/metrics"
+)
+
+// Connection pool stats are read from database/sql on each scrape. The
+// replica only has its own series when one is configured.
+func init() {
+	metrics.NewGaugeFunc("db_connections", "Open database connections, by database and state.",
+		func(set func(float64, ...string)) {
+			eachPool(func(name string, stats sql.DBStats) {
+				set(float64(stats.InUse), name, "in_use")
+				set(float64(stats.Idle), name, "idle")
+			})
+		}, "db", "state")
+	metrics.NewGaugeFunc("db_max_open_connections", "Maximum open connections allowed, by database.",
+		func(set func(float64, ...string)) {
+			eachPool(func(name string, stats sql.DBStats) {
+				set(float64(stats.MaxOpenConnections), name)
+			})
+		}, "db")
+	metrics.NewCounterFunc("db_wait_count_total", "Times a query waited for a free connection, by database.",
+		func(set func(float64, ...string)) {
+			eachPool(func(name string, stats sql.DBStats) {
+				set(float64(stats.WaitCount), name)
+			})
+		}, "db")
+	metrics.NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for a free connection, by database.",
+		func(set func(float64, ...string)) {
+			eachPool(func(name string, stats sql.DBStats) {
+				set(stats.WaitDuration.Seconds(), name)
+			})
+		}, "db")
+}
+
+// eachPool calls fn with the stats of the primary pool and, if separate,
+// the replica's.
+func eachPool(fn func(name string, stats sql.DBStats)) {
+	if DB == nil {
+		return
+	}
+	if sqlDB, err := DB.DB(); err == nil {
+		fn("primary", sqlDB.Stats())
+	}
+	if Replica != nil && Replica != DB {
+		if sqlDB, err := Replica.DB(); err == nil {
+			fn("replica", sqlDB.Stats())
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema changes are plain SQL files under migrations/<driver>/, named
+// NNNN_description.up.sql with a matching .down.sql that reverts it. Every
+// change needs a pair for each driver, with the same version number.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migration is one versioned schema change.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState describes a migration and whether it has been applied.
+type MigrationState struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// schemaMigration records an applied migration.
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// baselineTable is created by the first migration. A database that has it
+// but no migration history was set up by AutoMigrate before migrations
+// existed. It may predate parts of migration 1 too, so it's completed to
+// match before being adopted.
+const baselineTable = "url_mappings"
+
+// loadMigrations reads the embedded migrations for driver, oldest first.
+func loadMigrations(driver string) ([]migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q: %w", driver, err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		versionText, description, ok := strings.Cut(strings.TrimSuffix(name, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s: name must look like NNNN_description.%s.sql", name, direction)
+		}
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{Version: version, Name: description}
+			byVersion[version] = m
+		} else if m.Name != description {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, description)
+		}
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedMigrations returns the applied versions, creating the history table
+// on first use and adopting a pre-migrations schema as the baseline.
+func appliedMigrations(migrations []migration) (map[int]schemaMigration, error) {
+	if !DB.Migrator().HasTable(&schemaMigration{}) {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&schemaMigration{}); err != nil {
+				return err
+			}
+			if !tx.Migrator().HasTable(baselineTable) || len(migrations) == 0 {
+				return nil
+			}
+			baseline := schemaMigration{Version: migrations[0].Version, Name: migrations[0].Name, AppliedAt: time.Now()}
+			if err := completeBaseline(tx, migrations[0].Up); err != nil {
+				return fmt.Errorf("completing existing schema to migration %04d_%s: %w", baseline.Version, baseline.Name, err)
+			}
+			return tx.Create(&baseline).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		if DB.Migrator().HasTable(baselineTable) && len(migrations) > 0 {
+			log.Printf("Adopted existing schema as migration %04d_%s", migrations[0].Version, migrations[0].Name)
+		}
+	}
+
+	var rows []schemaMigration
+	if err := DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Migrate applies every pending migration for driver, each in its own
+// transaction, and returns how many it applied.
+func Migrate(driver string) (int, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, done := applied[m.Version]; done {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, m.Up); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown reverts the most recent steps applied migrations for driver.
+func MigrateDown(driver string, steps int) error {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(migrations)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, done := applied[m.Version]; !done {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, m.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+		steps--
+	}
+	return nil
+}
+
+// MigrationStatus lists driver's migrations and when each was applied.
+func MigrationStatus(driver string) ([]MigrationState, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Version: m.Version, Name: m.Name}
+		if row, done := applied[m.Version]; done {
+			appliedAt := row.AppliedAt
+			states[i].AppliedAt = &appliedAt
+		}
+	}
+	return states, nil
+}
+
+// PendingMigrations returns how many of driver's migrations haven't been
+// applied.
+func PendingMigrations(driver string) (int, error) {
+	states, err := MigrationStatus(driver)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// execScript runs a migration file one statement at a time.
+func execScript(tx *gorm.DB, script string) error {
+	for _, statement := range scriptStatements(script) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scriptStatements splits a migration file into statements. Statements end
+// with a semicolon at the end of a line, outside any $$-quoted function body.
+func scriptStatements(script string) []string {
+	var statements []string
+	var statement strings.Builder
+	quoted := false
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !quoted && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.Count(line, "$$")%2 == 1 {
+			quoted = !quoted
+		}
+		if !quoted && strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, statement.String())
+			statement.Reset()
+		}
+	}
+	if strings.TrimSpace(statement.String()) != "" {
+		statements = append(statements, statement.String())
+	}
+	return statements
+}
+
+// completeBaseline brings a schema AutoMigrate made up to the first
+// migration, whose script is made of CREATE TABLE and CREATE INDEX
+// statements only. Tables it lacks are created, columns it lacks are added
+// with their foreign keys, varchar columns narrower than the script's are
+// widened, and missing indexes are created. The oldest schemas have just
+// url_mappings, with a shorter short_code, and malicious_logs.
+func completeBaseline(tx *gorm.DB, script string) error {
+	for _, statement := range scriptStatements(script) {
+		table, columns, isTable := parseCreateTable(statement)
+		var err error
+		switch {
+		case !isTable:
+			err = tx.Exec(createIfNotExists(statement)).Error
+		case !tx.Migrator().HasTable(unquote(table)):
+			err = tx.Exec(statement).Error
+		default:
+			err = completeTable(tx, table, columns)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// baselineColumn is a column of a CREATE TABLE statement, with its name
+// quoted as in the script.
+type baselineColumn struct {
+	Name       string
+	Definition string // the type and constraints after the name
+	References string // the REFERENCES clause of its foreign key, if any
+}
+
+// parseCreateTable returns the quoted table name and columns of a CREATE
+// TABLE statement, one column or table constraint per line.
+func parseCreateTable(statement string) (string, []baselineColumn, bool) {
+	lines := strings.Split(strings.TrimSpace(statement), "\n")
+	head, ok := strings.CutPrefix(strings.TrimSpace(lines[0]), "CREATE TABLE ")
+	if !ok {
+		return "", nil, false
+	}
+	table := strings.TrimSpace(strings.TrimSuffix(head, "("))
+
+	var columns []baselineColumn
+	references := make(map[string]string)
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+		switch {
+		case strings.HasPrefix(line, "CONSTRAINT "):
+			_, foreignKey, ok := strings.Cut(line, "FOREIGN KEY (")
+			column, clause, _ := strings.Cut(foreignKey, ")")
+			if ok {
+				references[column] = strings.TrimSpace(clause)
+			}
+		case strings.HasPrefix(line, "PRIMARY KEY"), strings.HasPrefix(line, ")"), line == "":
+		default:
+			name, definition, _ := strings.Cut(line, " ")
+			columns = append(columns, baselineColumn{Name: name, Definition: definition})
+		}
+	}
+	for i := range columns {
+		columns[i].References = references[columns[i].Name]
+	}
+	return table, columns, true
+}
+
+// completeTable adds the columns table lacks and widens its varchar columns.
+func completeTable(tx *gorm.DB, table string, columns []baselineColumn) error {
+	existing, err := tx.Migrator().ColumnTypes(unquote(table))
+	if err != nil {
+		return err
+	}
+	lengths := make(map[string]int64, len(existing))
+	for _, column := range existing {
+		length, _ := column.Length()
+		lengths[column.Name()] = length
+	}
+
+	for _, column := range columns {
+		length, exists := lengths[unquote(column.Name)]
+		if !exists {
+			definition := strings.TrimSpace(column.Definition + " " + column.References)
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column.Name, definition)).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		// SQLite doesn't enforce lengths, so only PostgreSQL needs widening
+		var want int64
+		if _, err := fmt.Sscanf(column.Definition, "varchar(%d)", &want); err != nil || tx.Dialector.Name() != "postgres" || length == 0 || length >= want {
+			continue
+		}
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE varchar(%d)", table, column.Name, want)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIfNotExists makes a CREATE INDEX statement skip existing indexes.
+func createIfNotExists(statement string) string {
+	if strings.Contains(statement, " IF NOT EXISTS ") {
+		return statement
+	}
+	statement = strings.Replace(statement, "CREATE INDEX ", "CREATE INDEX IF NOT EXISTS ", 1)
+	return strings.Replace(statement, "CREATE UNIQUE INDEX ", "CREATE UNIQUE INDEX IF NOT EXISTS ", 1)
+}
+
+// unquote strips the backticks or double quotes around a name.
+func unquote(name string) string {
+	return strings.Trim(name, "`\"")
+}
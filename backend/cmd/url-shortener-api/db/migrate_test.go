@@ -0,0 +1,117 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+)
+
+// preMigrationsSchema is what AutoMigrate made of the first models, before
+// links had owners or migrations existed.
+const preMigrationsSchema = "CREATE TABLE `url_mappings` (`id` integer PRIMARY KEY AUTOINCREMENT,`short_code` varchar(10),`original_url` text NOT NULL,`created_at` datetime,`intended_live_date` timestamp,`intended_expiry_date` timestamp,`last_checked_at` timestamp,`status` varchar(20) DEFAULT 'pending',`check_interval` integer DEFAULT 24);\n" +
+	"CREATE UNIQUE INDEX `idx_url_mappings_short_code` ON `url_mappings`(`short_code`);\n" +
+	"CREATE TABLE `malicious_logs` (`id` integer PRIMARY KEY AUTOINCREMENT,`url` text NOT NULL,`user_agent` varchar(512),`ip_address` varchar(45),`risk_score` integer,`details` text,`created_at` datetime);\n" +
+	"INSERT INTO `url_mappings` (`short_code`, `original_url`, `created_at`, `last_checked_at`, `status`) VALUES ('old', 'https://example.com/old', '2024-01-02 03:04:05', '2024-01-02 03:04:05', 'live');\n"
+
+func TestMigrateAdoptsExistingSchema(t *testing.T) {
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		setup       func(t *testing.T)
+		wantApplied int
+		wantLinks   []string // short codes after adding one called new
+	}{
+		{
+			name:        "empty database",
+			setup:       func(t *testing.T) {},
+			wantApplied: len(migrations),
+			wantLinks:   []string{"new"},
+		},
+		{
+			name: "before migrations",
+			setup: func(t *testing.T) {
+				if err := execScript(DB, preMigrationsSchema); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantApplied: len(migrations) - 1,
+			wantLinks:   []string{"old", "new"},
+		},
+		{
+			name: "first migration without its history",
+			setup: func(t *testing.T) {
+				if err := execScript(DB, migrations[0].Up); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantApplied: len(migrations) - 1,
+			wantLinks:   []string{"new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Connect(config.Config{
+				DBDriver:           "sqlite",
+				DBConnectionString: filepath.Join(t.TempDir(), "migrate.db"),
+				DBConnectAttempts:  1,
+			})
+			t.Cleanup(func() { Close() })
+			tt.setup(t)
+
+			applied, err := Migrate("sqlite")
+			if err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+			if applied != tt.wantApplied {
+				t.Errorf("Migrate() applied %d migrations, want %d", applied, tt.wantApplied)
+			}
+			pending, err := PendingMigrations("sqlite")
+			if err != nil || pending != 0 {
+				t.Errorf("PendingMigrations() = %d, %v, want none", pending, err)
+			}
+
+			// Every table and column of the first migration is there
+			checked := 0
+			for _, statement := range scriptStatements(migrations[0].Up) {
+				table, columns, ok := parseCreateTable(statement)
+				if !ok {
+					continue
+				}
+				for _, column := range columns {
+					checked++
+					if !DB.Migrator().HasColumn(unquote(table), unquote(column.Name)) {
+						t.Errorf("%s has no column %s", table, column.Name)
+					}
+				}
+			}
+			if checked == 0 {
+				t.Fatal("parsed no columns from the first migration")
+			}
+			if !DB.Migrator().HasIndex("url_mappings", "idx_url_mappings_owner_id") {
+				t.Error("url_mappings has no owner index")
+			}
+
+			// Links made before migrating are kept, and owned ones can be added
+			err = DB.Exec("INSERT INTO users (email, password_hash) VALUES ('owner@example.com', 'unused')").Error
+			if err == nil {
+				err = DB.Exec("INSERT INTO url_mappings (short_code, original_url, owner_id, created_at) VALUES ('new', 'https://example.com/new', 1, ?)", time.Now()).Error
+			}
+			if err != nil {
+				t.Fatalf("creating a link after migrating: %v", err)
+			}
+			var codes []string
+			if err := DB.Table("url_mappings").Order("id").Pluck("short_code", &codes).Error; err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(codes, tt.wantLinks) {
+				t.Errorf("links %v, want %v", codes, tt.wantLinks)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS "abuse_reports";
+DROP TABLE IF EXISTS "blocked_domains";
+DROP TABLE IF EXISTS "invitations";
+DROP TABLE IF EXISTS "memberships";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "api_key_usages";
+DROP TABLE IF EXISTS "api_keys";
+DROP TABLE IF EXISTS "user_identities";
+DROP TABLE IF EXISTS "conversion_events";
+DROP TABLE IF EXISTS "click_rollups";
+DROP TABLE IF EXISTS "engagement_events";
+DROP TABLE IF EXISTS "click_events";
+DROP TABLE IF EXISTS "malicious_logs";
+DROP TABLE IF EXISTS "url_mappings";
+DROP TABLE IF EXISTS "organizations";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,238 @@
+CREATE TABLE "users" (
+    "id" bigserial,
+    "email" varchar(255) NOT NULL,
+    "password_hash" varchar(100) NOT NULL,
+    "role" varchar(20) DEFAULT 'user',
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+
+CREATE TABLE "organizations" (
+    "id" bigserial,
+    "name" varchar(100) NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE "url_mappings" (
+    "id" bigserial,
+    "short_code" varchar(32),
+    "owner_id" bigint,
+    "organization_id" bigint,
+    "original_url" text NOT NULL,
+    "final_url" text,
+    "content_type" varchar(100),
+    "download_type" varchar(10),
+    "created_at" timestamptz,
+    "intended_live_date" timestamp,
+    "intended_expiry_date" timestamp,
+    "last_checked_at" timestamp,
+    "status" varchar(20) DEFAULT 'pending',
+    "check_interval" bigint DEFAULT 24,
+    "forward_query" boolean,
+    "interstitial_seconds" bigint DEFAULT 0,
+    "language_targets" text,
+    "response_headers" text,
+    "hide_referrer" boolean DEFAULT false,
+    "proxy_content" boolean DEFAULT false,
+    "track_engagement" boolean DEFAULT false,
+    "print_campaign" boolean DEFAULT false,
+    "managed" boolean DEFAULT false,
+    "disabled_by_reports" boolean DEFAULT false,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_url_mappings_owner" FOREIGN KEY ("owner_id") REFERENCES "users"("id") ON DELETE SET NULL,
+    CONSTRAINT "fk_url_mappings_organization" FOREIGN KEY ("organization_id") REFERENCES "organizations"("id") ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS "idx_url_mappings_organization_id" ON "url_mappings" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_url_mappings_owner_id" ON "url_mappings" ("owner_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_url_mappings_short_code" ON "url_mappings" ("short_code");
+
+CREATE TABLE "malicious_logs" (
+    "id" bigserial,
+    "url" text NOT NULL,
+    "user_agent" varchar(512),
+    "ip_address" varchar(45),
+    "risk_score" bigint,
+    "details" text,
+    "disabled_at" timestamp,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_malicious_logs_risk_score" ON "malicious_logs" ("risk_score");
+
+CREATE TABLE "click_events" (
+    "id" bigserial,
+    "click_id" varchar(36),
+    "url_mapping_id" bigint NOT NULL,
+    "created_at" timestamptz,
+    "ip_address" varchar(45),
+    "user_agent" varchar(512),
+    "referrer" text,
+    "referrer_host" varchar(255),
+    "utm_source" varchar(255),
+    "utm_medium" varchar(255),
+    "utm_campaign" varchar(255),
+    "country" varchar(2),
+    "region" varchar(100),
+    "is_bot" boolean DEFAULT false,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_click_events_created_at" ON "click_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_click_events_is_bot" ON "click_events" ("is_bot");
+CREATE INDEX IF NOT EXISTS "idx_click_events_referrer_host" ON "click_events" ("referrer_host");
+CREATE INDEX IF NOT EXISTS "idx_click_events_url_mapping_id" ON "click_events" ("url_mapping_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_click_events_click_id" ON "click_events" ("click_id");
+
+CREATE TABLE "engagement_events" (
+    "id" bigserial,
+    "click_id" varchar(36) NOT NULL,
+    "duration_ms" bigint,
+    "interacted" boolean,
+    "bounced" boolean,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_engagement_events_bounced" ON "engagement_events" ("bounced");
+CREATE INDEX IF NOT EXISTS "idx_engagement_events_click_id" ON "engagement_events" ("click_id");
+
+CREATE TABLE "click_rollups" (
+    "id" bigserial,
+    "url_mapping_id" bigint NOT NULL,
+    "day" timestamptz NOT NULL,
+    "referrer_host" varchar(255),
+    "utm_source" varchar(255),
+    "utm_medium" varchar(255),
+    "utm_campaign" varchar(255),
+    "country" varchar(2),
+    "region" varchar(100),
+    "browser" varchar(100),
+    "os" varchar(100),
+    "device_class" varchar(20),
+    "is_bot" boolean DEFAULT false,
+    "clicks" bigint NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_click_rollups_link_day" ON "click_rollups" ("url_mapping_id","day");
+
+CREATE TABLE "conversion_events" (
+    "id" bigserial,
+    "url_mapping_id" bigint NOT NULL,
+    "click_id" varchar(36),
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_conversion_events_click_id" ON "conversion_events" ("click_id");
+CREATE INDEX IF NOT EXISTS "idx_conversion_events_url_mapping_id" ON "conversion_events" ("url_mapping_id");
+
+CREATE TABLE "user_identities" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "provider" varchar(20) NOT NULL,
+    "subject" varchar(255) NOT NULL,
+    "email" varchar(255),
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_identities_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_user_identities_user_id" ON "user_identities" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_identities_provider_subject" ON "user_identities" ("provider","subject");
+
+CREATE TABLE "api_keys" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "name" varchar(100),
+    "prefix" varchar(16) NOT NULL,
+    "key_hash" varchar(64) NOT NULL,
+    "daily_quota" bigint,
+    "monthly_quota" bigint,
+    "rate_limit_rps" decimal,
+    "rate_limit_burst" bigint,
+    "last_used_at" timestamp,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_api_keys_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_api_keys_user_id" ON "api_keys" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_key_hash" ON "api_keys" ("key_hash");
+
+CREATE TABLE "api_key_usages" (
+    "id" bigserial,
+    "api_key_id" bigint NOT NULL,
+    "day" date NOT NULL,
+    "count" bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_key_usages_key_day" ON "api_key_usages" ("api_key_id","day");
+
+CREATE TABLE "sessions" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "refresh_token_hash" varchar(64) NOT NULL,
+    "expires_at" timestamp NOT NULL,
+    "revoked_at" timestamp,
+    "last_used_at" timestamp,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_sessions_user_id" ON "sessions" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sessions_refresh_token_hash" ON "sessions" ("refresh_token_hash");
+
+CREATE TABLE "memberships" (
+    "id" bigserial,
+    "organization_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "role" varchar(20) NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_memberships_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_memberships_organization" FOREIGN KEY ("organization_id") REFERENCES "organizations"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_memberships_user_id" ON "memberships" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_memberships_org_user" ON "memberships" ("organization_id","user_id");
+
+CREATE TABLE "invitations" (
+    "id" bigserial,
+    "organization_id" bigint NOT NULL,
+    "email" varchar(255) NOT NULL,
+    "role" varchar(20) NOT NULL,
+    "invited_by_id" bigint,
+    "expires_at" timestamp NOT NULL,
+    "accepted_at" timestamp,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_invitations_organization" FOREIGN KEY ("organization_id") REFERENCES "organizations"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_invitations_invited_by" FOREIGN KEY ("invited_by_id") REFERENCES "users"("id") ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS "idx_invitations_email" ON "invitations" ("email");
+CREATE INDEX IF NOT EXISTS "idx_invitations_organization_id" ON "invitations" ("organization_id");
+
+CREATE TABLE "blocked_domains" (
+    "id" bigserial,
+    "domain" varchar(255) NOT NULL,
+    "action" varchar(10) NOT NULL DEFAULT 'block',
+    "reason" text,
+    "created_by_id" bigint,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_blocked_domains_domain" ON "blocked_domains" ("domain");
+
+CREATE TABLE "abuse_reports" (
+    "id" bigserial,
+    "url_mapping_id" bigint NOT NULL,
+    "reason" varchar(20) NOT NULL,
+    "details" text,
+    "reporter_email" varchar(255),
+    "reporter_ip" varchar(45),
+    "status" varchar(10) NOT NULL DEFAULT 'open',
+    "resolved_by_id" bigint,
+    "resolved_at" timestamp,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_abuse_reports_url_mapping" FOREIGN KEY ("url_mapping_id") REFERENCES "url_mappings"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_abuse_reports_reporter_ip" ON "abuse_reports" ("reporter_ip");
+CREATE INDEX IF NOT EXISTS "idx_abuse_reports_status" ON "abuse_reports" ("status");
+CREATE INDEX IF NOT EXISTS "idx_abuse_reports_url_mapping_id" ON "abuse_reports" ("url_mapping_id");
@@ -0,0 +1,33 @@
+CREATE TABLE "click_events_unpartitioned" (
+    "id" bigint NOT NULL DEFAULT nextval('click_events_id_seq'),
+    "click_id" varchar(36),
+    "url_mapping_id" bigint NOT NULL,
+    "created_at" timestamptz,
+    "ip_address" varchar(45),
+    "user_agent" varchar(512),
+    "referrer" text,
+    "referrer_host" varchar(255),
+    "utm_source" varchar(255),
+    "utm_medium" varchar(255),
+    "utm_campaign" varchar(255),
+    "country" varchar(2),
+    "region" varchar(100),
+    "is_bot" boolean DEFAULT false,
+    PRIMARY KEY ("id")
+);
+
+INSERT INTO "click_events_unpartitioned" ("id","click_id","url_mapping_id","created_at","ip_address","user_agent","referrer","referrer_host","utm_source","utm_medium","utm_campaign","country","region","is_bot")
+SELECT "id","click_id","url_mapping_id","created_at","ip_address","user_agent","referrer","referrer_host","utm_source","utm_medium","utm_campaign","country","region","is_bot"
+FROM "click_events";
+
+ALTER SEQUENCE "click_events_id_seq" OWNED BY "click_events_unpartitioned"."id";
+DROP TABLE "click_events";
+DROP FUNCTION IF EXISTS "create_click_events_partition"(date);
+
+ALTER TABLE "click_events_unpartitioned" RENAME TO "click_events";
+ALTER INDEX "click_events_unpartitioned_pkey" RENAME TO "click_events_pkey";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_click_events_click_id" ON "click_events" ("click_id");
+CREATE INDEX IF NOT EXISTS "idx_click_events_url_mapping_id" ON "click_events" ("url_mapping_id");
+CREATE INDEX IF NOT EXISTS "idx_click_events_created_at" ON "click_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_click_events_referrer_host" ON "click_events" ("referrer_host");
+CREATE INDEX IF NOT EXISTS "idx_click_events_is_bot" ON "click_events" ("is_bot");
@@ -0,0 +1,73 @@
+-- Raw clicks move to a table partitioned by month of created_at (UTC).
+-- Partitions are named click_events_yYYYYmMM and created through
+-- create_click_events_partition; the app keeps upcoming months created and
+-- drops expired ones. click_events_default catches anything outside them.
+-- Existing clicks are copied, so on a large table run this with the migrate
+-- subcommand during a quiet period.
+
+ALTER TABLE "click_events" RENAME TO "click_events_unpartitioned";
+ALTER INDEX "click_events_pkey" RENAME TO "click_events_unpartitioned_pkey";
+ALTER INDEX "idx_click_events_click_id" RENAME TO "idx_click_events_unpartitioned_click_id";
+ALTER INDEX "idx_click_events_url_mapping_id" RENAME TO "idx_click_events_unpartitioned_url_mapping_id";
+ALTER INDEX "idx_click_events_created_at" RENAME TO "idx_click_events_unpartitioned_created_at";
+ALTER INDEX "idx_click_events_referrer_host" RENAME TO "idx_click_events_unpartitioned_referrer_host";
+ALTER INDEX "idx_click_events_is_bot" RENAME TO "idx_click_events_unpartitioned_is_bot";
+
+-- The partition key has to be part of every unique index
+CREATE TABLE "click_events" (
+    "id" bigint NOT NULL DEFAULT nextval('click_events_id_seq'),
+    "click_id" varchar(36),
+    "url_mapping_id" bigint NOT NULL,
+    "created_at" timestamptz NOT NULL,
+    "ip_address" varchar(45),
+    "user_agent" varchar(512),
+    "referrer" text,
+    "referrer_host" varchar(255),
+    "utm_source" varchar(255),
+    "utm_medium" varchar(255),
+    "utm_campaign" varchar(255),
+    "country" varchar(2),
+    "region" varchar(100),
+    "is_bot" boolean DEFAULT false,
+    PRIMARY KEY ("id","created_at")
+) PARTITION BY RANGE ("created_at");
+ALTER SEQUENCE "click_events_id_seq" OWNED BY "click_events"."id";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_click_events_click_id" ON "click_events" ("click_id","created_at");
+CREATE INDEX IF NOT EXISTS "idx_click_events_url_mapping_id" ON "click_events" ("url_mapping_id");
+CREATE INDEX IF NOT EXISTS "idx_click_events_created_at" ON "click_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_click_events_referrer_host" ON "click_events" ("referrer_host");
+CREATE INDEX IF NOT EXISTS "idx_click_events_is_bot" ON "click_events" ("is_bot");
+CREATE TABLE "click_events_default" PARTITION OF "click_events" DEFAULT;
+
+CREATE OR REPLACE FUNCTION "create_click_events_partition"(month date) RETURNS void AS $$
+DECLARE
+    start date := date_trunc('month', month)::date;
+BEGIN
+    EXECUTE format(
+        'CREATE TABLE IF NOT EXISTS %I PARTITION OF "click_events" FOR VALUES FROM (%L) TO (%L)',
+        'click_events_' || to_char(start, '"y"YYYY"m"MM'),
+        start::text || ' 00:00:00+00',
+        (start + interval '1 month')::date::text || ' 00:00:00+00'
+    );
+END
+$$ LANGUAGE plpgsql;
+
+-- Create every month the existing clicks span, through the current one
+DO $$
+DECLARE
+    month date;
+BEGIN
+    SELECT date_trunc('month', COALESCE(MIN("created_at"), now()) AT TIME ZONE 'UTC')::date
+        INTO month FROM "click_events_unpartitioned";
+    WHILE month <= (now() AT TIME ZONE 'UTC')::date LOOP
+        PERFORM "create_click_events_partition"(month);
+        month := (month + interval '1 month')::date;
+    END LOOP;
+END
+$$;
+
+INSERT INTO "click_events" ("id","click_id","url_mapping_id","created_at","ip_address","user_agent","referrer","referrer_host","utm_source","utm_medium","utm_campaign","country","region","is_bot")
+SELECT "id","click_id","url_mapping_id",COALESCE("created_at", to_timestamp(0)),"ip_address","user_agent","referrer","referrer_host","utm_source","utm_medium","utm_campaign","country","region","is_bot"
+FROM "click_events_unpartitioned";
+
+DROP TABLE "click_events_unpartitioned";
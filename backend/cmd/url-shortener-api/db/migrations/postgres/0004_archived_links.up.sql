@@ -0,0 +1,17 @@
+CREATE TABLE "archived_links" (
+    "id" bigserial,
+    "link_id" bigint,
+    "short_code" varchar(32),
+    "owner_id" bigint,
+    "organization_id" bigint,
+    "original_url" text NOT NULL,
+    "link_created_at" timestamp,
+    "intended_expiry_date" timestamp,
+    "clicks" bigint,
+    "archived_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_archived_links_link_id" ON "archived_links" ("link_id");
+CREATE INDEX IF NOT EXISTS "idx_archived_links_short_code" ON "archived_links" ("short_code");
+CREATE INDEX IF NOT EXISTS "idx_archived_links_owner_id" ON "archived_links" ("owner_id");
+CREATE INDEX IF NOT EXISTS "idx_archived_links_organization_id" ON "archived_links" ("organization_id");
@@ -0,0 +1 @@
+ALTER TABLE "url_mappings" DROP COLUMN "pending_validation";
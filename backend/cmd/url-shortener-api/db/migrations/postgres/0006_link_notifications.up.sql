@@ -0,0 +1,3 @@
+ALTER TABLE "users" ADD COLUMN "notify_expiring" boolean DEFAULT true;
+ALTER TABLE "users" ADD COLUMN "notify_dead_links" boolean DEFAULT true;
+ALTER TABLE "url_mappings" ADD COLUMN "expiry_notice_sent_at" timestamp;
@@ -0,0 +1,3 @@
+ALTER TABLE "url_mappings" DROP COLUMN "click_threshold";
+DROP TABLE IF EXISTS "webhook_deliveries";
+DROP TABLE IF EXISTS "webhook_subscriptions";
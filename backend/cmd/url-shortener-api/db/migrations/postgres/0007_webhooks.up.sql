@@ -0,0 +1,32 @@
+CREATE TABLE "webhook_subscriptions" (
+    "id" bigserial,
+    "owner_id" bigint,
+    "url" text NOT NULL,
+    "secret" text NOT NULL,
+    "events" text,
+    "active" boolean DEFAULT true,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_webhook_subscriptions_owner" FOREIGN KEY ("owner_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_webhook_subscriptions_owner_id" ON "webhook_subscriptions" ("owner_id");
+
+CREATE TABLE "webhook_deliveries" (
+    "id" bigserial,
+    "subscription_id" bigint NOT NULL,
+    "event" varchar(50) NOT NULL,
+    "payload" text NOT NULL,
+    "status" varchar(10) NOT NULL DEFAULT 'pending',
+    "attempts" bigint NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamp,
+    "last_status_code" bigint,
+    "last_error" text,
+    "delivered_at" timestamp,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_webhook_deliveries_subscription" FOREIGN KEY ("subscription_id") REFERENCES "webhook_subscriptions"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_subscription_id" ON "webhook_deliveries" ("subscription_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_due" ON "webhook_deliveries" ("status","next_attempt_at");
+
+ALTER TABLE "url_mappings" ADD COLUMN "click_threshold" bigint DEFAULT 0;
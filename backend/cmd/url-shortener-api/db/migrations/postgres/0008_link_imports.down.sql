@@ -0,0 +1,2 @@
+ALTER TABLE "url_mappings" DROP COLUMN "tags";
+DROP TABLE IF EXISTS "link_imports";
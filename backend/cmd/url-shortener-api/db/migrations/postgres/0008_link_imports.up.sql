@@ -0,0 +1,20 @@
+CREATE TABLE "link_imports" (
+    "id" bigserial,
+    "owner_id" bigint,
+    "format" varchar(4) NOT NULL,
+    "status" varchar(10) NOT NULL DEFAULT 'queued',
+    "total_rows" bigint NOT NULL DEFAULT 0,
+    "processed" bigint NOT NULL DEFAULT 0,
+    "succeeded" bigint NOT NULL DEFAULT 0,
+    "failed" bigint NOT NULL DEFAULT 0,
+    "row_errors" text,
+    "error" text,
+    "created_at" timestamptz,
+    "started_at" timestamp,
+    "finished_at" timestamp,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_link_imports_owner" FOREIGN KEY ("owner_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_link_imports_owner_id" ON "link_imports" ("owner_id");
+
+ALTER TABLE "url_mappings" ADD COLUMN "tags" text;
@@ -0,0 +1 @@
+ALTER TABLE "url_mappings" ADD COLUMN "domain" varchar(253) NOT NULL DEFAULT '';
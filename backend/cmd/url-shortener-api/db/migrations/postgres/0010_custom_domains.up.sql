@@ -0,0 +1,15 @@
+CREATE TABLE "custom_domains" (
+    "id" bigserial,
+    "owner_id" bigint NOT NULL,
+    "host" varchar(253) NOT NULL,
+    "token" varchar(64) NOT NULL,
+    "verified_at" timestamp,
+    "last_checked_at" timestamp,
+    "last_error" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_custom_domains_owner" FOREIGN KEY ("owner_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_custom_domains_owner_host" ON "custom_domains" ("owner_id", "host");
+-- Only one claim of a host can be verified
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_custom_domains_verified_host" ON "custom_domains" ("host") WHERE "verified_at" IS NOT NULL;
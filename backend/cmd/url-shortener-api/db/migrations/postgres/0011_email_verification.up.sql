@@ -0,0 +1,3 @@
+ALTER TABLE "users" ADD COLUMN "email_verified_at" timestamp;
+-- Accounts already signed into through a provider had their email vouched for
+UPDATE "users" SET "email_verified_at" = "created_at" WHERE "id" IN (SELECT "user_id" FROM "user_identities");
@@ -0,0 +1,8 @@
+CREATE TABLE "sheets_exports" (
+    "id" bigserial,
+    "day" date NOT NULL,
+    "rows" bigint NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sheets_exports_day" ON "sheets_exports" ("day");
@@ -0,0 +1,16 @@
+CREATE TABLE "account_deletions" (
+    "id" bigserial,
+    "user_id" bigint NOT NULL,
+    "email" varchar(255) NOT NULL,
+    "links" varchar(10) NOT NULL,
+    "organization_id" bigint,
+    "status" varchar(10) NOT NULL DEFAULT 'pending',
+    "error" text,
+    "expires_at" timestamp NOT NULL,
+    "confirmed_at" timestamp,
+    "finished_at" timestamp,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_account_deletions_user_id" ON "account_deletions" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_account_deletions_status" ON "account_deletions" ("status");
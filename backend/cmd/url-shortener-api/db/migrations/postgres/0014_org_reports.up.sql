@@ -0,0 +1,10 @@
+CREATE TABLE "org_reports" (
+    "id" bigserial,
+    "organization_id" bigint NOT NULL,
+    "month" date NOT NULL,
+    "pdf" bytea NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_org_reports_organization" FOREIGN KEY ("organization_id") REFERENCES "organizations"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_org_reports_org_month" ON "org_reports" ("organization_id", "month");
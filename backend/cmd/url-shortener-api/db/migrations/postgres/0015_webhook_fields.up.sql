@@ -0,0 +1 @@
+ALTER TABLE "webhook_subscriptions" ADD COLUMN "fields" text;
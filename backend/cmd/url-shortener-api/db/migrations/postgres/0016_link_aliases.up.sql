@@ -0,0 +1,10 @@
+CREATE TABLE "link_aliases" (
+    "id" bigserial,
+    "short_code" varchar(32) NOT NULL,
+    "url_mapping_id" bigint NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_link_aliases_url_mapping" FOREIGN KEY ("url_mapping_id") REFERENCES "url_mappings"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_link_aliases_short_code" ON "link_aliases" ("short_code");
+CREATE INDEX IF NOT EXISTS "idx_link_aliases_url_mapping_id" ON "link_aliases" ("url_mapping_id");
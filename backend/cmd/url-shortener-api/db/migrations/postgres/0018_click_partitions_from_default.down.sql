@@ -0,0 +1,12 @@
+CREATE OR REPLACE FUNCTION "create_click_events_partition"(month date) RETURNS void AS $$
+DECLARE
+    start date := date_trunc('month', month)::date;
+BEGIN
+    EXECUTE format(
+        'CREATE TABLE IF NOT EXISTS %I PARTITION OF "click_events" FOR VALUES FROM (%L) TO (%L)',
+        'click_events_' || to_char(start, '"y"YYYY"m"MM'),
+        start::text || ' 00:00:00+00',
+        (start + interval '1 month')::date::text || ' 00:00:00+00'
+    );
+END
+$$ LANGUAGE plpgsql;
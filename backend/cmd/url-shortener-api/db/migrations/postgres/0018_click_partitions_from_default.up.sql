@@ -0,0 +1,40 @@
+-- Clicks recorded before their month's partition existed land in
+-- click_events_default, and Postgres won't create a partition while the
+-- default holds rows that belong in it. create_click_events_partition now
+-- detaches the default, creates the partition, moves those rows into it
+-- and attaches the default again, all in the caller's transaction. Clicks
+-- wait on the lock while that happens, which is only when the default has
+-- rows for the month.
+
+CREATE OR REPLACE FUNCTION "create_click_events_partition"(month date) RETURNS void AS $$
+DECLARE
+    start date := date_trunc('month', month)::date;
+    partition_name text := 'click_events_' || to_char(start, '"y"YYYY"m"MM');
+    from_time timestamptz := (start::text || ' 00:00:00+00')::timestamptz;
+    to_time timestamptz := ((start + interval '1 month')::date::text || ' 00:00:00+00')::timestamptz;
+BEGIN
+    IF to_regclass(format('%I', partition_name)) IS NOT NULL THEN
+        RETURN;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM "click_events_default" WHERE "created_at" >= from_time AND "created_at" < to_time) THEN
+        EXECUTE format(
+            'CREATE TABLE IF NOT EXISTS %I PARTITION OF "click_events" FOR VALUES FROM (%L) TO (%L)',
+            partition_name, from_time, to_time
+        );
+        RETURN;
+    END IF;
+
+    ALTER TABLE "click_events" DETACH PARTITION "click_events_default";
+    EXECUTE format(
+        'CREATE TABLE %I PARTITION OF "click_events" FOR VALUES FROM (%L) TO (%L)',
+        partition_name, from_time, to_time
+    );
+    EXECUTE format(
+        'INSERT INTO %I SELECT * FROM "click_events_default" WHERE "created_at" >= %L AND "created_at" < %L',
+        partition_name, from_time, to_time
+    );
+    DELETE FROM "click_events_default" WHERE "created_at" >= from_time AND "created_at" < to_time;
+    ALTER TABLE "click_events" ATTACH PARTITION "click_events_default" DEFAULT;
+END
+$$ LANGUAGE plpgsql;
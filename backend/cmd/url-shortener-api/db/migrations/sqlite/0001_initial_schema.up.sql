@@ -0,0 +1,222 @@
+CREATE TABLE `users` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `email` text NOT NULL,
+    `password_hash` text NOT NULL,
+    `role` text DEFAULT 'user',
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_users_email` ON `users`(`email`);
+
+CREATE TABLE `organizations` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `name` text NOT NULL,
+    `created_at` datetime
+);
+
+CREATE TABLE `url_mappings` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `short_code` text,
+    `owner_id` integer,
+    `organization_id` integer,
+    `original_url` text NOT NULL,
+    `final_url` text,
+    `content_type` text,
+    `download_type` text,
+    `created_at` datetime,
+    `intended_live_date` timestamp,
+    `intended_expiry_date` timestamp,
+    `last_checked_at` timestamp,
+    `status` text DEFAULT 'pending',
+    `check_interval` integer DEFAULT 24,
+    `forward_query` numeric,
+    `interstitial_seconds` integer DEFAULT 0,
+    `language_targets` text,
+    `response_headers` text,
+    `hide_referrer` numeric DEFAULT false,
+    `proxy_content` numeric DEFAULT false,
+    `track_engagement` numeric DEFAULT false,
+    `print_campaign` numeric DEFAULT false,
+    `managed` numeric DEFAULT false,
+    `disabled_by_reports` numeric DEFAULT false,
+    CONSTRAINT `fk_url_mappings_owner` FOREIGN KEY (`owner_id`) REFERENCES `users`(`id`) ON DELETE SET NULL,
+    CONSTRAINT `fk_url_mappings_organization` FOREIGN KEY (`organization_id`) REFERENCES `organizations`(`id`) ON DELETE SET NULL
+);
+CREATE INDEX `idx_url_mappings_organization_id` ON `url_mappings`(`organization_id`);
+CREATE INDEX `idx_url_mappings_owner_id` ON `url_mappings`(`owner_id`);
+CREATE UNIQUE INDEX `idx_url_mappings_short_code` ON `url_mappings`(`short_code`);
+
+CREATE TABLE `malicious_logs` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `url` text NOT NULL,
+    `user_agent` text,
+    `ip_address` text,
+    `risk_score` integer,
+    `details` text,
+    `disabled_at` timestamp,
+    `created_at` datetime
+);
+CREATE INDEX `idx_malicious_logs_risk_score` ON `malicious_logs`(`risk_score`);
+
+CREATE TABLE `click_events` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `click_id` text,
+    `url_mapping_id` integer NOT NULL,
+    `created_at` datetime,
+    `ip_address` text,
+    `user_agent` text,
+    `referrer` text,
+    `referrer_host` text,
+    `utm_source` text,
+    `utm_medium` text,
+    `utm_campaign` text,
+    `country` text,
+    `region` text,
+    `is_bot` numeric DEFAULT false
+);
+CREATE INDEX `idx_click_events_created_at` ON `click_events`(`created_at`);
+CREATE INDEX `idx_click_events_is_bot` ON `click_events`(`is_bot`);
+CREATE INDEX `idx_click_events_referrer_host` ON `click_events`(`referrer_host`);
+CREATE INDEX `idx_click_events_url_mapping_id` ON `click_events`(`url_mapping_id`);
+CREATE UNIQUE INDEX `idx_click_events_click_id` ON `click_events`(`click_id`);
+
+CREATE TABLE `engagement_events` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `click_id` text NOT NULL,
+    `duration_ms` integer,
+    `interacted` numeric,
+    `bounced` numeric,
+    `created_at` datetime
+);
+CREATE INDEX `idx_engagement_events_bounced` ON `engagement_events`(`bounced`);
+CREATE INDEX `idx_engagement_events_click_id` ON `engagement_events`(`click_id`);
+
+CREATE TABLE `click_rollups` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `url_mapping_id` integer NOT NULL,
+    `day` datetime NOT NULL,
+    `referrer_host` text,
+    `utm_source` text,
+    `utm_medium` text,
+    `utm_campaign` text,
+    `country` text,
+    `region` text,
+    `browser` text,
+    `os` text,
+    `device_class` text,
+    `is_bot` numeric DEFAULT false,
+    `clicks` integer NOT NULL
+);
+CREATE INDEX `idx_click_rollups_link_day` ON `click_rollups`(`url_mapping_id`,`day`);
+
+CREATE TABLE `conversion_events` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `url_mapping_id` integer NOT NULL,
+    `click_id` text,
+    `created_at` datetime
+);
+CREATE INDEX `idx_conversion_events_click_id` ON `conversion_events`(`click_id`);
+CREATE INDEX `idx_conversion_events_url_mapping_id` ON `conversion_events`(`url_mapping_id`);
+
+CREATE TABLE `user_identities` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `provider` text NOT NULL,
+    `subject` text NOT NULL,
+    `email` text,
+    `created_at` datetime,
+    CONSTRAINT `fk_user_identities_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_user_identities_user_id` ON `user_identities`(`user_id`);
+CREATE UNIQUE INDEX `idx_user_identities_provider_subject` ON `user_identities`(`provider`,`subject`);
+
+CREATE TABLE `api_keys` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `name` text,
+    `prefix` text NOT NULL,
+    `key_hash` text NOT NULL,
+    `daily_quota` integer,
+    `monthly_quota` integer,
+    `rate_limit_rps` real,
+    `rate_limit_burst` integer,
+    `last_used_at` timestamp,
+    `created_at` datetime,
+    CONSTRAINT `fk_api_keys_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_api_keys_user_id` ON `api_keys`(`user_id`);
+CREATE UNIQUE INDEX `idx_api_keys_key_hash` ON `api_keys`(`key_hash`);
+
+CREATE TABLE `api_key_usages` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `api_key_id` integer NOT NULL,
+    `day` date NOT NULL,
+    `count` integer NOT NULL DEFAULT 0
+);
+CREATE UNIQUE INDEX `idx_api_key_usages_key_day` ON `api_key_usages`(`api_key_id`,`day`);
+
+CREATE TABLE `sessions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `refresh_token_hash` text NOT NULL,
+    `expires_at` timestamp NOT NULL,
+    `revoked_at` timestamp,
+    `last_used_at` timestamp,
+    `created_at` datetime,
+    CONSTRAINT `fk_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_sessions_user_id` ON `sessions`(`user_id`);
+CREATE UNIQUE INDEX `idx_sessions_refresh_token_hash` ON `sessions`(`refresh_token_hash`);
+
+CREATE TABLE `memberships` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `organization_id` integer NOT NULL,
+    `user_id` integer NOT NULL,
+    `role` text NOT NULL,
+    `created_at` datetime,
+    CONSTRAINT `fk_memberships_organization` FOREIGN KEY (`organization_id`) REFERENCES `organizations`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_memberships_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_memberships_user_id` ON `memberships`(`user_id`);
+CREATE UNIQUE INDEX `idx_memberships_org_user` ON `memberships`(`organization_id`,`user_id`);
+
+CREATE TABLE `invitations` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `organization_id` integer NOT NULL,
+    `email` text NOT NULL,
+    `role` text NOT NULL,
+    `invited_by_id` integer,
+    `expires_at` timestamp NOT NULL,
+    `accepted_at` timestamp,
+    `created_at` datetime,
+    CONSTRAINT `fk_invitations_organization` FOREIGN KEY (`organization_id`) REFERENCES `organizations`(`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_invitations_invited_by` FOREIGN KEY (`invited_by_id`) REFERENCES `users`(`id`) ON DELETE SET NULL
+);
+CREATE INDEX `idx_invitations_email` ON `invitations`(`email`);
+CREATE INDEX `idx_invitations_organization_id` ON `invitations`(`organization_id`);
+
+CREATE TABLE `blocked_domains` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `domain` text NOT NULL,
+    `action` text NOT NULL DEFAULT 'block',
+    `reason` text,
+    `created_by_id` integer,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_blocked_domains_domain` ON `blocked_domains`(`domain`);
+
+CREATE TABLE `abuse_reports` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `url_mapping_id` integer NOT NULL,
+    `reason` text NOT NULL,
+    `details` text,
+    `reporter_email` text,
+    `reporter_ip` text,
+    `status` text NOT NULL DEFAULT 'open',
+    `resolved_by_id` integer,
+    `resolved_at` timestamp,
+    `created_at` datetime,
+    CONSTRAINT `fk_abuse_reports_url_mapping` FOREIGN KEY (`url_mapping_id`) REFERENCES `url_mappings`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_abuse_reports_reporter_ip` ON `abuse_reports`(`reporter_ip`);
+CREATE INDEX `idx_abuse_reports_status` ON `abuse_reports`(`status`);
+CREATE INDEX `idx_abuse_reports_url_mapping_id` ON `abuse_reports`(`url_mapping_id`);
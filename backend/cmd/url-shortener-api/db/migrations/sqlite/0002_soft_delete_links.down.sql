@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS `idx_url_mappings_deleted_at`;
+ALTER TABLE `url_mappings` DROP COLUMN `deleted_at`;
@@ -0,0 +1,2 @@
+ALTER TABLE `url_mappings` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX `idx_url_mappings_deleted_at` ON `url_mappings`(`deleted_at`);
@@ -0,0 +1 @@
+-- SQLite has no table partitioning; click_events stays a plain table.
@@ -0,0 +1,16 @@
+CREATE TABLE `archived_links` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `link_id` integer,
+    `short_code` text,
+    `owner_id` integer,
+    `organization_id` integer,
+    `original_url` text NOT NULL,
+    `link_created_at` timestamp,
+    `intended_expiry_date` timestamp,
+    `clicks` integer,
+    `archived_at` datetime
+);
+CREATE INDEX `idx_archived_links_link_id` ON `archived_links`(`link_id`);
+CREATE INDEX `idx_archived_links_short_code` ON `archived_links`(`short_code`);
+CREATE INDEX `idx_archived_links_owner_id` ON `archived_links`(`owner_id`);
+CREATE INDEX `idx_archived_links_organization_id` ON `archived_links`(`organization_id`);
@@ -0,0 +1 @@
+ALTER TABLE `url_mappings` ADD COLUMN `pending_validation` numeric DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE `url_mappings` DROP COLUMN `expiry_notice_sent_at`;
+ALTER TABLE `users` DROP COLUMN `notify_dead_links`;
+ALTER TABLE `users` DROP COLUMN `notify_expiring`;
@@ -0,0 +1,30 @@
+CREATE TABLE `webhook_subscriptions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `owner_id` integer,
+    `url` text NOT NULL,
+    `secret` text NOT NULL,
+    `events` text,
+    `active` numeric DEFAULT true,
+    `created_at` datetime,
+    CONSTRAINT `fk_webhook_subscriptions_owner` FOREIGN KEY (`owner_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_webhook_subscriptions_owner_id` ON `webhook_subscriptions`(`owner_id`);
+
+CREATE TABLE `webhook_deliveries` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `subscription_id` integer NOT NULL,
+    `event` text NOT NULL,
+    `payload` text NOT NULL,
+    `status` text NOT NULL DEFAULT 'pending',
+    `attempts` integer NOT NULL DEFAULT 0,
+    `next_attempt_at` timestamp,
+    `last_status_code` integer,
+    `last_error` text,
+    `delivered_at` timestamp,
+    `created_at` datetime,
+    CONSTRAINT `fk_webhook_deliveries_subscription` FOREIGN KEY (`subscription_id`) REFERENCES `webhook_subscriptions`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_webhook_deliveries_subscription_id` ON `webhook_deliveries`(`subscription_id`);
+CREATE INDEX `idx_webhook_deliveries_due` ON `webhook_deliveries`(`status`,`next_attempt_at`);
+
+ALTER TABLE `url_mappings` ADD COLUMN `click_threshold` integer DEFAULT 0;
@@ -0,0 +1,19 @@
+CREATE TABLE `link_imports` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `owner_id` integer,
+    `format` text NOT NULL,
+    `status` text NOT NULL DEFAULT 'queued',
+    `total_rows` integer NOT NULL DEFAULT 0,
+    `processed` integer NOT NULL DEFAULT 0,
+    `succeeded` integer NOT NULL DEFAULT 0,
+    `failed` integer NOT NULL DEFAULT 0,
+    `row_errors` text,
+    `error` text,
+    `created_at` datetime,
+    `started_at` timestamp,
+    `finished_at` timestamp,
+    CONSTRAINT `fk_link_imports_owner` FOREIGN KEY (`owner_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE INDEX `idx_link_imports_owner_id` ON `link_imports`(`owner_id`);
+
+ALTER TABLE `url_mappings` ADD COLUMN `tags` text;
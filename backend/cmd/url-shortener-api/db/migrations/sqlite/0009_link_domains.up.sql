@@ -0,0 +1 @@
+ALTER TABLE `url_mappings` ADD COLUMN `domain` text NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+CREATE TABLE `custom_domains` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `owner_id` integer NOT NULL,
+    `host` text NOT NULL,
+    `token` text NOT NULL,
+    `verified_at` timestamp,
+    `last_checked_at` timestamp,
+    `last_error` text,
+    `created_at` datetime,
+    CONSTRAINT `fk_custom_domains_owner` FOREIGN KEY (`owner_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_custom_domains_owner_host` ON `custom_domains`(`owner_id`, `host`);
+-- Only one claim of a host can be verified
+CREATE UNIQUE INDEX `idx_custom_domains_verified_host` ON `custom_domains`(`host`) WHERE `verified_at` IS NOT NULL;
@@ -0,0 +1,7 @@
+CREATE TABLE `sheets_exports` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `day` date NOT NULL,
+    `rows` integer NOT NULL,
+    `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_sheets_exports_day` ON `sheets_exports`(`day`);
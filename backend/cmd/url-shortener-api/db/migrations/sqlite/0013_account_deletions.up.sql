@@ -0,0 +1,15 @@
+CREATE TABLE `account_deletions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `user_id` integer NOT NULL,
+    `email` text NOT NULL,
+    `links` text NOT NULL,
+    `organization_id` integer,
+    `status` text NOT NULL DEFAULT 'pending',
+    `error` text,
+    `expires_at` timestamp NOT NULL,
+    `confirmed_at` timestamp,
+    `finished_at` timestamp,
+    `created_at` datetime
+);
+CREATE INDEX `idx_account_deletions_user_id` ON `account_deletions`(`user_id`);
+CREATE INDEX `idx_account_deletions_status` ON `account_deletions`(`status`);
@@ -0,0 +1,9 @@
+CREATE TABLE `org_reports` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `organization_id` integer NOT NULL,
+    `month` date NOT NULL,
+    `pdf` blob NOT NULL,
+    `created_at` datetime,
+    CONSTRAINT `fk_org_reports_organization` FOREIGN KEY (`organization_id`) REFERENCES `organizations`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_org_reports_org_month` ON `org_reports`(`organization_id`, `month`);
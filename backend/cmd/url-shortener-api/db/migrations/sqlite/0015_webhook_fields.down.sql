@@ -0,0 +1 @@
+ALTER TABLE `webhook_subscriptions` DROP COLUMN `fields`;
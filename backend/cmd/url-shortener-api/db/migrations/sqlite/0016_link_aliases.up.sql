@@ -0,0 +1,9 @@
+CREATE TABLE `link_aliases` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `short_code` text NOT NULL,
+    `url_mapping_id` integer NOT NULL,
+    `created_at` datetime,
+    CONSTRAINT `fk_link_aliases_url_mapping` FOREIGN KEY (`url_mapping_id`) REFERENCES `url_mappings`(`id`) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX `idx_link_aliases_short_code` ON `link_aliases`(`short_code`);
+CREATE INDEX `idx_link_aliases_url_mapping_id` ON `link_aliases`(`url_mapping_id`);
@@ -0,0 +1 @@
+-- SQLite doesn't enforce varchar lengths; encrypted password hashes fit as they are.
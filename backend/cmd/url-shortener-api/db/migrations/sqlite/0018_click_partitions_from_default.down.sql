@@ -0,0 +1 @@
+-- SQLite has no table partitioning; nothing to change.
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// clickPartitionName matches the monthly click_events partitions created by
+// migration 0003, capturing their year and month.
+var clickPartitionName = regexp.MustCompile(`^click_events_y(\d{4})m(\d{2})$`)
+
+// PartitionsClicks reports whether click_events is partitioned by month,
+// which it is on Postgres.
+func PartitionsClicks() bool {
+	return DB.Dialector.Name() == "postgres"
+}
+
+// EnsureClickPartitions creates the click_events partitions for the month
+// containing now and the ahead months after it, if they don't exist yet. A
+// month that can't be created doesn't stop the ones after it; their errors
+// are returned together.
+func EnsureClickPartitions(now time.Time, ahead int) error {
+	if !PartitionsClicks() {
+		return nil
+	}
+	now = now.UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var errs []error
+	for i := 0; i <= ahead; i++ {
+		start := month.AddDate(0, i, 0)
+		err := DB.Exec(`SELECT "create_click_events_partition"(?)`, start.Format("2006-01-02")).Error
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", start.Format("2006-01"), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DropClickPartitionsBefore drops the click_events partitions whose whole
+// month falls before cutoff, deleting their clicks, and returns their names.
+func DropClickPartitionsBefore(cutoff time.Time) ([]string, error) {
+	if !PartitionsClicks() {
+		return nil, nil
+	}
+
+	var partitions []string
+	err := DB.Raw(`SELECT child.relname FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = 'click_events'`).Scan(&partitions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var dropped []string
+	for _, partition := range partitions {
+		match := clickPartitionName.FindStringSubmatch(partition)
+		if match == nil {
+			continue // the default partition
+		}
+		start, err := time.Parse("2006-01", match[1]+"-"+match[2])
+		if err != nil {
+			continue
+		}
+		if start.AddDate(0, 1, 0).After(cutoff) {
+			continue
+		}
+		if err := DB.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS "%s"`, partition)).Error; err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, partition)
+	}
+	return dropped, nil
+}
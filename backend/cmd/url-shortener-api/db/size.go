@@ -0,0 +1,31 @@
+package db
+
+import "context"
+
+// TableSize is the space a table takes on disk, with its indexes.
+type TableSize struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Size estimates how much space the database takes on disk and, on
+// Postgres, lists its largest tables. Click partitions are counted as
+// separate tables.
+func Size(ctx context.Context, largest int) (int64, []TableSize, error) {
+	var size int64
+	if DB.Dialector.Name() != "postgres" {
+		err := DB.WithContext(ctx).Raw("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size).Error
+		return size, nil, err
+	}
+
+	if err := DB.WithContext(ctx).Raw("SELECT pg_database_size(current_database())").Scan(&size).Error; err != nil {
+		return 0, nil, err
+	}
+	var tables []TableSize
+	err := DB.WithContext(ctx).Raw(`SELECT relname AS name, pg_total_relation_size(oid) AS bytes
+		FROM pg_class
+		WHERE relkind = 'r' AND relnamespace = 'public'::regnamespace
+		ORDER BY bytes DESC
+		LIMIT ?`, largest).Scan(&tables).Error
+	return size, tables, err
+}
@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/mailer"
+	"url-shortener/models"
+	"url-shortener/store"
+
+	"gorm.io/gorm"
+)
+
+// errDeletionRefused marks reasons an account deletion can't go ahead as
+// asked, which fail it instead of being tried again.
+var errDeletionRefused = errors.New("account deletion refused")
+
+// DeleteAccounts carries out confirmed account deletions and drops pending
+// ones that were never confirmed. Each user's personal links, and those of
+// organizations they are the only member of, are deleted with their clicks,
+// moved into the chosen organization or left redirecting without an owner.
+// Then their organizations of one, memberships, sessions, API keys,
+// identities, webhooks, custom domains and imports go with the account.
+// Links shared with other members stay with their organization, unowned.
+func DeleteAccounts(ctx context.Context) error {
+	expired := db.DB.WithContext(ctx).Where("status = ? AND expires_at <= ?", models.DeletionPending, time.Now()).Delete(&models.AccountDeletion{})
+	if expired.Error != nil {
+		return expired.Error
+	}
+
+	var due []models.AccountDeletion
+	if err := db.DB.WithContext(ctx).Where("status = ?", models.DeletionConfirmed).Order("id").Find(&due).Error; err != nil {
+		return err
+	}
+	for _, deletion := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		codes, err := deleteAccount(ctx, deletion)
+		now := time.Now()
+		updates := map[string]interface{}{"status": models.DeletionCompleted, "finished_at": now}
+		switch {
+		case errors.Is(err, errDeletionRefused):
+			updates = map[string]interface{}{"status": models.DeletionFailed, "error": err.Error(), "finished_at": now}
+		case err != nil:
+			return fmt.Errorf("deleting account of user %d: %w", deletion.UserID, err)
+		}
+		if err := db.DB.Model(&deletion).Updates(updates).Error; err != nil {
+			return err
+		}
+		store.Invalidate(codes...)
+
+		subject, body := "Your account has been deleted", "Your account has been deleted as you asked.\n"
+		if updates["status"] == models.DeletionFailed {
+			log.Printf("Account deletion %d for user %d failed: %v", deletion.ID, deletion.UserID, err)
+			subject, body = "Your account was not deleted", fmt.Sprintf("Your account could not be deleted: %v.\nSign in and ask again.\n", err)
+		} else {
+			log.Printf("Deleted the account of user %d (links: %s)", deletion.UserID, deletion.Links)
+		}
+		if err := mailer.Send(deletion.Email, subject, body); err != nil {
+			log.Printf("Error emailing the outcome of account deletion %d: %v", deletion.ID, err)
+		}
+	}
+	return nil
+}
+
+// deleteAccount deletes one account in a transaction and returns the short
+// codes of the links whose owner changed or that were deleted.
+func deleteAccount(ctx context.Context, deletion models.AccountDeletion) ([]string, error) {
+	var codes []string
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		userID := deletion.UserID
+		if deletion.Links == models.LinksTransfer {
+			var role string
+			err := tx.Model(&models.Membership{}).Select("role").
+				Where("organization_id = ? AND user_id = ?", *deletion.OrganizationID, userID).Scan(&role).Error
+			if err != nil {
+				return err
+			}
+			if !models.OrgRoleAllows(role, models.OrgRoleEditor) {
+				return fmt.Errorf("%w: you can no longer add links to the organization", errDeletionRefused)
+			}
+		}
+
+		var alone []uint
+		others := tx.Model(&models.Membership{}).Select("organization_id").Where("user_id <> ?", userID)
+		err := tx.Model(&models.Membership{}).Where("user_id = ? AND organization_id NOT IN (?)", userID, others).
+			Pluck("organization_id", &alone).Error
+		if err != nil {
+			return err
+		}
+
+		personal := tx.Unscoped().Model(&models.UrlMapping{}).Where("(owner_id = ? AND organization_id IS NULL) OR organization_id IN ?", userID, alone)
+		if err := personal.Session(&gorm.Session{}).Pluck("short_code", &codes).Error; err != nil {
+			return err
+		}
+		var shared []string
+		if err := tx.Unscoped().Model(&models.UrlMapping{}).Where("owner_id = ? AND organization_id IS NOT NULL AND organization_id NOT IN ?", userID, append(alone, 0)).Pluck("short_code", &shared).Error; err != nil {
+			return err
+		}
+
+		archived := tx.Where("(owner_id = ? AND organization_id IS NULL) OR organization_id IN ?", userID, alone)
+		switch deletion.Links {
+		case models.LinksDelete:
+			var ids []uint
+			if err := personal.Session(&gorm.Session{}).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				if err := store.RemoveLinks(tx, ids); err != nil {
+					return err
+				}
+			}
+			if err := archived.Delete(&models.ArchivedLink{}).Error; err != nil {
+				return err
+			}
+		case models.LinksTransfer:
+			moved := map[string]interface{}{"owner_id": nil, "organization_id": *deletion.OrganizationID}
+			if err := personal.Session(&gorm.Session{}).Updates(moved).Error; err != nil {
+				return err
+			}
+			if err := archived.Model(&models.ArchivedLink{}).Updates(moved).Error; err != nil {
+				return err
+			}
+		default:
+			unowned := map[string]interface{}{"owner_id": nil, "organization_id": nil}
+			if err := personal.Session(&gorm.Session{}).Updates(unowned).Error; err != nil {
+				return err
+			}
+			if err := archived.Model(&models.ArchivedLink{}).Updates(unowned).Error; err != nil {
+				return err
+			}
+		}
+		codes = append(codes, shared...)
+
+		// Whatever is left is shared with an organization that stays
+		if err := tx.Unscoped().Model(&models.UrlMapping{}).Where("owner_id = ?", userID).Update("owner_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ArchivedLink{}).Where("owner_id = ?", userID).Update("owner_id", nil).Error; err != nil {
+			return err
+		}
+
+		if len(alone) > 0 {
+			if err := tx.Where("organization_id IN ?", alone).Delete(&models.Invitation{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("organization_id IN ?", alone).Delete(&models.Membership{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("organization_id IN ?", alone).Delete(&models.OrgReport{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&models.Organization{}, alone).Error; err != nil {
+				return err
+			}
+		}
+
+		keys := tx.Model(&models.APIKey{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("api_key_id IN (?)", keys).Delete(&models.APIKeyUsage{}).Error; err != nil {
+			return err
+		}
+		subscriptions := tx.Model(&models.WebhookSubscription{}).Select("id").Where("owner_id = ?", userID)
+		if err := tx.Where("subscription_id IN (?)", subscriptions).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Invitation{}).Where("invited_by_id = ?", userID).Update("invited_by_id", nil).Error; err != nil {
+			return err
+		}
+		for _, owned := range []interface{}{&models.APIKey{}, &models.Session{}, &models.UserIdentity{}, &models.Membership{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(owned).Error; err != nil {
+				return err
+			}
+		}
+		for _, owned := range []interface{}{&models.WebhookSubscription{}, &models.CustomDomain{}, &models.LinkImport{}} {
+			if err := tx.Where("owner_id = ?", userID).Delete(owned).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.User{}, userID).Error
+	})
+	return codes, err
+}
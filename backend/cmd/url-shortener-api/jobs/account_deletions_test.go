@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// setupDatabase points db.DB at an empty, migrated SQLite database for the
+// rest of the test.
+func setupDatabase(t *testing.T) {
+	t.Helper()
+	db.Connect(config.Config{
+		DBDriver:           "sqlite",
+		DBConnectionString: filepath.Join(t.TempDir(), "jobs.db"),
+		DBConnectAttempts:  1,
+	})
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Migrate("sqlite"); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+}
+
+func mustCreate(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := db.DB.Create(value).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteAccounts(t *testing.T) {
+	type linkFate struct {
+		exists bool
+		owned  bool  // still owned by the leaving user
+		org    *uint // organization it ends up in
+	}
+	tests := []struct {
+		name       string
+		links      string
+		role       string // the leaving user's role in the shared organization
+		wantStatus string
+	}{
+		{name: "delete", links: models.LinksDelete, role: models.OrgRoleEditor, wantStatus: models.DeletionCompleted},
+		{name: "transfer", links: models.LinksTransfer, role: models.OrgRoleEditor, wantStatus: models.DeletionCompleted},
+		{name: "anonymize", links: models.LinksAnonymize, role: models.OrgRoleEditor, wantStatus: models.DeletionCompleted},
+		{name: "transfer without editing rights", links: models.LinksTransfer, role: models.OrgRoleViewer, wantStatus: models.DeletionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupDatabase(t)
+
+			leaving := models.User{Email: "leaving@example.com", PasswordHash: "unused"}
+			colleague := models.User{Email: "colleague@example.com", PasswordHash: "unused"}
+			mustCreate(t, &leaving)
+			mustCreate(t, &colleague)
+			solo := models.Organization{Name: "Solo"}
+			shared := models.Organization{Name: "Shared"}
+			mustCreate(t, &solo)
+			mustCreate(t, &shared)
+			mustCreate(t, &models.Membership{OrganizationID: solo.ID, UserID: leaving.ID, Role: models.OrgRoleOwner})
+			mustCreate(t, &models.Membership{OrganizationID: shared.ID, UserID: leaving.ID, Role: tt.role})
+			mustCreate(t, &models.Membership{OrganizationID: shared.ID, UserID: colleague.ID, Role: models.OrgRoleOwner})
+			mustCreate(t, &models.Session{UserID: leaving.ID, RefreshTokenHash: "leaving", ExpiresAt: time.Now().Add(time.Hour)})
+			mustCreate(t, &models.APIKey{UserID: leaving.ID, Name: "ci", Prefix: "usk_test", KeyHash: "hash"})
+
+			links := map[string]*models.UrlMapping{
+				"personal":  {ShortCode: "personal", OriginalUrl: "https://example.com/1", OwnerID: &leaving.ID},
+				"solo":      {ShortCode: "solo", OriginalUrl: "https://example.com/2", OwnerID: &leaving.ID, OrganizationID: &solo.ID},
+				"shared":    {ShortCode: "shared", OriginalUrl: "https://example.com/3", OwnerID: &leaving.ID, OrganizationID: &shared.ID},
+				"colleague": {ShortCode: "colleague", OriginalUrl: "https://example.com/4", OwnerID: &colleague.ID},
+			}
+			for _, link := range links {
+				mustCreate(t, link)
+			}
+
+			deletion := models.AccountDeletion{
+				UserID:    leaving.ID,
+				Email:     leaving.Email,
+				Links:     tt.links,
+				Status:    models.DeletionConfirmed,
+				ExpiresAt: time.Now().Add(time.Hour),
+			}
+			if tt.links == models.LinksTransfer {
+				deletion.OrganizationID = &shared.ID
+			}
+			mustCreate(t, &deletion)
+			stale := models.AccountDeletion{UserID: colleague.ID, Email: colleague.Email, Links: models.LinksDelete, Status: models.DeletionPending, ExpiresAt: time.Now().Add(-time.Minute)}
+			mustCreate(t, &stale)
+
+			if err := DeleteAccounts(context.Background()); err != nil {
+				t.Fatalf("DeleteAccounts() error = %v", err)
+			}
+
+			if err := db.DB.First(&deletion, deletion.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if deletion.Status != tt.wantStatus {
+				t.Fatalf("deletion status %q (%s), want %q", deletion.Status, deletion.Error, tt.wantStatus)
+			}
+			var staleLeft int64
+			db.DB.Model(&models.AccountDeletion{}).Where("id = ?", stale.ID).Count(&staleLeft)
+			if staleLeft != 0 {
+				t.Error("unconfirmed deletion past its expiry wasn't dropped")
+			}
+
+			var users int64
+			db.DB.Model(&models.User{}).Where("id = ?", leaving.ID).Count(&users)
+			if tt.wantStatus == models.DeletionFailed {
+				if users != 1 {
+					t.Error("failed deletion removed the user")
+				}
+				return
+			}
+			if users != 0 {
+				t.Error("user wasn't deleted")
+			}
+			for _, owned := range []interface{}{&models.Session{}, &models.APIKey{}, &models.Membership{}} {
+				var count int64
+				db.DB.Model(owned).Where("user_id = ?", leaving.ID).Count(&count)
+				if count != 0 {
+					t.Errorf("%d %T rows left for the deleted user", count, owned)
+				}
+			}
+			var orgs int64
+			db.DB.Model(&models.Organization{}).Where("id = ?", solo.ID).Count(&orgs)
+			if orgs != 0 {
+				t.Error("organization the user was alone in wasn't deleted")
+			}
+
+			personal := linkFate{exists: true}
+			switch tt.links {
+			case models.LinksDelete:
+				personal = linkFate{}
+			case models.LinksTransfer:
+				personal = linkFate{exists: true, org: &shared.ID}
+			}
+			want := map[string]linkFate{
+				"personal":  personal,
+				"solo":      personal,
+				"shared":    {exists: true, org: &shared.ID},
+				"colleague": {exists: true},
+			}
+			for code, fate := range want {
+				var link models.UrlMapping
+				err := db.DB.Unscoped().Where("short_code = ?", code).First(&link).Error
+				if exists := err == nil; exists != fate.exists {
+					t.Errorf("link %s exists = %v, want %v", code, exists, fate.exists)
+					continue
+				}
+				if !fate.exists {
+					continue
+				}
+				if owned := link.OwnerID != nil && *link.OwnerID == leaving.ID; owned != fate.owned {
+					t.Errorf("link %s owned by the deleted user = %v", code, owned)
+				}
+				gotOrg, wantOrg := uint(0), uint(0)
+				if link.OrganizationID != nil {
+					gotOrg = *link.OrganizationID
+				}
+				if fate.org != nil {
+					wantOrg = *fate.org
+				}
+				if gotOrg != wantOrg {
+					t.Errorf("link %s organization = %d, want %d", code, gotOrg, wantOrg)
+				}
+			}
+		})
+	}
+}
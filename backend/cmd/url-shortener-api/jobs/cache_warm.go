@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/store"
+)
+
+// WarmLinkCache loads the limit links clicked most over the past window
+// into the link cache, so a restart or eviction doesn't send their
+// redirects to the database all at once.
+func WarmLinkCache(ctx context.Context, limit int, window time.Duration) error {
+	var shortCodes []string
+	err := db.Replica.WithContext(ctx).Model(&models.ClickEvent{}).
+		Select("url_mappings.short_code").
+		Joins("JOIN url_mappings ON url_mappings.id = click_events.url_mapping_id AND url_mappings.deleted_at IS NULL").
+		Where("click_events.created_at >= ?", time.Now().Add(-window)).
+		Group("url_mappings.short_code").
+		Order("COUNT(*) DESC").
+		Limit(limit).
+		Pluck("url_mappings.short_code", &shortCodes).Error
+	if err != nil {
+		return err
+	}
+	if warmed := store.Warm(ctx, shortCodes...); warmed > 0 {
+		log.Printf("Warmed the link cache with %d popular links", warmed)
+	}
+	return nil
+}
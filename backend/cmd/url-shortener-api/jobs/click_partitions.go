@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"url-shortener/db"
+)
+
+// MaintainClickPartitions keeps monthly click_events partitions created
+// ahead months in advance and, when retentionMonths is positive, drops
+// partitions that ended more than retentionMonths ago. Expired partitions
+// are still dropped when some months can't be created; the error names them.
+func MaintainClickPartitions(ahead, retentionMonths int) error {
+	now := time.Now().UTC()
+	var createErr error
+	if err := db.EnsureClickPartitions(now, ahead); err != nil {
+		createErr = fmt.Errorf("creating click partitions: %w", err)
+	}
+
+	if retentionMonths <= 0 {
+		return createErr
+	}
+	cutoff := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -retentionMonths, 0)
+	dropped, err := db.DropClickPartitionsBefore(cutoff)
+	if len(dropped) > 0 {
+		log.Printf("Dropped %d expired click partitions: %v", len(dropped), dropped)
+	}
+	if err != nil {
+		return errors.Join(createErr, fmt.Errorf("dropping expired click partitions: %w", err))
+	}
+	return createErr
+}
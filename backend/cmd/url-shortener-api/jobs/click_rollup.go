@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/analytics"
+	"url-shortener/db"
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+// rollupKey is the set of dimensions a daily rollup row is grouped by.
+type rollupKey struct {
+	UrlMappingID uint
+	ReferrerHost string
+	UTMSource    string
+	UTMMedium    string
+	UTMCampaign  string
+	Country      string
+	Region       string
+	Browser      string
+	OS           string
+	DeviceClass  string
+	IsBot        bool
+}
+
+// RollupClicks folds raw click events older than the retention period into
+// daily rollups and deletes them.
+func RollupClicks(ctx context.Context, retention time.Duration) error {
+	// Only whole days are rolled up, so the cutoff is always midnight UTC
+	now := time.Now().UTC()
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(-retention)
+
+	days, rows, err := rollupClicksBefore(ctx, cutoff)
+	if days > 0 {
+		log.Printf("Rolled up %d clicks from %d days", rows, days)
+	}
+	return err
+}
+
+// rollupClicksBefore rolls up every day of clicks before cutoff, oldest
+// first, one transaction per day. It stops between days once ctx is done.
+func rollupClicksBefore(ctx context.Context, cutoff time.Time) (int, int64, error) {
+	days := 0
+	var total int64
+	for ctx.Err() == nil {
+		var oldest struct {
+			CreatedAt *time.Time
+		}
+		err := db.DB.Model(&models.ClickEvent{}).
+			Select("MIN(created_at) AS created_at").
+			Where("created_at < ?", cutoff).
+			Scan(&oldest).Error
+		if err != nil {
+			return days, total, err
+		}
+		if oldest.CreatedAt == nil {
+			return days, total, nil
+		}
+
+		start := oldest.CreatedAt.UTC()
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		rows, err := rollupDay(day)
+		if err != nil {
+			return days, total, err
+		}
+		days++
+		total += rows
+	}
+	return days, total, ctx.Err()
+}
+
+// rollupDay writes the rollups for the UTC day starting at day and deletes
+// the raw clicks they summarize.
+func rollupDay(day time.Time) (int64, error) {
+	end := day.AddDate(0, 0, 1)
+	var deleted int64
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Group by User-Agent so each distinct one is parsed only once
+		var rows []struct {
+			rollupKey
+			UserAgent string
+			Clicks    int64
+		}
+		err := tx.Model(&models.ClickEvent{}).
+			Select("url_mapping_id, referrer_host, utm_source, utm_medium, utm_campaign, country, region, is_bot, user_agent, COUNT(*) AS clicks").
+			Where("created_at >= ? AND created_at < ?", day, end).
+			Group("url_mapping_id, referrer_host, utm_source, utm_medium, utm_campaign, country, region, is_bot, user_agent").
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		counts := make(map[rollupKey]int64)
+		for _, row := range rows {
+			device := analytics.ParseDevice(row.UserAgent)
+			key := row.rollupKey
+			key.Browser = device.Browser
+			key.OS = device.OS
+			key.DeviceClass = device.DeviceClass
+			counts[key] += row.Clicks
+		}
+
+		rollups := make([]models.ClickRollup, 0, len(counts))
+		for key, clicks := range counts {
+			rollups = append(rollups, models.ClickRollup{
+				UrlMappingID: key.UrlMappingID,
+				Day:          day,
+				ReferrerHost: key.ReferrerHost,
+				UTMSource:    key.UTMSource,
+				UTMMedium:    key.UTMMedium,
+				UTMCampaign:  key.UTMCampaign,
+				Country:      key.Country,
+				Region:       key.Region,
+				Browser:      key.Browser,
+				OS:           key.OS,
+				DeviceClass:  key.DeviceClass,
+				IsBot:        key.IsBot,
+				Clicks:       clicks,
+			})
+		}
+		if len(rollups) > 0 {
+			if err := tx.CreateInBatches(rollups, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Where("created_at >= ? AND created_at < ?", day, end).Delete(&models.ClickEvent{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/webhooks"
+
+	"gorm.io/gorm"
+)
+
+// clickThresholdLookback is how far back the first check after startup
+// looks for clicked links.
+const clickThresholdLookback = 24 * time.Hour
+
+// clickThresholdsCheckedAt is when NotifyClickThresholds last looked for
+// clicked links.
+var clickThresholdsCheckedAt time.Time
+
+// NotifyClickThresholds raises a link.click_threshold webhook event for
+// each link clicked since the last check whose human clicks, raw and rolled
+// up, have passed a threshold higher than any it was raised for before.
+// Links that pass several at once get one event, for the highest.
+func NotifyClickThresholds(ctx context.Context, thresholds []int64) error {
+	now := time.Now()
+	since := clickThresholdsCheckedAt
+	if since.IsZero() {
+		since = now.Add(-clickThresholdLookback)
+	}
+
+	subscribed, err := webhooks.Subscribed(webhooks.ClickThreshold)
+	if err != nil || !subscribed {
+		clickThresholdsCheckedAt = now
+		return err
+	}
+
+	var ids []uint
+	err = db.DB.WithContext(ctx).Model(&models.ClickEvent{}).
+		Where("created_at >= ? AND is_bot = ?", since, false).
+		Distinct().
+		Pluck("url_mapping_id", &ids).Error
+	if err != nil {
+		return err
+	}
+	clickThresholdsCheckedAt = now
+	if len(ids) == 0 {
+		return nil
+	}
+
+	totals := make(map[uint]int64, len(ids))
+	raw := db.DB.Model(&models.ClickEvent{}).Select("url_mapping_id, COUNT(*) AS clicks")
+	rollups := db.DB.Model(&models.ClickRollup{}).Select("url_mapping_id, CAST(SUM(clicks) AS bigint) AS clicks")
+	for _, query := range []*gorm.DB{raw, rollups} {
+		var rows []struct {
+			UrlMappingID uint
+			Clicks       int64
+		}
+		err := query.WithContext(ctx).
+			Where("url_mapping_id IN ? AND is_bot = ?", ids, false).
+			Group("url_mapping_id").
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			totals[row.UrlMappingID] += row.Clicks
+		}
+	}
+
+	sorted := append([]int64(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	var links []models.UrlMapping
+	if err := db.DB.WithContext(ctx).Where("id IN ?", ids).Find(&links).Error; err != nil {
+		return err
+	}
+	raised := 0
+	for _, link := range links {
+		clicks := totals[link.ID]
+		for _, threshold := range sorted {
+			if clicks < threshold {
+				continue
+			}
+			if threshold > link.ClickThreshold {
+				result := db.DB.Model(&models.UrlMapping{}).
+					Where("id = ? AND click_threshold = ?", link.ID, link.ClickThreshold).
+					Update("click_threshold", threshold)
+				if result.Error != nil {
+					log.Printf("Error recording click threshold for link %s: %v", link.ShortCode, result.Error)
+				} else if result.RowsAffected > 0 {
+					webhooks.RaiseClickThreshold(link, threshold, clicks)
+					raised++
+				}
+			}
+			break
+		}
+	}
+	if raised > 0 {
+		log.Printf("Raised click threshold events for %d links", raised)
+	}
+	return nil
+}
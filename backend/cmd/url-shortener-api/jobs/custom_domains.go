@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"url-shortener/customdomains"
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// VerifyCustomDomains looks up the DNS challenge of every custom domain
+// claimed but not yet verified, verifying those whose TXT record holds
+// their token. A claim of a host someone else has verified is left
+// unverified. Claims older than claimWindow are dropped instead, unless
+// it's zero.
+func VerifyCustomDomains(ctx context.Context, resolver *net.Resolver, claimWindow time.Duration) error {
+	if claimWindow > 0 {
+		result := db.DB.WithContext(ctx).Where("verified_at IS NULL AND created_at <= ?", time.Now().Add(-claimWindow)).Delete(&models.CustomDomain{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Dropped %d custom domains that were never verified", result.RowsAffected)
+		}
+	}
+
+	var claims []models.CustomDomain
+	if err := db.DB.WithContext(ctx).Where("verified_at IS NULL").Order("id").Find(&claims).Error; err != nil {
+		return err
+	}
+
+	for _, claim := range claims {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		now := time.Now()
+		claim.LastCheckedAt = &now
+		claim.LastError = ""
+		if err := customdomains.CheckChallenge(ctx, resolver, claim.Host, claim.Token); err != nil {
+			claim.LastError = err.Error()
+		} else if _, taken := customdomains.Verified(claim.Host); taken {
+			claim.LastError = "This domain has already been verified by another account"
+		} else {
+			claim.VerifiedAt = &now
+		}
+
+		// A unique index stops two instances verifying rival claims at once
+		err := db.DB.WithContext(ctx).Model(&claim).Select("verified_at", "last_checked_at", "last_error").Updates(&claim).Error
+		if err != nil {
+			log.Printf("Error saving check of custom domain %s: %v", claim.Host, err)
+			continue
+		}
+		if claim.VerifiedAt != nil {
+			log.Printf("Verified custom domain %s for user %d", claim.Host, claim.OwnerID)
+			customdomains.Invalidate()
+		}
+	}
+	return nil
+}
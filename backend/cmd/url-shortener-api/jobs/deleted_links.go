@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/store"
+)
+
+// PurgeDeletedLinks removes links that were deleted more than retention
+// ago, together with their clicks, freeing their short codes.
+func PurgeDeletedLinks(ctx context.Context, retention time.Duration) error {
+	purged, err := store.Links.Purge(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted links", purged)
+	}
+	return nil
+}
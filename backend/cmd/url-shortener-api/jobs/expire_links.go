@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/notifier"
+	"url-shortener/store"
+	"url-shortener/webhooks"
+
+	"gorm.io/gorm"
+)
+
+// archiveBatchSize bounds how many links one pass moves to the archive.
+const archiveBatchSize = 100
+
+// ExpireLinks marks links whose intended expiry date has passed as expired
+// and tells their owners, unless they turned expiry notices off, and webhook
+// subscribers. Disabled links keep their status. With archiveAfter set,
+// links that have been expired for that long are then moved to the archive.
+func ExpireLinks(ctx context.Context, archiveAfter time.Duration) error {
+	now := time.Now()
+
+	var due []struct {
+		ID                 uint
+		ShortCode          string
+		Status             string
+		IntendedExpiryDate time.Time
+		OwnerEmail         string
+	}
+	err := db.DB.WithContext(ctx).Model(&models.UrlMapping{}).
+		Select("url_mappings.id, url_mappings.short_code, url_mappings.status, url_mappings.intended_expiry_date, users.email AS owner_email").
+		Joins("LEFT JOIN users ON users.id = url_mappings.owner_id AND users.notify_expiring = ?", true).
+		Where("url_mappings.status NOT IN ? AND url_mappings.intended_expiry_date <= ?", []string{"expired", "disabled"}, now).
+		Scan(&due).Error
+	if err != nil {
+		return err
+	}
+
+	expired := 0
+	for _, link := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		result := db.DB.Model(&models.UrlMapping{}).
+			Where("id = ? AND status = ?", link.ID, link.Status).
+			Update("status", "expired")
+		if result.Error != nil {
+			log.Printf("Error expiring link %s: %v", link.ShortCode, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue // changed since it was read
+		}
+		store.Invalidate(link.ShortCode)
+		notifier.LinkExpired(link.ShortCode, link.OwnerEmail, link.IntendedExpiryDate)
+		raiseExpired(link.ID)
+		expired++
+	}
+	if expired > 0 {
+		log.Printf("Expired %d links", expired)
+	}
+
+	if archiveAfter <= 0 || ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return archiveExpiredLinks(ctx, now.Add(-archiveAfter))
+}
+
+// raiseExpired raises a link.expired webhook event for the link with id.
+func raiseExpired(id uint) {
+	var link models.UrlMapping
+	if err := db.DB.First(&link, id).Error; err != nil {
+		log.Printf("Error loading expired link %d for webhooks: %v", id, err)
+		return
+	}
+	webhooks.Raise(webhooks.LinkExpired, link)
+}
+
+// archiveExpiredLinks moves a batch of links that expired before cutoff
+// into archived_links, removing them and their clicks from the live tables.
+func archiveExpiredLinks(ctx context.Context, cutoff time.Time) error {
+	var links []models.UrlMapping
+	err := db.DB.WithContext(ctx).
+		Where("status = ? AND intended_expiry_date <= ?", "expired", cutoff).
+		Order("intended_expiry_date").
+		Limit(archiveBatchSize).
+		Find(&links).Error
+	if err != nil || len(links) == 0 {
+		return err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		ids := make([]uint, len(links))
+		archived := make([]models.ArchivedLink, len(links))
+		for i, link := range links {
+			var rawClicks, rolledUpClicks int64
+			if err := tx.Model(&models.ClickEvent{}).Where("url_mapping_id = ?", link.ID).Count(&rawClicks).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.ClickRollup{}).Where("url_mapping_id = ?", link.ID).
+				Select("COALESCE(SUM(clicks), 0)").Scan(&rolledUpClicks).Error; err != nil {
+				return err
+			}
+
+			ids[i] = link.ID
+			archived[i] = models.ArchivedLink{
+				LinkID:             link.ID,
+				ShortCode:          link.ShortCode,
+				OwnerID:            link.OwnerID,
+				OrganizationID:     link.OrganizationID,
+				OriginalUrl:        link.OriginalUrl,
+				LinkCreatedAt:      link.CreatedAt,
+				IntendedExpiryDate: *link.IntendedExpiryDate,
+				Clicks:             rawClicks + rolledUpClicks,
+			}
+		}
+		if err := tx.Create(&archived).Error; err != nil {
+			return err
+		}
+		return store.RemoveLinks(tx, ids)
+	})
+	if err != nil {
+		return err
+	}
+
+	shortCodes := make([]string, len(links))
+	for i, link := range links {
+		shortCodes[i] = link.ShortCode
+	}
+	store.Invalidate(shortCodes...)
+	log.Printf("Archived %d expired links", len(links))
+	return nil
+}
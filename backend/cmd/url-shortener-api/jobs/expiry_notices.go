@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/notifier"
+)
+
+// NotifyExpiringLinks warns owners of links that will expire within ahead,
+// once per expiry date. Owners who turned expiry notices off aren't warned,
+// and their links are left to be picked up if they turn them back on.
+func NotifyExpiringLinks(ctx context.Context, ahead time.Duration) error {
+	now := time.Now()
+
+	var due []struct {
+		ID                 uint
+		ShortCode          string
+		IntendedExpiryDate time.Time
+		OwnerEmail         string
+	}
+	err := db.DB.WithContext(ctx).Model(&models.UrlMapping{}).
+		Select("url_mappings.id, url_mappings.short_code, url_mappings.intended_expiry_date, users.email AS owner_email").
+		Joins("JOIN users ON users.id = url_mappings.owner_id AND users.notify_expiring = ?", true).
+		Where("url_mappings.expiry_notice_sent_at IS NULL AND url_mappings.status NOT IN ?", []string{"expired", "disabled", "rejected"}).
+		Where("url_mappings.intended_expiry_date > ? AND url_mappings.intended_expiry_date <= ?", now, now.Add(ahead)).
+		Scan(&due).Error
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, link := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		if !notifier.LinkExpiring(link.ShortCode, link.OwnerEmail, link.IntendedExpiryDate) {
+			continue // retried on the next pass
+		}
+		if err := db.DB.Model(&models.UrlMapping{}).Where("id = ?", link.ID).Update("expiry_notice_sent_at", time.Now()).Error; err != nil {
+			log.Printf("Error recording expiry notice for link %s: %v", link.ShortCode, err)
+			continue
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("Sent %d expiry notices", sent)
+	}
+	return ctx.Err()
+}
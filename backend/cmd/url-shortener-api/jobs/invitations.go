@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// ExpireInvitations deletes organization invitations that passed their
+// expiry without being accepted.
+func ExpireInvitations(ctx context.Context) error {
+	result := db.DB.WithContext(ctx).Where("accepted_at IS NULL AND expires_at <= ?", time.Now()).Delete(&models.Invitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Expired %d unused invitations", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// ActivatePendingLinks promotes pending links whose intended live date has
+// passed to live, leaving those still awaiting validation. Cached copies
+// aren't invalidated, since redirects already treat pending links past their
+// live date as live.
+func ActivatePendingLinks(ctx context.Context) error {
+	result := db.DB.WithContext(ctx).Model(&models.UrlMapping{}).
+		Where("status = ? AND pending_validation = ? AND intended_live_date IS NOT NULL AND intended_live_date <= ?", "pending", false, time.Now()).
+		Update("status", "live")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Activated %d pending links", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+
+	"url-shortener/metrics"
+	"url-shortener/scheduler"
+)
+
+var (
+	jobRuns = metrics.NewCounter("job_runs_total",
+		"Background job runs, by job and result (success, error or panic).", "job", "result")
+	jobDuration = metrics.NewHistogram("job_duration_seconds",
+		"Time taken by background job runs, by job.",
+		[]float64{0.01, 0.1, 0.5, 1, 5, 15, 60, 300, 900}, "job")
+)
+
+// recordRun is a scheduler hook that records each job run's duration and
+// result.
+func recordRun(name string, took time.Duration, err error) {
+	result := "success"
+	switch {
+	case errors.Is(err, scheduler.ErrPanicked):
+		result = "panic"
+	case err != nil:
+		result = "error"
+	}
+	jobRuns.Inc(name, result)
+	jobDuration.Observe(took.Seconds(), name)
+}
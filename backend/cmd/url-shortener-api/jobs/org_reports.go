@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/mailer"
+	"url-shortener/models"
+	"url-shortener/pdf"
+
+	"gorm.io/gorm"
+)
+
+// How many rows the report's tables list.
+const (
+	reportTopLinks  = 10
+	reportCountries = 15
+	reportIncidents = 20
+)
+
+// ReportOrganizations renders last month's usage report for every
+// organization that existed then and doesn't have one yet, and emails its
+// owners that it can be downloaded. A report covers the organization's
+// links: how many were created, the most clicked, clicks by country and
+// abuse reports filed against them. Bot clicks are left out.
+func ReportOrganizations(ctx context.Context) error {
+	now := time.Now().UTC()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, -1, 0)
+
+	var orgs []models.Organization
+	reported := db.DB.Model(&models.OrgReport{}).Select("organization_id").Where("month = ?", start)
+	err := db.DB.WithContext(ctx).Where("created_at < ? AND id NOT IN (?)", end, reported).Order("id").Find(&orgs).Error
+	if err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		document, err := renderOrgReport(ctx, org, start, end)
+		if err != nil {
+			return fmt.Errorf("reporting on organization %d: %w", org.ID, err)
+		}
+		if err := db.DB.Create(&models.OrgReport{OrganizationID: org.ID, Month: start, PDF: document}).Error; err != nil {
+			return err
+		}
+		log.Printf("Rendered the %s report for organization %d", start.Format("2006-01"), org.ID)
+		notifyOrgReport(org, start)
+	}
+	return nil
+}
+
+// renderOrgReport gathers the organization's figures for [start, end) and
+// lays them out as a PDF.
+func renderOrgReport(ctx context.Context, org models.Organization, start, end time.Time) ([]byte, error) {
+	tx := db.DB.WithContext(ctx)
+	links := tx.Unscoped().Model(&models.UrlMapping{}).Select("id").Where("organization_id = ?", org.ID)
+
+	var created int64
+	err := tx.Unscoped().Model(&models.UrlMapping{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", org.ID, start, end).
+		Count(&created).Error
+	if err != nil {
+		return nil, err
+	}
+	byLink, err := monthClicks(tx, links, start, end, "url_mapping_id")
+	if err != nil {
+		return nil, err
+	}
+	byCountry, err := monthClicks(tx, links, start, end, "country")
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, clicks := range byLink {
+		total += clicks
+	}
+
+	top := topKeys(byLink, reportTopLinks)
+	var topLinks []models.UrlMapping
+	if len(top) > 0 {
+		if err := tx.Unscoped().Select("id", "short_code", "original_url").Where("id IN ?", top).Find(&topLinks).Error; err != nil {
+			return nil, err
+		}
+	}
+	linksByID := make(map[string]models.UrlMapping, len(topLinks))
+	for _, link := range topLinks {
+		linksByID[strconv.FormatUint(uint64(link.ID), 10)] = link
+	}
+
+	var incidents []struct {
+		CreatedAt time.Time
+		ShortCode string
+		Reason    string
+		Status    string
+	}
+	var incidentCount int64
+	reports := tx.Model(&models.AbuseReport{}).
+		Joins("JOIN url_mappings ON url_mappings.id = abuse_reports.url_mapping_id").
+		Where("url_mappings.organization_id = ? AND abuse_reports.created_at >= ? AND abuse_reports.created_at < ?", org.ID, start, end)
+	if err := reports.Session(&gorm.Session{}).Count(&incidentCount).Error; err != nil {
+		return nil, err
+	}
+	err = reports.Session(&gorm.Session{}).
+		Select("abuse_reports.created_at, url_mappings.short_code, abuse_reports.reason, abuse_reports.status").
+		Order("abuse_reports.created_at").Limit(reportIncidents).Scan(&incidents).Error
+	if err != nil {
+		return nil, err
+	}
+
+	doc := pdf.New()
+	doc.Heading(fmt.Sprintf("%s: %s usage report", org.Name, start.Format("January 2006")))
+	doc.Text(fmt.Sprintf("Covers %s to %s (UTC), rendered %s.", start.Format("January 2"), end.AddDate(0, 0, -1).Format("January 2, 2006"), time.Now().UTC().Format("January 2, 2006")))
+
+	doc.Subheading("Summary")
+	doc.Text(fmt.Sprintf("Links created: %d", created))
+	doc.Text(fmt.Sprintf("Clicks: %d", total))
+	doc.Text(fmt.Sprintf("Abuse reports: %d", incidentCount))
+
+	doc.Subheading("Top links")
+	if len(top) == 0 {
+		doc.Text("No clicks this month.")
+	} else {
+		widths := []float64{70, 60, pdf.ContentWidth - 130}
+		doc.Row(true, widths, "Link", "Clicks", "Destination")
+		for _, id := range top {
+			link := linksByID[id]
+			doc.Row(false, widths, link.ShortCode, strconv.FormatInt(byLink[id], 10), link.OriginalUrl)
+		}
+	}
+
+	doc.Subheading("Clicks by country")
+	if len(byCountry) == 0 {
+		doc.Text("No clicks this month.")
+	} else {
+		widths := []float64{70, 60, 60}
+		doc.Row(true, widths, "Country", "Clicks", "Share")
+		for _, country := range topKeys(byCountry, reportCountries) {
+			name := country
+			if name == "" {
+				name = "Unknown"
+			}
+			doc.Row(false, widths, name, strconv.FormatInt(byCountry[country], 10), fmt.Sprintf("%.1f%%", 100*float64(byCountry[country])/float64(total)))
+		}
+	}
+
+	doc.Subheading("Incidents")
+	if incidentCount == 0 {
+		doc.Text("No abuse reports this month.")
+	} else {
+		widths := []float64{90, 70, 70, 70}
+		doc.Row(true, widths, "Reported", "Link", "Reason", "Status")
+		for _, incident := range incidents {
+			doc.Row(false, widths, incident.CreatedAt.UTC().Format("2006-01-02 15:04"), incident.ShortCode, incident.Reason, incident.Status)
+		}
+		if incidentCount > int64(len(incidents)) {
+			doc.Text(fmt.Sprintf("...and %d more.", incidentCount-int64(len(incidents))))
+		}
+	}
+	return doc.Bytes(), nil
+}
+
+// monthClicks returns human clicks on links in [start, end), raw and
+// rolled-up together, grouped by column.
+func monthClicks(tx *gorm.DB, links *gorm.DB, start, end time.Time, column string) (map[string]int64, error) {
+	raw := tx.Model(&models.ClickEvent{}).Select(column+" AS dimension, COUNT(*) AS clicks").
+		Where("url_mapping_id IN (?) AND is_bot = ? AND created_at >= ? AND created_at < ?", links, false, start, end)
+	rollups := tx.Model(&models.ClickRollup{}).Select(column+" AS dimension, CAST(SUM(clicks) AS bigint) AS clicks").
+		Where("url_mapping_id IN (?) AND is_bot = ? AND day >= ? AND day < ?", links, false, start, end)
+
+	totals := make(map[string]int64)
+	for _, query := range []*gorm.DB{raw, rollups} {
+		var rows []struct {
+			Dimension string
+			Clicks    int64
+		}
+		if err := query.Group(column).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			totals[row.Dimension] += row.Clicks
+		}
+	}
+	return totals, nil
+}
+
+// topKeys returns up to n keys of counts, highest count first.
+func topKeys(counts map[string]int64, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys[:min(n, len(keys))]
+}
+
+// notifyOrgReport tells the organization's owners their report is ready.
+func notifyOrgReport(org models.Organization, month time.Time) {
+	var emails []string
+	err := db.DB.Model(&models.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND memberships.role = ?", org.ID, models.OrgRoleOwner).
+		Pluck("users.email", &emails).Error
+	if err != nil {
+		log.Printf("Error finding the owners of organization %d: %v", org.ID, err)
+		return
+	}
+
+	subject := fmt.Sprintf("%s: %s usage report", org.Name, month.Format("January 2006"))
+	body := fmt.Sprintf("The %s usage report for %s is ready. Download it as a PDF from:\nGET /api/orgs/%d/reports/%s\n",
+		month.Format("January 2006"), org.Name, org.ID, month.Format("2006-01"))
+	for _, email := range emails {
+		if err := mailer.Send(email, subject, body); err != nil {
+			log.Printf("Error emailing the report of organization %d: %v", org.ID, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"url-shortener/blocklist"
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/notifier"
+	"url-shortener/store"
+	"url-shortener/utils"
+	"url-shortener/webhooks"
+)
+
+// RecheckLinks re-runs the destination checks for a batch of live and
+// inactive links whose CheckInterval has passed since LastCheckedAt. Dead
+// destinations are demoted to inactive, recovered ones go live again, and
+// destinations the URL scanners now report as unsafe are flagged. Owners of
+// links that go dead are emailed unless they turned that notice off.
+func RecheckLinks(ctx context.Context, cfg config.Config) error {
+	var due []models.UrlMapping
+	err := db.DB.WithContext(ctx).Where("status IN ? AND check_interval > 0", []string{"live", "inactive"}).
+		Where(store.RecheckDueCondition(db.DB)).
+		Order("last_checked_at").
+		Limit(cfg.LinkRecheckBatchSize).
+		Find(&due).Error
+	if err != nil {
+		return fmt.Errorf("finding links to re-check: %w", err)
+	}
+
+	checked, changed := 0, 0
+	for _, urlMapping := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		checked++
+		status, resolved := recheckStatus(ctx, cfg, urlMapping)
+		// Map updates skip the model's serializers, so seal the URL here
+		err := db.DB.Model(&models.UrlMapping{}).
+			Where("id = ? AND status = ?", urlMapping.ID, urlMapping.Status).
+			Updates(map[string]interface{}{
+				"status":          status,
+				"final_url":       store.SealURL(resolved.FinalURL),
+				"content_type":    resolved.ContentType,
+				"download_type":   resolved.DownloadType,
+				"last_checked_at": time.Now(),
+			}).Error
+		if err != nil {
+			log.Printf("Error updating link %s after re-check: %v", urlMapping.ShortCode, err)
+			continue
+		}
+		store.Invalidate(urlMapping.ShortCode)
+		if status != urlMapping.Status {
+			log.Printf("Link %s changed from %s to %s on re-check", urlMapping.ShortCode, urlMapping.Status, status)
+			changed++
+			switch status {
+			case "inactive":
+				notifier.LinkDead(urlMapping.ShortCode, ownerToNotify(urlMapping.OwnerID, "notify_dead_links"), urlMapping.OriginalUrl)
+			case "flagged":
+				urlMapping.Status = status
+				webhooks.Raise(webhooks.LinkFlagged, urlMapping)
+			}
+		}
+	}
+	if changed > 0 {
+		log.Printf("Re-checked %d links, %d changed status", checked, changed)
+	}
+	return ctx.Err()
+}
+
+// recheckStatus works out the status urlMapping should have now, following
+// its destination's redirects, and returns where they lead. An unreachable
+// destination keeps what was last recorded about it.
+func recheckStatus(ctx context.Context, cfg config.Config, urlMapping models.UrlMapping) (string, utils.ResolvedURL) {
+	resolved, err := utils.ResolveURL(ctx, urlMapping.OriginalUrl, cfg.MaxRedirectHops)
+	if err != nil {
+		log.Printf("Destination of link %s is unreachable: %v", urlMapping.ShortCode, err)
+		return "inactive", utils.ResolvedURL{
+			FinalURL:     urlMapping.FinalUrl,
+			ContentType:  urlMapping.ContentType,
+			DownloadType: urlMapping.DownloadType,
+		}
+	}
+
+	checked := []string{urlMapping.OriginalUrl}
+	if resolved.FinalURL != urlMapping.OriginalUrl {
+		checked = append(checked, resolved.FinalURL)
+	}
+	for _, inputURL := range checked {
+		if domain, blocked := blocklist.Blocked(inputURL); blocked {
+			log.Printf("Destination of link %s now leads to blocked domain %s", urlMapping.ShortCode, domain)
+			return "flagged", resolved
+		}
+
+		verdict, err := utils.ScanURL(ctx, cfg, inputURL)
+		if err != nil {
+			if !errors.Is(err, utils.ErrNoURLScanners) {
+				log.Printf("Error scanning destination of link %s: %v", urlMapping.ShortCode, err)
+			}
+			continue
+		}
+		if !verdict.IsSafe {
+			entry := models.MaliciousLog{
+				URL:       urlMapping.OriginalUrl,
+				RiskScore: verdict.RiskScore,
+				Details:   verdict.Message,
+			}
+			if err := db.DB.Create(&entry).Error; err != nil {
+				log.Println("Error writing malicious log:", err)
+			}
+			notifier.MaliciousDetected(entry.URL, entry.RiskScore, fmt.Sprintf("Existing link %s: %s", urlMapping.ShortCode, entry.Details))
+			return "flagged", resolved
+		}
+	}
+
+	if resolved.StatusCode < 200 || resolved.StatusCode >= 300 {
+		return "inactive", resolved
+	}
+
+	// A recovered link that is still embargoed waits for its live date
+	if urlMapping.IntendedLiveDate != nil && urlMapping.IntendedLiveDate.After(time.Now()) {
+		return "pending", resolved
+	}
+	return "live", resolved
+}
+
+// ownerToNotify returns the email address of the owner of a link, or ""
+// if it has none or they turned off the notice named by preference, a
+// boolean column of users.
+func ownerToNotify(ownerID *uint, preference string) string {
+	if ownerID == nil {
+		return ""
+	}
+	var emails []string
+	err := db.DB.Model(&models.User{}).Where("id = ?", *ownerID).Where(preference+" = ?", true).Pluck("email", &emails).Error
+	if err != nil {
+		log.Printf("Error finding owner %d to notify: %v", *ownerID, err)
+		return ""
+	}
+	if len(emails) == 0 {
+		return ""
+	}
+	return emails[0]
+}
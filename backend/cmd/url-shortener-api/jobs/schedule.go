@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/customdomains"
+	"url-shortener/db"
+	"url-shortener/scheduler"
+	"url-shortener/sheets"
+	"url-shortener/webhooks"
+)
+
+// Schedule registers the background jobs with s, along with a hook that
+// records their metrics. Every job is registered, so DISABLED_JOBS can name
+// any of them, but those cfg turns off get no interval and don't run.
+func Schedule(s *scheduler.Scheduler, cfg config.Config) {
+	s.AfterRun(recordRun)
+
+	clickRetention := time.Duration(cfg.ClickRetentionDays) * 24 * time.Hour
+	deletedLinkRetention := time.Duration(cfg.DeletedLinkRetentionDays) * 24 * time.Hour
+	expiredLinkArchive := time.Duration(cfg.ExpiredLinkArchiveDays) * 24 * time.Hour
+	customDomainClaimWindow := time.Duration(cfg.CustomDomainClaimDays) * 24 * time.Hour
+	domainResolver := customdomains.NewResolver(cfg.CustomDomainResolver)
+	var sheetsClient *sheets.Client
+	if cfg.GoogleSheetsSpreadsheetID != "" {
+		client, err := sheets.NewClient(cfg.GoogleSheetsCredentialsFile)
+		if err != nil {
+			log.Fatal("Invalid GOOGLE_SHEETS_CREDENTIALS_FILE: ", err)
+		}
+		sheetsClient = client
+	}
+
+	s.Add(scheduler.Job{
+		Name:     "activate-pending-links",
+		Interval: cfg.LiveDateCheckInterval,
+		Run:      ActivatePendingLinks,
+	})
+	s.Add(scheduler.Job{
+		Name:     "recheck-links",
+		Interval: cfg.LinkRecheckInterval,
+		Run: func(ctx context.Context) error {
+			return RecheckLinks(ctx, cfg)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:     "expire-links",
+		Interval: cfg.LinkExpiryInterval,
+		Run: func(ctx context.Context) error {
+			return ExpireLinks(ctx, expiredLinkArchive)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:       "notify-expiring-links",
+		Interval:   intervalIf(cfg.ExpiryNoticeDays > 0, time.Hour),
+		RunAtStart: true,
+		Run: func(ctx context.Context) error {
+			return NotifyExpiringLinks(ctx, time.Duration(cfg.ExpiryNoticeDays)*24*time.Hour)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:       "rollup-clicks",
+		Interval:   intervalIf(cfg.ClickRetentionDays > 0, cfg.ClickRollupInterval),
+		RunAtStart: true,
+		Run: func(ctx context.Context) error {
+			return RollupClicks(ctx, clickRetention)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:       "maintain-click-partitions",
+		Interval:   intervalIf(db.PartitionsClicks(), 24*time.Hour),
+		RunAtStart: true,
+		Run: func(context.Context) error {
+			return MaintainClickPartitions(cfg.ClickPartitionsAhead, cfg.ClickPartitionRetentionMonths)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:     "purge-deleted-links",
+		Interval: intervalIf(cfg.DeletedLinkRetentionDays > 0, time.Hour),
+		Run: func(ctx context.Context) error {
+			return PurgeDeletedLinks(ctx, deletedLinkRetention)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:     "expire-invitations",
+		Interval: intervalIf(cfg.JWTSecret != "", time.Hour),
+		Run:      ExpireInvitations,
+	})
+	s.Add(scheduler.Job{
+		Name:     "delete-accounts",
+		Interval: intervalIf(cfg.JWTSecret != "", time.Minute),
+		Run:      DeleteAccounts,
+	})
+	s.Add(scheduler.Job{
+		Name:       "report-organizations",
+		Interval:   intervalIf(cfg.JWTSecret != "", time.Hour),
+		RunAtStart: true,
+		Run:        ReportOrganizations,
+	})
+	s.Add(scheduler.Job{
+		Name:     "deliver-webhooks",
+		Interval: cfg.WebhookDeliveryInterval,
+		Run: func(ctx context.Context) error {
+			return webhooks.Deliver(ctx, cfg.WebhookMaxAttempts, cfg.WebhookRetryBackoff, cfg.WebhookTimeout)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:     "notify-click-thresholds",
+		Interval: intervalIf(len(cfg.WebhookClickThresholds) > 0, time.Minute),
+		Run: func(ctx context.Context) error {
+			return NotifyClickThresholds(ctx, cfg.WebhookClickThresholds)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:     "verify-custom-domains",
+		Interval: intervalIf(cfg.CustomDomainsPerUser > 0, cfg.CustomDomainVerifyInterval),
+		Run: func(ctx context.Context) error {
+			return VerifyCustomDomains(ctx, domainResolver, customDomainClaimWindow)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:     "export-stats-to-sheets",
+		Interval: intervalIf(sheetsClient != nil, cfg.GoogleSheetsExportInterval),
+		Run: func(ctx context.Context) error {
+			return ExportStatsToSheets(ctx, sheetsClient, cfg.GoogleSheetsSpreadsheetID, cfg.GoogleSheetsRange)
+		},
+	})
+	s.Add(scheduler.Job{
+		Name:       "warm-link-cache",
+		Interval:   intervalIf(cfg.RedisURL != "", cfg.CacheWarmInterval),
+		RunAtStart: true,
+		Run: func(ctx context.Context) error {
+			return WarmLinkCache(ctx, cfg.CacheWarmLinks, cfg.CacheWarmWindow)
+		},
+	})
+}
+
+// intervalIf returns interval when the job is turned on and zero, which
+// the scheduler skips, when it isn't.
+func intervalIf(on bool, interval time.Duration) time.Duration {
+	if !on {
+		return 0
+	}
+	return interval
+}
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/sheets"
+
+	"gorm.io/gorm"
+)
+
+// sheetsAppendRows is how many rows each Sheets API call appends.
+const sheetsAppendRows = 1000
+
+// ExportStatsToSheets appends the clicks of every UTC day that has ended
+// since the last export to the sheet, one row per link clicked that day:
+// the day, short code, destination, human clicks and bot clicks. The first
+// export covers yesterday. A day is only recorded as exported once all of
+// its rows are in, so a failed one is tried again whole.
+func ExportStatsToSheets(ctx context.Context, client *sheets.Client, spreadsheetID, sheetRange string) error {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	day := today.AddDate(0, 0, -1)
+	var last models.SheetsExport
+	err := db.DB.WithContext(ctx).Order("day DESC").First(&last).Error
+	switch {
+	case err == nil:
+		day = time.Date(last.Day.Year(), last.Day.Month(), last.Day.Day()+1, 0, 0, 0, 0, time.UTC)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+		rows, err := dailyLinkClicks(ctx, day)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(rows); start += sheetsAppendRows {
+			end := min(start+sheetsAppendRows, len(rows))
+			if err := client.Append(ctx, spreadsheetID, sheetRange, rows[start:end]); err != nil {
+				return err
+			}
+		}
+
+		if err := db.DB.WithContext(ctx).Create(&models.SheetsExport{Day: day, Rows: len(rows)}).Error; err != nil {
+			return err
+		}
+		log.Printf("Exported clicks on %d links for %s to Google Sheets", len(rows), day.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// dailyLinkClicks returns a sheet row for each link clicked on day, raw and
+// rolled-up clicks together, most clicked first. Deleted links are left out.
+func dailyLinkClicks(ctx context.Context, day time.Time) ([][]interface{}, error) {
+	next := day.AddDate(0, 0, 1)
+	type counts struct{ human, bots int64 }
+	totals := make(map[uint]*counts)
+
+	raw := db.DB.Model(&models.ClickEvent{}).Select("url_mapping_id, is_bot, COUNT(*) AS clicks").
+		Where("created_at >= ? AND created_at < ?", day, next)
+	rollups := db.DB.Model(&models.ClickRollup{}).Select("url_mapping_id, is_bot, CAST(SUM(clicks) AS bigint) AS clicks").
+		Where("day >= ? AND day < ?", day, next)
+	for _, query := range []*gorm.DB{raw, rollups} {
+		var rows []struct {
+			UrlMappingID uint
+			IsBot        bool
+			Clicks       int64
+		}
+		if err := query.WithContext(ctx).Group("url_mapping_id, is_bot").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			total, ok := totals[row.UrlMappingID]
+			if !ok {
+				total = &counts{}
+				totals[row.UrlMappingID] = total
+			}
+			if row.IsBot {
+				total.bots += row.Clicks
+			} else {
+				total.human += row.Clicks
+			}
+		}
+	}
+	if len(totals) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(totals))
+	for id := range totals {
+		ids = append(ids, id)
+	}
+	var links []models.UrlMapping
+	if err := db.DB.WithContext(ctx).Select("id", "short_code", "original_url").Where("id IN ?", ids).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(links, func(i, j int) bool {
+		a, b := totals[links[i].ID], totals[links[j].ID]
+		if a.human != b.human {
+			return a.human > b.human
+		}
+		return links[i].ShortCode < links[j].ShortCode
+	})
+
+	date := day.Format("2006-01-02")
+	rows := make([][]interface{}, 0, len(links))
+	for _, link := range links {
+		total := totals[link.ID]
+		rows = append(rows, []interface{}{date, link.ShortCode, link.OriginalUrl, total.human, total.bots})
+	}
+	return rows, nil
+}
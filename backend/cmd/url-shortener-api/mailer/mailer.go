@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"url-shortener/config"
+)
+
+var settings struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// Configure sets the SMTP server messages are sent through. Without a host,
+// messages are written to the log instead, which is enough for development.
+func Configure(cfg config.Config) {
+	settings.host = cfg.SMTPHost
+	settings.port = cfg.SMTPPort
+	settings.username = cfg.SMTPUsername
+	settings.password = cfg.SMTPPassword
+	settings.from = cfg.MailFrom
+}
+
+// Send delivers a plain-text email to a single recipient.
+func Send(to, subject, body string) error {
+	if settings.host == "" {
+		log.Printf("Email to %s (SMTP not configured)\nSubject: %s\n\n%s", to, subject, body)
+		return nil
+	}
+
+	// Header values come from our own code, but strip line breaks so a
+	// crafted address can't inject extra headers
+	to = stripNewlines(to)
+	subject = stripNewlines(subject)
+
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		settings.from, to, subject, strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if settings.username != "" {
+		auth = smtp.PlainAuth("", settings.username, settings.password, settings.host)
+	}
+	addr := net.JoinHostPort(settings.host, strconv.Itoa(settings.port))
+	return smtp.SendMail(addr, auth, settings.from, []string{to}, []byte(message))
+}
+
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
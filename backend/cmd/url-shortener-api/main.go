@@ -1,27 +1,240 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/redis/go-redis/v9"
+
+	"url-shortener/analytics"
+	"url-shortener/blocklist"
 	"url-shortener/config"
+	"url-shortener/controllers"
 	"url-shortener/db"
+	"url-shortener/jobs"
+	"url-shortener/mailer"
+	"url-shortener/middlewares"
+	"url-shortener/notifier"
 	"url-shortener/routes"
+	"url-shortener/scheduler"
+	"url-shortener/store"
+	"url-shortener/templates"
+	"url-shortener/utils"
+	"url-shortener/version"
+	"url-shortener/webhooks"
 )
 
 func main() {
 	// Load configuration
-	cfg := config.LoadConfig()
+	configPath := flag.String("config", "", "path to a YAML or TOML config file; environment variables override its settings")
+	printVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if *printVersion {
+		fmt.Println(version.Get())
+		return
+	}
+	log.Println("Starting url-shortener", version.Get())
+	cfg := config.LoadConfig(*configPath)
+
+	// Schema management runs instead of the server
+	if flag.Arg(0) == "migrate" {
+		runMigrateCommand(cfg, flag.Args()[1:])
+		return
+	}
+
+	// Load custom page templates
+	if cfg.InterstitialTemplatePath != "" {
+		if err := templates.UseInterstitialFile(cfg.InterstitialTemplatePath); err != nil {
+			log.Fatal("Failed to load interstitial template:", err)
+		}
+	}
+
+	// Load the GeoIP database used to enrich clicks
+	if cfg.GeoIPDatabasePath != "" {
+		if err := analytics.OpenGeoIP(cfg.GeoIPDatabasePath); err != nil {
+			log.Fatal("Failed to open GeoIP database:", err)
+		}
+	}
+
+	// Trust X-Forwarded-For only from known proxies
+	if err := utils.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// Keep destination checks away from internal addresses
+	if err := utils.SetOutboundNetworks(cfg.OutboundBlockedNetworks, cfg.OutboundAllowedNetworks); err != nil {
+		log.Fatal("Invalid OUTBOUND_BLOCKED_NETWORKS or OUTBOUND_ALLOWED_NETWORKS:", err)
+	}
+
+	// Configure outgoing mail
+	mailer.Configure(cfg)
+	notifier.Configure(cfg)
+
+	// Encrypt destination URLs at rest when a key is set
+	if err := store.SetEncryptionKey(cfg.URLEncryptionKey); err != nil {
+		log.Fatal("Invalid URL_ENCRYPTION_KEY:", err)
+	}
 
 	// Initialize database
 	db.InitDatabase(cfg)
+	switch cfg.LinkStore {
+	case "database":
+		store.Links = store.NewGormStore(db.DB, db.Replica)
+	case "memory":
+		log.Println("Keeping links in memory; they will be lost on restart, and jobs, takedowns, feeds and summary stats won't see them")
+		store.Links = store.NewMemoryStore(store.OrganizationsOf(db.DB))
+	default:
+		log.Fatalf("LINK_STORE must be database or memory, got %q", cfg.LinkStore)
+	}
+	if cfg.RedisURL != "" {
+		options, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			log.Fatal("Invalid REDIS_URL:", err)
+		}
+		store.Links = store.NewRedisCache(store.Links, redis.NewClient(options), cfg.RedisCacheTTL)
+	}
+
+	// Tell webhook subscribers about new links, and links newly flagged
+	controllers.RegisterCreationHook(func(c *controllers.LinkCreation) {
+		if c.Replacing == nil {
+			webhooks.Raise(webhooks.LinkCreated, *c.Mapping)
+		}
+		if c.Mapping.Status == "flagged" && (c.Replacing == nil || c.Replacing.Status != "flagged") {
+			webhooks.Raise(webhooks.LinkFlagged, *c.Mapping)
+		}
+	})
+
+	// Start background jobs
+	analytics.StartClickWriter(cfg)
+	if cfg.AsyncValidation {
+		controllers.StartValidationWorkers(&cfg)
+	}
+	jobScheduler := scheduler.New(cfg.JobJitter, cfg.DisabledJobs)
+	jobs.Schedule(jobScheduler, cfg)
+	if err := jobScheduler.Start(); err != nil {
+		log.Fatal("Invalid DISABLED_JOBS:", err)
+	}
+
+	// Reload rate limits and features on SIGHUP or when the config file changes
+	rateLimiter := middlewares.NewRateLimiter(cfg.RateLimits)
+	go reloadSettings(rateLimiter, cfg.ConfigWatchInterval)
 
 	// Setup routes
-	router := routes.SetupRoutes(cfg)
+	if cfg.MaintenanceMode {
+		log.Println("Starting in maintenance mode; writes are refused")
+	}
+	middlewares.SetMaintenance(cfg.MaintenanceMode)
+	router := routes.SetupRoutes(cfg, rateLimiter, jobScheduler)
+
+	// Start the server. Live click streams are ended on shutdown rather
+	// than holding it up.
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	server.RegisterOnShutdown(analytics.CloseStreams)
+	redirectServer := configureTLS(cfg, server)
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			log.Printf("Server is running on port %s with TLS", cfg.Port)
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Printf("Server is running on port %s", cfg.Port)
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+	if redirectServer != nil {
+		go func() {
+			log.Printf("Redirecting HTTP on port %s to HTTPS", cfg.HTTPRedirectPort)
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("Failed to start HTTP redirect server:", err)
+			}
+		}()
+	}
+
+	// Shut down gracefully on SIGINT or SIGTERM: stop taking requests and
+	// drain those in flight, let running jobs and validations finish, write
+	// out the buffered clicks, then close the connections they all used
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		// Cut off the requests still running after the timeout
+		log.Println("Error draining requests:", err)
+		server.Close()
+	}
+	if redirectServer != nil {
+		redirectServer.Close()
+	}
+	if err := jobScheduler.Stop(ctx); err != nil {
+		log.Println("Error waiting for background jobs:", err)
+	}
+	if err := controllers.StopImports(ctx); err != nil {
+		log.Println("Error waiting for link imports:", err)
+	}
+	if err := controllers.StopValidationWorkers(ctx); err != nil {
+		log.Println("Error waiting for link validation:", err)
+	}
+	if err := analytics.StopClickWriter(ctx); err != nil {
+		log.Println("Error writing buffered clicks:", err)
+	}
+	if err := store.Close(); err != nil {
+		log.Println("Error closing link cache:", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Println("Error closing database:", err)
+	}
+	log.Println("Server stopped")
+}
+
+// reloadSettings re-reads the rate limits and features each time the
+// process receives SIGHUP or, every watchInterval, finds the config file
+// changed, so they can be tuned without a rebuild or restart. The domain
+// blocklist is reloaded from the database at the same time. Invalid
+// settings are logged and the current ones kept.
+func reloadSettings(rateLimiter *middlewares.RateLimiter, watchInterval time.Duration) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	var ticks <-chan time.Time
+	if watchInterval > 0 {
+		ticks = time.NewTicker(watchInterval).C
+	}
+
+	for {
+		select {
+		case <-hangups:
+		case <-ticks:
+			if !config.FileChanged() {
+				continue
+			}
+		}
 
-	// Start the server
-	log.Printf("Server is running on port %s", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, router); err != nil {
-		log.Fatal("Failed to start server:", err)
+		limits, err := config.Reload()
+		if err != nil {
+			log.Printf("Keeping the current settings, the new ones are invalid:\n%v", err)
+			continue
+		}
+		rateLimiter.Update(limits)
+		blocklist.Invalidate()
+		log.Printf("Reloaded settings: API %.2f rps burst %d, redirects %.2f rps burst %d, %d route overrides",
+			limits.API.RPS, limits.API.Burst, limits.Redirect.RPS, limits.Redirect.Burst, len(limits.Routes))
 	}
 }
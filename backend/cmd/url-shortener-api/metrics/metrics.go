@@ -0,0 +1,267 @@
+// Package metrics keeps counters, histograms and gauges and serves them in
+// the Prometheus text exposition format. It covers only what this service
+// needs: labelled counters and histograms updated in place, and values read
+// from elsewhere when scraped.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is anything that can write itself out in the exposition format.
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func register(m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// Handler serves every registered metric.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registry.mu.Lock()
+		metrics := append([]metric(nil), registry.metrics...)
+		registry.mu.Unlock()
+		for _, m := range metrics {
+			m.write(w)
+		}
+	})
+}
+
+// DefaultBuckets suit request and query latencies, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// series holds the label values of one time series of a metric.
+type series struct {
+	labelValues []string
+}
+
+// family is what every metric shares: a name, help text and label names.
+type family struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (f family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s takes %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (f family) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, kind)
+}
+
+// labelString formats label pairs as {a="x",b="y"}, with extra name and
+// value pairs after the family's own.
+func (f family) labelString(labelValues []string, extra ...string) string {
+	pairs := make([]string, 0, len(f.labels)+len(extra)/2)
+	for i, name := range f.labels {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(labelValues[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes label values the way the exposition format expects.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value per combination of labels.
+type Counter struct {
+	family
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	series
+	value float64
+}
+
+// NewCounter registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: family{name: name, help: help, labels: labels}, values: make(map[string]*counterSeries)}
+	register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series with the given
+// label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &counterSeries{series: series{labelValues: append([]string(nil), labelValues...)}}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+// Value returns the series with the given label values, or zero if it
+// hasn't been incremented.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.values[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, key := range sortedKeys(c.values) {
+		s := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(s.labelValues), formatValue(s.value))
+	}
+}
+
+// Histogram counts observations into cumulative buckets per combination of
+// labels.
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	series
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// in increasing order, and label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  family{name: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogramSeries{
+			series: series{labelValues: append([]string(nil), labelValues...)},
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		s := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labelValues, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(s.labelValues), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(s.labelValues), s.count)
+	}
+}
+
+// Func is a gauge or counter whose values are read when scraped, for
+// figures kept elsewhere such as connection pool stats.
+type Func struct {
+	family
+	kind    string
+	collect func(set func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge whose series collect reports on each
+// scrape by calling set once per combination of label values.
+func NewGaugeFunc(name, help string, collect func(set func(value float64, labelValues ...string)), labels ...string) *Func {
+	return newFunc("gauge", name, help, collect, labels)
+}
+
+// NewCounterFunc is NewGaugeFunc for values that only ever increase.
+func NewCounterFunc(name, help string, collect func(set func(value float64, labelValues ...string)), labels ...string) *Func {
+	return newFunc("counter", name, help, collect, labels)
+}
+
+func newFunc(kind, name, help string, collect func(set func(value float64, labelValues ...string)), labels []string) *Func {
+	f := &Func{family: family{name: name, help: help, labels: labels}, kind: kind, collect: collect}
+	register(f)
+	return f
+}
+
+func (f *Func) write(w io.Writer) {
+	f.header(w, f.kind)
+	f.collect(func(value float64, labelValues ...string) {
+		f.key(labelValues) // checks the label count
+		fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(labelValues), formatValue(value))
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,145 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/utils"
+)
+
+type contextKey string
+
+const (
+	userIDKey    contextKey = "userID"
+	apiKeyIDKey  contextKey = "apiKeyID"
+	sessionIDKey contextKey = "sessionID"
+	apiKeyKey    contextKey = "apiKey"
+)
+
+// AuthMiddleware identifies the user from a "Bearer" access token or API key,
+// if one is sent. Requests without a valid credential carry on anonymously so
+// that public routes, and routes using other bearer tokens, are unaffected.
+func AuthMiddleware(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			switch {
+			case !found:
+			case utils.IsAPIKey(token):
+				if apiKey, ok := lookupAPIKey(r.Context(), token); ok {
+					r = withAPIKey(r, apiKey)
+				}
+			default:
+				userID, sessionID, err := utils.ValidateAccessToken(secret, token)
+				if err == nil && sessionActive(r.Context(), sessionID, userID) {
+					ctx := context.WithValue(r.Context(), userIDKey, userID)
+					r = r.WithContext(context.WithValue(ctx, sessionIDKey, sessionID))
+				}
+			}
+			next.ServeHTTP(w, withRole(r))
+		})
+	}
+}
+
+// QueryAPIKeyMiddleware also accepts an API key in the param query
+// parameter, for clients such as bookmarklets that can't set headers. The
+// access log leaves the key out.
+func QueryAPIKeyMiddleware(param string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := UserID(r); !ok {
+				if key := r.URL.Query().Get(param); utils.IsAPIKey(key) {
+					if apiKey, ok := lookupAPIKey(r.Context(), key); ok {
+						r = withRole(withAPIKey(r, apiKey))
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func withAPIKey(r *http.Request, apiKey models.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), userIDKey, apiKey.UserID)
+	ctx = context.WithValue(ctx, apiKeyKey, apiKey)
+	return r.WithContext(context.WithValue(ctx, apiKeyIDKey, apiKey.ID))
+}
+
+// withRole gives admin users the same standing as the admin token.
+func withRole(r *http.Request) *http.Request {
+	if userID, ok := UserID(r); ok {
+		if role, err := lookupRole(r.Context(), userID); err == nil && role == models.RoleAdmin {
+			r = r.WithContext(context.WithValue(r.Context(), adminKey, true))
+		}
+	}
+	return r
+}
+
+// RequireUser rejects requests that AuthMiddleware couldn't attribute to a user.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := UserID(r); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserID returns the authenticated user's ID for r, if any.
+func UserID(r *http.Request) (uint, bool) {
+	userID, ok := r.Context().Value(userIDKey).(uint)
+	return userID, ok
+}
+
+// APIKeyID returns the ID of the API key r was authenticated with, if any.
+func APIKeyID(r *http.Request) (uint, bool) {
+	apiKeyID, ok := r.Context().Value(apiKeyIDKey).(uint)
+	return apiKeyID, ok
+}
+
+// SessionID returns the login session r's access token belongs to, if any.
+func SessionID(r *http.Request) (uint, bool) {
+	sessionID, ok := r.Context().Value(sessionIDKey).(uint)
+	return sessionID, ok
+}
+
+// sessionActive reports whether a session exists for userID and hasn't been
+// revoked, so logging out takes effect before access tokens expire.
+func sessionActive(ctx context.Context, sessionID, userID uint) bool {
+	var count int64
+	err := db.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Count(&count).Error
+	if err != nil {
+		log.Println("Error checking session:", err)
+		return false
+	}
+	return count > 0
+}
+
+// apiKeyTouchInterval is how stale an API key's last_used_at gets before a
+// request updates it, so busy keys don't write on every request.
+const apiKeyTouchInterval = time.Minute
+
+func lookupAPIKey(ctx context.Context, key string) (models.APIKey, bool) {
+	var apiKey models.APIKey
+	if err := db.DB.WithContext(ctx).Select("id", "user_id", "rate_limit_rps", "rate_limit_burst", "last_used_at").Where("key_hash = ?", utils.HashAPIKey(key)).First(&apiKey).Error; err != nil {
+		return apiKey, false
+	}
+	now := time.Now()
+	if stale := now.Add(-apiKeyTouchInterval); apiKey.LastUsedAt == nil || apiKey.LastUsedAt.Before(stale) {
+		// The condition keeps concurrent requests from all writing it
+		err := db.DB.WithContext(ctx).Model(&apiKey).Where("last_used_at IS NULL OR last_used_at < ?", stale).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			log.Println("Error recording API key use:", err)
+		}
+	}
+	return apiKey, true
+}
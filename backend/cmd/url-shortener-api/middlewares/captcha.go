@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+
+	"url-shortener/utils"
+)
+
+// CaptchaHeader carries the token from the client's solved CAPTCHA.
+const CaptchaHeader = "X-Captcha-Token"
+
+// CaptchaMiddleware makes unauthenticated requests prove they came from a
+// person by passing a solved reCAPTCHA or Turnstile token in CaptchaHeader.
+// Signed-in users, API keys and admins skip the check. An empty provider
+// disables it.
+func CaptchaMiddleware(provider, secret string, minScore float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if provider == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := UserID(r); ok || IsAdmin(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := r.Header.Get(CaptchaHeader)
+			if token == "" {
+				http.Error(w, "CAPTCHA required", http.StatusForbidden)
+				return
+			}
+
+			passed, err := utils.VerifyCaptcha(r.Context(), provider, secret, token, utils.ClientIP(r), minScore)
+			if err != nil {
+				// Failing open would let bots through whenever the provider blips
+				log.Printf("Error verifying %s CAPTCHA: %v", provider, err)
+				http.Error(w, "Could not verify CAPTCHA, please try again", http.StatusServiceUnavailable)
+				return
+			}
+			if !passed {
+				http.Error(w, "CAPTCHA verification failed", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCaptchaMiddlewareSkipsKnownCallers(t *testing.T) {
+	const adminToken = "admin-secret"
+	tests := []struct {
+		name   string
+		header string
+		user   bool
+		want   int
+	}{
+		{name: "anonymous without a token", want: http.StatusForbidden},
+		{name: "admin token", header: "Bearer " + adminToken, want: http.StatusOK},
+		{name: "wrong admin token", header: "Bearer not-the-token", want: http.StatusForbidden},
+		{name: "signed-in user", user: true, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AdminTokenMiddleware(adminToken)(
+				CaptchaMiddleware("turnstile", "captcha-secret", 0)(
+					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+			r := httptest.NewRequest(http.MethodPost, "/shorten", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.user {
+				r = r.WithContext(context.WithValue(r.Context(), userIDKey, uint(7)))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptchaMiddlewareDisabled(t *testing.T) {
+	handler := CaptchaMiddleware("", "", 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/shorten", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status %d, want %d", w.Code, http.StatusOK)
+	}
+}
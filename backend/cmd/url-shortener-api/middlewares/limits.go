@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestTimeoutMiddleware cancels each request's context after timeout, so
+// the database queries and outbound calls made with it give up and the
+// handler can answer. Routes whose templates are exempt, such as streams and
+// exports, run as long as the client stays.
+func RequestTimeoutMiddleware(timeout time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	exempted := make(map[string]bool, len(exempt))
+	for _, template := range exempt {
+		exempted[template] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil && exempted[template] {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// MaxBodySize stops reading request bodies after limit bytes. Handlers see
+// an *http.MaxBytesError when decoding a larger body.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
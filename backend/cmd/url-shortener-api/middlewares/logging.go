@@ -1,17 +1,118 @@
 package middlewares
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"url-shortener/utils"
 )
 
-// LoggingMiddleware logs each incoming HTTP request.
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		duration := time.Since(start)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, duration)
-	})
+// accessEntry is one request in the access log.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	ClientIP   string    `json:"client_ip"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Protocol   string    `json:"protocol"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Referrer   string    `json:"referrer"`
+	UserAgent  string    `json:"user_agent"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// LoggingMiddleware writes an access log line for each request, in Apache's
+// combined format or, with format "json", as one JSON object per line.
+func LoggingMiddleware(format string) func(http.Handler) http.Handler {
+	// Access log lines carry their own timestamps
+	accessLog := log.New(log.Writer(), "", 0)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			entry := accessEntry{
+				Time:       start,
+				ClientIP:   utils.ClientIP(r),
+				Method:     r.Method,
+				URI:        redactURI(r.RequestURI),
+				Protocol:   r.Proto,
+				Status:     recorder.status,
+				Bytes:      recorder.bytes,
+				Referrer:   r.Referer(),
+				UserAgent:  r.UserAgent(),
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if format == "json" {
+				// Query strings are full of &s, which needn't be escaped here
+				var line bytes.Buffer
+				encoder := json.NewEncoder(&line)
+				encoder.SetEscapeHTML(false)
+				if err := encoder.Encode(entry); err != nil {
+					log.Println("Error encoding access log entry:", err)
+					return
+				}
+				accessLog.Print(line.String())
+				return
+			}
+			accessLog.Print(combinedLogLine(entry))
+		})
+	}
+}
+
+// redactedParams are query parameters that carry credentials, whose values
+// are kept out of the access log.
+var redactedParams = []string{"key"}
+
+func redactURI(uri string) string {
+	path, rawQuery, found := strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+	// Malformed pairs are dropped, which only matters when there's a key
+	query, _ := url.ParseQuery(rawQuery)
+	redacted := false
+	for _, param := range redactedParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return uri
+	}
+	return path + "?" + query.Encode()
+}
+
+// combinedLogLine formats entry in Apache's combined log format. Quoted
+// fields are escaped so a client can't forge extra fields or lines.
+func combinedLogLine(entry accessEntry) string {
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+	return fmt.Sprintf("%s - - [%s] %s %d %s %s %s",
+		entry.ClientIP,
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(entry.Method+" "+entry.URI+" "+entry.Protocol),
+		entry.Status,
+		size,
+		strconv.Quote(orDash(entry.Referrer)),
+		strconv.Quote(orDash(entry.UserAgent)),
+	)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
 }
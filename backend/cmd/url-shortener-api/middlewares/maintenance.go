@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var maintenance atomic.Bool
+
+// SetMaintenance turns maintenance mode on or off for this instance.
+func SetMaintenance(on bool) {
+	maintenance.Store(on)
+}
+
+// InMaintenance reports whether this instance is in maintenance mode.
+func InMaintenance() bool {
+	return maintenance.Load()
+}
+
+// MaintenanceMiddleware rejects writes with 503 while in maintenance mode,
+// telling clients to retry after retryAfter. Reads, including redirects,
+// carry on. Routes whose templates are exempt, such as the one that ends
+// maintenance, always run.
+func MaintenanceMiddleware(retryAfter time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	exempted := make(map[string]bool, len(exempt))
+	for _, template := range exempt {
+		exempted[template] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !InMaintenance() || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil && exempted[template] {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			refuseForMaintenance(w, retryAfter)
+		})
+	}
+}
+
+// MaintenanceWriteMiddleware refuses a GET route that writes, such as one
+// that creates links, while in maintenance mode, as MaintenanceMiddleware
+// does other writes.
+func MaintenanceWriteMiddleware(retryAfter time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if InMaintenance() {
+				refuseForMaintenance(w, retryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func refuseForMaintenance(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	http.Error(w, "Down for maintenance, please try again later", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,131 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// APIKeyQuotaMiddleware meters requests made with an API key against the
+// key's daily and monthly quotas, rejecting them with 429 once either is used
+// up. Keys without their own quotas use the given defaults; zero is unlimited.
+// Requests not made with an API key pass through unmetered.
+func APIKeyQuotaMiddleware(defaultDaily, defaultMonthly int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ChargeAPIKeyQuota(w, r, 1, defaultDaily, defaultMonthly) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// ChargeAPIKeyQuota meters units calls against the quotas of the API key r
+// was made with, for requests that do the work of many calls, such as
+// imports. Unless the key has that many calls left, nothing is charged and
+// it writes a 429 or other error and returns false. Requests not made with
+// an API key always pass.
+func ChargeAPIKeyQuota(w http.ResponseWriter, r *http.Request, units, defaultDaily, defaultMonthly int) bool {
+	apiKeyID, ok := APIKeyID(r)
+	if !ok {
+		return true
+	}
+
+	var apiKey models.APIKey
+	if err := db.DB.WithContext(r.Context()).First(&apiKey, apiKeyID).Error; err != nil {
+		log.Printf("Error retrieving API key %d: %v", apiKeyID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	daily, monthly := EffectiveQuotas(apiKey, defaultDaily, defaultMonthly)
+
+	now := time.Now().UTC()
+	usage, err := recordAPIKeyUse(r.Context(), apiKey.ID, now, units, daily, monthly)
+	if errors.Is(err, errQuotaExceeded) {
+		retryAt := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		if monthly > 0 && usage.Month+int64(units) > int64(monthly) {
+			retryAt = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		message := fmt.Sprintf("API key quota exceeded (%d today, %d this month)", usage.Day, usage.Month)
+		if units > 1 {
+			message = fmt.Sprintf("API key quota can't cover %d more calls (%d today, %d this month)", units, usage.Day, usage.Month)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAt.Sub(now).Seconds())+1))
+		http.Error(w, message, http.StatusTooManyRequests)
+		rateLimitRejections.Inc("api_key_quota")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error metering API key %d: %v", apiKey.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// quotaUsage is an API key's call count for the current day and month.
+type quotaUsage struct {
+	Day   int64
+	Month int64
+}
+
+// EffectiveQuotas returns the daily and monthly quotas that apply to apiKey.
+func EffectiveQuotas(apiKey models.APIKey, defaultDaily, defaultMonthly int) (int, int) {
+	daily, monthly := defaultDaily, defaultMonthly
+	if apiKey.DailyQuota != nil {
+		daily = *apiKey.DailyQuota
+	}
+	if apiKey.MonthlyQuota != nil {
+		monthly = *apiKey.MonthlyQuota
+	}
+	return daily, monthly
+}
+
+// recordAPIKeyUse counts units calls for apiKeyID at now, unless that would
+// exceed either quota, in which case nothing is recorded and
+// errQuotaExceeded is returned along with the usage so far.
+func recordAPIKeyUse(ctx context.Context, apiKeyID uint, now time.Time, units, daily, monthly int) (quotaUsage, error) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var usage quotaUsage
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		row := models.APIKeyUsage{APIKeyID: apiKeyID, Day: day, Count: int64(units)}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "api_key_id"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("api_key_usages.count + ?", units)}),
+		}).Create(&row).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.APIKeyUsage{}).
+			Select("COALESCE(MAX(CASE WHEN day = ? THEN count END), 0) AS day, CAST(COALESCE(SUM(count), 0) AS bigint) AS month", day).
+			Where("api_key_id = ? AND day >= ?", apiKeyID, monthStart).
+			Scan(&usage).Error
+		if err != nil {
+			return err
+		}
+
+		// Roll back the increment so rejected calls don't use up quota
+		if (daily > 0 && usage.Day > int64(daily)) || (monthly > 0 && usage.Month > int64(monthly)) {
+			usage.Day -= int64(units)
+			usage.Month -= int64(units)
+			return errQuotaExceeded
+		}
+		return nil
+	})
+	return usage, err
+}
@@ -1,20 +1,172 @@
 package middlewares
 
 import (
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"sync"
 
+	"url-shortener/config"
+	"url-shortener/models"
+	"url-shortener/utils"
+
+	"github.com/gorilla/mux"
 	"golang.org/x/time/rate"
 )
 
-// RateLimitMiddleware limits the number of requests to prevent abuse.
-func RateLimitMiddleware(next http.Handler) http.Handler {
-	limiter := rate.NewLimiter(1, 3) // 1 request per second with a burst of 3
+// Rate limit classes. Routes are in the API class unless assigned another.
+const (
+	APIClass      = "api"
+	RedirectClass = "redirect"
+)
+
+// RateLimiter limits the number of requests from each client to prevent
+// abuse, so one noisy caller doesn't throttle everyone else. Anonymous
+// clients are told apart by IP; signed-in users by account and API keys by
+// key, each key with its own rate, so users behind a shared NAT aren't
+// throttled together. Redirects get a far higher limit than the API and are
+// always limited per IP, individual routes can have their own limits, and
+// the limits can be swapped while serving.
+type RateLimiter struct {
+	mu            sync.RWMutex
+	classes       map[string]*keyedLimiter
+	routes        map[string]*keyedLimiter
+	apiKeys       *keyedLimiter
+	apiKeyDefault config.RateLimit
+	bypass        []*net.IPNet
+	// routeClasses maps route templates to their class
+	routeClasses map[string]string
+}
+
+// NewRateLimiter creates a limiter with the given limits.
+func NewRateLimiter(limits config.RateLimits) *RateLimiter {
+	l := &RateLimiter{routeClasses: make(map[string]string)}
+	l.Update(limits)
+	return l
+}
+
+// SetRouteClass puts the routes with the given templates in class.
+func (l *RateLimiter) SetRouteClass(class string, templates ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, template := range templates {
+		l.routeClasses[template] = class
+	}
+}
 
+// Update replaces the limits. Clients start over with full buckets.
+func (l *RateLimiter) Update(limits config.RateLimits) {
+	classes := map[string]*keyedLimiter{
+		APIClass:      newRateLimitLimiter(limits.API),
+		RedirectClass: newRateLimitLimiter(limits.Redirect),
+	}
+	bypass, err := utils.ParseNetworks(limits.Bypass)
+	if err != nil {
+		log.Println("Ignoring RATE_LIMIT_BYPASS:", err)
+	}
+	routeLimiters := make(map[string]*keyedLimiter, len(limits.Routes))
+	for route, routeLimit := range limits.Routes {
+		routeLimiters[route] = newRateLimitLimiter(routeLimit)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.classes = classes
+	l.routes = routeLimiters
+	l.apiKeys = newKeyedLimiter(rate.Limit(limits.APIKey.RPS), limits.APIKey.Burst)
+	l.apiKeyDefault = limits.APIKey
+	l.bypass = bypass
+}
+
+// Middleware rejects requests over the limit with 429, sending rate limit
+// headers once a client gets close. Clients on the bypass list aren't limited.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !limiter.Allow() {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		if status, limited := l.take(r); limited && rejectOverLimit(w, status, "request_rate") {
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// take takes a token from the bucket of the client that sent r, reporting
+// false if the request isn't limited at all.
+func (l *RateLimiter) take(r *http.Request) (limitStatus, bool) {
+	if l.bypassed(utils.ClientIP(r)) {
+		return limitStatus{}, false
+	}
+
+	limiter, class := l.limiterFor(r)
+	userID, signedIn := UserID(r)
+
+	// Redirects are limited per IP even for signed-in users
+	if class == RedirectClass || !signedIn {
+		if limiter == nil {
+			return limitStatus{}, false
+		}
+		return limiter.take(utils.ClientIP(r)), true
+	}
+
+	if apiKey, ok := r.Context().Value(apiKeyKey).(models.APIKey); ok {
+		l.mu.RLock()
+		apiKeys, limit := l.apiKeys, EffectiveRateLimit(apiKey, l.apiKeyDefault)
+		l.mu.RUnlock()
+		if limit.RPS <= 0 {
+			return limitStatus{}, false
+		}
+		return apiKeys.takeWith(fmt.Sprint(apiKey.ID), rate.Limit(limit.RPS), limit.Burst), true
+	}
+
+	if limiter == nil {
+		return limitStatus{}, false
+	}
+	return limiter.take(fmt.Sprintf("user:%d", userID)), true
+}
+
+// limiterFor returns the limiter for the route r matched, or nil if it's
+// unlimited, along with the route's class. A route's own limit wins over its
+// class's.
+func (l *RateLimiter) limiterFor(r *http.Request) (*keyedLimiter, string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	class := APIClass
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if routeClass, ok := l.routeClasses[template]; ok {
+				class = routeClass
+			}
+			if limiter, ok := l.routes[template]; ok {
+				return limiter, class
+			}
+		}
+	}
+	return l.classes[class], class
+}
+
+func (l *RateLimiter) bypassed(ip string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return utils.InNetworks(ip, l.bypass)
+}
+
+// EffectiveRateLimit returns the rate limit that applies to apiKey, using
+// the default for whatever the key doesn't set itself.
+func EffectiveRateLimit(apiKey models.APIKey, defaultLimit config.RateLimit) config.RateLimit {
+	limit := defaultLimit
+	if apiKey.RateLimitRPS != nil {
+		limit.RPS = *apiKey.RateLimitRPS
+	}
+	if apiKey.RateLimitBurst != nil {
+		limit.Burst = *apiKey.RateLimitBurst
+	}
+	return limit
+}
+
+func newRateLimitLimiter(limit config.RateLimit) *keyedLimiter {
+	if limit.RPS <= 0 {
+		return nil
+	}
+	return newKeyedLimiter(rate.Limit(limit.RPS), limit.Burst)
+}
@@ -0,0 +1,131 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+)
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	type request struct {
+		remoteAddr string
+		want       int
+	}
+	tests := []struct {
+		name     string
+		limits   config.RateLimits
+		requests []request
+	}{
+		{
+			name:   "over the burst",
+			limits: config.RateLimits{API: config.RateLimit{RPS: 0.001, Burst: 2}},
+			requests: []request{
+				{"192.0.2.1:1000", http.StatusOK},
+				{"192.0.2.1:1001", http.StatusOK},
+				{"192.0.2.1:1002", http.StatusTooManyRequests},
+			},
+		},
+		{
+			name:   "clients have their own buckets",
+			limits: config.RateLimits{API: config.RateLimit{RPS: 0.001, Burst: 1}},
+			requests: []request{
+				{"192.0.2.1:1000", http.StatusOK},
+				{"192.0.2.1:1000", http.StatusTooManyRequests},
+				{"192.0.2.2:1000", http.StatusOK},
+			},
+		},
+		{
+			name:   "bypassed range",
+			limits: config.RateLimits{API: config.RateLimit{RPS: 0.001, Burst: 1}, Bypass: []string{"198.51.100.0/24"}},
+			requests: []request{
+				{"198.51.100.7:1000", http.StatusOK},
+				{"198.51.100.7:1000", http.StatusOK},
+				{"198.51.100.8:1000", http.StatusOK},
+				{"192.0.2.1:1000", http.StatusOK},
+				{"192.0.2.1:1000", http.StatusTooManyRequests},
+			},
+		},
+		{
+			name:   "unlimited",
+			limits: config.RateLimits{API: config.RateLimit{RPS: 0, Burst: 1}},
+			requests: []request{
+				{"192.0.2.1:1000", http.StatusOK},
+				{"192.0.2.1:1000", http.StatusOK},
+				{"192.0.2.1:1000", http.StatusOK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewRateLimiter(tt.limits).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			for i, req := range tt.requests {
+				r := httptest.NewRequest(http.MethodGet, "/api/links", nil)
+				r.RemoteAddr = req.remoteAddr
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Code != req.want {
+					t.Fatalf("request %d from %s: status %d, want %d", i, req.remoteAddr, w.Code, req.want)
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d: 429 without Retry-After", i)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterEvictsIdleClients(t *testing.T) {
+	idle := time.Now().Add(-2 * limiterIdleTTL)
+	tests := []struct {
+		name     string
+		swept    time.Time
+		lastSeen time.Time
+		kept     bool
+	}{
+		{name: "idle client after the sweep interval", swept: idle, lastSeen: idle, kept: false},
+		{name: "recent client after the sweep interval", swept: idle, lastSeen: time.Now(), kept: true},
+		{name: "idle client before the sweep interval", swept: time.Now(), lastSeen: idle, kept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newKeyedLimiter(1, 1)
+			k.take("old")
+			k.limiters["old"].lastSeen = tt.lastSeen
+			k.swept = tt.swept
+
+			k.take("new")
+			if _, ok := k.limiters["old"]; ok != tt.kept {
+				t.Errorf("old client kept = %v, want %v", ok, tt.kept)
+			}
+			if _, ok := k.limiters["new"]; !ok {
+				t.Error("new client wasn't added")
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterStatus(t *testing.T) {
+	k := newKeyedLimiter(0.001, 3)
+	tests := []struct {
+		name      string
+		allowed   bool
+		remaining int
+	}{
+		{name: "first", allowed: true, remaining: 2},
+		{name: "second", allowed: true, remaining: 1},
+		{name: "third", allowed: true, remaining: 0},
+		{name: "over", allowed: false, remaining: 0},
+	}
+	for _, tt := range tests {
+		status := k.take("client")
+		if status.allowed != tt.allowed || status.remaining != tt.remaining || status.limit != 3 {
+			t.Errorf("%s: take() = %+v, want allowed %v, remaining %d, limit 3", tt.name, status, tt.allowed, tt.remaining)
+		}
+		if !tt.allowed && status.retryAfter <= 0 {
+			t.Errorf("%s: retryAfter = %v, want > 0", tt.name, status.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"url-shortener/utils"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL is how long a client's limiter is kept after its last request.
+const limiterIdleTTL = 10 * time.Minute
+
+// keyedLimiter hands out a separate token bucket per client key.
+type keyedLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*limiterEntry
+	swept    time.Time
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newKeyedLimiter(limit rate.Limit, burst int) *keyedLimiter {
+	return &keyedLimiter{
+		limit:    limit,
+		burst:    burst,
+		limiters: make(map[string]*limiterEntry),
+		swept:    time.Now(),
+	}
+}
+
+// limitStatus is the outcome of taking a token from a client's bucket.
+type limitStatus struct {
+	allowed    bool
+	limit      int           // bucket size
+	remaining  int           // whole tokens left
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when not allowed
+}
+
+// take takes a token from key's bucket, reporting whether one was available
+// and how much of the bucket is left.
+func (k *keyedLimiter) take(key string) limitStatus {
+	return k.takeWith(key, k.limit, k.burst)
+}
+
+// takeWith is take for a bucket with its own rate, such as an API key's.
+func (k *keyedLimiter) takeWith(key string, limit rate.Limit, burst int) limitStatus {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	// Forget idle clients now and then so the map doesn't grow without bound
+	if now.Sub(k.swept) > limiterIdleTTL {
+		for key, entry := range k.limiters {
+			if now.Sub(entry.lastSeen) > limiterIdleTTL {
+				delete(k.limiters, key)
+			}
+		}
+		k.swept = now
+	}
+
+	entry, ok := k.limiters[key]
+	if !ok {
+		entry = &limiterEntry{limiter: rate.NewLimiter(limit, burst)}
+		k.limiters[key] = entry
+	}
+	// Pick up changed rates without emptying the bucket
+	if entry.limiter.Limit() != limit {
+		entry.limiter.SetLimitAt(now, limit)
+	}
+	if entry.limiter.Burst() != burst {
+		entry.limiter.SetBurstAt(now, burst)
+	}
+	entry.lastSeen = now
+
+	status := limitStatus{allowed: entry.limiter.AllowN(now, 1), limit: burst}
+	tokens := entry.limiter.TokensAt(now)
+	if tokens > 0 {
+		status.remaining = int(tokens)
+	}
+	status.reset = tokenWait(float64(burst)-tokens, limit)
+	if !status.allowed {
+		status.retryAfter = tokenWait(1-tokens, limit)
+	}
+	return status
+}
+
+// tokenWait is how long it takes to refill tokens at limit per second.
+func tokenWait(tokens float64, limit rate.Limit) time.Duration {
+	if tokens <= 0 || limit <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / float64(limit) * float64(time.Second))
+}
+
+// nearLimitFraction is how empty a bucket gets before rate limit headers are
+// sent on successful responses too.
+const nearLimitFraction = 0.2
+
+// rejectOverLimit writes the rate limit headers when the client is close to or
+// over its limit, and the 429 response when it's over. It reports whether the
+// request was rejected, counting rejections under limiter.
+func rejectOverLimit(w http.ResponseWriter, status limitStatus, limiter string) bool {
+	if status.allowed && float64(status.remaining) > nearLimitFraction*float64(status.limit) {
+		return false
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(status.reset)))
+	if status.allowed {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(status.retryAfter)))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	rateLimitRejections.Inc(limiter)
+	return true
+}
+
+// ceilSeconds rounds d up to whole seconds, and to at least one so clients
+// don't retry immediately.
+func ceilSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// TierRateLimitMiddleware limits anonymous clients per IP address and
+// authenticated users per account, each to their tier's requests per minute.
+// Requests with the admin token share one authenticated bucket. Zero disables the limit for that tier.
+func TierRateLimitMiddleware(anonymousPerMinute, authenticatedPerMinute int) func(http.Handler) http.Handler {
+	anonymous := newKeyedLimiter(rate.Limit(float64(anonymousPerMinute)/60), anonymousPerMinute)
+	authenticated := newKeyedLimiter(rate.Limit(float64(authenticatedPerMinute)/60), authenticatedPerMinute)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userID, ok := UserID(r); ok || IsAdmin(r) {
+				key := fmt.Sprint(userID)
+				if !ok {
+					key = "admin"
+				}
+				if authenticatedPerMinute > 0 && rejectOverLimit(w, authenticated.take(key), "shorten_tier") {
+					return
+				}
+			} else if anonymousPerMinute > 0 && rejectOverLimit(w, anonymous.take(utils.ClientIP(r)), "shorten_tier") {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CallerRateLimit limits callers a handler identifies itself, such as chat
+// users in a signed request body, each to perMinute requests per minute.
+type CallerRateLimit struct {
+	perMinute int
+	callers   *keyedLimiter
+}
+
+// NewCallerRateLimit returns a limit of perMinute requests per minute for
+// each caller. Zero disables it.
+func NewCallerRateLimit(perMinute int) *CallerRateLimit {
+	return &CallerRateLimit{
+		perMinute: perMinute,
+		callers:   newKeyedLimiter(rate.Limit(float64(perMinute)/60), perMinute),
+	}
+}
+
+// Take counts a request from caller, reporting whether it's within the
+// limit and, if not, how long until the caller can try again, in whole
+// seconds. Rejections are counted under limiter.
+func (l *CallerRateLimit) Take(caller, limiter string) (bool, time.Duration) {
+	if l.perMinute <= 0 {
+		return true, 0
+	}
+	status := l.callers.take(caller)
+	if status.allowed {
+		return true, 0
+	}
+	rateLimitRejections.Inc(limiter)
+	return false, time.Duration(ceilSeconds(status.retryAfter)) * time.Second
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/store"
+)
+
+const migrateUsage = "usage: url-shortener-api [-config file] migrate [up | down [steps] | status | seal]"
+
+// runMigrateCommand handles `url-shortener-api migrate ...`, which manages
+// the schema, and encrypts values stored before URL_ENCRYPTION_KEY was set,
+// without starting the server.
+func runMigrateCommand(cfg config.Config, args []string) {
+	db.Connect(cfg)
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := db.Migrate(cfg.DBDriver)
+		if err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		log.Printf("Applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatal(migrateUsage)
+			}
+			steps = n
+		}
+		if err := db.MigrateDown(cfg.DBDriver, steps); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+	case "status":
+		states, err := db.MigrationStatus(cfg.DBDriver)
+		if err != nil {
+			log.Fatal("Failed to read migration status: ", err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(os.Stdout, "%04d_%s\t%s\n", state.Version, state.Name, applied)
+		}
+	case "seal":
+		if cfg.URLEncryptionKey == "" {
+			log.Fatal("Set URL_ENCRYPTION_KEY to encrypt stored values")
+		}
+		if err := store.SetEncryptionKey(cfg.URLEncryptionKey); err != nil {
+			log.Fatal("Invalid URL_ENCRYPTION_KEY:", err)
+		}
+		sealed, err := store.SealStored(context.Background(), db.DB)
+		if err != nil {
+			log.Fatal("Encrypting stored values failed: ", err)
+		}
+		log.Printf("Encrypted %d values stored in plaintext", sealed)
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// Abuse report statuses. Reports stay open until an admin triages the link
+// they're about, which resolves all of its open reports together.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// abuseReasons are the reasons a visitor can give for reporting a link.
+var abuseReasons = map[string]bool{
+	"phishing": true,
+	"malware":  true,
+	"spam":     true,
+	"illegal":  true,
+	"other":    true,
+}
+
+// ValidAbuseReason reports whether reason is a known abuse report reason.
+func ValidAbuseReason(reason string) bool {
+	return abuseReasons[reason]
+}
+
+type AbuseReport struct {
+	ID            uint       `gorm:"primaryKey"`
+	UrlMappingID  uint       `gorm:"index;not null"`
+	UrlMapping    UrlMapping `gorm:"constraint:OnDelete:CASCADE"`
+	Reason        string     `gorm:"size:20;not null"`
+	Details       string     `gorm:"type:text"`
+	ReporterEmail string     `gorm:"size:255"` // optional, for follow-up
+	ReporterIP    string     `gorm:"size:45;index"`
+	Status        string     `gorm:"size:10;not null;default:'open';index"`
+	ResolvedByID  *uint      // Nullable; the admin token has no user
+	ResolvedAt    *time.Time `gorm:"type:timestamp"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// Account deletion statuses. A deletion is pending until the user confirms
+// it with the emailed token, then confirmed until the delete-accounts job
+// carries it out. It fails if its links can no longer go where asked.
+const (
+	DeletionPending   = "pending"
+	DeletionConfirmed = "confirmed"
+	DeletionCompleted = "completed"
+	DeletionFailed    = "failed"
+)
+
+// What an account deletion does with the links the user owns outside any
+// organization. Links already shared with an organization stay with it.
+const (
+	LinksDelete    = "delete"    // delete them and their clicks
+	LinksTransfer  = "transfer"  // move them into an organization
+	LinksAnonymize = "anonymize" // keep them redirecting, unowned, until they expire
+)
+
+// AccountDeletion is a user's request to delete their account. It outlives
+// the account, so UserID has no foreign key.
+type AccountDeletion struct {
+	ID             uint       `gorm:"primaryKey"`
+	UserID         uint       `gorm:"index;not null"`
+	Email          string     `gorm:"size:255;not null"` // where to report the outcome once the user is gone
+	Links          string     `gorm:"size:10;not null"`  // delete, transfer or anonymize
+	OrganizationID *uint      // Nullable; where transferred links go
+	Status         string     `gorm:"size:10;not null;default:'pending';index"`
+	Error          string     `gorm:"type:text"`               // why the deletion failed
+	ExpiresAt      time.Time  `gorm:"type:timestamp;not null"` // confirm by then or ask again
+	ConfirmedAt    *time.Time `gorm:"type:timestamp"`
+	FinishedAt     *time.Time `gorm:"type:timestamp"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+type APIKey struct {
+	ID             uint       `gorm:"primaryKey"`
+	UserID         uint       `gorm:"index;not null"`
+	User           User       `gorm:"constraint:OnDelete:CASCADE"`
+	Name           string     `gorm:"size:100"`
+	Prefix         string     `gorm:"size:16;not null"`             // first characters of the key, for display
+	KeyHash        string     `gorm:"size:64;uniqueIndex;not null"` // SHA-256 of the full key
+	DailyQuota     *int       // Nullable; falls back to the global default, 0 means unlimited
+	MonthlyQuota   *int       // Nullable; falls back to the global default, 0 means unlimited
+	RateLimitRPS   *float64   // Nullable; falls back to the global default, 0 means unlimited
+	RateLimitBurst *int       // Nullable; falls back to the global default
+	LastUsedAt     *time.Time `gorm:"type:timestamp"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`
+}
+
+type APIKeyUsage struct {
+	ID       uint      `gorm:"primaryKey"`
+	APIKeyID uint      `gorm:"not null;uniqueIndex:idx_api_key_usages_key_day"`
+	Day      time.Time `gorm:"type:date;not null;uniqueIndex:idx_api_key_usages_key_day"` // UTC
+	Count    int64     `gorm:"not null;default:0"`                                        // shorten calls made that day
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// ArchivedLink is an expired link moved out of url_mappings once it has
+// been expired for the archive window. Its short code is free again, and
+// its clicks are kept only as a total.
+type ArchivedLink struct {
+	ID                 uint      `gorm:"primaryKey"`
+	LinkID             uint      `gorm:"index"` // the link's ID in url_mappings
+	ShortCode          string    `gorm:"size:32;index"`
+	OwnerID            *uint     `gorm:"index"`
+	OrganizationID     *uint     `gorm:"index"`
+	OriginalUrl        string    `gorm:"type:text;not null;serializer:encrypted"`
+	LinkCreatedAt      time.Time `gorm:"type:timestamp"`
+	IntendedExpiryDate time.Time `gorm:"type:timestamp"`
+	Clicks             int64     // raw and rolled-up clicks recorded before archiving
+	ArchivedAt         time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// Domain rule actions. Rules cover a domain and all of its subdomains; the
+// most specific matching rule wins, so an allow rule can carve an exception
+// out of a blocked parent domain.
+const (
+	DomainBlock = "block"
+	DomainAllow = "allow"
+)
+
+type BlockedDomain struct {
+	ID          uint      `gorm:"primaryKey"`
+	Domain      string    `gorm:"size:255;uniqueIndex;not null"` // stored lowercased, without a trailing dot
+	Action      string    `gorm:"size:10;not null;default:'block'"`
+	Reason      string    `gorm:"type:text"`
+	CreatedByID *uint     // Nullable; the admin token has no user
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+type ClickEvent struct {
+	ID           uint      `gorm:"primaryKey"`
+	ClickID      string    `gorm:"size:36;uniqueIndex"` // public ID handed to the destination for engagement tracking
+	UrlMappingID uint      `gorm:"index;not null"`
+	CreatedAt    time.Time `gorm:"autoCreateTime;index"`
+	IPAddress    string    `gorm:"size:45"`
+	UserAgent    string    `gorm:"size:512"`
+	Referrer     string    `gorm:"type:text"`
+	ReferrerHost string    `gorm:"size:255;index"` // empty for direct traffic
+	UTMSource    string    `gorm:"size:255"`
+	UTMMedium    string    `gorm:"size:255"`
+	UTMCampaign  string    `gorm:"size:255"`
+	Country      string    `gorm:"size:2"`              // ISO 3166-1 alpha-2, empty when unknown
+	Region       string    `gorm:"size:100"`            // first subdivision name, empty when unknown
+	IsBot        bool      `gorm:"default:false;index"` // crawler or link-preview fetcher; excluded from stats by default
+}
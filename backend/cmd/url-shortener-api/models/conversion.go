@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+type ConversionEvent struct {
+	ID           uint      `gorm:"primaryKey"`
+	UrlMappingID uint      `gorm:"index;not null"`
+	ClickID      string    `gorm:"size:36;index"` // click that led to the conversion, empty when unknown
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// CustomDomain is a branded domain a user has claimed for their links. The
+// verification job sets VerifiedAt once the host's DNS challenge record
+// holds Token, after which links can be made on it. Several users may claim
+// the same host, but only one can verify it.
+type CustomDomain struct {
+	ID            uint       `gorm:"primaryKey"`
+	OwnerID       uint       `gorm:"not null;uniqueIndex:idx_custom_domains_owner_host"`
+	Owner         *User      `gorm:"constraint:OnDelete:CASCADE"`
+	Host          string     `gorm:"size:253;not null;uniqueIndex:idx_custom_domains_owner_host"`
+	Token         string     `gorm:"size:64;not null"`
+	VerifiedAt    *time.Time `gorm:"type:timestamp"` // Nullable; set once the DNS challenge passed
+	LastCheckedAt *time.Time `gorm:"type:timestamp"` // Nullable; when the job last looked up the challenge
+	LastError     string     `gorm:"type:text"`      // why the last check failed
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
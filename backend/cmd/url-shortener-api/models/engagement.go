@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type EngagementEvent struct {
+	ID         uint      `gorm:"primaryKey"`
+	ClickID    string    `gorm:"size:36;index;not null"`
+	DurationMs int64     // time on page as reported by the destination
+	Interacted bool      // any click, scroll, key press or touch
+	Bounced    bool      `gorm:"index"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
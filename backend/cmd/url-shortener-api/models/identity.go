@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE"`
+	Provider  string    `gorm:"size:20;not null;uniqueIndex:idx_user_identities_provider_subject"`  // e.g., google, github
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject"` // provider's user ID
+	Email     string    `gorm:"size:255"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Invitation asks someone by email to join an organization with a given
+// role. The emailed link carries a signed token naming the invitation.
+type Invitation struct {
+	ID             uint         `gorm:"primaryKey"`
+	OrganizationID uint         `gorm:"index;not null"`
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE"`
+	Email          string       `gorm:"size:255;index;not null"`
+	Role           string       `gorm:"size:20;not null"` // owner, editor or viewer
+	InvitedByID    *uint        // Nullable; kept after the inviter's account is gone
+	InvitedBy      *User        `gorm:"constraint:OnDelete:SET NULL"`
+	ExpiresAt      time.Time    `gorm:"type:timestamp;not null"`
+	AcceptedAt     *time.Time   `gorm:"type:timestamp"` // Nullable; set once the invite is used
+	CreatedAt      time.Time    `gorm:"autoCreateTime"`
+}
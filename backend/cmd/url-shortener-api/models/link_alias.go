@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// LinkAlias is a short code that redirects through another link, left
+// behind when a duplicate link was merged into it.
+type LinkAlias struct {
+	ID           uint       `gorm:"primaryKey"`
+	ShortCode    string     `gorm:"uniqueIndex;size:32;not null"`
+	UrlMappingID uint       `gorm:"index;not null"`
+	UrlMapping   UrlMapping `gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// Link import statuses. An import is queued until a worker picks it up and
+// ends completed, even when some rows failed, or failed if it couldn't finish.
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// LinkImport tracks a bulk import of links from a CSV or JSON file. The
+// rows themselves are only held in memory while the import runs.
+type LinkImport struct {
+	ID         uint              `gorm:"primaryKey"`
+	OwnerID    *uint             `gorm:"index"` // Nullable; imports made with the admin token create unowned links
+	Owner      *User             `gorm:"constraint:OnDelete:CASCADE"`
+	Format     string            `gorm:"size:4;not null"` // csv or json
+	Status     string            `gorm:"size:10;not null;default:'queued'"`
+	TotalRows  int               `gorm:"not null;default:0"`
+	Processed  int               `gorm:"not null;default:0"`
+	Succeeded  int               `gorm:"not null;default:0"`
+	Failed     int               `gorm:"not null;default:0"`
+	RowErrors  []LinkImportError `gorm:"type:text;serializer:encryptedjson"` // holds the rows' URLs, so encrypted at rest
+	Error      string            `gorm:"type:text"`                          // why the import as a whole failed
+	CreatedAt  time.Time         `gorm:"autoCreateTime"`
+	StartedAt  *time.Time        `gorm:"type:timestamp"`
+	FinishedAt *time.Time        `gorm:"type:timestamp"`
+}
+
+// LinkImportError reports a row of an import that didn't become a link.
+// Row counts data rows from one, not counting a CSV header.
+type LinkImportError struct {
+	Row     int    `json:"row"`
+	URL     string `json:"url,omitempty"`
+	Alias   string `json:"custom_alias,omitempty"`
+	Message string `json:"message"`
+}
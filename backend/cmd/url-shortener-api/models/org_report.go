@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// OrgReport is an organization's usage report for one calendar month,
+// rendered as a PDF once the month is over.
+type OrgReport struct {
+	ID             uint         `gorm:"primaryKey"`
+	OrganizationID uint         `gorm:"not null;uniqueIndex:idx_org_reports_org_month"`
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE"`
+	Month          time.Time    `gorm:"type:date;not null;uniqueIndex:idx_org_reports_org_month"` // first day of the month, UTC
+	PDF            []byte       `gorm:"not null"`
+	CreatedAt      time.Time    `gorm:"autoCreateTime"`
+}
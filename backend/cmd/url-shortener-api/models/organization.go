@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Organization member roles, from least to most privileged.
+const (
+	OrgRoleViewer = "viewer"
+	OrgRoleEditor = "editor"
+	OrgRoleOwner  = "owner"
+)
+
+var orgRoleRanks = map[string]int{
+	OrgRoleViewer: 1,
+	OrgRoleEditor: 2,
+	OrgRoleOwner:  3,
+}
+
+// ValidOrgRole reports whether role is a known organization role.
+func ValidOrgRole(role string) bool {
+	_, ok := orgRoleRanks[role]
+	return ok
+}
+
+// OrgRoleAllows reports whether a member with role have may act as role want.
+func OrgRoleAllows(have, want string) bool {
+	return ValidOrgRole(have) && orgRoleRanks[have] >= orgRoleRanks[want]
+}
+
+type Organization struct {
+	ID        uint      `gorm:"primaryKey"`
+	Name      string    `gorm:"size:100;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+type Membership struct {
+	ID             uint         `gorm:"primaryKey"`
+	OrganizationID uint         `gorm:"not null;uniqueIndex:idx_memberships_org_user"`
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE"`
+	UserID         uint         `gorm:"not null;uniqueIndex:idx_memberships_org_user;index"`
+	User           User         `gorm:"constraint:OnDelete:CASCADE"`
+	Role           string       `gorm:"size:20;not null"` // owner, editor or viewer
+	CreatedAt      time.Time    `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// ClickRollup is the daily click count for one combination of dimensions,
+// kept after the raw click events it summarizes have been deleted.
+type ClickRollup struct {
+	ID           uint      `gorm:"primaryKey"`
+	UrlMappingID uint      `gorm:"index:idx_click_rollups_link_day;not null"`
+	Day          time.Time `gorm:"index:idx_click_rollups_link_day;not null"` // midnight UTC
+	ReferrerHost string    `gorm:"size:255"`
+	UTMSource    string    `gorm:"size:255"`
+	UTMMedium    string    `gorm:"size:255"`
+	UTMCampaign  string    `gorm:"size:255"`
+	Country      string    `gorm:"size:2"`
+	Region       string    `gorm:"size:100"`
+	Browser      string    `gorm:"size:100"`
+	OS           string    `gorm:"size:100"`
+	DeviceClass  string    `gorm:"size:20"`
+	IsBot        bool      `gorm:"default:false"`
+	Clicks       int64     `gorm:"not null"`
+}
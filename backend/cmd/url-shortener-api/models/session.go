@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login, identified to clients by its refresh token. Access
+// tokens name the session they belong to, so revoking it cuts them off too.
+type Session struct {
+	ID               uint       `gorm:"primaryKey"`
+	UserID           uint       `gorm:"index;not null"`
+	User             User       `gorm:"constraint:OnDelete:CASCADE"`
+	RefreshTokenHash string     `gorm:"size:64;uniqueIndex;not null"` // SHA-256 of the current refresh token
+	ExpiresAt        time.Time  `gorm:"type:timestamp;not null"`
+	RevokedAt        *time.Time `gorm:"type:timestamp"` // Nullable; set on logout
+	LastUsedAt       time.Time  `gorm:"type:timestamp"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// SheetsExport records a UTC day whose per-link click totals have been
+// appended to the Google Sheet, so each day is exported once.
+type SheetsExport struct {
+	ID        uint      `gorm:"primaryKey"`
+	Day       time.Time `gorm:"type:date;uniqueIndex;not null"` // UTC
+	Rows      int       `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
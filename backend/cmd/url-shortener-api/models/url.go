@@ -2,26 +2,52 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type UrlMapping struct {
-	ID                 uint       `gorm:"primaryKey"`
-	ShortCode          string     `gorm:"uniqueIndex;size:10"`
-	OriginalUrl        string     `gorm:"type:text;not null"`
-	CreatedAt          time.Time  `gorm:"autoCreateTime"`
-	IntendedLiveDate   *time.Time `gorm:"type:timestamp"` // Nullable field
-	IntendedExpiryDate *time.Time `gorm:"type:timestamp"` // Nullable field
-	LastCheckedAt      time.Time  `gorm:"type:timestamp"`
-	Status             string     `gorm:"size:20;default:'pending'"` // e.g., pending, live, inactive
-	CheckInterval      int        `gorm:"default:24"`                // in hours
+	ID                  uint              `gorm:"primaryKey"`
+	ShortCode           string            `gorm:"uniqueIndex;size:32"`
+	Domain              string            `gorm:"size:253;not null;default:''"` // LINK_DOMAINS or custom domain host the link is bound to; empty for the default hosts
+	OwnerID             *uint             `gorm:"index"`                        // Nullable; links created anonymously or by admins have no owner
+	Owner               *User             `gorm:"constraint:OnDelete:SET NULL"`
+	OrganizationID      *uint             `gorm:"index"` // Nullable; team that shares the link
+	Organization        *Organization     `gorm:"constraint:OnDelete:SET NULL"`
+	OriginalUrl         string            `gorm:"type:text;not null;serializer:encrypted"` // encrypted at rest when URL_ENCRYPTION_KEY is set
+	FinalUrl            string            `gorm:"type:text;serializer:encrypted"`          // where OriginalUrl's redirects end up when last checked
+	ContentType         string            `gorm:"size:100"`                                // media type FinalUrl served when last checked
+	DownloadType        string            `gorm:"size:10"`                                 // empty for web pages, else file or risky
+	CreatedAt           time.Time         `gorm:"autoCreateTime"`
+	IntendedLiveDate    *time.Time        `gorm:"type:timestamp"` // Nullable field
+	IntendedExpiryDate  *time.Time        `gorm:"type:timestamp"` // Nullable field
+	LastCheckedAt       time.Time         `gorm:"type:timestamp"`
+	Status              string            `gorm:"size:20;default:'pending'"` // e.g., pending, live, inactive, expired, rejected
+	CheckInterval       int               `gorm:"default:24"`                // in hours
+	ForwardQuery        *bool             // Nullable; falls back to the global default
+	InterstitialSeconds int               `gorm:"default:0"`                          // countdown before redirecting; 0 disables
+	LanguageTargets     map[string]string `gorm:"type:text;serializer:encryptedjson"` // language tag -> localized destination; encrypted at rest
+	ResponseHeaders     map[string]string `gorm:"type:text;serializer:json"`          // extra headers sent with the redirect
+	HideReferrer        bool              `gorm:"default:false"`                      // redirect through a no-referrer page
+	ProxyContent        bool              `gorm:"default:false"`                      // serve the destination's content instead of redirecting
+	TrackEngagement     bool              `gorm:"default:false"`                      // pass the click ID on for the engagement script
+	PrintCampaign       bool              `gorm:"default:false"`                      // printed/QR link; old browsers get a plain-HTML page
+	Tags                []string          `gorm:"type:text;serializer:json"`          // lowercase labels for organizing links
+	Managed             bool              `gorm:"default:false"`                      // provisioned through the declarative links API
+	DisabledByReports   bool              `gorm:"default:false"`                      // disabled automatically by abuse reports, pending triage
+	PendingValidation   bool              `gorm:"default:false"`                      // destination checks still queued; never redirects meanwhile
+	ExpiryNoticeSentAt  *time.Time        `gorm:"type:timestamp"`                     // Nullable; set once the owner was warned of the expiry date
+	ClickThreshold      int64             `gorm:"default:0"`                          // highest click threshold a webhook event was raised for
+	DeletedAt           gorm.DeletedAt    `gorm:"index"`                              // set while a deleted link can still be restored
 }
 
 type MaliciousLog struct {
-	ID        uint      `gorm:"primaryKey"`
-	URL       string    `gorm:"type:text;not null"`
-	UserAgent string    `gorm:"size:512"`
-	IPAddress string    `gorm:"size:45"`
-	RiskScore int       // Define a scoring system
-	Details   string    `gorm:"type:text"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
+	ID         uint       `gorm:"primaryKey"`
+	URL        string     `gorm:"type:text;not null;serializer:encrypted"` // encrypted at rest when URL_ENCRYPTION_KEY is set
+	UserAgent  string     `gorm:"size:512"`
+	IPAddress  string     `gorm:"size:45"`
+	RiskScore  int        `gorm:"index"` // 0-100, from the threat type
+	Details    string     `gorm:"type:text"`
+	DisabledAt *time.Time `gorm:"type:timestamp"` // Nullable; set when an admin takes the URL's links down
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
 }
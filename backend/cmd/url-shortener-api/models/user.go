@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// User roles, from least to most privileged.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleUser:  1,
+	RoleAdmin: 2,
+}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows reports whether a user with role have may act as role want.
+func RoleAllows(have, want string) bool {
+	return ValidRole(have) && roleRanks[have] >= roleRanks[want]
+}
+
+type User struct {
+	ID              uint       `gorm:"primaryKey"`
+	Email           string     `gorm:"uniqueIndex;size:255;not null"`           // stored lowercased
+	PasswordHash    string     `gorm:"type:text;not null;serializer:encrypted"` // bcrypt; encrypted at rest when URL_ENCRYPTION_KEY is set
+	Role            string     `gorm:"size:20;default:'user'"`                  // user or admin
+	NotifyExpiring  bool       `gorm:"default:true"`                            // email before and when owned links expire
+	NotifyDeadLinks bool       `gorm:"default:true"`                            // email when a re-check finds an owned link's destination dead
+	EmailVerifiedAt *time.Time `gorm:"type:timestamp"`                          // Nullable; set once an identity provider vouched for Email
+	CreatedAt       time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook delivery statuses. Deliveries stay pending while they have
+// attempts left.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription sends the events it names about a user's links to a
+// URL. Subscriptions without an owner, made with the admin token, get
+// events about every link.
+type WebhookSubscription struct {
+	ID        uint      `gorm:"primaryKey"`
+	OwnerID   *uint     `gorm:"index"` // Nullable; admin subscriptions cover all links
+	Owner     *User     `gorm:"constraint:OnDelete:CASCADE"`
+	URL       string    `gorm:"type:text;not null"`
+	Secret    string    `gorm:"type:text;not null;serializer:encrypted"` // signs deliveries; encrypted at rest when URL_ENCRYPTION_KEY is set
+	Events    []string  `gorm:"type:text;serializer:json"`
+	Fields    []string  `gorm:"type:text;serializer:json"` // payload fields sent; empty sends them all
+	Active    bool      `gorm:"default:true"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to a subscription.
+type WebhookDelivery struct {
+	ID             uint                `gorm:"primaryKey"`
+	SubscriptionID uint                `gorm:"index;not null"`
+	Subscription   WebhookSubscription `gorm:"constraint:OnDelete:CASCADE"`
+	Event          string              `gorm:"size:50;not null"`
+	Payload        string              `gorm:"type:text;not null;serializer:encrypted"` // the JSON body, signed as sent; holds the link's URL, so encrypted at rest
+	Status         string              `gorm:"size:10;not null;default:'pending';index:idx_webhook_deliveries_due"`
+	Attempts       int                 `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time           `gorm:"type:timestamp;index:idx_webhook_deliveries_due"`
+	LastStatusCode int                 // response status of the last attempt; 0 if there was none
+	LastError      string              `gorm:"type:text"`
+	DeliveredAt    *time.Time          `gorm:"type:timestamp"`
+	CreatedAt      time.Time           `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,117 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/mailer"
+)
+
+var settings struct {
+	slackWebhookURL string
+	emails          []string
+	spikeThreshold  int
+	spikeWindow     time.Duration
+}
+
+// detections remembers recent malicious detections to spot spikes.
+var detections struct {
+	mu          sync.Mutex
+	times       []time.Time
+	lastSpikeAt time.Time
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Configure sets where alerts go. With neither a Slack webhook nor alert
+// emails configured, alerts are only logged.
+func Configure(cfg config.Config) {
+	settings.slackWebhookURL = cfg.AlertSlackWebhookURL
+	settings.emails = cfg.AlertEmails
+	settings.spikeThreshold = cfg.AlertSpikeThreshold
+	settings.spikeWindow = cfg.AlertSpikeWindow
+}
+
+// MaliciousDetected alerts operators that a URL was flagged or rejected as
+// malicious. Once AlertSpikeThreshold detections land within
+// AlertSpikeWindow, a spike alert is sent too, at most once per window.
+func MaliciousDetected(url string, riskScore int, details string) {
+	Send(fmt.Sprintf("Malicious URL detected (risk %d)", riskScore), fmt.Sprintf("%s\n\n%s", url, details))
+
+	if count, spiking := recordDetection(time.Now()); spiking {
+		Send("Spike in malicious URL detections",
+			fmt.Sprintf("%d malicious URLs were detected in the last %s. Check the admin malicious log for details.", count, settings.spikeWindow))
+	}
+}
+
+// recordDetection adds a detection at now and reports whether it tips the
+// recent count over the spike threshold for the first time this window.
+func recordDetection(now time.Time) (int, bool) {
+	if settings.spikeThreshold <= 0 {
+		return 0, false
+	}
+
+	detections.mu.Lock()
+	defer detections.mu.Unlock()
+
+	cutoff := now.Add(-settings.spikeWindow)
+	recent := detections.times[:0]
+	for _, at := range detections.times {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	detections.times = append(recent, now)
+
+	if len(detections.times) < settings.spikeThreshold || detections.lastSpikeAt.After(cutoff) {
+		return len(detections.times), false
+	}
+	detections.lastSpikeAt = now
+	return len(detections.times), true
+}
+
+// Send delivers an alert to every configured channel in the background.
+// Delivery failures are logged rather than returned, since alerts are
+// raised from request paths that shouldn't wait on or fail because of them.
+func Send(subject, text string) {
+	log.Printf("Alert: %s: %s", subject, text)
+
+	if settings.slackWebhookURL != "" {
+		go func() {
+			if err := postSlack(subject, text); err != nil {
+				log.Println("Error sending Slack alert:", err)
+			}
+		}()
+	}
+	for _, to := range settings.emails {
+		go func(to string) {
+			if err := mailer.Send(to, subject, text); err != nil {
+				log.Printf("Error emailing alert to %s: %v", to, err)
+			}
+		}(to)
+	}
+}
+
+func postSlack(subject, text string) error {
+	payload, err := json.Marshal(map[string]string{"text": fmt.Sprintf("*%s*\n%s", subject, text)})
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(settings.slackWebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"url-shortener/mailer"
+)
+
+// Owner notices go to the email address of the user who owns a link. They
+// are sent synchronously, since they're raised from background jobs, and
+// callers pass an empty address for links without an owner or whose owner
+// turned the notice off.
+
+// LinkExpiring warns a link's owner that it will stop redirecting at
+// expiresAt. It reports whether the notice was sent.
+func LinkExpiring(shortCode, ownerEmail string, expiresAt time.Time) bool {
+	if ownerEmail == "" {
+		return false
+	}
+	body := fmt.Sprintf("Your short link %s will expire on %s and stop redirecting.\n\nSet a later expiry date on the link to keep it working.",
+		shortCode, formatNoticeTime(expiresAt))
+	return sendOwnerNotice(ownerEmail, fmt.Sprintf("Short link %s expires soon", shortCode), body, shortCode)
+}
+
+// LinkExpired tells a link's owner that it stopped redirecting because its
+// expiry date passed. Links without an owner are only logged.
+func LinkExpired(shortCode, ownerEmail string, expiredAt time.Time) {
+	log.Printf("Link %s expired at %s", shortCode, expiredAt.UTC().Format(time.RFC3339))
+	if ownerEmail == "" {
+		return
+	}
+	body := fmt.Sprintf("Your short link %s reached its expiry date on %s and no longer redirects.\n\nSet a later expiry date on the link to bring it back.",
+		shortCode, formatNoticeTime(expiredAt))
+	sendOwnerNotice(ownerEmail, fmt.Sprintf("Short link %s has expired", shortCode), body, shortCode)
+}
+
+// LinkDead tells a link's owner that a re-check couldn't reach its
+// destination, so it stopped redirecting until the destination recovers.
+func LinkDead(shortCode, ownerEmail, destination string) {
+	if ownerEmail == "" {
+		return
+	}
+	body := fmt.Sprintf("Your short link %s stopped redirecting because its destination could not be reached:\n\n%s\n\nIt will start redirecting again once a later check finds the destination working.",
+		shortCode, destination)
+	sendOwnerNotice(ownerEmail, fmt.Sprintf("Short link %s has a dead destination", shortCode), body, shortCode)
+}
+
+func sendOwnerNotice(to, subject, body, shortCode string) bool {
+	if err := mailer.Send(to, subject, body); err != nil {
+		log.Printf("Error emailing notice for link %s: %v", shortCode, err)
+		return false
+	}
+	return true
+}
+
+func formatNoticeTime(t time.Time) string {
+	return t.UTC().Format("2 January 2006 15:04 MST")
+}
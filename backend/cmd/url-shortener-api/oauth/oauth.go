@@ -0,0 +1,139 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"url-shortener/config"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+var ErrEmailNotVerified = errors.New("provider account has no verified email address")
+
+// Profile is what a provider tells us about the person who logged in.
+type Profile struct {
+	Subject       string // provider's stable user ID
+	Email         string
+	EmailVerified bool
+	Groups        []string // only filled in by OIDC providers
+}
+
+// Provider is a configured social login provider.
+type Provider struct {
+	Name         string
+	Config       oauth2.Config
+	GroupRoles   map[string]string // IdP group -> user role; empty leaves roles alone
+	fetchProfile func(ctx context.Context, token *oauth2.Token, client *http.Client) (Profile, error)
+}
+
+// Providers returns the social login providers that have client credentials
+// configured, keyed by name. Redirect URLs are filled in per request.
+func Providers(cfg config.Config) map[string]*Provider {
+	providers := make(map[string]*Provider)
+	if cfg.GoogleClientID != "" {
+		providers["google"] = &Provider{
+			Name: "google",
+			Config: oauth2.Config{
+				ClientID:     cfg.GoogleClientID,
+				ClientSecret: cfg.GoogleClientSecret,
+				Endpoint:     endpoints.Google,
+				Scopes:       []string{"openid", "email"},
+			},
+			fetchProfile: fetchGoogleProfile,
+		}
+	}
+	if cfg.GitHubClientID != "" {
+		providers["github"] = &Provider{
+			Name: "github",
+			Config: oauth2.Config{
+				ClientID:     cfg.GitHubClientID,
+				ClientSecret: cfg.GitHubClientSecret,
+				Endpoint:     endpoints.GitHub,
+				Scopes:       []string{"read:user", "user:email"},
+			},
+			fetchProfile: fetchGitHubProfile,
+		}
+	}
+	if cfg.OIDCDiscoveryURL != "" {
+		providers["oidc"] = newOIDCProvider(cfg)
+	}
+	return providers
+}
+
+// Exchange trades an authorization code for a token and fetches the profile
+// of the account it belongs to.
+func (p *Provider) Exchange(ctx context.Context, redirectURL, code string) (Profile, error) {
+	oauthConfig := p.Config
+	oauthConfig.RedirectURL = redirectURL
+
+	token, err := oauthConfig.Exchange(ctx, code)
+	if err != nil {
+		return Profile{}, fmt.Errorf("exchanging code: %w", err)
+	}
+	return p.fetchProfile(ctx, token, oauthConfig.Client(ctx, token))
+}
+
+func fetchGoogleProfile(ctx context.Context, _ *oauth2.Token, client *http.Client) (Profile, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := getJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", &info); err != nil {
+		return Profile{}, err
+	}
+	return Profile{Subject: info.Sub, Email: info.Email, EmailVerified: info.EmailVerified}, nil
+}
+
+func fetchGitHubProfile(ctx context.Context, _ *oauth2.Token, client *http.Client) (Profile, error) {
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
+		return Profile{}, err
+	}
+
+	// The profile email is optional and unverified, so use the primary one instead
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return Profile{}, err
+	}
+
+	profile := Profile{Subject: strconv.FormatInt(user.ID, 10)}
+	for _, email := range emails {
+		if email.Primary {
+			profile.Email = email.Email
+			profile.EmailVerified = email.Verified
+		}
+	}
+	return profile, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,107 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"url-shortener/config"
+	"url-shortener/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// newOIDCProvider discovers a generic OIDC provider such as Okta or Azure AD
+// from its discovery document. It exits if discovery fails, since a login
+// option that silently vanishes is worse than a server that won't start.
+func newOIDCProvider(cfg config.Config) *Provider {
+	issuer := strings.TrimSuffix(strings.TrimSuffix(cfg.OIDCDiscoveryURL, "/"), "/.well-known/openid-configuration")
+	discovered, err := oidc.NewProvider(context.Background(), issuer)
+	if err != nil {
+		log.Fatal("Failed to discover OIDC provider:", err)
+	}
+
+	for group, role := range cfg.OIDCGroupRoles {
+		if !models.ValidRole(role) {
+			log.Fatalf("OIDC_GROUP_ROLES maps %q to unknown role %q", group, role)
+		}
+	}
+
+	verifier := discovered.Verifier(&oidc.Config{ClientID: cfg.OIDCClientID})
+	groupsClaim := cfg.OIDCGroupsClaim
+	trustEmail := cfg.OIDCTrustEmail
+
+	return &Provider{
+		Name: "oidc",
+		Config: oauth2.Config{
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       cfg.OIDCScopes,
+		},
+		GroupRoles: cfg.OIDCGroupRoles,
+		fetchProfile: func(ctx context.Context, token *oauth2.Token, _ *http.Client) (Profile, error) {
+			return verifyIDToken(ctx, verifier, token, groupsClaim, trustEmail)
+		},
+	}
+}
+
+// verifyIDToken checks the ID token that came with token and reads the
+// profile from its claims.
+func verifyIDToken(ctx context.Context, verifier *oidc.IDTokenVerifier, token *oauth2.Token, groupsClaim string, trustEmail bool) (Profile, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Profile{}, errors.New("token response has no id_token")
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Profile{}, fmt.Errorf("verifying id_token: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Profile{}, fmt.Errorf("reading id_token claims: %w", err)
+	}
+
+	profile := Profile{Subject: idToken.Subject}
+	profile.Email, _ = claims["email"].(string)
+	if verified, ok := claims["email_verified"].(bool); ok {
+		profile.EmailVerified = verified
+	} else {
+		profile.EmailVerified = trustEmail
+	}
+
+	// Groups usually come as a list, but some IdPs send a lone group as a string
+	switch groups := claims[groupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				profile.Groups = append(profile.Groups, name)
+			}
+		}
+	case string:
+		profile.Groups = []string{groups}
+	}
+	return profile, nil
+}
+
+// RoleFor returns the most privileged role any of groups maps to, or the
+// plain user role if none do. It returns false if the provider doesn't map
+// groups to roles at all.
+func (p *Provider) RoleFor(groups []string) (string, bool) {
+	if len(p.GroupRoles) == 0 {
+		return "", false
+	}
+
+	role := models.RoleUser
+	for _, group := range groups {
+		if mapped, ok := p.GroupRoles[group]; ok && models.RoleAllows(mapped, role) {
+			role = mapped
+		}
+	}
+	return role, true
+}
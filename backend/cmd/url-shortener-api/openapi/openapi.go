@@ -0,0 +1,214 @@
+// Package openapi builds an OpenAPI 3 document from a table of operations.
+// Request and response schemas are derived from the Go types handlers
+// decode and encode, so they follow the code as it changes.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Auth says what credentials an operation takes.
+type Auth int
+
+const (
+	// Public operations take no credentials.
+	Public Auth = iota
+	// Optional operations work anonymously but act for the caller when
+	// given a token or API key.
+	Optional
+	// SignedIn operations need an access token or API key.
+	SignedIn
+	// Admin operations need an admin's access token or ADMIN_API_TOKEN.
+	Admin
+)
+
+// Param is a query parameter.
+type Param struct {
+	Name        string
+	Description string
+	Type        string // string (default), integer, number, boolean or date-time
+}
+
+// Operation documents one route.
+type Operation struct {
+	Method string
+	// Path is the route's template as registered with the router. Any
+	// pattern in a variable, as in {id:[0-9]+}, is left out of the document.
+	Path        string
+	Tag         string
+	Summary     string
+	Description string
+	Auth        Auth
+	Query       []Param
+	// Request and Response are values of the types decoded from and encoded
+	// to JSON bodies; nil means there is none.
+	Request  interface{}
+	Response interface{}
+	// Status is the success status, 200 when zero.
+	Status int
+	// ContentType is the success response's type when it isn't JSON.
+	ContentType string
+}
+
+// Document is a built OpenAPI document.
+type Document struct {
+	body       []byte
+	operations map[string]bool // "METHOD /path"
+}
+
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// New builds the document for operations.
+func New(title, version, description string, operations []Operation) (*Document, error) {
+	schemas := newSchemaSet()
+	paths := make(map[string]map[string]interface{})
+	documented := make(map[string]bool, len(operations))
+
+	for _, op := range operations {
+		path := pathVariable.ReplaceAllString(op.Path, "{$1}")
+		documented[op.Method+" "+path] = true
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(op.Method)] = op.build(schemas)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       title,
+			"version":     version,
+			"description": description,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An access token from /api/login, an API key, or ADMIN_API_TOKEN.",
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{body: body, operations: documented}, nil
+}
+
+// Documents reports whether the document covers method on the route with
+// template path.
+func (d *Document) Documents(method, path string) bool {
+	return d.operations[method+" "+pathVariable.ReplaceAllString(path, "{$1}")]
+}
+
+// ServeHTTP serves the document as JSON.
+func (d *Document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(d.body)
+}
+
+func (op Operation) build(schemas *schemaSet) map[string]interface{} {
+	operation := map[string]interface{}{
+		"summary":   op.Summary,
+		"responses": op.responses(schemas),
+	}
+	if op.Tag != "" {
+		operation["tags"] = []string{op.Tag}
+	}
+	if op.Description != "" {
+		operation["description"] = op.Description
+	}
+
+	switch op.Auth {
+	case Optional:
+		operation["security"] = []interface{}{map[string]interface{}{}, map[string]interface{}{"bearer": []string{}}}
+	case SignedIn, Admin:
+		operation["security"] = []interface{}{map[string]interface{}{"bearer": []string{}}}
+	}
+
+	var parameters []interface{}
+	for _, match := range pathVariable.FindAllStringSubmatch(op.Path, -1) {
+		schema := map[string]interface{}{"type": "string"}
+		if match[2] == ":[0-9]+" {
+			schema = map[string]interface{}{"type": "integer"}
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": schema,
+		})
+	}
+	for _, param := range op.Query {
+		parameter := map[string]interface{}{"name": param.Name, "in": "query", "schema": paramSchema(param.Type)}
+		if param.Description != "" {
+			parameter["description"] = param.Description
+		}
+		parameters = append(parameters, parameter)
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if op.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.of(op.Request)},
+			},
+		}
+	}
+	return operation
+}
+
+func (op Operation) responses(schemas *schemaSet) map[string]interface{} {
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.ContentType != "":
+		success["content"] = map[string]interface{}{op.ContentType: map[string]interface{}{}}
+	case op.Response != nil:
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemas.of(op.Response)},
+		}
+	}
+
+	responses := map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default": map[string]interface{}{
+			"description": "An error, usually with a JSON message",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"message": map[string]interface{}{"type": "string"}},
+				}},
+			},
+		},
+	}
+	if op.Auth == SignedIn || op.Auth == Admin {
+		responses["401"] = map[string]interface{}{"description": "Missing or invalid credentials"}
+	}
+	if op.Auth == Admin {
+		responses["403"] = map[string]interface{}{"description": "Not an admin"}
+	}
+	return responses
+}
+
+func paramSchema(kind string) map[string]interface{} {
+	switch kind {
+	case "", "string":
+		return map[string]interface{}{"type": "string"}
+	case "date-time":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	default:
+		return map[string]interface{}{"type": kind}
+	}
+}
@@ -0,0 +1,125 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaSet turns Go types into JSON schemas the way encoding/json would
+// encode them. Named structs become components, referenced by name.
+type schemaSet struct {
+	components map[string]interface{}
+	names      map[reflect.Type]string
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{
+		components: make(map[string]interface{}),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// of returns the schema of value's type.
+func (s *schemaSet) of(value interface{}) map[string]interface{} {
+	return s.schema(reflect.TypeOf(value))
+}
+
+func (s *schemaSet) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		// Any JSON value
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			// Siblings of $ref are ignored in OpenAPI 3.0
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, seen := s.names[t]
+		if !seen {
+			name = s.componentName(t)
+			s.names[t] = name
+			s.components[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// componentName names t's component after the type, qualified by its
+// package if another package's type took the name first.
+func (s *schemaSet) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := s.components[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
+
+// object returns the schema of a struct's JSON fields. Fields of embedded
+// structs without a JSON name are promoted, as encoding/json does.
+func (s *schemaSet) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	s.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s *schemaSet) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.addFields(field.Type, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+	}
+}
@@ -0,0 +1,159 @@
+// Package pdf writes plain text documents as PDF, which is all the reports
+// need: one column of Helvetica on A4 pages, broken onto a new page when
+// one fills up. Characters outside printable ASCII are written as "?".
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points, and the margin kept on every side.
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 56.0
+)
+
+// ContentWidth is the width text can take, for laying out rows.
+const ContentWidth = pageWidth - 2*margin
+
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// Document is a PDF being written. The zero value is not usable; use New.
+type Document struct {
+	pages []*bytes.Buffer
+	y     float64 // baseline of the last line on the current page
+}
+
+// New starts a document with one empty page.
+func New() *Document {
+	d := &Document{}
+	d.newPage()
+	return d
+}
+
+// Heading writes a large bold line.
+func (d *Document) Heading(text string) {
+	d.line(fontBold, 18, 8, margin, text, ContentWidth)
+}
+
+// Subheading writes a bold line with room above it for a new section.
+func (d *Document) Subheading(text string) {
+	d.line(fontBold, 12, 14, margin, text, ContentWidth)
+}
+
+// Text writes a line of body text, cut short to fit the page.
+func (d *Document) Text(text string) {
+	d.line(fontRegular, 10, 4, margin, text, ContentWidth)
+}
+
+// Row writes a line of cells, each starting where the previous one's width
+// ends and cut short to fit it. The first row of a table is usually bold.
+func (d *Document) Row(bold bool, widths []float64, cells ...string) {
+	font := fontRegular
+	if bold {
+		font = fontBold
+	}
+	d.advance(10, 4)
+	x := margin
+	for i, cell := range cells {
+		if i >= len(widths) {
+			break
+		}
+		d.show(font, 10, x, cell, widths[i]-6)
+		x += widths[i]
+	}
+}
+
+// Bytes returns the finished document.
+func (d *Document) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// Objects 1-4 are the catalog, page tree and fonts; each page then
+	// takes two, itself and its content stream
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+// advance moves down a line of size points after gap points of spacing,
+// starting a new page when the line wouldn't fit.
+func (d *Document) advance(size, gap float64) {
+	d.y -= size + gap
+	if d.y < margin {
+		d.newPage()
+		d.y -= size
+	}
+}
+
+func (d *Document) line(font string, size, gap, x float64, text string, width float64) {
+	d.advance(size, gap)
+	d.show(font, size, x, text, width)
+}
+
+func (d *Document) show(font string, size, x float64, text string, width float64) {
+	page := d.pages[len(d.pages)-1]
+	fmt.Fprintf(page, "BT /%s %g Tf %g %g Td (%s) Tj ET\n", font, size, x, d.y, escape(fit(text, size, width)))
+}
+
+// fit cuts text to about width points, going by Helvetica's average
+// character width, which is close enough for report text.
+func fit(text string, size, width float64) string {
+	limit := int(width / (size * 0.5))
+	runes := []rune(text)
+	if len(runes) <= limit || limit < 4 {
+		return text
+	}
+	return string(runes[:limit-3]) + "..."
+}
+
+// escape writes text as the body of a PDF string literal.
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > '~':
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"url-shortener/chaos"
+	"url-shortener/config"
+	"url-shortener/utils"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrUpstreamStatus        = errors.New("upstream returned a non-200 status")
+	ErrContentTypeNotAllowed = errors.New("content type is not allowed for proxying")
+	ErrContentTooLarge       = errors.New("content exceeds the proxy size limit")
+)
+
+// maxCachedEntries bounds the number of proxied bodies kept in memory, on
+// top of ProxyCacheMaxBytes bounding their total size.
+const maxCachedEntries = 100
+
+// client refuses internal addresses, since destinations are user-supplied
+var client = &http.Client{Timeout: 15 * time.Second, Transport: utils.OutboundTransport}
+
+type cachedContent struct {
+	body               []byte
+	contentType        string
+	contentDisposition string
+	expiresAt          time.Time
+}
+
+var (
+	cacheMu    sync.Mutex
+	cache      = make(map[string]cachedContent)
+	cacheBytes int64 // total size of the cached bodies
+
+	// fetches collapses concurrent fetches of the same destination into one
+	fetches singleflight.Group
+)
+
+// ServeContent fetches destination and writes it to w instead of redirecting.
+// Nothing is written to w when an error is returned, so callers can fall back
+// to a normal redirect. Requests for a destination that's already being
+// fetched share that fetch, and its failure if the request that started it
+// goes away.
+func ServeContent(ctx context.Context, w http.ResponseWriter, destination string, cfg *config.Config) error {
+	content, ok := getCached(destination)
+	if !ok {
+		fetched, err, _ := fetches.Do(destination, func() (interface{}, error) {
+			content, err := fetch(ctx, destination, cfg)
+			if err == nil {
+				putCached(destination, content, cfg.ProxyCacheMaxBytes)
+			}
+			return content, err
+		})
+		if err != nil {
+			return err
+		}
+		content = fetched.(cachedContent)
+	}
+
+	w.Header().Set("Content-Type", content.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content.body)))
+	if content.contentDisposition != "" {
+		w.Header().Set("Content-Disposition", content.contentDisposition)
+	}
+	// Proxied content is served from our origin, so keep it inert
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cfg.ProxyCacheTTL.Seconds())))
+	w.Write(content.body)
+	return nil
+}
+
+func fetch(ctx context.Context, destination string, cfg *config.Config) (cachedContent, error) {
+	if err := chaos.Inject(chaos.TargetOutbound); err != nil {
+		return cachedContent{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, destination, nil)
+	if err != nil {
+		return cachedContent{}, fmt.Errorf("failed to fetch proxied content: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return cachedContent{}, fmt.Errorf("failed to fetch proxied content: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return cachedContent{}, fmt.Errorf("%w: %d", ErrUpstreamStatus, resp.StatusCode)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !isAllowedType(mediaType, cfg.ProxyAllowedTypes) {
+		return cachedContent{}, fmt.Errorf("%w: %q", ErrContentTypeNotAllowed, resp.Header.Get("Content-Type"))
+	}
+
+	if resp.ContentLength > cfg.ProxyMaxBytes {
+		return cachedContent{}, ErrContentTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cfg.ProxyMaxBytes+1))
+	if err != nil {
+		return cachedContent{}, fmt.Errorf("failed to read proxied content: %w", err)
+	}
+	if int64(len(body)) > cfg.ProxyMaxBytes {
+		return cachedContent{}, ErrContentTooLarge
+	}
+
+	return cachedContent{
+		body:               body,
+		contentType:        resp.Header.Get("Content-Type"),
+		contentDisposition: resp.Header.Get("Content-Disposition"),
+		expiresAt:          time.Now().Add(cfg.ProxyCacheTTL),
+	}, nil
+}
+
+func isAllowedType(mediaType string, allowed []string) bool {
+	for _, t := range allowed {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func getCached(destination string) (cachedContent, bool) {
+	if err := chaos.Inject(chaos.TargetCache); err != nil {
+		return cachedContent{}, false
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	content, ok := cache[destination]
+	if !ok {
+		return cachedContent{}, false
+	}
+	if time.Now().After(content.expiresAt) {
+		delete(cache, destination)
+		cacheBytes -= int64(len(content.body))
+		return cachedContent{}, false
+	}
+	return content, true
+}
+
+// putCached keeps content for its TTL, evicting expired entries and then
+// those closest to expiry to stay within the entry and maxBytes limits.
+// Content larger than maxBytes on its own isn't kept.
+func putCached(destination string, content cachedContent, maxBytes int64) {
+	size := int64(len(content.body))
+	if !content.expiresAt.After(time.Now()) || size > maxBytes {
+		return
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if old, ok := cache[destination]; ok {
+		delete(cache, destination)
+		cacheBytes -= int64(len(old.body))
+	}
+	if len(cache) >= maxCachedEntries || cacheBytes+size > maxBytes {
+		now := time.Now()
+		for key, entry := range cache {
+			if now.After(entry.expiresAt) {
+				delete(cache, key)
+				cacheBytes -= int64(len(entry.body))
+			}
+		}
+	}
+	for len(cache) >= maxCachedEntries || cacheBytes+size > maxBytes {
+		var soonest string
+		for key, entry := range cache {
+			if soonest == "" || entry.expiresAt.Before(cache[soonest].expiresAt) {
+				soonest = key
+			}
+		}
+		cacheBytes -= int64(len(cache[soonest].body))
+		delete(cache, soonest)
+	}
+	cache[destination] = content
+	cacheBytes += size
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/utils"
+)
+
+// resetCache empties the cache for the rest of the test.
+func resetCache(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		cacheMu.Lock()
+		defer cacheMu.Unlock()
+		cache = make(map[string]cachedContent)
+		cacheBytes = 0
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestPutCached(t *testing.T) {
+	resetCache(t)
+	now := time.Now()
+	entry := func(size int, ttl time.Duration) cachedContent {
+		return cachedContent{body: make([]byte, size), expiresAt: now.Add(ttl)}
+	}
+
+	putCached("a", entry(40, time.Hour), 100)
+	putCached("b", entry(40, 2*time.Hour), 100)
+	putCached("too big", entry(101, time.Hour), 100)
+	putCached("expired", entry(1, -time.Minute), 100)
+	putCached("c", entry(40, 3*time.Hour), 100) // evicts a, the soonest to expire
+	putCached("b", entry(10, 2*time.Hour), 100) // replaces b
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	var keys []string
+	for key := range cache {
+		keys = append(keys, key)
+	}
+	if len(cache) != 2 || cache["b"].body == nil || cache["c"].body == nil {
+		t.Errorf("cached %v, want b and c", keys)
+	}
+	if cacheBytes != 50 {
+		t.Errorf("cached %d bytes, want 50", cacheBytes)
+	}
+}
+
+func TestServeContentSharesFetches(t *testing.T) {
+	resetCache(t)
+	if err := utils.SetOutboundNetworks(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var fetched atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		ProxyMaxBytes:      1 << 10,
+		ProxyAllowedTypes:  []string{"text/plain"},
+		ProxyCacheTTL:      time.Minute,
+		ProxyCacheMaxBytes: 1 << 20,
+	}
+	const visitors = 5
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, visitors)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			if err := ServeContent(context.Background(), w, upstream.URL, &cfg); err != nil {
+				t.Errorf("ServeContent() error = %v", err)
+			}
+		}(recorders[i])
+	}
+	// Let the visitors pile up on the first fetch before it completes
+	for fetched.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := fetched.Load(); n != 1 {
+		t.Errorf("destination fetched %d times, want once", n)
+	}
+	for i, w := range recorders {
+		if body := w.Body.String(); body != "hello" {
+			t.Errorf("visitor %d got %q", i, body)
+		}
+	}
+
+	// A canceled request doesn't fetch at all
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ServeContent(ctx, httptest.NewRecorder(), upstream.URL+"/other", &cfg)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("ServeContent() with a canceled context error = %v", err)
+	}
+}
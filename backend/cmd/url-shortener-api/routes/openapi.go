@@ -0,0 +1,314 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"url-shortener/analytics"
+	"url-shortener/controllers"
+	"url-shortener/middlewares"
+	"url-shortener/openapi"
+	"url-shortener/version"
+
+	"github.com/gorilla/mux"
+)
+
+// Query parameters shared by several operations.
+var (
+	pageParams = []openapi.Param{
+		{Name: "limit", Type: "integer", Description: "Page size, up to 200"},
+		{Name: "cursor", Description: "The X-Next-Cursor header of the previous page"},
+	}
+	rangeParams = []openapi.Param{
+		{Name: "from", Description: "Start of the range, RFC 3339 or YYYY-MM-DD"},
+		{Name: "to", Description: "End of the range, exclusive, RFC 3339 or YYYY-MM-DD"},
+	}
+	botsParam = openapi.Param{Name: "include_bots", Type: "boolean", Description: "Count clicks from bots too"}
+)
+
+// operations documents every route SetupRoutes can register, including
+// those that depend on configuration.
+var operations = []openapi.Operation{
+	// Probes
+	{Method: "GET", Path: "/healthz", Tag: "probes", Summary: "Liveness probe"},
+	{Method: "GET", Path: "/readyz", Tag: "probes", Summary: "Readiness probe, checking the database, replica, Redis and migrations",
+		Response: controllers.ReadinessResponse{}},
+	{Method: "GET", Path: "/metrics", Tag: "probes", Summary: "Prometheus metrics",
+		Description: "Needs METRICS_TOKEN as a bearer token when one is configured.", ContentType: "text/plain"},
+	{Method: "GET", Path: "/version", Tag: "probes", Summary: "Version of the running build", Response: version.Info{}},
+	{Method: "GET", Path: "/openapi.json", Tag: "probes", Summary: "This document", ContentType: "application/json"},
+	{Method: "GET", Path: "/docs", Tag: "probes", Summary: "Swagger UI for this document, when OPENAPI_DOCS_UI is on", ContentType: "text/html"},
+
+	// Public
+	{Method: "POST", Path: "/shorten", Tag: "links", Summary: "Shorten a URL", Auth: openapi.Optional,
+		Description: "Anonymous callers may need a captcha token in the " + middlewares.CaptchaHeader + " header.",
+		Request:     controllers.ShortenURLRequest{}, Response: controllers.ShortenURLResponse{}},
+	{Method: "POST", Path: "/v4/shorten", Tag: "links", Summary: "Shorten a URL, in the shape of Bitly's API", Auth: openapi.Optional,
+		Description: "For tools written for Bitly; pass an API key as the bearer token. domain may be one of the link domains; group_guid is ignored.",
+		Request:     controllers.BitlyShortenRequest{}, Response: controllers.BitlyLinkResponse{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/integrations/slack", Tag: "links", Summary: "Slack /shorten slash command, when SLACK_SIGNING_SECRET is set",
+		Description: "Takes Slack's form-encoded command, signed with the app's signing secret in X-Slack-Signature.",
+		Response:    controllers.SlackMessage{}},
+	{Method: "GET", Path: "/analytics.js", Tag: "analytics", Summary: "Engagement tracking script", ContentType: "application/javascript"},
+	{Method: "POST", Path: "/collect", Tag: "analytics", Summary: "Record engagement with a destination page",
+		Request: controllers.CollectRequest{}, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/px/{shortCode}.gif", Tag: "analytics", Summary: "Conversion tracking pixel",
+		Query: []openapi.Param{{Name: analytics.ClickIDParam, Description: "Click ID passed to the destination"}}, ContentType: "image/gif"},
+	{Method: "POST", Path: "/report/{shortCode}", Tag: "links", Summary: "Report a link as abusive",
+		Description: "Anonymous callers may need a captcha token in the " + middlewares.CaptchaHeader + " header.",
+		Request:     controllers.ReportLinkRequest{}, Status: http.StatusAccepted, Response: controllers.ErrorResponse{}},
+	{Method: "GET", Path: "/{shortCode}", Tag: "links", Summary: "Redirect to a link's destination",
+		Query:  []openapi.Param{{Name: "preview", Description: "Preview token for a link that isn't live yet"}},
+		Status: http.StatusFound},
+
+	// Accounts, when JWT_SECRET is set
+	{Method: "POST", Path: "/api/register", Tag: "accounts", Summary: "Create an account",
+		Request: controllers.CredentialsRequest{}, Response: controllers.UserResponse{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/api/login", Tag: "accounts", Summary: "Sign in with an email and password",
+		Request: controllers.CredentialsRequest{}, Response: controllers.TokenResponse{}},
+	{Method: "POST", Path: "/api/token/refresh", Tag: "accounts", Summary: "Exchange a refresh token for new tokens",
+		Request: controllers.RefreshRequest{}, Response: controllers.TokenResponse{}},
+	{Method: "POST", Path: "/api/logout", Tag: "accounts", Summary: "End the session of the access token used", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/logout/all", Tag: "accounts", Summary: "End every session", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/me", Tag: "accounts", Summary: "The signed-in user", Auth: openapi.SignedIn,
+		Response: controllers.UserResponse{}},
+	{Method: "GET", Path: "/api/me/notifications", Tag: "accounts", Summary: "Email notification preferences", Auth: openapi.SignedIn,
+		Response: controllers.NotificationPreferences{}},
+	{Method: "PUT", Path: "/api/me/notifications", Tag: "accounts", Summary: "Change email notification preferences", Auth: openapi.SignedIn,
+		Request: controllers.UpdateNotificationPreferencesRequest{}, Response: controllers.NotificationPreferences{}},
+	{Method: "POST", Path: "/api/me/deletion", Tag: "accounts", Summary: "Ask to delete your account; a confirmation token is emailed", Auth: openapi.SignedIn,
+		Request: controllers.DeleteAccountRequest{}, Response: controllers.AccountDeletionResponse{}, Status: http.StatusAccepted},
+	{Method: "POST", Path: "/api/me/deletion/confirm", Tag: "accounts", Summary: "Confirm deleting your account; it is deleted in the background", Auth: openapi.SignedIn,
+		Request: controllers.ConfirmAccountDeletionRequest{}, Response: controllers.AccountDeletionResponse{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/auth/{provider}/login", Tag: "accounts", Summary: "Start signing in with google, github or oidc",
+		Status: http.StatusFound},
+	{Method: "GET", Path: "/api/auth/{provider}/callback", Tag: "accounts", Summary: "Finish signing in with a provider",
+		Response: controllers.TokenResponse{}},
+	{Method: "POST", Path: "/api/keys", Tag: "api keys", Summary: "Create an API key; the key is only shown once", Auth: openapi.SignedIn,
+		Request: controllers.CreateAPIKeyRequest{}, Response: controllers.APIKeyResponse{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/api/keys", Tag: "api keys", Summary: "List your API keys", Auth: openapi.SignedIn,
+		Response: []controllers.APIKeyResponse{}},
+	{Method: "DELETE", Path: "/api/keys/{id:[0-9]+}", Tag: "api keys", Summary: "Revoke an API key", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/keys/{id:[0-9]+}/usage", Tag: "api keys", Summary: "Usage of an API key against its quotas", Auth: openapi.SignedIn,
+		Response: controllers.APIKeyUsageResponse{}},
+	{Method: "POST", Path: "/api/orgs", Tag: "organizations", Summary: "Create an organization", Auth: openapi.SignedIn,
+		Request: controllers.CreateOrganizationRequest{}, Response: controllers.OrganizationResponse{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/api/orgs", Tag: "organizations", Summary: "List your organizations", Auth: openapi.SignedIn,
+		Response: []controllers.OrganizationResponse{}},
+	{Method: "GET", Path: "/api/orgs/{orgID:[0-9]+}/members", Tag: "organizations", Summary: "List an organization's members", Auth: openapi.SignedIn,
+		Response: []controllers.MemberResponse{}},
+	{Method: "POST", Path: "/api/orgs/{orgID:[0-9]+}/members", Tag: "organizations", Summary: "Add a member", Auth: openapi.SignedIn,
+		Request: controllers.AddMemberRequest{}, Response: controllers.MemberResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/api/orgs/{orgID:[0-9]+}/members/{userID:[0-9]+}", Tag: "organizations", Summary: "Change a member's role", Auth: openapi.SignedIn,
+		Request: controllers.SetRoleRequest{}, Response: controllers.MemberResponse{}},
+	{Method: "DELETE", Path: "/api/orgs/{orgID:[0-9]+}/members/{userID:[0-9]+}", Tag: "organizations", Summary: "Remove a member", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/orgs/{orgID:[0-9]+}/invites", Tag: "organizations", Summary: "List pending invites", Auth: openapi.SignedIn,
+		Response: []controllers.InviteResponse{}},
+	{Method: "POST", Path: "/api/orgs/{orgID:[0-9]+}/invites", Tag: "organizations", Summary: "Invite someone by email", Auth: openapi.SignedIn,
+		Request: controllers.CreateInviteRequest{}, Response: controllers.InviteResponse{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/api/orgs/{orgID:[0-9]+}/invites/{inviteID:[0-9]+}", Tag: "organizations", Summary: "Revoke an invite", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/orgs/{orgID:[0-9]+}/reports", Tag: "organizations", Summary: "List monthly usage reports", Auth: openapi.SignedIn,
+		Response: []controllers.OrgReportResponse{}},
+	{Method: "GET", Path: "/api/orgs/{orgID:[0-9]+}/reports/{month}", Tag: "organizations", Summary: "Download a monthly usage report as a PDF", Auth: openapi.SignedIn,
+		ContentType: "application/pdf"},
+	{Method: "GET", Path: "/api/invites/{token}", Tag: "organizations", Summary: "What an invite is for",
+		Response: controllers.InviteDetailsResponse{}},
+	{Method: "POST", Path: "/api/invites/{token}/accept", Tag: "organizations", Summary: "Accept an invite", Auth: openapi.SignedIn,
+		Response: controllers.OrganizationResponse{}},
+
+	// Custom domains
+	{Method: "POST", Path: "/api/domains", Tag: "domains", Summary: "Claim a domain for your links, when CUSTOM_DOMAINS_PER_USER is above zero", Auth: openapi.SignedIn,
+		Description: "Put txt_record_value in a TXT record named txt_record_name and point the domain at this service. " +
+			"A background job checks the record; once verified, links can be made on the domain by setting their domain.",
+		Request: controllers.CustomDomainRequest{}, Response: controllers.CustomDomainResponse{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/api/domains", Tag: "domains", Summary: "List your domains, or everyone's for admins", Auth: openapi.SignedIn,
+		Response: []controllers.CustomDomainResponse{}},
+	{Method: "GET", Path: "/api/domains/{id:[0-9]+}", Tag: "domains", Summary: "A domain and how its verification is going", Auth: openapi.SignedIn,
+		Response: controllers.CustomDomainResponse{}},
+	{Method: "DELETE", Path: "/api/domains/{id:[0-9]+}", Tag: "domains", Summary: "Remove a domain; verified ones must have no links left", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	// Links
+	{Method: "GET", Path: "/api/links", Tag: "links", Summary: "List your links, or every link for admins", Auth: openapi.SignedIn,
+		Query: pageParams, Response: []controllers.LinkResource{}},
+	{Method: "POST", Path: "/api/links/reconcile", Tag: "links", Summary: "Make links match a declared set", Auth: openapi.Admin,
+		Request: controllers.ReconcileRequest{}, Response: controllers.ReconcileResponse{}},
+	{Method: "POST", Path: "/api/links/import", Tag: "links", Summary: "Import links from a CSV or JSON file", Auth: openapi.SignedIn,
+		Description: "The file is the body or the file field of a multipart form. CSV files need a header row with a url column " +
+			"and may have custom_alias, expiry and tags columns; JSON files hold an array of objects with the same keys. " +
+			"Links are created in the background; poll the import at the Location header. Each row uses up one call of an API key's " +
+			"quota, and files with more rows than are left are refused.",
+		Query:    []openapi.Param{{Name: "format", Description: "csv or json, when the content type or file name doesn't say"}},
+		Response: controllers.LinkImportResponse{}, Status: http.StatusAccepted},
+	{Method: "GET", Path: "/api/links/export", Tag: "links", Summary: "Download all your links, or every link for admins", Auth: openapi.SignedIn,
+		Description: "Streams CSV, or with format=ndjson one link per line, newest first.",
+		Query: []openapi.Param{
+			{Name: "format", Description: "csv, the default, or ndjson"},
+			{Name: "stats", Type: "boolean", Description: "Add each link's all-time human and bot clicks"},
+		},
+		ContentType: "text/csv"},
+	{Method: "GET", Path: "/api/quick", Tag: "links", Summary: "Shorten a URL from a bookmarklet or shell", Auth: openapi.SignedIn,
+		Description: "Answers with the short URL as plain text, or a small HTML page for browsers. An API key may be passed as ?key= " +
+			"where headers can't be set.",
+		Query: []openapi.Param{
+			{Name: "url", Description: "The URL to shorten"},
+			{Name: "alias", Description: "Custom short code"},
+			{Name: "format", Description: "text or html; defaults to html when the Accept header asks for it"},
+			{Name: "key", Description: "API key, for clients that can't send an Authorization header"},
+		},
+		ContentType: "text/plain"},
+	{Method: "GET", Path: "/api/expand", Tag: "links", Summary: "Follow a URL's redirects and judge where they lead", Auth: openapi.SignedIn,
+		Description: "Works for any URL, including other services' short links. Redirects to internal addresses aren't followed.",
+		Query:       []openapi.Param{{Name: "url", Description: "The URL to expand"}},
+		Response:    controllers.ExpandResponse{}},
+	{Method: "GET", Path: "/api/users/{id:[0-9]+}/links.atom", Tag: "links", Summary: "Atom feed of a user's newest links", Auth: openapi.SignedIn,
+		Description: "Users may only read their own feed. An API key may be passed as ?key= for feed readers.",
+		Query:       []openapi.Param{{Name: "key", Description: "API key, for clients that can't send an Authorization header"}},
+		ContentType: "application/atom+xml"},
+	{Method: "GET", Path: "/api/links/import/{id:[0-9]+}", Tag: "links", Summary: "An import's progress and failed rows", Auth: openapi.SignedIn,
+		Response: controllers.LinkImportResponse{}},
+	{Method: "GET", Path: "/api/links/{shortCode}", Tag: "links", Summary: "Get a link", Auth: openapi.SignedIn, Response: controllers.LinkResource{}},
+	{Method: "PUT", Path: "/api/links/{shortCode}", Tag: "links", Summary: "Create or replace a link with this short code", Auth: openapi.SignedIn,
+		Description: "Answers 201 when the link is created.",
+		Request:     controllers.ShortenURLRequest{}, Response: controllers.LinkResource{}},
+	{Method: "DELETE", Path: "/api/links/{shortCode}", Tag: "links", Summary: "Delete a link", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/links/{shortCode}/preview", Tag: "links", Summary: "Issue a preview link for a link waiting for its live date", Auth: openapi.SignedIn,
+		Response: controllers.PreviewTokenResponse{}},
+
+	// Webhooks
+	{Method: "POST", Path: "/api/webhooks", Tag: "webhooks", Summary: "Subscribe a URL to link events; the secret is only shown once", Auth: openapi.SignedIn,
+		Description: "Events are link.created, link.expired, link.flagged and link.click_threshold. Deliveries are POSTed " +
+			"with an X-Webhook-Signature of sha256= and the hex HMAC-SHA256 of X-Webhook-Timestamp, a dot and the body.",
+		Request: controllers.CreateWebhookRequest{}, Response: controllers.WebhookResponse{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/api/webhooks", Tag: "webhooks", Summary: "List your webhook subscriptions, or all of them for admins", Auth: openapi.SignedIn,
+		Response: []controllers.WebhookResponse{}},
+	{Method: "PUT", Path: "/api/webhooks/{id:[0-9]+}", Tag: "webhooks", Summary: "Change a subscription's events or turn it on or off", Auth: openapi.SignedIn,
+		Request: controllers.UpdateWebhookRequest{}, Response: controllers.WebhookResponse{}},
+	{Method: "DELETE", Path: "/api/webhooks/{id:[0-9]+}", Tag: "webhooks", Summary: "Delete a subscription and its delivery log", Auth: openapi.SignedIn,
+		Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/webhooks/{id:[0-9]+}/deliveries", Tag: "webhooks", Summary: "A subscription's delivery log, newest first", Auth: openapi.SignedIn,
+		Query:    append([]openapi.Param{{Name: "status", Description: "pending, succeeded or failed"}}, pageParams...),
+		Response: []controllers.WebhookDeliveryResponse{}},
+
+	// Analytics
+	{Method: "GET", Path: "/api/stats/summary", Tag: "analytics", Summary: "Dashboard totals, top links and recent links", Auth: openapi.SignedIn,
+		Description: "Covers the links you can list, or every link for admins.",
+		Query:       []openapi.Param{botsParam}, Response: controllers.SummaryResponse{}},
+	{Method: "GET", Path: "/api/links/{shortCode}/stats/referrers", Tag: "analytics", Summary: "Clicks by referrer", Auth: openapi.SignedIn,
+		Query: []openapi.Param{botsParam}, Response: []controllers.ReferrerStat{}},
+	{Method: "GET", Path: "/api/links/{shortCode}/stats/utm", Tag: "analytics", Summary: "Clicks by UTM parameters", Auth: openapi.SignedIn,
+		Query: []openapi.Param{botsParam}, Response: []controllers.UTMStat{}},
+	{Method: "GET", Path: "/api/links/{shortCode}/stats/devices", Tag: "analytics", Summary: "Clicks by browser, OS and device class", Auth: openapi.SignedIn,
+		Query: []openapi.Param{botsParam}, Response: controllers.DeviceStats{}},
+	{Method: "GET", Path: "/api/links/{shortCode}/stats/timeseries", Tag: "analytics", Summary: "Clicks over time", Auth: openapi.SignedIn,
+		Query:    append([]openapi.Param{{Name: "interval", Description: "hour, day (default) or week"}, botsParam}, rangeParams...),
+		Response: controllers.TimeSeriesResponse{}},
+	{Method: "GET", Path: "/api/links/{shortCode}/stats/conversions", Tag: "analytics", Summary: "Clicks, conversions and conversion rate", Auth: openapi.SignedIn,
+		Query: []openapi.Param{botsParam}, Response: controllers.ConversionStats{}},
+	{Method: "GET", Path: "/api/links/{shortCode}/stats/stream", Tag: "analytics", Summary: "Live clicks as server-sent ClickStreamEvents", Auth: openapi.SignedIn,
+		Description: "An API key may be passed as ?key= for EventSource, which can't send an Authorization header.",
+		Query:       []openapi.Param{{Name: "key", Description: "API key, for clients that can't send an Authorization header"}},
+		ContentType: "text/event-stream"},
+	{Method: "GET", Path: "/api/links/{shortCode}/clicks/export", Tag: "analytics", Summary: "Raw clicks as CSV", Auth: openapi.SignedIn,
+		Query: rangeParams, ContentType: "text/csv"},
+
+	// Admin
+	{Method: "GET", Path: "/api/admin/vars", Tag: "admin", Summary: "Runtime counters from expvar", Auth: openapi.Admin,
+		ContentType: "application/json"},
+	{Method: "GET", Path: "/api/admin/system", Tag: "admin", Summary: "Health overview for operators", Auth: openapi.Admin,
+		Response: controllers.SystemStats{}},
+	{Method: "GET", Path: "/api/admin/maintenance", Tag: "admin", Summary: "Whether this instance is in maintenance mode", Auth: openapi.Admin,
+		Response: controllers.MaintenanceStatus{}},
+	{Method: "PUT", Path: "/api/admin/maintenance", Tag: "admin", Summary: "Turn maintenance mode on or off for this instance", Auth: openapi.Admin,
+		Request: controllers.MaintenanceStatus{}, Response: controllers.MaintenanceStatus{}},
+	{Method: "GET", Path: "/api/admin/users", Tag: "admin", Summary: "List users", Auth: openapi.Admin,
+		Response: []controllers.UserResponse{}},
+	{Method: "PUT", Path: "/api/admin/users/{id:[0-9]+}/role", Tag: "admin", Summary: "Change a user's role", Auth: openapi.Admin,
+		Request: controllers.SetRoleRequest{}, Response: controllers.UserResponse{}},
+	{Method: "PUT", Path: "/api/admin/keys/{id:[0-9]+}/quota", Tag: "admin", Summary: "Set an API key's quotas", Auth: openapi.Admin,
+		Request: controllers.SetQuotaRequest{}, Response: controllers.APIKeyResponse{}},
+	{Method: "PUT", Path: "/api/admin/keys/{id:[0-9]+}/rate-limit", Tag: "admin", Summary: "Set an API key's rate limit", Auth: openapi.Admin,
+		Request: controllers.SetRateLimitRequest{}, Response: controllers.APIKeyResponse{}},
+	{Method: "GET", Path: "/api/admin/malicious", Tag: "admin", Summary: "List URLs detected as malicious", Auth: openapi.Admin,
+		Query: append([]openapi.Param{
+			{Name: "min_score", Type: "integer"},
+			{Name: "max_score", Type: "integer"},
+			{Name: "pending", Type: "boolean", Description: "Only detections whose links haven't been disabled"},
+		}, pageParams...),
+		Response: []controllers.MaliciousLogResponse{}},
+	{Method: "POST", Path: "/api/admin/malicious/{id:[0-9]+}/disable", Tag: "admin", Summary: "Disable every link to a malicious URL", Auth: openapi.Admin,
+		Response: controllers.TakedownResponse{}},
+	{Method: "GET", Path: "/api/admin/links/deleted", Tag: "admin", Summary: "List deleted links", Auth: openapi.Admin,
+		Query: pageParams, Response: []controllers.LinkResource{}},
+	{Method: "POST", Path: "/api/admin/links/{shortCode}/restore", Tag: "admin", Summary: "Restore a deleted link", Auth: openapi.Admin,
+		Response: controllers.LinkResource{}},
+	{Method: "GET", Path: "/api/admin/links/duplicates", Tag: "admin", Summary: "Find links whose destinations only differ in spelling", Auth: openapi.Admin,
+		Response: []controllers.DuplicateGroup{}},
+	{Method: "POST", Path: "/api/admin/links/merge", Tag: "admin", Summary: "Merge duplicate links, keeping their codes as aliases", Auth: openapi.Admin,
+		Request: controllers.MergeLinksRequest{}, Response: controllers.MergeLinksResponse{}},
+	{Method: "GET", Path: "/api/admin/reports", Tag: "admin", Summary: "List abuse reports", Auth: openapi.Admin,
+		Query:    append([]openapi.Param{{Name: "status", Description: "open (default), dismissed, actioned or all"}}, pageParams...),
+		Response: []controllers.AbuseReportResponse{}},
+	{Method: "POST", Path: "/api/admin/reports/{id:[0-9]+}/resolve", Tag: "admin", Summary: "Dismiss a report or disable its link", Auth: openapi.Admin,
+		Request: controllers.ResolveReportRequest{}, Response: map[string]string{}},
+	{Method: "GET", Path: "/api/admin/domains", Tag: "admin", Summary: "List domain block and allow rules", Auth: openapi.Admin,
+		Query: []openapi.Param{{Name: "action", Description: "block or allow"}}, Response: []controllers.DomainRuleResponse{}},
+	{Method: "PUT", Path: "/api/admin/domains", Tag: "admin", Summary: "Add or change a domain rule", Auth: openapi.Admin,
+		Request: controllers.DomainRuleRequest{}, Response: controllers.DomainRuleResponse{}},
+	{Method: "DELETE", Path: "/api/admin/domains/{id:[0-9]+}", Tag: "admin", Summary: "Delete a domain rule", Auth: openapi.Admin,
+		Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/admin/chaos", Tag: "admin", Summary: "Faults being injected, in chaos builds", Auth: openapi.Admin,
+		Response: []controllers.ChaosFaultRequest{}},
+	{Method: "PUT", Path: "/api/admin/chaos", Tag: "admin", Summary: "Inject latency or errors, in chaos builds", Auth: openapi.Admin,
+		Request: controllers.ChaosFaultRequest{}, Response: []controllers.ChaosFaultRequest{}},
+	{Method: "DELETE", Path: "/api/admin/chaos", Tag: "admin", Summary: "Stop injecting faults, in chaos builds", Auth: openapi.Admin,
+		Status: http.StatusNoContent},
+}
+
+// checkDocumented logs routes missing from the OpenAPI document, so it's
+// noticed when a route is added without one.
+func checkDocumented(router *mux.Router, doc *openapi.Document) {
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if !doc.Documents(method, template) {
+				log.Printf("Route %s %s is missing from the OpenAPI document", method, template)
+			}
+		}
+		return nil
+	})
+}
+
+// swaggerUI loads Swagger UI from a CDN and points it at /openapi.json.
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>URL Shortener API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func serveSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(strings.TrimSpace(swaggerUI)))
+}
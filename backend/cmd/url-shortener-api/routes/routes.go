@@ -1,23 +1,189 @@
 package routes
 
 import (
+	"expvar"
+	"log"
+
+	"url-shortener/chaos"
 	"url-shortener/config"
 	"url-shortener/controllers"
+	"url-shortener/metrics"
 	"url-shortener/middlewares"
+	"url-shortener/models"
+	"url-shortener/oauth"
+	"url-shortener/openapi"
+	"url-shortener/scheduler"
+	"url-shortener/version"
 
 	"github.com/gorilla/mux"
 )
 
-func SetupRoutes(cfg config.Config) *mux.Router {
+func SetupRoutes(cfg config.Config, rateLimiter *middlewares.RateLimiter, jobScheduler *scheduler.Scheduler) *mux.Router {
 	router := mux.NewRouter()
 
+	// Probes for Kubernetes and load balancers, limited like redirects so
+	// frequent polling from one address isn't throttled
+	router.HandleFunc("/healthz", controllers.Liveness()).Methods("GET")
+	router.HandleFunc("/readyz", controllers.Readiness(&cfg)).Methods("GET")
+	router.Handle("/metrics", middlewares.RequireMetricsToken(cfg.MetricsToken, metrics.Handler())).Methods("GET")
+	router.HandleFunc("/version", controllers.GetVersion()).Methods("GET")
+	rateLimiter.SetRouteClass(middlewares.RedirectClass, "/healthz", "/readyz", "/metrics", "/version")
+
+	// API documentation
+	doc, err := openapi.New("URL Shortener API", version.Get().Version,
+		"Shortens URLs and reports on their clicks.", operations)
+	if err != nil {
+		log.Fatal("Error building the OpenAPI document:", err)
+	}
+	router.Handle("/openapi.json", doc).Methods("GET")
+	if cfg.OpenAPIDocsUI {
+		router.HandleFunc("/docs", serveSwaggerUI).Methods("GET")
+	}
+
 	// Public Routes
-	router.HandleFunc("/shorten", controllers.ShortenURL(&cfg)).Methods("POST")
-	router.HandleFunc("/{shortCode}", controllers.RedirectURL()).Methods("GET")
+	quota := middlewares.APIKeyQuotaMiddleware(cfg.APIKeyDailyQuota, cfg.APIKeyMonthlyQuota)
+	tierLimit := middlewares.TierRateLimitMiddleware(cfg.AnonymousTier.ShortenPerMinute, cfg.AuthenticatedTier.ShortenPerMinute)
+	captcha := middlewares.CaptchaMiddleware(cfg.CaptchaProvider, cfg.CaptchaSecret, cfg.CaptchaMinScore)
+	bodyLimit := middlewares.MaxBodySize(int64(cfg.MaxRequestBodyBytes))
+	router.Handle("/shorten", bodyLimit(tierLimit(captcha(quota(controllers.ShortenURL(&cfg)))))).Methods("POST")
+	router.Handle("/v4/shorten", bodyLimit(tierLimit(captcha(quota(controllers.BitlyShorten(&cfg)))))).Methods("POST")
+	router.HandleFunc("/analytics.js", controllers.ServeAnalyticsScript()).Methods("GET")
+	router.HandleFunc("/collect", controllers.CollectEngagement()).Methods("POST")
+	router.HandleFunc("/px/{shortCode}.gif", controllers.TrackConversion()).Methods("GET")
+	router.Handle("/report/{shortCode}", captcha(controllers.ReportLink(&cfg))).Methods("POST")
+	if cfg.SlackSigningSecret != "" {
+		router.Handle("/integrations/slack", bodyLimit(controllers.SlackCommand(&cfg))).Methods("POST")
+	}
+	router.HandleFunc("/{shortCode}", controllers.RedirectURL(&cfg)).Methods("GET")
+	rateLimiter.SetRouteClass(middlewares.RedirectClass, "/analytics.js", "/collect", "/px/{shortCode}.gif", "/{shortCode}")
+
+	// Account Routes
+	if cfg.JWTSecret != "" {
+		signedIn := middlewares.AdminOrUserMiddleware(cfg.AdminAPIToken)
+
+		router.HandleFunc("/api/register", controllers.Register()).Methods("POST")
+		router.HandleFunc("/api/login", controllers.Login(&cfg)).Methods("POST")
+		router.HandleFunc("/api/token/refresh", controllers.RefreshToken(&cfg)).Methods("POST")
+		router.Handle("/api/logout", middlewares.RequireUser(controllers.Logout())).Methods("POST")
+		router.Handle("/api/logout/all", middlewares.RequireUser(controllers.LogoutEverywhere())).Methods("POST")
+		router.Handle("/api/me", middlewares.RequireUser(controllers.GetCurrentUser())).Methods("GET")
+		router.Handle("/api/me/notifications", middlewares.RequireUser(controllers.GetNotificationPreferences())).Methods("GET")
+		router.Handle("/api/me/notifications", middlewares.RequireUser(controllers.UpdateNotificationPreferences())).Methods("PUT")
+		router.Handle("/api/me/deletion", middlewares.RequireUser(controllers.RequestAccountDeletion(&cfg))).Methods("POST")
+		router.Handle("/api/me/deletion/confirm", middlewares.RequireUser(controllers.ConfirmAccountDeletion(&cfg))).Methods("POST")
+
+		providers := oauth.Providers(cfg)
+		router.HandleFunc("/api/auth/{provider}/login", controllers.OAuthLogin(&cfg, providers)).Methods("GET")
+		router.HandleFunc("/api/auth/{provider}/callback", controllers.OAuthCallback(&cfg, providers)).Methods("GET")
+
+		router.Handle("/api/keys", middlewares.RequireUser(controllers.CreateAPIKey(&cfg))).Methods("POST")
+		router.Handle("/api/keys", middlewares.RequireUser(controllers.ListAPIKeys(&cfg))).Methods("GET")
+		router.Handle("/api/keys/{id:[0-9]+}", middlewares.RequireUser(controllers.DeleteAPIKey())).Methods("DELETE")
+		router.Handle("/api/keys/{id:[0-9]+}/usage", signedIn(controllers.GetAPIKeyUsage(&cfg))).Methods("GET")
+
+		router.Handle("/api/orgs", middlewares.RequireUser(controllers.CreateOrganization())).Methods("POST")
+		router.Handle("/api/orgs", middlewares.RequireUser(controllers.ListOrganizations())).Methods("GET")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/members", signedIn(controllers.ListMembers())).Methods("GET")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/members", signedIn(controllers.AddMember())).Methods("POST")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/members/{userID:[0-9]+}", signedIn(controllers.SetMemberRole())).Methods("PUT")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/members/{userID:[0-9]+}", signedIn(controllers.RemoveMember())).Methods("DELETE")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/invites", signedIn(controllers.ListInvites())).Methods("GET")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/invites", signedIn(controllers.CreateInvite(&cfg))).Methods("POST")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/invites/{inviteID:[0-9]+}", signedIn(controllers.RevokeInvite())).Methods("DELETE")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/reports", signedIn(controllers.ListOrgReports())).Methods("GET")
+		router.Handle("/api/orgs/{orgID:[0-9]+}/reports/{month}", signedIn(controllers.GetOrgReport())).Methods("GET")
+		router.HandleFunc("/api/invites/{token}", controllers.GetInvite(&cfg)).Methods("GET")
+		router.Handle("/api/invites/{token}/accept", middlewares.RequireUser(controllers.AcceptInvite(&cfg))).Methods("POST")
+
+		if cfg.CustomDomainsPerUser > 0 {
+			router.Handle("/api/domains", middlewares.RequireUser(controllers.CreateCustomDomain(&cfg))).Methods("POST")
+			router.Handle("/api/domains", signedIn(controllers.ListCustomDomains())).Methods("GET")
+			router.Handle("/api/domains/{id:[0-9]+}", signedIn(controllers.GetCustomDomain())).Methods("GET")
+			router.Handle("/api/domains/{id:[0-9]+}", signedIn(controllers.DeleteCustomDomain())).Methods("DELETE")
+		}
+	}
+
+	// Link Management Routes
+	adminOnly := middlewares.RequireRole(models.RoleAdmin, cfg.AdminAPIToken)
+	adminOrOwner := middlewares.AdminOrUserMiddleware(cfg.AdminAPIToken)
+	router.Handle("/api/links", adminOrOwner(controllers.ListLinks())).Methods("GET")
+	router.Handle("/api/links/reconcile", adminOnly(controllers.ReconcileLinks(&cfg))).Methods("POST")
+	router.Handle("/api/links/import", adminOrOwner(controllers.ImportLinks(&cfg))).Methods("POST")
+	router.Handle("/api/links/import/{id:[0-9]+}", adminOrOwner(controllers.GetLinkImport())).Methods("GET")
+	router.Handle("/api/links/export", adminOrOwner(controllers.ExportLinks())).Methods("GET")
+	queryKey := middlewares.QueryAPIKeyMiddleware("key")
+	// Creates links despite being a GET, so maintenance mode must refuse it
+	writeGuard := middlewares.MaintenanceWriteMiddleware(cfg.MaintenanceRetryAfter)
+	router.Handle("/api/quick", writeGuard(queryKey(adminOrOwner(tierLimit(quota(controllers.QuickShorten(&cfg))))))).Methods("GET")
+	// Only reads, so it doesn't count against the shorten quota
+	router.Handle("/api/expand", adminOrOwner(controllers.ExpandURL(&cfg))).Methods("GET")
+	router.Handle("/api/users/{id:[0-9]+}/links.atom", queryKey(adminOrOwner(controllers.UserLinksFeed()))).Methods("GET")
+	router.Handle("/api/links/{shortCode}", adminOrOwner(controllers.GetLink())).Methods("GET")
+	router.Handle("/api/links/{shortCode}", adminOrOwner(controllers.PutLink(&cfg))).Methods("PUT")
+	router.Handle("/api/links/{shortCode}", adminOrOwner(controllers.DeleteLink())).Methods("DELETE")
+	router.Handle("/api/links/{shortCode}/preview", adminOrOwner(controllers.CreatePreviewToken(&cfg))).Methods("POST")
+
+	// Webhook Routes
+	router.Handle("/api/webhooks", adminOrOwner(controllers.CreateWebhook())).Methods("POST")
+	router.Handle("/api/webhooks", adminOrOwner(controllers.ListWebhooks())).Methods("GET")
+	router.Handle("/api/webhooks/{id:[0-9]+}", adminOrOwner(controllers.UpdateWebhook())).Methods("PUT")
+	router.Handle("/api/webhooks/{id:[0-9]+}", adminOrOwner(controllers.DeleteWebhook())).Methods("DELETE")
+	router.Handle("/api/webhooks/{id:[0-9]+}/deliveries", adminOrOwner(controllers.ListWebhookDeliveries())).Methods("GET")
+
+	// Analytics Routes
+	router.Handle("/api/stats/summary", adminOrOwner(controllers.GetSummaryStats())).Methods("GET")
+	router.Handle("/api/links/{shortCode}/stats/referrers", adminOrOwner(controllers.GetReferrerStats())).Methods("GET")
+	router.Handle("/api/links/{shortCode}/stats/utm", adminOrOwner(controllers.GetUTMStats())).Methods("GET")
+	router.Handle("/api/links/{shortCode}/stats/devices", adminOrOwner(controllers.GetDeviceStats())).Methods("GET")
+	router.Handle("/api/links/{shortCode}/stats/timeseries", adminOrOwner(controllers.GetTimeSeriesStats())).Methods("GET")
+	router.Handle("/api/links/{shortCode}/stats/conversions", adminOrOwner(controllers.GetConversionStats())).Methods("GET")
+	router.Handle("/api/links/{shortCode}/stats/stream", queryKey(adminOrOwner(controllers.StreamClicks()))).Methods("GET")
+	router.Handle("/api/links/{shortCode}/clicks/export", adminOrOwner(controllers.ExportClicks())).Methods("GET")
+
+	// Admin Routes
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(middlewares.RequireRole(models.RoleAdmin, cfg.AdminAPIToken))
+	admin.Handle("/vars", expvar.Handler()).Methods("GET")
+	admin.HandleFunc("/system", controllers.GetSystemStats(&cfg, jobScheduler)).Methods("GET")
+	admin.HandleFunc("/maintenance", controllers.GetMaintenance()).Methods("GET")
+	admin.HandleFunc("/maintenance", controllers.SetMaintenance()).Methods("PUT")
+	admin.HandleFunc("/users", controllers.ListUsers()).Methods("GET")
+	admin.HandleFunc("/users/{id:[0-9]+}/role", controllers.SetUserRole()).Methods("PUT")
+	admin.HandleFunc("/keys/{id:[0-9]+}/quota", controllers.SetAPIKeyQuota(&cfg)).Methods("PUT")
+	admin.HandleFunc("/malicious", controllers.ListMaliciousLogs()).Methods("GET")
+	admin.HandleFunc("/malicious/{id:[0-9]+}/disable", controllers.DisableMaliciousLinks()).Methods("POST")
+	admin.HandleFunc("/links/deleted", controllers.ListDeletedLinks()).Methods("GET")
+	admin.HandleFunc("/links/{shortCode}/restore", controllers.RestoreLink()).Methods("POST")
+	admin.HandleFunc("/links/duplicates", controllers.FindDuplicateLinks()).Methods("GET")
+	admin.HandleFunc("/links/merge", controllers.MergeLinks()).Methods("POST")
+	admin.HandleFunc("/reports", controllers.ListAbuseReports()).Methods("GET")
+	admin.HandleFunc("/reports/{id:[0-9]+}/resolve", controllers.ResolveAbuseReport()).Methods("POST")
+	admin.HandleFunc("/domains", controllers.ListDomainRules()).Methods("GET")
+	admin.HandleFunc("/domains", controllers.PutDomainRule()).Methods("PUT")
+	admin.HandleFunc("/domains/{id:[0-9]+}", controllers.DeleteDomainRule()).Methods("DELETE")
+	admin.HandleFunc("/keys/{id:[0-9]+}/rate-limit", controllers.SetAPIKeyRateLimit(&cfg)).Methods("PUT")
+	if chaos.Enabled {
+		admin.HandleFunc("/chaos", controllers.ListChaosFaults()).Methods("GET")
+		admin.HandleFunc("/chaos", controllers.SetChaosFault()).Methods("PUT")
+		admin.HandleFunc("/chaos", controllers.ClearChaosFaults()).Methods("DELETE")
+	}
 
 	// Apply Middlewares
-	router.Use(middlewares.LoggingMiddleware)
-	router.Use(middlewares.RateLimitMiddleware)
+	// Metrics wrap the rest so rejected requests are counted too
+	router.Use(middlewares.MetricsMiddleware)
+	router.Use(middlewares.LoggingMiddleware(cfg.AccessLogFormat))
+	router.Use(middlewares.RequestTimeoutMiddleware(cfg.RequestTimeout,
+		"/api/links/{shortCode}/stats/stream", "/api/links/{shortCode}/clicks/export", "/api/links/reconcile",
+		"/api/links/export"))
+	router.Use(middlewares.AdminTokenMiddleware(cfg.AdminAPIToken))
+	// Authentication runs first so signed-in traffic is limited per account or key
+	if cfg.JWTSecret != "" {
+		router.Use(middlewares.AuthMiddleware(cfg.JWTSecret))
+	}
+	router.Use(rateLimiter.Middleware)
+	router.Use(middlewares.MaintenanceMiddleware(cfg.MaintenanceRetryAfter, "/api/admin/maintenance"))
+
+	checkDocumented(router, doc)
 
 	return router
 }
@@ -0,0 +1,213 @@
+// Package scheduler runs the recurring background jobs, each on its own
+// interval, and stops them cleanly on shutdown.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Job is a recurring task.
+type Job struct {
+	// Name identifies the job in logs and in the DISABLED_JOBS setting.
+	Name string
+	// Interval is the time between the end of one run and the start of
+	// the next.
+	Interval time.Duration
+	// RunAtStart runs the job as soon as the scheduler starts instead of
+	// after the first interval.
+	RunAtStart bool
+	// Run does one pass of the job. It should return promptly once ctx is
+	// cancelled.
+	Run func(ctx context.Context) error
+}
+
+// ErrPanicked is reported to hooks for a run that panicked.
+var ErrPanicked = errors.New("job panicked")
+
+// Hook is told the outcome of every job run.
+type Hook func(name string, took time.Duration, err error)
+
+// JobStatus is what the scheduler knows about a job at a point in time.
+type JobStatus struct {
+	Name      string     `json:"name"`
+	Running   bool       `json:"running"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+}
+
+// Scheduler runs jobs until it's stopped. A job never overlaps itself.
+type Scheduler struct {
+	jitter   float64
+	disabled map[string]bool
+	known    map[string]bool
+	jobs     []Job
+	hooks    []Hook
+
+	mu       sync.Mutex
+	statuses map[string]*JobStatus
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a scheduler that spreads each wait by up to jitter (a
+// fraction of the interval, e.g. 0.1 for ±10%) so replicas don't run jobs
+// in lockstep, and that skips the named disabled jobs.
+func New(jitter float64, disabled []string) *Scheduler {
+	s := &Scheduler{
+		jitter:   jitter,
+		disabled: make(map[string]bool, len(disabled)),
+		known:    make(map[string]bool),
+		statuses: make(map[string]*JobStatus),
+	}
+	for _, name := range disabled {
+		s.disabled[name] = true
+	}
+	return s
+}
+
+// Add registers job to run. A disabled job, or one without an interval, is
+// only recorded as a known name. Add must be called before Start.
+func (s *Scheduler) Add(job Job) {
+	s.known[job.Name] = true
+	if s.disabled[job.Name] {
+		log.Printf("Job %s is disabled", job.Name)
+		return
+	}
+	if job.Interval <= 0 {
+		return
+	}
+	s.jobs = append(s.jobs, job)
+	s.statuses[job.Name] = &JobStatus{Name: job.Name}
+}
+
+// AfterRun adds a hook called after each run of every job, such as for
+// metrics. It must be called before Start.
+func (s *Scheduler) AfterRun(hook Hook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Jobs reports on every registered job, in the order they were added.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		statuses = append(statuses, *s.statuses[job.Name])
+	}
+	return statuses
+}
+
+func (s *Scheduler) updateStatus(name string, update func(status *JobStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s.statuses[name])
+}
+
+// Start launches every registered job in the background. It fails without
+// starting any if a disabled name matches no job, which is likely a typo.
+func (s *Scheduler) Start() error {
+	for name := range s.disabled {
+		if !s.known[name] {
+			return fmt.Errorf("unknown job %q", name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+	log.Printf("Scheduler started %d jobs", len(s.jobs))
+	return nil
+}
+
+// Stop cancels the jobs and waits for running ones to return, or for ctx
+// to expire.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	if job.RunAtStart {
+		s.run(ctx, job)
+	}
+	for {
+		wait := s.wait(job.Interval)
+		next := time.Now().Add(wait)
+		s.updateStatus(job.Name, func(status *JobStatus) { status.NextRun = &next })
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.run(ctx, job)
+		}
+	}
+}
+
+// run does one pass of job, logging its error or panic rather than letting
+// it take the process down, and reports the outcome to the hooks.
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	start := time.Now()
+	s.updateStatus(job.Name, func(status *JobStatus) { status.Running, status.NextRun = true, nil })
+	err := runRecovering(ctx, job)
+	s.updateStatus(job.Name, func(status *JobStatus) {
+		status.Running, status.LastRun, status.LastError = false, &start, ""
+		if err != nil {
+			status.LastError = err.Error()
+		}
+	})
+	if err != nil && ctx.Err() == nil && !errors.Is(err, ErrPanicked) {
+		log.Printf("Job %s failed: %v", job.Name, err)
+	}
+	for _, hook := range s.hooks {
+		hook(job.Name, time.Since(start), err)
+	}
+}
+
+func runRecovering(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Job %s panicked: %v\n%s", job.Name, recovered, debug.Stack())
+			err = fmt.Errorf("%w: %v", ErrPanicked, recovered)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// wait returns interval spread by the scheduler's jitter.
+func (s *Scheduler) wait(interval time.Duration) time.Duration {
+	if s.jitter <= 0 {
+		return interval
+	}
+	spread := (rand.Float64()*2 - 1) * s.jitter
+	return time.Duration(float64(interval) * (1 + spread))
+}
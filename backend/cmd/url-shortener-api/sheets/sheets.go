@@ -0,0 +1,123 @@
+// Package sheets appends rows to Google Sheets through the Sheets API,
+// signed in as a service account the spreadsheet has been shared with.
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	scope           = "https://www.googleapis.com/auth/spreadsheets"
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	requestTimeout  = 30 * time.Second
+)
+
+// apiBaseURL is where spreadsheets are addressed; tests point it elsewhere.
+var apiBaseURL = "https://sheets.googleapis.com/v4/spreadsheets/"
+
+// Client appends rows to spreadsheets as one service account.
+type Client struct {
+	http *http.Client
+}
+
+// serviceAccountKey is the part of a service account's JSON key file the
+// client needs.
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// NewClient returns a client signed in with the service account JSON key in
+// credentialsFile, as downloaded from the Google Cloud console.
+func NewClient(credentialsFile string) (*Client, error) {
+	contents, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(contents, &key); err != nil {
+		return nil, fmt.Errorf("reading service account key: %w", err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" {
+		return nil, errors.New("not a service account key file")
+	}
+	if err := checkPrivateKey(key.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	tokenURL := key.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+	conf := &jwt.Config{
+		Email:        key.ClientEmail,
+		PrivateKey:   []byte(key.PrivateKey),
+		PrivateKeyID: key.PrivateKeyID,
+		Scopes:       []string{scope},
+		TokenURL:     tokenURL,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Timeout: requestTimeout})
+	client := conf.Client(ctx)
+	client.Timeout = requestTimeout
+	return &Client{http: client}, nil
+}
+
+// Append adds rows after the last row of the table in sheetRange, such as
+// "Sheet1", of the spreadsheet. Values are stored as given, never parsed as
+// formulas.
+func (c *Client) Append(ctx context.Context, spreadsheetID, sheetRange string, rows [][]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"values": rows})
+	if err != nil {
+		return err
+	}
+	endpoint := apiBaseURL + url.PathEscape(spreadsheetID) + "/values/" + url.PathEscape(sheetRange) +
+		":append?valueInputOption=RAW&insertDataOption=INSERT_ROWS"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sheets API answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// checkPrivateKey makes sure a key file's private key can be used, so a bad
+// file is caught at startup rather than at the first export.
+func checkPrivateKey(privateKey string) error {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return errors.New("service account key has no PEM private key")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return errors.New("service account private key is not an RSA key")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned for a page token that wasn't issued by
+// EncodeCursor.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a page in a list ordered by a timestamp and
+// then ID, both descending. The next page starts just after it, so rows
+// added meanwhile don't shift pages the way OFFSET does.
+type Cursor struct {
+	Time time.Time `json:"t"`
+	ID   uint      `json:"id"`
+}
+
+// EncodeCursor returns c as an opaque page token.
+func EncodeCursor(c Cursor) string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// DecodeCursor parses a page token from EncodeCursor.
+func DecodeCursor(token string) (Cursor, error) {
+	var c Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == 0 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Before reports whether a row at t with the given ID comes after c in
+// descending order, i.e. belongs on a later page.
+func (c Cursor) Before(t time.Time, id uint) bool {
+	return t.Before(c.Time) || (t.Equal(c.Time) && id < c.ID)
+}
+
+// Paginate orders query newest first by column and then id, and starts it
+// after cursor when one is given.
+func Paginate(query *gorm.DB, column string, after *Cursor) *gorm.DB {
+	query = query.Order(fmt.Sprintf("%s DESC, id DESC", column))
+	if after != nil {
+		query = query.Where(fmt.Sprintf("(%[1]s < ? OR (%[1]s = ? AND id < ?))", column), after.Time, after.Time, after.ID)
+	}
+	return query
+}
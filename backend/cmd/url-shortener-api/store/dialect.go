@@ -0,0 +1,39 @@
+package store
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// The few queries that need database-specific SQL get it from here, so
+// handlers and jobs work the same on Postgres and SQLite.
+
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// BucketStartExpr is a SQL expression for the start of the hour, day or
+// (Monday-based) week that created_at falls in, as Unix seconds in UTC.
+func BucketStartExpr(db *gorm.DB, interval string) string {
+	if !isSQLite(db) {
+		return fmt.Sprintf("CAST(EXTRACT(EPOCH FROM date_trunc('%s', created_at AT TIME ZONE 'UTC')) AS bigint)", interval)
+	}
+	switch interval {
+	case "hour":
+		return "CAST(strftime('%s', strftime('%Y-%m-%d %H:00:00', created_at)) AS integer)"
+	case "week":
+		return "CAST(strftime('%s', date(created_at, 'weekday 0', '-6 days')) AS integer)"
+	default:
+		return "CAST(strftime('%s', date(created_at)) AS integer)"
+	}
+}
+
+// RecheckDueCondition is a SQL condition matching links whose
+// check_interval, in hours, has passed since last_checked_at.
+func RecheckDueCondition(db *gorm.DB) string {
+	if isSQLite(db) {
+		return "julianday(last_checked_at) <= julianday('now') - check_interval / 24.0"
+	}
+	return "last_checked_at <= NOW() - check_interval * INTERVAL '1 hour'"
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// sealedPrefix marks an encrypted column value. Values without it are
+// plaintext, written before a key was configured.
+const sealedPrefix = "enc:v1:"
+
+// ErrNoEncryptionKey is returned when reading an encrypted value without
+// URL_ENCRYPTION_KEY set.
+var ErrNoEncryptionKey = errors.New("value is encrypted but no encryption key is configured")
+
+// urlCipher encrypts destination URLs and the other columns tagged
+// serializer:encrypted or serializer:encryptedjson; nil stores them in
+// plaintext.
+var urlCipher *sealer
+
+func init() {
+	// Columns tagged serializer:encrypted or serializer:encryptedjson go
+	// through the configured key
+	schema.RegisterSerializer("encrypted", encryptedSerializer{})
+	schema.RegisterSerializer("encryptedjson", encryptedJSONSerializer{})
+}
+
+// SetEncryptionKey turns on encryption of destination URLs, webhook secrets
+// and password hashes at rest with a base64-encoded 32-byte key. An empty
+// key leaves them in plaintext. Existing plaintext values stay readable and
+// are encrypted when next saved, or by SealStored.
+func SetEncryptionKey(encodedKey string) error {
+	if encodedKey == "" {
+		urlCipher = nil
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	s, err := newSealer(key)
+	if err != nil {
+		return err
+	}
+	urlCipher = s
+	return nil
+}
+
+// SealURL returns rawURL as it's stored in the database. Use it where a URL
+// column is written without going through the model, such as map updates.
+func SealURL(rawURL string) string {
+	return Seal(rawURL)
+}
+
+// Seal returns value as an encrypted column stores it, or unchanged without
+// a key.
+func Seal(value string) string {
+	if urlCipher == nil || value == "" {
+		return value
+	}
+	return urlCipher.seal(value)
+}
+
+// IsSealed reports whether value, as read straight from an encrypted
+// column, is encrypted.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// URLColumnValues returns the stored forms rawURL may have, for matching a
+// URL column with IN: its plaintext and, with a key set, its ciphertext.
+// Encryption is deterministic so equal URLs seal alike.
+func URLColumnValues(rawURL string) []string {
+	if sealed := SealURL(rawURL); sealed != rawURL {
+		return []string{rawURL, sealed}
+	}
+	return []string{rawURL}
+}
+
+// sealer is deterministic AES-GCM: the nonce is derived from the plaintext,
+// so equality lookups still work. It reveals which rows share a URL, and
+// nothing else.
+type sealer struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+func newSealer(key []byte) (*sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the nonce derivation key separate from the encryption key
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("url-shortener nonce key"))
+	return &sealer{aead: aead, nonceKey: mac.Sum(nil)}, nil
+}
+
+func (s *sealer) seal(plaintext string) string {
+	mac := hmac.New(sha256.New, s.nonceKey)
+	mac.Write([]byte(plaintext))
+	nonce := mac.Sum(nil)[:s.aead.NonceSize()]
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func (s *sealer) open(value string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// encryptedSerializer stores string fields through urlCipher.
+type encryptedSerializer struct{}
+
+func (encryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	value, err := openColumn(dbValue)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(value)
+	return nil
+}
+
+func (encryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted fields must be strings, got %T", fieldValue)
+	}
+	return Seal(value), nil
+}
+
+// encryptedJSONSerializer stores fields as JSON through urlCipher, for maps
+// and lists that hold destination URLs.
+type encryptedJSONSerializer struct{}
+
+func (encryptedJSONSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	value, err := openColumn(dbValue)
+	if err != nil {
+		return err
+	}
+	return schema.JSONSerializer{}.Scan(ctx, field, dst, value)
+}
+
+func (encryptedJSONSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, err := schema.JSONSerializer{}.Value(ctx, field, dst, fieldValue)
+	if text, ok := value.(string); ok && err == nil {
+		return Seal(text), nil
+	}
+	return value, err
+}
+
+// openColumn decrypts a value read from an encrypted column, passing
+// plaintext through.
+func openColumn(dbValue interface{}) (string, error) {
+	value, err := columnText(dbValue)
+	if err != nil || !IsSealed(value) {
+		return value, err
+	}
+	if urlCipher == nil {
+		return "", ErrNoEncryptionKey
+	}
+	return urlCipher.open(value)
+}
+
+// sealBatchSize is how many rows SealStored reads at a time.
+const sealBatchSize = 500
+
+// SealStored encrypts the values of encrypted columns that were stored in
+// plaintext before a key was set, and returns how many it encrypted. A value
+// changed since it was read is left for its writer, who sealed it.
+func SealStored(ctx context.Context, conn *gorm.DB) (int64, error) {
+	if urlCipher == nil {
+		return 0, errors.New("no encryption key is configured")
+	}
+
+	var sealed int64
+	for _, model := range []interface{}{
+		&models.UrlMapping{}, &models.ArchivedLink{}, &models.MaliciousLog{}, &models.User{},
+		&models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.LinkImport{},
+	} {
+		statement := &gorm.Statement{DB: conn}
+		if err := statement.Parse(model); err != nil {
+			return sealed, err
+		}
+		var columns []string
+		for _, field := range statement.Schema.Fields {
+			if serializer := field.TagSettings["SERIALIZER"]; serializer == "encrypted" || serializer == "encryptedjson" {
+				columns = append(columns, field.DBName)
+			}
+		}
+
+		table := statement.Schema.Table
+		var lastID int64
+		for {
+			var rows []map[string]interface{}
+			err := conn.WithContext(ctx).Table(table).Select(append([]string{"id"}, columns...)).
+				Where("id > ?", lastID).Order("id").Limit(sealBatchSize).Find(&rows).Error
+			if err != nil {
+				return sealed, fmt.Errorf("reading %s: %w", table, err)
+			}
+			for _, row := range rows {
+				id, ok := row["id"].(int64)
+				if !ok {
+					return sealed, fmt.Errorf("reading %s: unexpected id type %T", table, row["id"])
+				}
+				lastID = id
+				for _, column := range columns {
+					plaintext, err := columnText(row[column])
+					if err != nil || plaintext == "" || IsSealed(plaintext) {
+						continue
+					}
+					result := conn.WithContext(ctx).Table(table).Where("id = ? AND "+column+" = ?", id, plaintext).
+						Update(column, Seal(plaintext))
+					if result.Error != nil {
+						return sealed, fmt.Errorf("encrypting %s.%s of row %d: %w", table, column, lastID, result.Error)
+					}
+					sealed += result.RowsAffected
+				}
+			}
+			if len(rows) < sealBatchSize {
+				break
+			}
+		}
+	}
+	return sealed, nil
+}
+
+// columnText returns a value read from an encrypted column as it's stored.
+func columnText(dbValue interface{}) (string, error) {
+	switch v := dbValue.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("unsupported encrypted value type %T", dbValue)
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"url-shortener/config"
+	"url-shortener/db"
+	"url-shortener/models"
+
+	"gorm.io/gorm/schema"
+)
+
+var (
+	testKey      = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	otherTestKey = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+// useKey sets the encryption key for the rest of the test.
+func useKey(t *testing.T, key string) {
+	t.Helper()
+	if err := SetEncryptionKey(key); err != nil {
+		t.Fatalf("SetEncryptionKey() error = %v", err)
+	}
+	t.Cleanup(func() { SetEncryptionKey("") })
+}
+
+func TestSetEncryptionKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "32 bytes", key: testKey},
+		{name: "empty turns encryption off", key: ""},
+		{name: "not base64", key: "not base64!", wantErr: true},
+		{name: "too short", key: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "too long", key: base64.StdEncoding.EncodeToString(make([]byte, 33)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { SetEncryptionKey("") })
+			err := SetEncryptionKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetEncryptionKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (urlCipher != nil) != (tt.key != "") {
+				t.Errorf("encryption on = %v with key %q", urlCipher != nil, tt.key)
+			}
+		})
+	}
+}
+
+func TestSealURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		url    string
+		sealed bool
+	}{
+		{name: "no key", url: "https://example.com/a", sealed: false},
+		{name: "key", key: testKey, url: "https://example.com/a", sealed: true},
+		{name: "empty URL", key: testKey, url: "", sealed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKey(t, tt.key)
+			got := SealURL(tt.url)
+			if sealed := IsSealed(got); sealed != tt.sealed {
+				t.Fatalf("SealURL(%q) = %q, sealed %v, want %v", tt.url, got, sealed, tt.sealed)
+			}
+			if !tt.sealed && got != tt.url {
+				t.Errorf("SealURL(%q) = %q, want it unchanged", tt.url, got)
+			}
+			if tt.sealed && SealURL(tt.url) != got {
+				t.Error("sealing the same URL twice gave different values")
+			}
+
+			want := []string{tt.url}
+			if tt.sealed {
+				want = append(want, got)
+			}
+			if values := URLColumnValues(tt.url); !reflect.DeepEqual(values, want) {
+				t.Errorf("URLColumnValues(%q) = %q, want %q", tt.url, values, want)
+			}
+		})
+	}
+}
+
+func TestSealerOpen(t *testing.T) {
+	key, _ := base64.StdEncoding.DecodeString(testKey)
+	otherKey, _ := base64.StdEncoding.DecodeString(otherTestKey)
+	s, err := newSealer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newSealer(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := s.seal("https://example.com/a")
+
+	tests := []struct {
+		name    string
+		sealer  *sealer
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "round trip", sealer: s, value: sealed, want: "https://example.com/a"},
+		{name: "unicode", sealer: s, value: s.seal("https://example.com/ü?q=ä"), want: "https://example.com/ü?q=ä"},
+		{name: "other key", sealer: other, value: sealed, wantErr: true},
+		{name: "tampered", sealer: s, value: sealed[:len(sealed)-2] + "AA", wantErr: true},
+		{name: "not base64", sealer: s, value: sealedPrefix + "!!!", wantErr: true},
+		{name: "too short", sealer: s, value: sealedPrefix + "AAAA", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sealer.open(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("open() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedSerializer(t *testing.T) {
+	linkSchema, err := schema.Parse(&models.UrlMapping{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := linkSchema.LookUpField("OriginalUrl")
+
+	useKey(t, testKey)
+	sealed := SealURL("https://example.com/a")
+	SetEncryptionKey("")
+
+	tests := []struct {
+		name    string
+		key     string
+		dbValue interface{}
+		want    string
+		wantErr error
+	}{
+		{name: "sealed string", key: testKey, dbValue: sealed, want: "https://example.com/a"},
+		{name: "sealed bytes", key: testKey, dbValue: []byte(sealed), want: "https://example.com/a"},
+		{name: "plaintext with a key", key: testKey, dbValue: "https://example.com/b", want: "https://example.com/b"},
+		{name: "plaintext without a key", dbValue: "https://example.com/b", want: "https://example.com/b"},
+		{name: "null", key: testKey, dbValue: nil, want: ""},
+		{name: "sealed without a key", dbValue: sealed, wantErr: ErrNoEncryptionKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKey(t, tt.key)
+			var link models.UrlMapping
+			err := encryptedSerializer{}.Scan(context.Background(), field, reflect.ValueOf(&link).Elem(), tt.dbValue)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Scan() error = %v, want %v", err, tt.wantErr)
+			}
+			if link.OriginalUrl != tt.want {
+				t.Errorf("Scan() set %q, want %q", link.OriginalUrl, tt.want)
+			}
+		})
+	}
+
+	t.Run("value", func(t *testing.T) {
+		useKey(t, testKey)
+		got, err := encryptedSerializer{}.Value(context.Background(), field, reflect.Value{}, "https://example.com/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != sealed {
+			t.Errorf("Value() = %v, want %q", got, sealed)
+		}
+		if _, err := (encryptedSerializer{}).Value(context.Background(), field, reflect.Value{}, 42); err == nil {
+			t.Error("Value() of a non-string didn't fail")
+		}
+	})
+}
+
+func TestSealStored(t *testing.T) {
+	db.Connect(config.Config{
+		DBDriver:           "sqlite",
+		DBConnectionString: filepath.Join(t.TempDir(), "seal.db"),
+		DBConnectAttempts:  1,
+	})
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Migrate("sqlite"); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	// Stored before a key was set
+	user := models.User{Email: "owner@example.com", PasswordHash: "bcrypt-hash"}
+	link := models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/a", LanguageTargets: map[string]string{"de": "https://example.com/de"}}
+	subscription := models.WebhookSubscription{URL: "https://hooks.example.com", Secret: "webhook-secret"}
+	for _, value := range []interface{}{&user, &link, &subscription,
+		&models.MaliciousLog{URL: "https://malware.example.com"},
+		&models.LinkImport{Format: "csv", RowErrors: []models.LinkImportError{{Row: 1, URL: "https://example.com/b", Message: "taken"}}},
+	} {
+		if err := db.DB.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	delivery := models.WebhookDelivery{SubscriptionID: subscription.ID, Event: "link.created", Payload: `{"url": "https://example.com/a"}`}
+	if err := db.DB.Create(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SealStored(context.Background(), db.DB); err == nil {
+		t.Error("SealStored() without a key didn't fail")
+	}
+	useKey(t, testKey)
+	sealed, err := SealStored(context.Background(), db.DB)
+	if err != nil {
+		t.Fatalf("SealStored() error = %v", err)
+	}
+	if sealed != 7 {
+		t.Errorf("SealStored() = %d, want 7", sealed)
+	}
+	if again, err := SealStored(context.Background(), db.DB); err != nil || again != 0 {
+		t.Errorf("second SealStored() = %d, %v, want nothing left to seal", again, err)
+	}
+
+	for _, column := range []struct{ table, name string }{
+		{"users", "password_hash"},
+		{"url_mappings", "original_url"},
+		{"url_mappings", "language_targets"},
+		{"webhook_subscriptions", "secret"},
+		{"webhook_deliveries", "payload"},
+		{"malicious_logs", "url"},
+		{"link_imports", "row_errors"},
+	} {
+		var stored string
+		if err := db.DB.Table(column.table).Select(column.name).Row().Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if !IsSealed(stored) {
+			t.Errorf("%s.%s = %q, want it encrypted", column.table, column.name, stored)
+		}
+	}
+	var finalURL string
+	if err := db.DB.Table("url_mappings").Select("final_url").Row().Scan(&finalURL); err != nil || finalURL != "" {
+		t.Errorf("empty final_url stored as %q, %v, want it left empty", finalURL, err)
+	}
+
+	// The models read the sealed values back as they were
+	var reread models.UrlMapping
+	if err := db.DB.First(&reread, link.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reread.OriginalUrl != link.OriginalUrl || !reflect.DeepEqual(reread.LanguageTargets, link.LanguageTargets) {
+		t.Errorf("link read back as %q, %v", reread.OriginalUrl, reread.LanguageTargets)
+	}
+	var job models.LinkImport
+	if err := db.DB.First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(job.RowErrors) != 1 || job.RowErrors[0].URL != "https://example.com/b" {
+		t.Errorf("import row errors read back as %+v", job.RowErrors)
+	}
+	if err := db.DB.First(&delivery, delivery.ID).Error; err != nil || delivery.Payload != `{"url": "https://example.com/a"}` {
+		t.Errorf("delivery payload read back as %q, %v", delivery.Payload, err)
+	}
+}
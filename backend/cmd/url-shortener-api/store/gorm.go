@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+// GormStore keeps links in a SQL database through gorm.
+type GormStore struct {
+	db      *gorm.DB
+	replica *gorm.DB
+}
+
+// NewGormStore returns a store backed by db that serves Lookup from
+// replica, which may be db itself.
+func NewGormStore(db, replica *gorm.DB) *GormStore {
+	return &GormStore{db: db, replica: replica}
+}
+
+func (s *GormStore) Create(ctx context.Context, urlMapping *models.UrlMapping) error {
+	return s.db.WithContext(ctx).Create(urlMapping).Error
+}
+
+func (s *GormStore) GetByCode(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	return getByCode(s.db.WithContext(ctx), shortCode)
+}
+
+func (s *GormStore) Lookup(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	return getByCode(s.replica.WithContext(ctx), shortCode)
+}
+
+func getByCode(db *gorm.DB, shortCode string) (models.UrlMapping, error) {
+	var urlMapping models.UrlMapping
+	err := db.Where("short_code = ?", shortCode).First(&urlMapping).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return urlMapping, ErrNotFound
+	}
+	return urlMapping, err
+}
+
+func (s *GormStore) Update(ctx context.Context, urlMapping *models.UrlMapping) error {
+	return s.db.WithContext(ctx).Save(urlMapping).Error
+}
+
+func (s *GormStore) Delete(ctx context.Context, urlMapping models.UrlMapping) error {
+	return s.db.WithContext(ctx).Delete(&urlMapping).Error
+}
+
+func (s *GormStore) Taken(ctx context.Context, shortCode string) (bool, error) {
+	db := s.db.WithContext(ctx)
+	var count int64
+	err := db.Unscoped().Model(&models.UrlMapping{}).Where("short_code = ?", shortCode).Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+	err = db.Model(&models.LinkAlias{}).Where("short_code = ?", shortCode).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *GormStore) Restore(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	result := s.db.WithContext(ctx).Unscoped().Model(&models.UrlMapping{}).
+		Where("short_code = ? AND deleted_at IS NOT NULL", shortCode).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return models.UrlMapping{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.UrlMapping{}, ErrNotFound
+	}
+	return s.GetByCode(ctx, shortCode)
+}
+
+func (s *GormStore) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	db := s.db.WithContext(ctx)
+	var ids []uint
+	err := db.Unscoped().Model(&models.UrlMapping{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return RemoveLinks(tx, ids)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// RemoveLinks permanently deletes the links with the given IDs along with
+// their clicks, rollups, conversions, abuse reports and aliases. Run it in a
+// transaction.
+func RemoveLinks(tx *gorm.DB, ids []uint) error {
+	if err := tx.Where("url_mapping_id IN ?", ids).Delete(&models.ClickEvent{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("url_mapping_id IN ?", ids).Delete(&models.ClickRollup{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("url_mapping_id IN ?", ids).Delete(&models.ConversionEvent{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("url_mapping_id IN ?", ids).Delete(&models.AbuseReport{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("url_mapping_id IN ?", ids).Delete(&models.LinkAlias{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.UrlMapping{}, ids).Error
+}
+
+// OrganizationsOf returns a lookup of the organizations a user belongs to,
+// for stores that keep links outside db.
+func OrganizationsOf(db *gorm.DB) func(ctx context.Context, userID uint) ([]uint, error) {
+	return func(ctx context.Context, userID uint) ([]uint, error) {
+		var ids []uint
+		err := db.WithContext(ctx).Model(&models.Membership{}).Where("user_id = ?", userID).Pluck("organization_id", &ids).Error
+		return ids, err
+	}
+}
+
+func (s *GormStore) List(ctx context.Context, opts ListOptions) ([]models.UrlMapping, error) {
+	db := s.db.WithContext(ctx)
+	query := Paginate(db, "created_at", opts.After)
+	if opts.Deleted {
+		query = Paginate(db.Unscoped().Where("deleted_at IS NOT NULL"), "deleted_at", opts.After)
+	}
+	if opts.VisibleTo != nil {
+		memberOf := db.Model(&models.Membership{}).Select("organization_id").Where("user_id = ?", *opts.VisibleTo)
+		query = query.Where("owner_id = ? OR organization_id IN (?)", *opts.VisibleTo, memberOf)
+	}
+	if opts.OwnedBy != nil {
+		query = query.Where("owner_id = ?", *opts.OwnedBy)
+	}
+	if opts.IDs != nil {
+		query = query.Where("id IN ?", opts.IDs)
+	}
+	if opts.Managed != nil {
+		query = query.Where("managed = ?", *opts.Managed)
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+
+	var urlMappings []models.UrlMapping
+	err := query.Find(&urlMappings).Error
+	return urlMappings, err
+}
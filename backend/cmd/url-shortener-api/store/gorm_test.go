@@ -0,0 +1,24 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"url-shortener/config"
+	"url-shortener/db"
+)
+
+func TestGormStore(t *testing.T) {
+	testURLStore(t, func(t *testing.T) URLStore {
+		db.Connect(config.Config{
+			DBDriver:           "sqlite",
+			DBConnectionString: filepath.Join(t.TempDir(), "links.db"),
+			DBConnectAttempts:  1,
+		})
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Migrate("sqlite"); err != nil {
+			t.Fatalf("Migrate() error = %v", err)
+		}
+		return NewGormStore(db.DB, db.Replica)
+	})
+}
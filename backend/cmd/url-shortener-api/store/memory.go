@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+// MemoryStore keeps links in process memory. It's meant for demos and
+// tests: nothing survives a restart, and it only covers redirects and the
+// link CRUD endpoints. Everything that queries url_mappings directly skips
+// its links: the scheduled jobs (expiry, live dates, re-checks, click
+// thresholds and expiry notices), malicious link and abuse report
+// takedowns, and the dashboard's link and click totals.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	links    map[string]models.UrlMapping // by short code
+	nextID   uint
+	memberOf func(ctx context.Context, userID uint) ([]uint, error)
+}
+
+// NewMemoryStore returns an empty store. memberOf lists the organizations a
+// user belongs to, for ListOptions.VisibleTo; when nil, users only see the
+// links they own.
+func NewMemoryStore(memberOf func(ctx context.Context, userID uint) ([]uint, error)) *MemoryStore {
+	return &MemoryStore{links: make(map[string]models.UrlMapping), memberOf: memberOf}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, urlMapping *models.UrlMapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.links[urlMapping.ShortCode]; exists {
+		return fmt.Errorf("short code %q is already in use", urlMapping.ShortCode)
+	}
+
+	// Match the column defaults the database would fill in
+	if urlMapping.Status == "" {
+		urlMapping.Status = "pending"
+	}
+	if urlMapping.CheckInterval == 0 {
+		urlMapping.CheckInterval = 24
+	}
+	if urlMapping.CreatedAt.IsZero() {
+		urlMapping.CreatedAt = time.Now()
+	}
+	s.nextID++
+	urlMapping.ID = s.nextID
+
+	s.links[urlMapping.ShortCode] = cloneMapping(*urlMapping)
+	return nil
+}
+
+func (s *MemoryStore) GetByCode(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urlMapping, ok := s.links[shortCode]
+	if !ok || urlMapping.DeletedAt.Valid {
+		return models.UrlMapping{}, ErrNotFound
+	}
+	return cloneMapping(urlMapping), nil
+}
+
+func (s *MemoryStore) Lookup(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	return s.GetByCode(ctx, shortCode)
+}
+
+func (s *MemoryStore) Update(ctx context.Context, urlMapping *models.UrlMapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The short code may have changed, so find the link by ID
+	for shortCode, existing := range s.links {
+		if existing.ID != urlMapping.ID || existing.DeletedAt.Valid {
+			continue
+		}
+		if shortCode != urlMapping.ShortCode {
+			if _, taken := s.links[urlMapping.ShortCode]; taken {
+				return fmt.Errorf("short code %q is already in use", urlMapping.ShortCode)
+			}
+			delete(s.links, shortCode)
+		}
+		s.links[urlMapping.ShortCode] = cloneMapping(*urlMapping)
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, urlMapping models.UrlMapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.links[urlMapping.ShortCode]
+	if ok && !stored.DeletedAt.Valid {
+		stored.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		s.links[urlMapping.ShortCode] = stored
+	}
+	return nil
+}
+
+func (s *MemoryStore) Taken(ctx context.Context, shortCode string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.links[shortCode]
+	return ok, nil
+}
+
+func (s *MemoryStore) Restore(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urlMapping, ok := s.links[shortCode]
+	if !ok || !urlMapping.DeletedAt.Valid {
+		return models.UrlMapping{}, ErrNotFound
+	}
+	urlMapping.DeletedAt = gorm.DeletedAt{}
+	s.links[shortCode] = urlMapping
+	return cloneMapping(urlMapping), nil
+}
+
+func (s *MemoryStore) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for shortCode, urlMapping := range s.links {
+		if urlMapping.DeletedAt.Valid && urlMapping.DeletedAt.Time.Before(deletedBefore) {
+			delete(s.links, shortCode)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, opts ListOptions) ([]models.UrlMapping, error) {
+	var organizations map[uint]bool
+	if opts.VisibleTo != nil && s.memberOf != nil {
+		ids, err := s.memberOf(ctx, *opts.VisibleTo)
+		if err != nil {
+			return nil, err
+		}
+		organizations = make(map[uint]bool, len(ids))
+		for _, id := range ids {
+			organizations[id] = true
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urlMappings := []models.UrlMapping{}
+	for _, urlMapping := range s.links {
+		if urlMapping.DeletedAt.Valid != opts.Deleted {
+			continue
+		}
+		if opts.VisibleTo != nil {
+			owned := urlMapping.OwnerID != nil && *urlMapping.OwnerID == *opts.VisibleTo
+			shared := urlMapping.OrganizationID != nil && organizations[*urlMapping.OrganizationID]
+			if !owned && !shared {
+				continue
+			}
+		}
+		if opts.OwnedBy != nil && (urlMapping.OwnerID == nil || *urlMapping.OwnerID != *opts.OwnedBy) {
+			continue
+		}
+		if opts.IDs != nil && !slices.Contains(opts.IDs, urlMapping.ID) {
+			continue
+		}
+		if opts.Managed != nil && urlMapping.Managed != *opts.Managed {
+			continue
+		}
+		if opts.After != nil {
+			at := urlMapping.CreatedAt
+			if opts.Deleted {
+				at = urlMapping.DeletedAt.Time
+			}
+			if !opts.After.Before(at, urlMapping.ID) {
+				continue
+			}
+		}
+		urlMappings = append(urlMappings, cloneMapping(urlMapping))
+	}
+
+	sort.Slice(urlMappings, func(i, j int) bool {
+		a, b := urlMappings[i], urlMappings[j]
+		if opts.Deleted && !a.DeletedAt.Time.Equal(b.DeletedAt.Time) {
+			return a.DeletedAt.Time.After(b.DeletedAt.Time)
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	if opts.Limit > 0 && len(urlMappings) > opts.Limit {
+		urlMappings = urlMappings[:opts.Limit]
+	}
+	return urlMappings, nil
+}
+
+// cloneMapping copies urlMapping's maps, slices and pointers so callers can't change
+// a stored link without going through Update.
+func cloneMapping(urlMapping models.UrlMapping) models.UrlMapping {
+	urlMapping.Owner = nil
+	urlMapping.Organization = nil
+	urlMapping.OwnerID = clonePtr(urlMapping.OwnerID)
+	urlMapping.OrganizationID = clonePtr(urlMapping.OrganizationID)
+	urlMapping.IntendedLiveDate = clonePtr(urlMapping.IntendedLiveDate)
+	urlMapping.IntendedExpiryDate = clonePtr(urlMapping.IntendedExpiryDate)
+	urlMapping.ForwardQuery = clonePtr(urlMapping.ForwardQuery)
+	urlMapping.LanguageTargets = cloneStrings(urlMapping.LanguageTargets)
+	urlMapping.ResponseHeaders = cloneStrings(urlMapping.ResponseHeaders)
+	urlMapping.Tags = slices.Clone(urlMapping.Tags)
+	return urlMapping
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func cloneStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
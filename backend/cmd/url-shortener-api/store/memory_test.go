@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"url-shortener/models"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testURLStore(t, func(t *testing.T) URLStore {
+		return NewMemoryStore(nil)
+	})
+}
+
+func TestMemoryStoreUpdate(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(nil)
+	first := models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/abc"}
+	second := models.UrlMapping{ShortCode: "xyz", OriginalUrl: "https://example.com/xyz"}
+	for _, urlMapping := range []*models.UrlMapping{&first, &second} {
+		if err := s.Create(ctx, urlMapping); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unknown := models.UrlMapping{ID: 99, ShortCode: "new", OriginalUrl: "https://example.com/new"}
+	if err := s.Update(ctx, &unknown); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() of an unknown link error = %v, want ErrNotFound", err)
+	}
+
+	first.ShortCode = "xyz"
+	if err := s.Update(ctx, &first); err == nil {
+		t.Error("Update() onto another link's short code succeeded")
+	}
+	if got, err := s.GetByCode(ctx, "xyz"); err != nil || got.ID != second.ID {
+		t.Errorf("GetByCode() = %d, %v, want the second link %d", got.ID, err, second.ID)
+	}
+}
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(nil)
+	urlMapping := models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/abc", Tags: []string{"launch"}}
+	if err := s.Create(ctx, &urlMapping); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetByCode(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Tags[0] = "changed"
+	urlMapping.Tags[0] = "changed"
+
+	if again, _ := s.GetByCode(ctx, "abc"); again.Tags[0] != "launch" {
+		t.Errorf("stored tags = %v, want them unaffected by callers", again.Tags)
+	}
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"url-shortener/metrics"
+	"url-shortener/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces cached links in a shared Redis.
+const redisKeyPrefix = "link:"
+
+var cacheLookups = metrics.NewCounter("link_cache_lookups_total",
+	"Link lookups answered from Redis (hit), not cached there (miss), or failed over to the store (error).", "result")
+
+// CacheLookups returns how many link lookups Redis has answered (hits),
+// didn't have (misses) or failed on (failures) since startup.
+func CacheLookups() (hits, misses, failures float64) {
+	return cacheLookups.Value("hit"), cacheLookups.Value("miss"), cacheLookups.Value("error")
+}
+
+// RedisCache is a read-through cache of Lookup calls in front of another
+// store. Writes through it invalidate the link's cache entry; code that
+// changes links directly in the database should call Invalidate.
+type RedisCache struct {
+	URLStore
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisCache caches next's Lookup results in client for ttl.
+func NewRedisCache(next URLStore, client *redis.Client, ttl time.Duration) *RedisCache {
+	return &RedisCache{URLStore: next, client: client, ttl: ttl}
+}
+
+// Lookup serves the link from Redis when it can. Redis errors fall back to
+// the underlying store, so an outage only costs latency.
+func (c *RedisCache) Lookup(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	key := redisKeyPrefix + shortCode
+
+	cached, err := c.client.Get(ctx, key).Bytes()
+	if err == nil {
+		var urlMapping models.UrlMapping
+		if err := json.Unmarshal(cached, &urlMapping); err == nil {
+			cacheLookups.Inc("hit")
+			return urlMapping, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Println("Error reading link from Redis:", err)
+		cacheLookups.Inc("error")
+	} else {
+		cacheLookups.Inc("miss")
+	}
+
+	urlMapping, err := c.URLStore.Lookup(ctx, shortCode)
+	if err != nil {
+		return urlMapping, err
+	}
+	c.set(ctx, urlMapping)
+	return urlMapping, nil
+}
+
+// Warm reloads the given links from the underlying store into Redis,
+// resetting their TTL, and returns how many it cached.
+func (c *RedisCache) Warm(ctx context.Context, shortCodes ...string) int {
+	warmed := 0
+	for _, shortCode := range shortCodes {
+		urlMapping, err := c.URLStore.Lookup(ctx, shortCode)
+		if err != nil {
+			continue
+		}
+		if c.set(ctx, urlMapping) {
+			warmed++
+		}
+	}
+	return warmed
+}
+
+func (c *RedisCache) set(ctx context.Context, urlMapping models.UrlMapping) bool {
+	encoded, err := json.Marshal(urlMapping)
+	if err != nil {
+		return false
+	}
+	if err := c.client.Set(ctx, redisKeyPrefix+urlMapping.ShortCode, encoded, c.ttl).Err(); err != nil {
+		log.Println("Error caching link in Redis:", err)
+		return false
+	}
+	return true
+}
+
+func (c *RedisCache) Update(ctx context.Context, urlMapping *models.UrlMapping) error {
+	err := c.URLStore.Update(ctx, urlMapping)
+	c.Invalidate(urlMapping.ShortCode)
+	return err
+}
+
+func (c *RedisCache) Delete(ctx context.Context, urlMapping models.UrlMapping) error {
+	err := c.URLStore.Delete(ctx, urlMapping)
+	c.Invalidate(urlMapping.ShortCode)
+	return err
+}
+
+func (c *RedisCache) Restore(ctx context.Context, shortCode string) (models.UrlMapping, error) {
+	urlMapping, err := c.URLStore.Restore(ctx, shortCode)
+	c.Invalidate(shortCode)
+	return urlMapping, err
+}
+
+// Ping checks that Redis is reachable.
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis client.
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+// Invalidate drops the cached copies of the given links. It doesn't take the
+// caller's context: a write that went through must not leave a stale entry
+// behind because the request then timed out.
+func (c *RedisCache) Invalidate(shortCodes ...string) {
+	if len(shortCodes) == 0 {
+		return
+	}
+	keys := make([]string, len(shortCodes))
+	for i, shortCode := range shortCodes {
+		keys[i] = redisKeyPrefix + shortCode
+	}
+	if err := c.client.Del(context.Background(), keys...).Err(); err != nil {
+		log.Println("Error invalidating links in Redis:", err)
+	}
+}
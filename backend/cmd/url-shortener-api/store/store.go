@@ -0,0 +1,95 @@
+// Package store hides how links are persisted from the handlers that use
+// them, so handlers can run against fakes and other backends.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"url-shortener/models"
+)
+
+// ErrNotFound is returned when no link has the requested short code.
+var ErrNotFound = errors.New("link not found")
+
+// Links is the store handlers read and write links through. It's set at
+// startup, once the database is connected.
+var Links URLStore
+
+// URLStore persists links. Every method stops waiting on the backend once
+// ctx is done.
+type URLStore interface {
+	// Create stores a new link, filling in its ID and creation time.
+	Create(ctx context.Context, urlMapping *models.UrlMapping) error
+	// GetByCode returns the link with the given short code, or ErrNotFound.
+	GetByCode(ctx context.Context, shortCode string) (models.UrlMapping, error)
+	// Lookup is GetByCode for hot read paths such as redirects. It may
+	// return a link as it was a moment ago, so don't use it to read back
+	// a write.
+	Lookup(ctx context.Context, shortCode string) (models.UrlMapping, error)
+	// Update saves every field of an existing link.
+	Update(ctx context.Context, urlMapping *models.UrlMapping) error
+	// Delete soft-deletes a link. It disappears from every other method
+	// but keeps its short code, clicks and conversions until it's restored
+	// or purged.
+	Delete(ctx context.Context, urlMapping models.UrlMapping) error
+	// List returns links matching opts, newest first.
+	List(ctx context.Context, opts ListOptions) ([]models.UrlMapping, error)
+	// Taken reports whether a link uses shortCode, counting deleted links
+	// and the aliases merged links leave behind.
+	Taken(ctx context.Context, shortCode string) (bool, error)
+	// Restore undeletes the link with the given short code, or returns
+	// ErrNotFound if no deleted link has it.
+	Restore(ctx context.Context, shortCode string) (models.UrlMapping, error)
+	// Purge permanently removes links deleted before deletedBefore, with
+	// their clicks and conversions, and returns how many it removed.
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+}
+
+// Invalidate tells the store that the given links were changed directly in
+// the database, so any cached copies must be dropped.
+func Invalidate(shortCodes ...string) {
+	if cache, ok := Links.(interface{ Invalidate(...string) }); ok {
+		cache.Invalidate(shortCodes...)
+	}
+}
+
+// Warm asks a caching store to load the given links ahead of demand,
+// refreshing their entries. It returns how many were cached, and does
+// nothing without a cache.
+func Warm(ctx context.Context, shortCodes ...string) int {
+	if cache, ok := Links.(interface {
+		Warm(context.Context, ...string) int
+	}); ok {
+		return cache.Warm(ctx, shortCodes...)
+	}
+	return 0
+}
+
+// Ping checks that the store's cache, if it has one, is reachable.
+func Ping(ctx context.Context) error {
+	if cache, ok := Links.(interface{ Ping(context.Context) error }); ok {
+		return cache.Ping(ctx)
+	}
+	return nil
+}
+
+// Close releases the store's cache connections, if it has any.
+func Close() error {
+	if cache, ok := Links.(interface{ Close() error }); ok {
+		return cache.Close()
+	}
+	return nil
+}
+
+// ListOptions filters a List call. Zero values don't filter.
+type ListOptions struct {
+	VisibleTo *uint   // only links owned by this user or shared with their organizations
+	OwnedBy   *uint   // only links owned by this user
+	IDs       []uint  // only links with these IDs
+	Managed   *bool   // only links that are, or aren't, provisioned declaratively
+	Deleted   bool    // only deleted links, most recently deleted first
+	After     *Cursor // start after this position in the list order
+	Limit     int
+}
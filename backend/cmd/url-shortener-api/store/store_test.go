@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shortener/models"
+)
+
+// testURLStore checks the URLStore contract every backend has to meet.
+// newStore returns an empty store.
+func testURLStore(t *testing.T, newStore func(t *testing.T) URLStore) {
+	ctx := context.Background()
+	create := func(t *testing.T, s URLStore, shortCode string) models.UrlMapping {
+		t.Helper()
+		urlMapping := models.UrlMapping{ShortCode: shortCode, OriginalUrl: "https://example.com/" + shortCode}
+		if err := s.Create(ctx, &urlMapping); err != nil {
+			t.Fatalf("Create(%s) error = %v", shortCode, err)
+		}
+		return urlMapping
+	}
+
+	t.Run("create and read back", func(t *testing.T) {
+		s := newStore(t)
+		created := create(t, s, "abc")
+		if created.ID == 0 || created.CreatedAt.IsZero() {
+			t.Fatalf("Create() left ID %d, CreatedAt %v", created.ID, created.CreatedAt)
+		}
+		if created.Status != "pending" || created.CheckInterval != 24 {
+			t.Errorf("Create() status %q, check interval %d, want the column defaults", created.Status, created.CheckInterval)
+		}
+
+		for name, get := range map[string]func(context.Context, string) (models.UrlMapping, error){
+			"GetByCode": s.GetByCode,
+			"Lookup":    s.Lookup,
+		} {
+			got, err := get(ctx, "abc")
+			if err != nil {
+				t.Fatalf("%s() error = %v", name, err)
+			}
+			if got.ID != created.ID || got.OriginalUrl != created.OriginalUrl {
+				t.Errorf("%s() = %d %q, want %d %q", name, got.ID, got.OriginalUrl, created.ID, created.OriginalUrl)
+			}
+		}
+	})
+
+	t.Run("create conflict", func(t *testing.T) {
+		s := newStore(t)
+		create(t, s, "abc")
+		duplicate := models.UrlMapping{ShortCode: "abc", OriginalUrl: "https://example.com/other"}
+		if err := s.Create(ctx, &duplicate); err == nil {
+			t.Fatal("Create() of a taken short code succeeded")
+		}
+		got, err := s.GetByCode(ctx, "abc")
+		if err != nil || got.OriginalUrl != "https://example.com/abc" {
+			t.Errorf("GetByCode() = %q, %v, want the first link", got.OriginalUrl, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.GetByCode(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByCode() error = %v, want ErrNotFound", err)
+		}
+		if _, err := s.Lookup(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Lookup() error = %v, want ErrNotFound", err)
+		}
+		if _, err := s.Restore(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Restore() error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		s := newStore(t)
+		urlMapping := create(t, s, "abc")
+		urlMapping.OriginalUrl = "https://example.com/changed"
+		urlMapping.Status = "live"
+		urlMapping.Tags = []string{"launch"}
+		if err := s.Update(ctx, &urlMapping); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+
+		got, err := s.GetByCode(ctx, "abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.OriginalUrl != "https://example.com/changed" || got.Status != "live" || len(got.Tags) != 1 {
+			t.Errorf("GetByCode() after Update() = %q %q %v", got.OriginalUrl, got.Status, got.Tags)
+		}
+	})
+
+	t.Run("update changes the short code", func(t *testing.T) {
+		s := newStore(t)
+		urlMapping := create(t, s, "abc")
+		urlMapping.ShortCode = "xyz"
+		if err := s.Update(ctx, &urlMapping); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		if _, err := s.GetByCode(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByCode() of the old code error = %v, want ErrNotFound", err)
+		}
+		if got, err := s.GetByCode(ctx, "xyz"); err != nil || got.ID != urlMapping.ID {
+			t.Errorf("GetByCode() of the new code = %d, %v, want %d", got.ID, err, urlMapping.ID)
+		}
+	})
+
+	t.Run("delete, restore and purge", func(t *testing.T) {
+		s := newStore(t)
+		urlMapping := create(t, s, "abc")
+		if err := s.Delete(ctx, urlMapping); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, err := s.GetByCode(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByCode() of a deleted link error = %v, want ErrNotFound", err)
+		}
+		if taken, err := s.Taken(ctx, "abc"); err != nil || !taken {
+			t.Errorf("Taken() of a deleted link = %v, %v, want true", taken, err)
+		}
+		if deleted, err := s.List(ctx, ListOptions{Deleted: true}); err != nil || len(deleted) != 1 {
+			t.Errorf("List(Deleted) = %d links, %v, want 1", len(deleted), err)
+		}
+
+		if _, err := s.Restore(ctx, "abc"); err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if _, err := s.GetByCode(ctx, "abc"); err != nil {
+			t.Errorf("GetByCode() of a restored link error = %v", err)
+		}
+
+		if err := s.Delete(ctx, urlMapping); err != nil {
+			t.Fatal(err)
+		}
+		if purged, err := s.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+			t.Errorf("Purge() of links deleted later = %d, %v, want 0", purged, err)
+		}
+		if purged, err := s.Purge(ctx, time.Now().Add(time.Hour)); err != nil || purged != 1 {
+			t.Errorf("Purge() = %d, %v, want 1", purged, err)
+		}
+		if taken, err := s.Taken(ctx, "abc"); err != nil || taken {
+			t.Errorf("Taken() of a purged link = %v, %v, want false", taken, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		s := newStore(t)
+		owner := uint(7)
+		first := create(t, s, "a")
+		second := models.UrlMapping{ShortCode: "b", OriginalUrl: "https://example.com/b", OwnerID: &owner, Managed: true}
+		if err := s.Create(ctx, &second); err != nil {
+			t.Fatal(err)
+		}
+		third := create(t, s, "c")
+
+		managed := true
+		tests := []struct {
+			name string
+			opts ListOptions
+			want []string
+		}{
+			{name: "everything, newest first", want: []string{"c", "b", "a"}},
+			{name: "limit", opts: ListOptions{Limit: 2}, want: []string{"c", "b"}},
+			{name: "after a cursor", opts: ListOptions{After: &Cursor{Time: third.CreatedAt, ID: third.ID}}, want: []string{"b", "a"}},
+			{name: "visible", opts: ListOptions{VisibleTo: &owner}, want: []string{"b"}},
+			{name: "owned", opts: ListOptions{OwnedBy: &owner}, want: []string{"b"}},
+			{name: "by ID", opts: ListOptions{IDs: []uint{first.ID, third.ID}}, want: []string{"c", "a"}},
+			{name: "managed", opts: ListOptions{Managed: &managed}, want: []string{"b"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				urlMappings, err := s.List(ctx, tt.opts)
+				if err != nil {
+					t.Fatalf("List() error = %v", err)
+				}
+				var got []string
+				for _, urlMapping := range urlMappings {
+					got = append(got, urlMapping.ShortCode)
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("List() = %v, want %v", got, tt.want)
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Fatalf("List() = %v, want %v", got, tt.want)
+					}
+				}
+			})
+		}
+	})
+}
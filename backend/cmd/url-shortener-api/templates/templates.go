@@ -0,0 +1,94 @@
+package templates
+
+import (
+	"embed"
+	"html/template"
+	"io"
+)
+
+//go:embed *.html
+var files embed.FS
+
+var (
+	interstitial = template.Must(template.ParseFS(files, "interstitial.html"))
+	dereferrer   = template.Must(template.ParseFS(files, "dereferrer.html"))
+	fallback     = template.Must(template.ParseFS(files, "fallback.html"))
+	warning      = template.Must(template.ParseFS(files, "warning.html"))
+	download     = template.Must(template.ParseFS(files, "download.html"))
+	quick        = template.Must(template.ParseFS(files, "quick.html"))
+)
+
+// InterstitialData is passed to the countdown page template.
+type InterstitialData struct {
+	ShortCode    string
+	Destination  string
+	Seconds      int
+	HideReferrer bool
+}
+
+// DereferrerData is passed to the referrer-stripping hop page.
+type DereferrerData struct {
+	Destination string
+}
+
+// FallbackData is passed to the script-free landing page for constrained browsers.
+type FallbackData struct {
+	Destination  string
+	HideReferrer bool
+}
+
+// WarningData is passed to the warning pages shown for flagged links and
+// risky downloads.
+type WarningData struct {
+	ShortCode   string
+	Destination string
+	ProceedURL  string // empty when visitors may not continue
+}
+
+// QuickData is passed to the page showing a link made by /api/quick. Error
+// is set instead of ShortURL when the link couldn't be made.
+type QuickData struct {
+	ShortURL    string
+	Destination string
+	Error       string
+}
+
+// UseInterstitialFile replaces the built-in countdown page with a custom template.
+func UseInterstitialFile(path string) error {
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return err
+	}
+	interstitial = tmpl
+	return nil
+}
+
+// RenderInterstitial writes the countdown page for data to w.
+func RenderInterstitial(w io.Writer, data InterstitialData) error {
+	return interstitial.Execute(w, data)
+}
+
+// RenderDereferrer writes a page that forwards to the destination without a referrer.
+func RenderDereferrer(w io.Writer, data DereferrerData) error {
+	return dereferrer.Execute(w, data)
+}
+
+// RenderFallback writes a plain page with a single large link to the destination.
+func RenderFallback(w io.Writer, data FallbackData) error {
+	return fallback.Execute(w, data)
+}
+
+// RenderWarning writes the interstitial warning page for a flagged link.
+func RenderWarning(w io.Writer, data WarningData) error {
+	return warning.Execute(w, data)
+}
+
+// RenderDownloadWarning writes the page shown before a risky file download.
+func RenderDownloadWarning(w io.Writer, data WarningData) error {
+	return download.Execute(w, data)
+}
+
+// RenderQuick writes the page showing a quick-shortened link, selected for copying.
+func RenderQuick(w io.Writer, data QuickData) error {
+	return quick.Execute(w, data)
+}
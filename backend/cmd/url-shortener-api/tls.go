@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"url-shortener/config"
+	"url-shortener/customdomains"
+)
+
+// configureTLS sets up server to serve HTTPS when cfg has certificate files
+// or autocert domains. It returns the server that redirects plain HTTP to
+// HTTPS, or nil when TLS or the redirect is off.
+func configureTLS(cfg config.Config, server *http.Server) *http.Server {
+	var challenges func(http.Handler) http.Handler
+	switch {
+	case len(cfg.AutocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocertHostPolicy(cfg.AutocertDomains),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		// Also answers TLS-ALPN challenges, so port 80 isn't required
+		server.TLSConfig = manager.TLSConfig()
+		challenges = manager.HTTPHandler
+	case cfg.TLSCertFile != "":
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	default:
+		return nil
+	}
+
+	if cfg.HTTPRedirectPort == "" {
+		return nil
+	}
+	handler := redirectToHTTPS(cfg.Port)
+	if challenges != nil {
+		handler = challenges(handler)
+	}
+	return &http.Server{Addr: ":" + cfg.HTTPRedirectPort, Handler: handler, ReadHeaderTimeout: cfg.ReadHeaderTimeout, IdleTimeout: cfg.IdleTimeout}
+}
+
+// autocertHostPolicy allows certificates for domains and for verified
+// custom domains, so links on those are served over HTTPS too.
+func autocertHostPolicy(domains []string) autocert.HostPolicy {
+	allowed := autocert.HostWhitelist(domains...)
+	return func(ctx context.Context, host string) error {
+		if _, ok := customdomains.Verified(host); ok {
+			return nil
+		}
+		return allowed(ctx, host)
+	}
+}
+
+// redirectToHTTPS sends every request to the same host and path over HTTPS
+// on port. The redirect is permanent and keeps the method, so API clients
+// posting to the plain HTTP address aren't silently turned into GETs.
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// accountDeletionAudience keeps deletion confirmation tokens apart from the
+// other tokens signed with the JWT secret.
+const accountDeletionAudience = "account-deletion"
+
+var (
+	ErrDeletionTokenInvalid = errors.New("invalid account deletion token")
+	ErrDeletionTokenExpired = errors.New("account deletion token has expired")
+)
+
+// GenerateAccountDeletionToken signs a token confirming the account
+// deletion deletionID, valid until expiresAt.
+func GenerateAccountDeletionToken(secret string, deletionID uint, expiresAt time.Time) (string, error) {
+	return signRecordToken(secret, accountDeletionAudience, deletionID, expiresAt)
+}
+
+// ValidateAccountDeletionToken checks the signature and expiry of token and
+// returns the account deletion it confirms.
+func ValidateAccountDeletionToken(secret, token string) (uint, error) {
+	deletionID, err := parseRecordToken(secret, accountDeletionAudience, token)
+	switch {
+	case err == nil, errors.Is(err, ErrJWTSecretMissing):
+		return deletionID, err
+	case errors.Is(err, errRecordTokenExpired):
+		return 0, ErrDeletionTokenExpired
+	default:
+		return 0, ErrDeletionTokenInvalid
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidAlias  = errors.New("alias must be 1-32 letters, digits, '-' or '_' and start with a letter or digit")
+	ErrReservedAlias = errors.New("alias is reserved")
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,31}$`)
+
+// reservedAliases collide with top-level routes and can't be used as short codes.
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"collect": true,
+	"docs":    true,
+	"healthz": true,
+	"metrics": true,
+	"readyz":  true,
+	"shorten": true,
+	"version": true,
+}
+
+// ValidateAlias checks that alias can be used as a custom short code.
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return ErrInvalidAlias
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: %s", ErrReservedAlias, alias)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix marks bearer tokens that are API keys rather than JWTs.
+const APIKeyPrefix = "usk_"
+
+// GenerateAPIKey returns a new random API key, the short prefix shown to
+// identify it, and the hash to store in its place.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, key[:len(APIKeyPrefix)+8], HashAPIKey(key), nil
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashAPIKey returns the stored form of an API key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
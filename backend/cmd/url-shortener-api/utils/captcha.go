@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// captchaVerifyURLs are the siteverify endpoints of the supported CAPTCHA
+// providers. Both take the same form fields and answer in the same shape.
+var captchaVerifyURLs = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+type captchaResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"` // reCAPTCHA v3 only
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// VerifyCaptcha checks a CAPTCHA token a client solved with the provider.
+// reCAPTCHA v3 tokens must also score at least minScore. It returns false
+// with a nil error when the token is simply wrong.
+func VerifyCaptcha(ctx context.Context, provider, secret, token, remoteIP string, minScore float64) (bool, error) {
+	endpoint, ok := captchaVerifyURLs[provider]
+	if !ok {
+		return false, fmt.Errorf("unknown CAPTCHA provider %q", provider)
+	}
+
+	form := url.Values{"secret": {secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s siteverify returned status %d", provider, resp.StatusCode)
+	}
+
+	var result captchaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	if !result.Success {
+		return false, nil
+	}
+	if result.Score != nil && *result.Score < minScore {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the networks whose X-Forwarded-For headers are believed.
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the reverse proxies, as IPs or CIDR ranges, that
+// ClientIP trusts to report the original client in X-Forwarded-For.
+func SetTrustedProxies(proxies []string) error {
+	networks, err := ParseNetworks(proxies)
+	if err != nil {
+		return err
+	}
+	trustedProxies = networks
+	return nil
+}
+
+// ParseNetworks parses a list of IPs and CIDR ranges, treating a bare IP as
+// a network of one address.
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// InNetworks reports whether host is an IP address within any of networks.
+func InNetworks(host string, networks []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that made r. When the request
+// came through trusted proxies, X-Forwarded-For is walked from the right,
+// skipping them, so a client can't spoof its address by sending the header.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// ClientNetwork returns what a client IP from ClientIP stands for when
+// counting different clients: IPv4 addresses as they are, and IPv6 ones as
+// their /64, since a single subscriber is routinely handed a whole /64.
+func ClientNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	mask := net.CIDRMask(64, 128)
+	return (&net.IPNet{IP: parsed.Mask(mask), Mask: mask}).String()
+}
+
+func isTrustedProxy(host string) bool {
+	return InNetworks(host, trustedProxies)
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For headers, in order
+		want       string
+	}{
+		{name: "no proxies", remoteAddr: "192.0.2.1:4000", want: "192.0.2.1"},
+		{name: "header from an untrusted client", remoteAddr: "192.0.2.1:4000", forwarded: []string{"203.0.113.9"}, want: "192.0.2.1"},
+		{name: "trusted proxy", proxies: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:4000", forwarded: []string{"203.0.113.9"}, want: "203.0.113.9"},
+		{name: "trusted proxy without the header", proxies: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:4000", want: "10.0.0.1"},
+		{
+			name:       "spoofed leftmost hop",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"198.51.100.66, 203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "chain of trusted proxies",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.9, 10.0.0.3, 10.0.0.2"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "several headers",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"198.51.100.66", "203.0.113.9, 10.0.0.2"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "garbage hop",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"203.0.113.9, not-an-ip, 10.0.0.2"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "every hop trusted",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:4000",
+			forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{name: "IPv6", proxies: []string{"2001:db8::/32"}, remoteAddr: "[2001:db8::1]:4000", forwarded: []string{"2001:db9::5"}, want: "2001:db9::5"},
+		{name: "remote address without a port", remoteAddr: "192.0.2.1", want: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { SetTrustedProxies(nil) })
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		in      []string
+		out     []string
+		wantErr bool
+	}{
+		{name: "IPv4 address", entries: []string{"192.0.2.1"}, in: []string{"192.0.2.1"}, out: []string{"192.0.2.2"}},
+		{name: "IPv4 range", entries: []string{"192.0.2.0/24"}, in: []string{"192.0.2.1", "192.0.2.255"}, out: []string{"192.0.3.1"}},
+		{name: "IPv6 address", entries: []string{"2001:db8::1"}, in: []string{"2001:db8::1"}, out: []string{"2001:db8::2"}},
+		{name: "not an IP", entries: []string{"192.0.2.1", "example.com"}, out: []string{"example.com"}, wantErr: true},
+		{name: "bad range", entries: []string{"192.0.2.0/33"}, wantErr: true},
+		{name: "none", out: []string{"192.0.2.1", "garbage"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := ParseNetworks(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetworks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, host := range tt.in {
+				if !InNetworks(host, networks) {
+					t.Errorf("%s isn't in %v", host, tt.entries)
+				}
+			}
+			for _, host := range tt.out {
+				if InNetworks(host, networks) {
+					t.Errorf("%s is in %v", host, tt.entries)
+				}
+			}
+		})
+	}
+}
+
+func TestClientNetwork(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "192.0.2.1", want: "192.0.2.1"},
+		{ip: "::ffff:192.0.2.1", want: "::ffff:192.0.2.1"},
+		{ip: "2001:db8:1:2:3:4:5:6", want: "2001:db8:1:2::/64"},
+		{ip: "2001:db8:1:2::9", want: "2001:db8:1:2::/64"},
+		{ip: "2001:db8:1:3::9", want: "2001:db8:1:3::/64"},
+		{ip: "not an ip", want: "not an ip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := ClientNetwork(tt.ip); got != tt.want {
+				t.Errorf("ClientNetwork(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Download types recorded for link destinations.
+const (
+	DownloadNone  = ""      // a web page
+	DownloadFile  = "file"  // a direct file download
+	DownloadRisky = "risky" // an executable, installer or archive
+)
+
+// riskyContentTypes are MIME types of executables, installers and archives.
+var riskyContentTypes = map[string]bool{
+	"application/x-msdownload":                      true,
+	"application/x-msdos-program":                   true,
+	"application/x-msi":                             true,
+	"application/x-executable":                      true,
+	"application/x-sh":                              true,
+	"application/vnd.microsoft.portable-executable": true,
+	"application/vnd.android.package-archive":       true,
+	"application/x-apple-diskimage":                 true,
+	"application/java-archive":                      true,
+	"application/zip":                               true,
+	"application/x-zip-compressed":                  true,
+	"application/vnd.rar":                           true,
+	"application/x-rar-compressed":                  true,
+	"application/x-7z-compressed":                   true,
+	"application/x-tar":                             true,
+	"application/gzip":                              true,
+	"application/x-iso9660-image":                   true,
+}
+
+// riskyExtensions are file extensions of executables, scripts and archives.
+var riskyExtensions = map[string]bool{
+	".exe": true, ".msi": true, ".bat": true, ".cmd": true, ".scr": true,
+	".com": true, ".ps1": true, ".vbs": true, ".sh": true, ".apk": true,
+	".dmg": true, ".pkg": true, ".jar": true, ".zip": true, ".rar": true,
+	".7z": true, ".tar": true, ".gz": true, ".iso": true,
+}
+
+// ClassifyDownload works out whether a response with the given Content-Type
+// and Content-Disposition headers from rawURL is a web page, a file
+// download, or a risky download such as an executable or archive.
+func ClassifyDownload(rawURL, contentType, disposition string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var filename string
+	attachment := false
+	if dispositionType, params, err := mime.ParseMediaType(disposition); err == nil {
+		attachment = dispositionType == "attachment"
+		filename = params["filename"]
+	}
+	if filename == "" {
+		if parsedURL, err := url.Parse(rawURL); err == nil {
+			filename = path.Base(parsedURL.Path)
+		}
+	}
+
+	isPage := mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	if isPage && !attachment {
+		return DownloadNone
+	}
+	if riskyContentTypes[mediaType] || riskyExtensions[strings.ToLower(path.Ext(filename))] {
+		return DownloadRisky
+	}
+	return DownloadFile
+}
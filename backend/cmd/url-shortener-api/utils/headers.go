@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxResponseHeaders     = 10
+	maxResponseHeaderValue = 256
+)
+
+var (
+	ErrTooManyHeaders     = errors.New("too many response headers")
+	ErrHeaderNotAllowed   = errors.New("response header is not allowed")
+	ErrInvalidHeaderValue = errors.New("invalid response header value")
+)
+
+// allowedResponseHeaders are the headers links may set on their redirect.
+// Anything that could change how the redirect itself is interpreted
+// (Location, Set-Cookie, Content-*) is deliberately left out.
+var allowedResponseHeaders = map[string]bool{
+	"Cache-Control":   true,
+	"Referrer-Policy": true,
+	"X-Robots-Tag":    true,
+	"Link":            true,
+}
+
+// ValidateResponseHeaders checks per-link response headers against the
+// allowlist and returns them with canonicalized names.
+func ValidateResponseHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if len(headers) > maxResponseHeaders {
+		return nil, fmt.Errorf("%w: maximum is %d", ErrTooManyHeaders, maxResponseHeaders)
+	}
+
+	canonical := make(map[string]string, len(headers))
+	for name, value := range headers {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if !allowedResponseHeaders[name] {
+			return nil, fmt.Errorf("%w: %s", ErrHeaderNotAllowed, name)
+		}
+		if len(value) > maxResponseHeaderValue || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHeaderValue, name)
+		}
+		canonical[name] = value
+	}
+	return canonical, nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// inviteAudience keeps invite tokens and access tokens from being mistaken
+// for one another, since both are signed with the JWT secret.
+const inviteAudience = "org-invite"
+
+var (
+	ErrInviteTokenInvalid = errors.New("invalid invite token")
+	ErrInviteTokenExpired = errors.New("invite token has expired")
+)
+
+// GenerateInviteToken signs a token naming inviteID that is valid until expiresAt.
+func GenerateInviteToken(secret string, inviteID uint, expiresAt time.Time) (string, error) {
+	return signRecordToken(secret, inviteAudience, inviteID, expiresAt)
+}
+
+// ValidateInviteToken checks the signature and expiry of token and returns
+// the invitation it names.
+func ValidateInviteToken(secret, token string) (uint, error) {
+	inviteID, err := parseRecordToken(secret, inviteAudience, token)
+	switch {
+	case err == nil, errors.Is(err, ErrJWTSecretMissing):
+		return inviteID, err
+	case errors.Is(err, errRecordTokenExpired):
+		return 0, ErrInviteTokenExpired
+	default:
+		return 0, ErrInviteTokenInvalid
+	}
+}
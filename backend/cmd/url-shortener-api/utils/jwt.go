@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrJWTSecretMissing   = errors.New("JWT secret is not set")
+	ErrAccessTokenInvalid = errors.New("invalid access token")
+)
+
+// GenerateAccessToken signs a JWT identifying userID and their login session
+// that is valid until now+ttl.
+func GenerateAccessToken(secret string, userID, sessionID uint, ttl time.Duration) (string, time.Time, error) {
+	if secret == "" {
+		return "", time.Time{}, ErrJWTSecretMissing
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expiresAt := now.Add(ttl)
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		ID:        strconv.FormatUint(uint64(sessionID), 10),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// ValidateAccessToken checks the signature and expiry of token and returns
+// the user and session IDs it was issued for.
+func ValidateAccessToken(secret, token string) (uint, uint, error) {
+	if secret == "" {
+		return 0, 0, ErrJWTSecretMissing
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, 0, ErrAccessTokenInvalid
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || userID == 0 {
+		return 0, 0, ErrAccessTokenInvalid
+	}
+	sessionID, err := strconv.ParseUint(claims.ID, 10, 64)
+	if err != nil || sessionID == 0 {
+		return 0, 0, ErrAccessTokenInvalid
+	}
+	return uint(userID), uint(sessionID), nil
+}
+
+// GenerateRefreshToken returns a new random refresh token and the hash to
+// store in its place.
+func GenerateRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the stored form of a refresh token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func TestValidateAccessToken(t *testing.T) {
+	mustAccess := func(secret string, ttl time.Duration) string {
+		token, _, err := GenerateAccessToken(secret, 7, 3, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := mustAccess(testSecret, time.Hour)
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.RegisteredClaims{
+		Subject: "7", ID: "3", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))
+
+	tests := []struct {
+		name        string
+		secret      string
+		token       string
+		wantUser    uint
+		wantSession uint
+		wantErr     error
+	}{
+		{name: "valid", secret: testSecret, token: valid, wantUser: 7, wantSession: 3},
+		{name: "other secret", secret: "other-secret", token: valid, wantErr: ErrAccessTokenInvalid},
+		{name: "expired", secret: testSecret, token: mustAccess(testSecret, -time.Minute), wantErr: ErrAccessTokenInvalid},
+		{name: "no secret", secret: "", token: valid, wantErr: ErrJWTSecretMissing},
+		{name: "alg none", secret: testSecret, token: unsigned, wantErr: ErrAccessTokenInvalid},
+		{name: "tampered signature", secret: testSecret, token: tampered, wantErr: ErrAccessTokenInvalid},
+		{name: "garbage", secret: testSecret, token: "not.a.token", wantErr: ErrAccessTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, sessionID, err := ValidateAccessToken(tt.secret, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateAccessToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if userID != tt.wantUser || sessionID != tt.wantSession {
+				t.Errorf("ValidateAccessToken() = %d, %d, want %d, %d", userID, sessionID, tt.wantUser, tt.wantSession)
+			}
+		})
+	}
+}
+
+func TestGenerateRefreshToken(t *testing.T) {
+	token, hash, err := GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != HashRefreshToken(token) {
+		t.Errorf("GenerateRefreshToken() hash = %s, want HashRefreshToken of the token", hash)
+	}
+	if hash == token || strings.Contains(hash, token) {
+		t.Errorf("GenerateRefreshToken() hash %s gives away the token", hash)
+	}
+
+	other, otherHash, err := GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token || otherHash == hash {
+		t.Error("GenerateRefreshToken() returned the same token twice")
+	}
+	if HashRefreshToken(token+"x") == hash {
+		t.Error("HashRefreshToken() matched a different token")
+	}
+}
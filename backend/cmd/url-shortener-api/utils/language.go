@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+var ErrInvalidLanguageTag = errors.New("invalid language tag")
+
+// ValidateLanguageTargets checks that every key is a BCP 47 language tag and
+// every destination passes the same URL checks as the main destination.
+func ValidateLanguageTargets(targets map[string]string) error {
+	for tag, target := range targets {
+		if _, err := language.Parse(tag); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidLanguageTag, tag)
+		}
+		if err := ValidateURLSyntax(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MatchLanguageTarget picks the destination from targets that best matches
+// an Accept-Language header. It reports false when nothing matches well
+// enough, in which case the link's default destination should be used.
+func MatchLanguageTarget(acceptLanguage string, targets map[string]string) (string, bool) {
+	if len(targets) == 0 || acceptLanguage == "" {
+		return "", false
+	}
+
+	desired, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(desired) == 0 {
+		return "", false
+	}
+
+	// The first supported tag is what the matcher falls back to, so Und
+	// stands in for "no override".
+	supported := []language.Tag{language.Und}
+	keys := []string{""}
+	for key := range targets {
+		tag, err := language.Parse(key)
+		if err != nil {
+			continue
+		}
+		supported = append(supported, tag)
+		keys = append(keys, key)
+	}
+
+	_, index, confidence := language.NewMatcher(supported).Match(desired...)
+	if index == 0 || confidence == language.No {
+		return "", false
+	}
+	return targets[keys[index]], true
+}
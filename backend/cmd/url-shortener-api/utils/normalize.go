@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NormalizeURL returns the spelling of a destination that its trivially
+// different variants share, for finding duplicate links: https for http,
+// a lowercase host without its default port, no trailing slash, no utm_
+// parameters, the other parameters sorted, and no empty fragment. URLs
+// that don't parse are returned as they are.
+func NormalizeURL(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Scheme == "http" {
+		parsed.Scheme = "https"
+	}
+	parsed.Host = strings.ToLower(parsed.Host)
+	if host, port, err := net.SplitHostPort(parsed.Host); err == nil && (port == "80" || port == "443") {
+		parsed.Host = host
+	}
+	parsed.Path = strings.TrimRight(parsed.Path, "/")
+	parsed.RawPath = ""
+
+	query := parsed.Query()
+	for name := range query {
+		if strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	parsed.RawQuery = query.Encode() // sorted by name
+	parsed.ForceQuery = false
+	return parsed.String()
+}
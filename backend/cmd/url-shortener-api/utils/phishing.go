@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// suspiciousTLDs are top-level domains disproportionately used for phishing,
+// or easily confused with file names.
+var suspiciousTLDs = map[string]bool{
+	"zip": true, "mov": true, "xyz": true, "top": true, "tk": true, "ml": true,
+	"ga": true, "cf": true, "gq": true, "click": true, "country": true,
+	"work": true, "support": true, "rest": true, "cam": true,
+}
+
+// phishingKeywords are words phishing hosts use to look legitimate.
+var phishingKeywords = []string{"login", "signin", "verify", "secure", "account", "update", "wallet", "banking"}
+
+// PhishingScore is the heuristic phishing risk of a URL.
+type PhishingScore struct {
+	Score   int      `json:"score"` // 0-100
+	Reasons []string `json:"reasons"`
+}
+
+// ScorePhishingRisk rates how much rawURL looks like a phishing link from
+// its shape alone, without fetching it.
+func ScorePhishingRisk(rawURL string) PhishingScore {
+	var result PhishingScore
+	add := func(points int, reason string) {
+		result.Score += points
+		result.Reasons = append(result.Reasons, reason)
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return result
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), ".")
+
+	if parsedURL.User != nil {
+		add(30, "URL contains credentials before the host")
+	}
+
+	if net.ParseIP(host) != nil {
+		add(40, "host is an IP address")
+	} else {
+		labels := strings.Split(host, ".")
+		for _, label := range labels {
+			if strings.HasPrefix(label, "xn--") {
+				add(35, "host uses punycode, which can imitate other domains")
+				break
+			}
+		}
+		if len(labels) > 4 {
+			add(15, fmt.Sprintf("host has %d subdomain levels", len(labels)-2))
+		}
+		if suspiciousTLDs[labels[len(labels)-1]] {
+			add(20, fmt.Sprintf("top-level domain .%s is commonly abused", labels[len(labels)-1]))
+		}
+		if strings.Count(host, "-") > 3 {
+			add(10, "host has many hyphens")
+		}
+		for _, keyword := range phishingKeywords {
+			if strings.Contains(host, keyword) {
+				add(10, fmt.Sprintf("host contains %q", keyword))
+				break
+			}
+		}
+	}
+
+	if IsURLShortener(rawURL) {
+		add(25, "destination is another URL shortener")
+	}
+
+	if len(rawURL) > 200 {
+		add(10, "URL is unusually long")
+	}
+
+	if result.Score > 100 {
+		result.Score = 100
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPreviewTokenSecretMissing = errors.New("preview token secret is not set")
+	ErrPreviewTokenInvalid       = errors.New("invalid preview token")
+	ErrPreviewTokenExpired       = errors.New("preview token has expired")
+)
+
+// GeneratePreviewToken signs a token granting access to shortCode until now+ttl.
+func GeneratePreviewToken(secret, shortCode string, ttl time.Duration) (string, time.Time, error) {
+	if secret == "" {
+		return "", time.Time{}, ErrPreviewTokenSecretMissing
+	}
+
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + signPreview(secret, shortCode, expiry), expiresAt, nil
+}
+
+// ValidatePreviewToken checks that token was issued for shortCode and has not expired.
+func ValidatePreviewToken(secret, shortCode, token string) error {
+	if secret == "" {
+		return ErrPreviewTokenSecretMissing
+	}
+
+	expiry, signature, found := strings.Cut(token, ".")
+	if !found {
+		return ErrPreviewTokenInvalid
+	}
+
+	expected := signPreview(secret, shortCode, expiry)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrPreviewTokenInvalid
+	}
+
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return ErrPreviewTokenInvalid
+	}
+	if time.Now().After(time.Unix(unix, 0)) {
+		return ErrPreviewTokenExpired
+	}
+
+	return nil
+}
+
+func signPreview(secret, shortCode, expiry string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s|%s", shortCode, expiry)
+	return hex.EncodeToString(mac.Sum(nil))
+}
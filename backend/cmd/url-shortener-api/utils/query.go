@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"net/url"
+)
+
+// MergeQuery adds extra query parameters to destination. Parameters already
+// present on the destination win, so a link's own configuration is never
+// overridden by the visitor's request.
+func MergeQuery(destination string, extra url.Values) string {
+	if len(extra) == 0 {
+		return destination
+	}
+
+	parsedURL, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	query := parsedURL.Query()
+	for key, values := range extra {
+		if _, exists := query[key]; exists {
+			continue
+		}
+		query[key] = values
+	}
+	parsedURL.RawQuery = query.Encode()
+
+	return parsedURL.String()
+}
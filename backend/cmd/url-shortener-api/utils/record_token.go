@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// errRecordTokenExpired tells the callers of parseRecordToken a token was
+// genuine but too old, so they can return their own expired error.
+var errRecordTokenExpired = errors.New("record token has expired")
+
+// signRecordToken signs a token naming the record id, valid until expiresAt
+// and only for audience, so tokens of one kind can't stand in for another.
+func signRecordToken(secret, audience string, id uint, expiresAt time.Time) (string, error) {
+	if secret == "" {
+		return "", ErrJWTSecretMissing
+	}
+
+	claims := jwt.RegisteredClaims{
+		ID:        strconv.FormatUint(uint64(id), 10),
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// parseRecordToken checks the signature, audience and expiry of token and
+// returns the record it names, or zero if it is not valid.
+func parseRecordToken(secret, audience, token string) (uint, error) {
+	if secret == "" {
+		return 0, ErrJWTSecretMissing
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithAudience(audience))
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return 0, errRecordTokenExpired
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(claims.ID, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("token names no record")
+	}
+	return uint(id), nil
+}
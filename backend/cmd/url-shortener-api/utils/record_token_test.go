@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecordTokenAudiences(t *testing.T) {
+	later, earlier := time.Now().Add(time.Hour), time.Now().Add(-time.Minute)
+	mustSign := func(secret, audience string, id uint, expiresAt time.Time) string {
+		token, err := signRecordToken(secret, audience, id, expiresAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	invite := mustSign(testSecret, inviteAudience, 42, later)
+	deletion := mustSign(testSecret, accountDeletionAudience, 42, later)
+	access, _, err := GenerateAccessToken(testSecret, 42, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validateInvite := ValidateInviteToken
+	validateDeletion := ValidateAccountDeletionToken
+	tests := []struct {
+		name     string
+		validate func(secret, token string) (uint, error)
+		secret   string
+		token    string
+		wantID   uint
+		wantErr  error
+	}{
+		{name: "invite", validate: validateInvite, secret: testSecret, token: invite, wantID: 42},
+		{name: "deletion", validate: validateDeletion, secret: testSecret, token: deletion, wantID: 42},
+		{name: "deletion token as an invite", validate: validateInvite, secret: testSecret, token: deletion, wantErr: ErrInviteTokenInvalid},
+		{name: "invite as a deletion token", validate: validateDeletion, secret: testSecret, token: invite, wantErr: ErrDeletionTokenInvalid},
+		{name: "access token as an invite", validate: validateInvite, secret: testSecret, token: access, wantErr: ErrInviteTokenInvalid},
+		{name: "access token as a deletion token", validate: validateDeletion, secret: testSecret, token: access, wantErr: ErrDeletionTokenInvalid},
+		{name: "expired invite", validate: validateInvite, secret: testSecret, token: mustSign(testSecret, inviteAudience, 42, earlier), wantErr: ErrInviteTokenExpired},
+		{name: "expired deletion", validate: validateDeletion, secret: testSecret, token: mustSign(testSecret, accountDeletionAudience, 42, earlier), wantErr: ErrDeletionTokenExpired},
+		{name: "other secret", validate: validateInvite, secret: "other-secret", token: invite, wantErr: ErrInviteTokenInvalid},
+		{name: "no record", validate: validateInvite, secret: testSecret, token: mustSign(testSecret, inviteAudience, 0, later), wantErr: ErrInviteTokenInvalid},
+		{name: "no secret", validate: validateDeletion, secret: "", token: deletion, wantErr: ErrJWTSecretMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.validate(tt.secret, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("id = %d, want %d", id, tt.wantID)
+			}
+		})
+	}
+
+	// Record tokens are signed with the JWT secret, so they must not sign anyone in
+	for name, token := range map[string]string{"invite": invite, "deletion": deletion} {
+		if _, _, err := ValidateAccessToken(testSecret, token); !errors.Is(err, ErrAccessTokenInvalid) {
+			t.Errorf("ValidateAccessToken() of a %s token error = %v, want ErrAccessTokenInvalid", name, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"url-shortener/config"
+)
+
+// ErrNoURLScanners is returned by ScanURL when no threat-intel provider is
+// configured, so there's nothing to check URLs against.
+var ErrNoURLScanners = errors.New("no URL scanners are configured")
+
+// errScannerNotConfigured is returned by scanners missing their API key.
+var errScannerNotConfigured = errors.New("scanner is not configured")
+
+// ScanResult is one provider's verdict on a URL.
+type ScanResult struct {
+	Provider   string `json:"provider"`
+	IsSafe     bool   `json:"is_safe"`
+	ThreatType string `json:"threat_type,omitempty"`
+	RiskScore  int    `json:"risk_score"`
+	Message    string `json:"message"`
+}
+
+// URLScanner checks URLs against a threat-intel provider.
+type URLScanner interface {
+	Name() string
+	Scan(ctx context.Context, inputURL string) (ScanResult, error)
+}
+
+// NewURLScanners returns the scanners named in cfg.URLScanners, in order.
+// Unknown names are logged and skipped.
+func NewURLScanners(cfg config.Config) []URLScanner {
+	var scanners []URLScanner
+	for _, name := range cfg.URLScanners {
+		switch strings.ToLower(name) {
+		case "safebrowsing":
+			scanners = append(scanners, safeBrowsingScanner{cfg: cfg})
+		case "virustotal":
+			scanners = append(scanners, virusTotalScanner{
+				apiKey:        cfg.VirusTotalAPIKey,
+				timeout:       cfg.VirusTotalTimeout,
+				minDetections: cfg.VirusTotalMinDetections,
+				ttl:           cfg.VirusTotalCacheTTL,
+			})
+		default:
+			log.Printf("Ignoring unknown URL scanner %q", name)
+		}
+	}
+	return scanners
+}
+
+// ScanURL checks inputURL with every configured scanner and combines their
+// verdicts. With the "any" aggregation one unsafe verdict is enough; with
+// "all" every scanner that answered must agree. The riskiest unsafe verdict
+// is returned. Scanners that fail are skipped, so an error is only returned
+// if none of them answered.
+func ScanURL(ctx context.Context, cfg config.Config, inputURL string) (ScanResult, error) {
+	safe := ScanResult{IsSafe: true, Message: "URL is safe"}
+
+	var answered, unsafe []ScanResult
+	var lastErr error
+	for _, scanner := range NewURLScanners(cfg) {
+		result, err := cachedScan(ctx, scanner, inputURL)
+		if errors.Is(err, errScannerNotConfigured) {
+			continue
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", scanner.Name(), err)
+			continue
+		}
+		answered = append(answered, result)
+		if !result.IsSafe {
+			unsafe = append(unsafe, result)
+		}
+	}
+
+	if len(answered) == 0 {
+		if lastErr != nil {
+			return safe, lastErr
+		}
+		return safe, ErrNoURLScanners
+	}
+	if len(unsafe) == 0 || (cfg.URLScanAggregation == "all" && len(unsafe) < len(answered)) {
+		return safe, nil
+	}
+
+	worst := unsafe[0]
+	for _, result := range unsafe[1:] {
+		if result.RiskScore > worst.RiskScore {
+			worst = result
+		}
+	}
+	return worst, nil
+}
+
+// cachedScan reuses a recent verdict from the same scanner to save API quota.
+func cachedScan(ctx context.Context, scanner URLScanner, inputURL string) (ScanResult, error) {
+	cacheKey := scanner.Name() + " " + normalizeCacheKey(inputURL)
+	if cached, ok := scanCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	result, err := scanner.Scan(ctx, inputURL)
+	if err != nil {
+		return result, err
+	}
+
+	var ttl time.Duration
+	if ttlScanner, ok := scanner.(interface{ cacheTTL() time.Duration }); ok {
+		ttl = ttlScanner.cacheTTL()
+	}
+	scanCache.set(cacheKey, result, ttl)
+	return result, nil
+}
+
+// safeBrowsingScanner checks URLs with Google Safe Browsing.
+type safeBrowsingScanner struct {
+	cfg config.Config
+}
+
+func (s safeBrowsingScanner) Name() string { return "safebrowsing" }
+
+func (s safeBrowsingScanner) cacheTTL() time.Duration { return s.cfg.SafeBrowsingCacheTTL }
+
+func (s safeBrowsingScanner) Scan(ctx context.Context, inputURL string) (ScanResult, error) {
+	verdict, err := CheckSafeBrowsing(ctx, s.cfg, inputURL)
+	if errors.Is(err, ErrSafeBrowsingAPIKeyMissing) {
+		return ScanResult{}, errScannerNotConfigured
+	}
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	result := ScanResult{
+		Provider:   s.Name(),
+		IsSafe:     verdict.IsSafe,
+		ThreatType: verdict.ThreatType,
+		Message:    verdict.Message,
+	}
+	if !verdict.IsSafe {
+		result.RiskScore = ThreatRiskScore(verdict.ThreatType)
+	}
+	return result, nil
+}
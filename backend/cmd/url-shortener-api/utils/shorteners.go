@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// urlShorteners are other shortening services; pointing a short link at
+// another one hides where it really goes.
+var urlShorteners = map[string]bool{
+	"bit.ly": true, "tinyurl.com": true, "t.co": true, "goo.gl": true,
+	"ow.ly": true, "is.gd": true, "buff.ly": true, "cutt.ly": true,
+	"rebrand.ly": true, "shorturl.at": true, "rb.gy": true, "t.ly": true,
+}
+
+// IsURLShortener reports whether rawURL is a link on a known URL shortener.
+func IsURLShortener(rawURL string) bool {
+	return urlShorteners[urlHost(rawURL)]
+}
+
+// HostIn reports whether rawURL's host is one of hosts, ignoring case and a
+// leading "www.".
+func HostIn(rawURL string, hosts []string) bool {
+	host := urlHost(rawURL)
+	if host == "" {
+		return false
+	}
+	for _, candidate := range hosts {
+		if strings.TrimPrefix(strings.ToLower(candidate), "www.") == host {
+			return true
+		}
+	}
+	return false
+}
+
+// urlHost returns rawURL's lowercased host without port, trailing dot or
+// leading "www.".
+func urlHost(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), ".")
+	return strings.TrimPrefix(host, "www.")
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when an outbound request would connect to
+// a private, loopback, link-local or otherwise internal address.
+var ErrBlockedAddress = errors.New("destination address is not allowed")
+
+var (
+	blockedNetworks []*net.IPNet
+	allowedNetworks []*net.IPNet
+)
+
+// OutboundTransport is used for requests to user-supplied URLs. It checks
+// every address it connects to, after DNS resolution, so hostnames that
+// resolve to internal addresses are caught too. It doesn't use an HTTP proxy,
+// since the proxy's address would be checked instead of the destination's.
+var OutboundTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkOutboundAddress,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// SetOutboundNetworks sets the IP ranges OutboundTransport refuses to
+// connect to, and exceptions to them, as IPs or CIDR ranges.
+func SetOutboundNetworks(blocked, allowed []string) error {
+	blockedNets, err := ParseNetworks(blocked)
+	if err != nil {
+		return err
+	}
+	allowedNets, err := ParseNetworks(allowed)
+	if err != nil {
+		return err
+	}
+	blockedNetworks, allowedNetworks = blockedNets, allowedNets
+	return nil
+}
+
+// checkOutboundAddress is the dialer's Control hook, run with the resolved
+// address just before each connection is made.
+func checkOutboundAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if InNetworks(host, blockedNetworks) && !InNetworks(host, allowedNetworks) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// outboundClient returns a client for user-supplied URLs that doesn't
+// follow redirects, so callers can check each hop themselves.
+func outboundClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: OutboundTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 50
+)
+
+var (
+	ErrTooManyTags = errors.New("too many tags")
+	ErrInvalidTag  = errors.New("invalid tag")
+)
+
+// NormalizeTags trims and lowercases link tags, dropping duplicates, and
+// checks them against the limits. Order is kept.
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.ContainsAny(tag, ",\r\n") {
+			return nil, fmt.Errorf("%w: %q must be 1 to %d characters without commas", ErrInvalidTag, tag, maxTagLength)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("%w: maximum is %d", ErrTooManyTags, maxTags)
+	}
+	return normalized, nil
+}
@@ -1,14 +1,17 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"url-shortener/chaos"
 	"url-shortener/config"
 )
 
@@ -18,6 +21,7 @@ var (
 	ErrURLNotHTTPS               = errors.New("URL scheme is not HTTPS")
 	ErrURLRedirect               = errors.New("URL redirects to another location")
 	ErrSafeBrowsingAPIKeyMissing = errors.New("safe browsing API key is not set")
+	ErrTooManyRedirects          = errors.New("URL redirects too many times")
 )
 
 // Safe Browsing API Response
@@ -34,8 +38,9 @@ type SafeBrowsingResponse struct {
 
 // SafeBrowsingResult represents the result of a Safe Browsing check
 type SafeBrowsingResult struct {
-	IsSafe  bool   `json:"is_safe"`
-	Message string `json:"message"`
+	IsSafe     bool   `json:"is_safe"`
+	Message    string `json:"message"`
+	ThreatType string `json:"threat_type,omitempty"`
 }
 
 // ValidateURLSyntax ensures the URL is properly formatted and uses HTTPS.
@@ -54,13 +59,12 @@ func ValidateURLSyntax(inputURL string) error {
 
 // CheckRedirects checks if the URL responds with 301 or 302 status codes.
 func CheckRedirects(inputURL string) error {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	if err := chaos.Inject(chaos.TargetOutbound); err != nil {
+		return err
 	}
 
+	client := outboundClient(10 * time.Second)
+
 	resp, err := client.Head(inputURL)
 	if err != nil {
 		return fmt.Errorf("failed to check redirects: %w", err)
@@ -75,7 +79,7 @@ func CheckRedirects(inputURL string) error {
 }
 
 // CheckSafeBrowsing uses Google's Safe Browsing API to check the URL.
-func CheckSafeBrowsing(cfg config.Config, inputURL string) (SafeBrowsingResult, error) {
+func CheckSafeBrowsing(ctx context.Context, cfg config.Config, inputURL string) (SafeBrowsingResult, error) {
 	result := SafeBrowsingResult{IsSafe: true, Message: "URL is safe"}
 
 	apiKey := cfg.SafeBrowsingAPIKey
@@ -83,6 +87,10 @@ func CheckSafeBrowsing(cfg config.Config, inputURL string) (SafeBrowsingResult,
 		return result, ErrSafeBrowsingAPIKeyMissing
 	}
 
+	if err := chaos.Inject(chaos.TargetOutbound); err != nil {
+		return result, err
+	}
+
 	endpoint := fmt.Sprintf("https://safebrowsing.googleapis.com/v4/threatMatches:find?key=%s", apiKey)
 	requestBody := map[string]interface{}{
 		"client": map[string]string{
@@ -90,7 +98,7 @@ func CheckSafeBrowsing(cfg config.Config, inputURL string) (SafeBrowsingResult,
 			"clientVersion": "1.0",
 		},
 		"threatInfo": map[string]interface{}{
-			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING"},
+			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
 			"platformTypes":    []string{"ANY_PLATFORM"},
 			"threatEntryTypes": []string{"URL"},
 			"threatEntries": []map[string]string{
@@ -104,12 +112,23 @@ func CheckSafeBrowsing(cfg config.Config, inputURL string) (SafeBrowsingResult,
 		return result, err
 	}
 
-	resp, err := http.Post(endpoint, "application/json", strings.NewReader(string(jsonData)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(string(jsonData)))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: cfg.SafeBrowsingTimeout}
+	resp, err := client.Do(req)
 	if err != nil {
 		return result, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("safe browsing API returned status %d", resp.StatusCode)
+	}
+
 	var sbResp SafeBrowsingResponse
 	err = json.NewDecoder(resp.Body).Decode(&sbResp)
 	if err != nil {
@@ -118,20 +137,39 @@ func CheckSafeBrowsing(cfg config.Config, inputURL string) (SafeBrowsingResult,
 
 	if len(sbResp.Matches) > 0 {
 		result.IsSafe = false
+		result.ThreatType = sbResp.Matches[0].ThreatType
 		result.Message = fmt.Sprintf("URL is unsafe: %s. Threat type: %s", inputURL, sbResp.Matches[0].ThreatType)
 	}
 
 	return result, nil
 }
 
+// threatRiskScores rates Safe Browsing threat types for the malicious log.
+var threatRiskScores = map[string]int{
+	"MALWARE":                         100,
+	"SOCIAL_ENGINEERING":              90,
+	"POTENTIALLY_HARMFUL_APPLICATION": 70,
+	"UNWANTED_SOFTWARE":               60,
+}
+
+// ThreatRiskScore returns the risk score recorded for a Safe Browsing threat type.
+func ThreatRiskScore(threatType string) int {
+	if score, ok := threatRiskScores[threatType]; ok {
+		return score
+	}
+	return 50
+}
+
 // URLCheckResult represents the result of URL checks
 type URLCheckResult struct {
-	StatusCode  int    `json:"status_code"`
-	IsHTTPS     bool   `json:"is_https"`
-	RedirectURL string `json:"redirect_url,omitempty"`
+	StatusCode         int    `json:"status_code"`
+	IsHTTPS            bool   `json:"is_https"`
+	RedirectURL        string `json:"redirect_url,omitempty"`
+	ContentType        string `json:"content_type,omitempty"`
+	ContentDisposition string `json:"content_disposition,omitempty"`
 }
 
-func CheckURLStatus(inputURL string) (URLCheckResult, error) {
+func CheckURLStatus(ctx context.Context, inputURL string) (URLCheckResult, error) {
 	result := URLCheckResult{IsHTTPS: false}
 
 	// Validate URL syntax
@@ -143,26 +181,85 @@ func CheckURLStatus(inputURL string) (URLCheckResult, error) {
 	// Check if the URL uses HTTPS
 	result.IsHTTPS = parsedURL.Scheme == "https"
 
-	// Check the URL status
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	if err := chaos.Inject(chaos.TargetOutbound); err != nil {
+		return result, err
 	}
 
-	resp, err := client.Head(inputURL)
+	// Check the URL status
+	client := outboundClient(10 * time.Second)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, inputURL, nil)
+	if err != nil {
+		return result, fmt.Errorf("%w: %s", ErrInvalidURLSyntax, inputURL)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return result, fmt.Errorf("failed to check URL status: %w", err)
 	}
 	defer resp.Body.Close()
 
 	result.StatusCode = resp.StatusCode
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.ContentDisposition = resp.Header.Get("Content-Disposition")
 
 	// Check for redirect and get the redirect URL
-	if resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusFound {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
 		result.RedirectURL = resp.Header.Get("Location")
 	}
 
 	return result, nil
 }
+
+// ResolvedURL is where a URL ends up after following its redirects.
+type ResolvedURL struct {
+	FinalURL     string        `json:"final_url"`
+	StatusCode   int           `json:"status_code"` // status of the final URL
+	Hops         int           `json:"hops"`
+	ContentType  string        `json:"content_type,omitempty"`  // media type of the final URL
+	DownloadType string        `json:"download_type,omitempty"` // see ClassifyDownload
+	Chain        []RedirectHop `json:"chain,omitempty"`         // every URL requested, in order
+}
+
+// RedirectHop is one URL requested while following redirects and what it
+// answered. Location is only set for redirects.
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location,omitempty"`
+}
+
+// ResolveURL follows inputURL's redirects, up to maxHops of them, and
+// reports the final destination, its status and what kind of content it serves.
+func ResolveURL(ctx context.Context, inputURL string, maxHops int) (ResolvedURL, error) {
+	resolved := ResolvedURL{FinalURL: inputURL}
+	for {
+		result, err := CheckURLStatus(ctx, resolved.FinalURL)
+		if err != nil {
+			return resolved, err
+		}
+		resolved.StatusCode = result.StatusCode
+		resolved.Chain = append(resolved.Chain, RedirectHop{URL: resolved.FinalURL, StatusCode: result.StatusCode, Location: result.RedirectURL})
+		if result.RedirectURL == "" {
+			resolved.ContentType, _, _ = mime.ParseMediaType(result.ContentType)
+			resolved.DownloadType = ClassifyDownload(resolved.FinalURL, result.ContentType, result.ContentDisposition)
+			return resolved, nil
+		}
+
+		if resolved.Hops >= maxHops {
+			return resolved, fmt.Errorf("%w: more than %d redirects", ErrTooManyRedirects, maxHops)
+		}
+
+		// Location may be relative to the URL that sent it
+		current, err := url.Parse(resolved.FinalURL)
+		if err != nil {
+			return resolved, err
+		}
+		next, err := current.Parse(result.RedirectURL)
+		if err != nil {
+			return resolved, fmt.Errorf("%w: bad redirect location %q", ErrInvalidURLSyntax, result.RedirectURL)
+		}
+		resolved.FinalURL = next.String()
+		resolved.Hops++
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/chaos"
+)
+
+// maxVerdictCacheEntries bounds the cache before expired entries are swept.
+const maxVerdictCacheEntries = 10000
+
+var scanCache = newVerdictCache()
+
+type cachedVerdict struct {
+	result    ScanResult
+	expiresAt time.Time
+}
+
+// verdictCache is an in-memory TTL cache of URL scanner verdicts.
+type verdictCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedVerdict
+}
+
+func newVerdictCache() *verdictCache {
+	return &verdictCache{entries: make(map[string]cachedVerdict)}
+}
+
+func (c *verdictCache) get(key string) (ScanResult, bool) {
+	// An injected cache failure degrades to a miss
+	if err := chaos.Inject(chaos.TargetCache); err != nil {
+		return ScanResult{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return ScanResult{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return ScanResult{}, false
+	}
+	return entry.result, true
+}
+
+func (c *verdictCache) set(key string, result ScanResult, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxVerdictCacheEntries {
+		c.sweep()
+	}
+	c.entries[key] = cachedVerdict{result: result, expiresAt: time.Now().Add(ttl)}
+}
+
+// sweep drops expired entries, or everything if none have expired yet.
+func (c *verdictCache) sweep() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) >= maxVerdictCacheEntries {
+		c.entries = make(map[string]cachedVerdict)
+	}
+}
+
+// normalizeCacheKey lowercases the scheme and host and drops the fragment so
+// trivially different spellings of the same URL share a verdict.
+func normalizeCacheKey(inputURL string) string {
+	parsedURL, err := url.Parse(inputURL)
+	if err != nil {
+		return inputURL
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	parsedURL.Host = strings.ToLower(parsedURL.Host)
+	parsedURL.Fragment = ""
+	if parsedURL.Path == "" {
+		parsedURL.Path = "/"
+	}
+	return parsedURL.String()
+}
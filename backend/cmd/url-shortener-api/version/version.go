@@ -0,0 +1,74 @@
+// Package version identifies the running build. Version, Commit and
+// BuildTime are set at link time:
+//
+//	go build -ldflags "-X url-shortener/version.Version=v1.2.3 \
+//		-X url-shortener/version.Commit=$(git rev-parse HEAD) \
+//		-X url-shortener/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them the commit is read from the VCS information Go embeds when
+// building from a checkout, and there is no build time.
+package version
+
+import "runtime/debug"
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	// CommitTime and Modified come from the checkout the binary was
+	// built in; Modified means it had uncommitted changes.
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	GoVersion  string `json:"go_version"`
+}
+
+// Get returns the running build's version information.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = build.GoVersion
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+// String summarizes the build for logs, e.g. "v1.2.3 (commit 1a2b3c4, built
+// 2024-05-01T12:00:00Z)".
+func (i Info) String() string {
+	summary := i.Version
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		summary += " (commit " + commit
+		if i.Modified {
+			summary += "+modified"
+		}
+		if i.BuildTime != "" {
+			summary += ", built " + i.BuildTime
+		}
+		summary += ")"
+	}
+	return summary
+}
@@ -0,0 +1,155 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+	"url-shortener/utils"
+)
+
+const (
+	// deliveryBatchSize bounds how many deliveries one pass sends.
+	deliveryBatchSize = 50
+	// maxBackoff caps the wait between attempts.
+	maxBackoff = 6 * time.Hour
+	// maxErrorLength bounds the error or response excerpt kept per delivery.
+	maxErrorLength = 500
+)
+
+// Headers sent with every delivery. The signature is "sha256=" and the hex
+// HMAC-SHA256, keyed with the subscription's secret, of the timestamp, a
+// dot and the body, so receivers can reject stale or replayed deliveries.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Sign returns the signature header value for body sent at timestamp, in
+// Unix seconds.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver sends a batch of pending deliveries that are due. A delivery
+// succeeds on any 2xx response; otherwise it's retried after backoff,
+// doubling each time, until it has been attempted maxAttempts times.
+func Deliver(ctx context.Context, maxAttempts int, backoff, timeout time.Duration) error {
+	var due []models.WebhookDelivery
+	err := db.DB.WithContext(ctx).Preload("Subscription").
+		Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+		Order("next_attempt_at").
+		Limit(deliveryBatchSize).
+		Find(&due).Error
+	if err != nil {
+		return fmt.Errorf("finding webhook deliveries: %w", err)
+	}
+
+	// Redirects aren't followed, so a subscription can't be bounced to an
+	// address the transport would have refused
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: utils.OutboundTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	failed := 0
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		statusCode, err := send(ctx, client, delivery)
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"attempts":         delivery.Attempts + 1,
+			"last_status_code": statusCode,
+			"last_error":       "",
+		}
+		switch {
+		case err == nil:
+			updates["status"] = models.DeliverySucceeded
+			updates["delivered_at"] = now
+		case delivery.Attempts+1 >= maxAttempts:
+			updates["status"] = models.DeliveryFailed
+			updates["last_error"] = truncate(err.Error())
+			failed++
+		default:
+			updates["next_attempt_at"] = now.Add(retryDelay(backoff, delivery.Attempts+1))
+			updates["last_error"] = truncate(err.Error())
+		}
+		if err := db.DB.Model(&delivery).Updates(updates).Error; err != nil {
+			log.Printf("Error recording webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+	if failed > 0 {
+		log.Printf("Gave up on %d webhook deliveries after %d attempts", failed, maxAttempts)
+	}
+	return ctx.Err()
+}
+
+// send POSTs delivery to its subscription, returning the response status
+// and an error for anything but a 2xx.
+func send(ctx context.Context, client *http.Client, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortener-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Subscription.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+	return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+}
+
+// retryDelay is how long to wait after the given number of failed attempts.
+func retryDelay(backoff time.Duration, attempts int) time.Duration {
+	delay := backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+func truncate(message string) string {
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength]
+	}
+	return message
+}
@@ -0,0 +1,62 @@
+package webhooks
+
+import (
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	const body = `{"event":"link.created"}`
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{
+			name:      "payload",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			body:      body,
+			want:      "sha256=157c90f250cb20ef0f8f798ef6b985d7bf78bcf43128ad5325212589883c33e8",
+		},
+		{
+			name:      "empty body",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			body:      "",
+			want:      "sha256=5967f3c560522fa40cf2876ebc3c3a08551dd6959aaade3b413460591895bdcc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignCoversEveryInput(t *testing.T) {
+	base := Sign("whsec_test", 1700000000, []byte("body"))
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+	}{
+		{name: "other secret", secret: "whsec_other", timestamp: 1700000000, body: "body"},
+		{name: "other timestamp", secret: "whsec_test", timestamp: 1700000001, body: "body"},
+		{name: "other body", secret: "whsec_test", timestamp: 1700000000, body: "Body"},
+		// The dot keeps timestamp and body apart: 17000000001.body isn't
+		// 1700000000.1body
+		{name: "digit moved across the dot", secret: "whsec_test", timestamp: 17000000001, body: "body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got == base {
+				t.Errorf("Sign() = %q, same as the unchanged signature", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Package webhooks notifies subscribed URLs of link events. Raising an
+// event stores a delivery for each matching subscription; Deliver sends
+// them from a background job, signed with the subscription's secret, and
+// retries failures with exponential backoff.
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"url-shortener/db"
+	"url-shortener/models"
+)
+
+// Event types a subscription can ask for.
+const (
+	LinkCreated    = "link.created"
+	LinkExpired    = "link.expired"
+	LinkFlagged    = "link.flagged"
+	ClickThreshold = "link.click_threshold"
+)
+
+// Events lists every event type, in the order they're documented.
+var Events = []string{LinkCreated, LinkExpired, LinkFlagged, ClickThreshold}
+
+// ValidEvent reports whether event is a known event type.
+func ValidEvent(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Link describes the link an event is about.
+type Link struct {
+	ShortCode          string     `json:"short_code"`
+	OriginalURL        string     `json:"original_url"`
+	Status             string     `json:"status"`
+	OwnerID            *uint      `json:"owner_id,omitempty"`
+	OrganizationID     *uint      `json:"organization_id,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	IntendedExpiryDate *time.Time `json:"intended_expiry_date,omitempty"`
+}
+
+// Payload is the JSON body of a delivery. Clicks and Threshold are only set
+// for click threshold events.
+type Payload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Link       Link      `json:"link"`
+	Clicks     int64     `json:"clicks,omitempty"`
+	Threshold  int64     `json:"threshold,omitempty"`
+}
+
+// Fields lists the payload fields a subscription can narrow its deliveries
+// to, as dotted paths; "link" keeps the whole link. The event and the time
+// it occurred are always sent.
+var Fields = []string{
+	"link", "link.short_code", "link.original_url", "link.status", "link.owner_id",
+	"link.organization_id", "link.created_at", "link.intended_expiry_date",
+	"clicks", "threshold",
+}
+
+// ValidField reports whether field is a payload field a subscription can
+// ask for.
+func ValidField(field string) bool {
+	for _, known := range Fields {
+		if field == known {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateSecret returns a new random signing secret.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Subscribed reports whether any active subscription asks for event, so
+// callers can skip work that only matters to subscribers.
+func Subscribed(event string) (bool, error) {
+	var subscriptions []models.WebhookSubscription
+	if err := db.DB.Select("events").Where("active = ?", true).Find(&subscriptions).Error; err != nil {
+		return false, err
+	}
+	for _, subscription := range subscriptions {
+		if wants(subscription, event) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Raise queues event about link for its owner's subscriptions and the
+// admin's. Errors are logged; they never fail what raised the event.
+func Raise(event string, link models.UrlMapping) {
+	raise(Payload{Event: event, Link: linkOf(link)}, link.OwnerID)
+}
+
+// RaiseClickThreshold queues a click threshold event for link, which has
+// had clicks human clicks, passing threshold.
+func RaiseClickThreshold(link models.UrlMapping, threshold, clicks int64) {
+	raise(Payload{Event: ClickThreshold, Link: linkOf(link), Clicks: clicks, Threshold: threshold}, link.OwnerID)
+}
+
+func raise(payload Payload, ownerID *uint) {
+	query := db.DB.Where("active = ?", true)
+	if ownerID != nil {
+		query = query.Where("owner_id IS NULL OR owner_id = ?", *ownerID)
+	} else {
+		query = query.Where("owner_id IS NULL")
+	}
+	var subscriptions []models.WebhookSubscription
+	if err := query.Find(&subscriptions).Error; err != nil {
+		log.Printf("Error finding webhook subscriptions for %s: %v", payload.Event, err)
+		return
+	}
+
+	payload.OccurredAt = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding %s webhook payload: %v", payload.Event, err)
+		return
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !wants(subscription, payload.Event) {
+			continue
+		}
+		sent := body
+		if len(subscription.Fields) > 0 {
+			if sent, err = selectFields(body, subscription.Fields); err != nil {
+				log.Printf("Error encoding %s webhook payload: %v", payload.Event, err)
+				return
+			}
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			Event:          payload.Event,
+			Payload:        string(sent),
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  payload.OccurredAt,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := db.DB.Omit("Subscription").Create(&deliveries).Error; err != nil {
+		log.Printf("Error queueing %s webhook deliveries: %v", payload.Event, err)
+	}
+}
+
+func wants(subscription models.WebhookSubscription, event string) bool {
+	for _, wanted := range subscription.Events {
+		if wanted == event {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFields narrows an encoded payload to the event, the time it
+// occurred and fields. Fields the event doesn't have are left out.
+func selectFields(body []byte, fields []string) ([]byte, error) {
+	var full map[string]interface{}
+	if err := json.Unmarshal(body, &full); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]interface{}{"event": full["event"], "occurred_at": full["occurred_at"]}
+	for _, field := range fields {
+		parent, child, nested := strings.Cut(field, ".")
+		value, ok := full[parent]
+		if !ok {
+			continue
+		}
+		if !nested {
+			selected[parent] = value
+			continue
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := object[child]; ok {
+			into, ok := selected[parent].(map[string]interface{})
+			if !ok {
+				into = map[string]interface{}{}
+				selected[parent] = into
+			}
+			into[child] = value
+		}
+	}
+	return json.Marshal(selected)
+}
+
+func linkOf(link models.UrlMapping) Link {
+	return Link{
+		ShortCode:          link.ShortCode,
+		OriginalURL:        link.OriginalUrl,
+		Status:             link.Status,
+		OwnerID:            link.OwnerID,
+		OrganizationID:     link.OrganizationID,
+		CreatedAt:          link.CreatedAt,
+		IntendedExpiryDate: link.IntendedExpiryDate,
+	}
+}
@@ -0,0 +1,41 @@
+package webhooks
+
+import (
+	"testing"
+)
+
+func TestSelectFields(t *testing.T) {
+	body := []byte(`{"event":"link.click_threshold","occurred_at":"2026-01-02T03:04:05Z","link":{"short_code":"abc","original_url":"https://example.com","status":"live"},"clicks":120,"threshold":100}`)
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{
+			name:   "nested fields",
+			fields: []string{"link.short_code", "link.status"},
+			want:   `{"event":"link.click_threshold","link":{"short_code":"abc","status":"live"},"occurred_at":"2026-01-02T03:04:05Z"}`,
+		},
+		{
+			name:   "whole link and a top-level field",
+			fields: []string{"link", "clicks"},
+			want:   `{"clicks":120,"event":"link.click_threshold","link":{"original_url":"https://example.com","short_code":"abc","status":"live"},"occurred_at":"2026-01-02T03:04:05Z"}`,
+		},
+		{
+			name:   "fields the event doesn't have",
+			fields: []string{"link.intended_expiry_date"},
+			want:   `{"event":"link.click_threshold","occurred_at":"2026-01-02T03:04:05Z"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectFields(body, tt.fields)
+			if err != nil {
+				t.Fatalf("selectFields() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("selectFields() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nextCursorHeader carries the ?cursor= token for the next page of a list.
+const nextCursorHeader = "X-Next-Cursor"
+
+// maxAttempts is how many times a rate-limited request is sent.
+const maxAttempts = 5
+
+// client calls the REST API, authenticating with an API key.
+type client struct {
+	server string
+	apiKey string
+	http   *http.Client
+}
+
+func newClient(server, apiKey string) *client {
+	return &client{
+		server: strings.TrimRight(server, "/"),
+		apiKey: apiKey,
+		http:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+// apiError is an error response from the API.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+}
+
+// do sends a request with body, if any, encoded as JSON and decodes the
+// response into out, if given. It returns the response headers.
+func (c *client) do(method, path string, query url.Values, body, out interface{}) (http.Header, error) {
+	target := c.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	// Rate-limited requests are retried after the wait the server asks for
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(method, target, bytes.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+		req.Header.Set("User-Agent", "urlctl/"+version)
+
+		resp, err = c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxAttempts {
+			break
+		}
+		resp.Body.Close()
+		time.Sleep(retryAfter(resp.Header))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var message struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(raw, &message) == nil {
+			apiErr.Message = message.Message
+		} else {
+			apiErr.Message = strings.TrimSpace(string(raw))
+		}
+		return resp.Header, apiErr
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.Header, fmt.Errorf("decoding the response: %w", err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// retryAfter returns how long a 429 response asks the client to wait.
+func retryAfter(header http.Header) time.Duration {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Second
+}
+
+// link is a link as the API describes it.
+type link struct {
+	ShortCode          string     `json:"short_code"`
+	ShortURL           string     `json:"short_url"`
+	URL                string     `json:"url"`
+	Status             string     `json:"status"`
+	PendingValidation  bool       `json:"pending_validation,omitempty"`
+	IntendedLiveDate   *time.Time `json:"intended_live_date,omitempty"`
+	IntendedExpiryDate *time.Time `json:"intended_expiry_date,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// shortenRequest is the body of POST /shorten.
+type shortenRequest struct {
+	URL                string     `json:"url"`
+	Alias              string     `json:"alias,omitempty"`
+	IntendedExpiryDate *time.Time `json:"intended_expiry_date,omitempty"`
+}
+
+// shortenResponse is what POST /shorten returns.
+type shortenResponse struct {
+	ShortURL           string     `json:"short_url"`
+	Status             string     `json:"status"`
+	PendingValidation  bool       `json:"pending_validation,omitempty"`
+	FinalURL           string     `json:"final_url,omitempty"`
+	IntendedExpiryDate *time.Time `json:"intended_expiry_date,omitempty"`
+}
+
+func (c *client) shorten(req shortenRequest) (shortenResponse, error) {
+	var resp shortenResponse
+	_, err := c.do(http.MethodPost, "/shorten", nil, req, &resp)
+	return resp, err
+}
+
+// listLinks calls fn with each page of the caller's links, newest first,
+// until fn returns false or there are no more. limit is the page size.
+// Links are passed as the API returned them, so none of their fields are
+// lost.
+func (c *client) listLinks(limit int, fn func([]json.RawMessage) bool) error {
+	query := url.Values{"limit": {fmt.Sprint(limit)}}
+	for {
+		var page []json.RawMessage
+		header, err := c.do(http.MethodGet, "/api/links", query, nil, &page)
+		if err != nil {
+			return err
+		}
+		if !fn(page) {
+			return nil
+		}
+		cursor := header.Get(nextCursorHeader)
+		if cursor == "" {
+			return nil
+		}
+		query.Set("cursor", cursor)
+	}
+}
+
+func (c *client) deleteLink(shortCode string) error {
+	_, err := c.do(http.MethodDelete, "/api/links/"+url.PathEscape(shortCode), nil, nil, nil)
+	return err
+}
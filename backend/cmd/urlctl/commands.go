@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout is the date-only form accepted wherever a time is, as by the
+// API's date filters.
+const dateLayout = "2006-01-02"
+
+func runShorten(c *client, out *output, args []string) error {
+	flags := flag.NewFlagSet("shorten", flag.ExitOnError)
+	alias := flags.String("alias", "", "custom short code")
+	expires := flags.String("expires", "", "expiry date, RFC 3339 or YYYY-MM-DD")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: urlctl shorten [-alias code] [-expires date] <url>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	req := shortenRequest{URL: flags.Arg(0), Alias: *alias}
+	if *expires != "" {
+		expiry, err := parseDate(*expires)
+		if err != nil {
+			return err
+		}
+		req.IntendedExpiryDate = &expiry
+	}
+	resp, err := c.shorten(req)
+	if err != nil {
+		return err
+	}
+
+	if out.json {
+		return out.value(resp)
+	}
+	fmt.Fprintln(out.w, resp.ShortURL)
+	return nil
+}
+
+func runList(c *client, out *output, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	limit := flags.Int("limit", 50, "how many links to show")
+	all := flags.Bool("all", false, "show every link, fetching as many pages as it takes")
+	flags.Parse(args)
+	if *limit < 1 {
+		return fmt.Errorf("-limit must be at least 1")
+	}
+
+	pageSize := *limit
+	if pageSize > 200 {
+		pageSize = 200
+	}
+	var links []json.RawMessage
+	err := c.listLinks(pageSize, func(page []json.RawMessage) bool {
+		links = append(links, page...)
+		return *all || len(links) < *limit
+	})
+	if err != nil {
+		return err
+	}
+	if !*all && len(links) > *limit {
+		links = links[:*limit]
+	}
+
+	if out.json {
+		if links == nil {
+			links = []json.RawMessage{}
+		}
+		return out.value(links)
+	}
+	rows := make([][]string, 0, len(links))
+	for _, raw := range links {
+		var l link
+		if err := json.Unmarshal(raw, &l); err != nil {
+			return err
+		}
+		rows = append(rows, []string{l.ShortCode, l.Status, formatTime(l.CreatedAt), formatOptionalTime(l.IntendedExpiryDate), l.URL})
+	}
+	out.table([]string{"SHORT CODE", "STATUS", "CREATED", "EXPIRES", "URL"}, rows)
+	return nil
+}
+
+// linkStats is what the stats command reports for a link.
+type linkStats struct {
+	ShortCode      string            `json:"short_code"`
+	Clicks         int64             `json:"clicks"`
+	Conversions    int64             `json:"conversions"`
+	ConversionRate float64           `json:"conversion_rate"`
+	Interval       string            `json:"interval"`
+	Points         []timeSeriesPoint `json:"points"`
+}
+
+type timeSeriesPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Clicks int64     `json:"clicks"`
+}
+
+func runStats(c *client, out *output, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	interval := flags.String("interval", "day", "hour, day or week")
+	from := flags.String("from", "", "start of the range, RFC 3339 or YYYY-MM-DD; defaults to the server's")
+	to := flags.String("to", "", "end of the range, exclusive")
+	bots := flags.Bool("bots", false, "count clicks from bots too")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: urlctl stats [-interval i] [-from date] [-to date] [-bots] <short code>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	shortCode := flags.Arg(0)
+	path := "/api/links/" + url.PathEscape(shortCode) + "/stats/"
+
+	query := url.Values{}
+	if *bots {
+		query.Set("include_bots", "true")
+	}
+	stats := linkStats{ShortCode: shortCode}
+	if _, err := c.do(http.MethodGet, path+"conversions", query, nil, &stats); err != nil {
+		return err
+	}
+
+	query.Set("interval", *interval)
+	if *from != "" {
+		query.Set("from", *from)
+	}
+	if *to != "" {
+		query.Set("to", *to)
+	}
+	if _, err := c.do(http.MethodGet, path+"timeseries", query, nil, &stats); err != nil {
+		return err
+	}
+
+	if out.json {
+		return out.value(stats)
+	}
+	fmt.Fprintf(out.w, "Clicks: %d\nConversions: %d (%.1f%%)\n\n", stats.Clicks, stats.Conversions, stats.ConversionRate*100)
+	rows := make([][]string, 0, len(stats.Points))
+	for _, point := range stats.Points {
+		rows = append(rows, []string{formatTime(point.Bucket), strconv.FormatInt(point.Clicks, 10)})
+	}
+	out.table([]string{strings.ToUpper(stats.Interval), "CLICKS"}, rows)
+	return nil
+}
+
+func runDelete(c *client, out *output, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: urlctl delete <short code>...")
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Carry on past failures so one bad code doesn't stop the rest
+	deleted := []string{}
+	failed := 0
+	for _, shortCode := range flags.Args() {
+		if err := c.deleteLink(shortCode); err != nil {
+			fmt.Fprintf(os.Stderr, "urlctl: deleting %s: %v\n", shortCode, err)
+			failed++
+			continue
+		}
+		deleted = append(deleted, shortCode)
+		if !out.json {
+			fmt.Fprintf(out.w, "Deleted %s\n", shortCode)
+		}
+	}
+	if out.json {
+		if err := out.value(map[string][]string{"deleted": deleted}); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d links could not be deleted", failed, flags.NArg())
+	}
+	return nil
+}
+
+// parseDate reads an RFC 3339 time or a YYYY-MM-DD date, taken as midnight UTC.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("%q is not an RFC 3339 time or YYYY-MM-DD date", value)
+	}
+	return t, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return formatTime(*t)
+}
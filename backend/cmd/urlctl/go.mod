@@ -0,0 +1,3 @@
+module urlctl
+
+go 1.21
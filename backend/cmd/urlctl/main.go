@@ -0,0 +1,119 @@
+// Command urlctl is a command-line client for the URL shortener's REST
+// API, for scripting and quick operations work. It authenticates with an
+// API key and prints tables, or JSON with -output json.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// version is set at link time with -ldflags "-X main.version=...".
+var version = "dev"
+
+const usage = `usage: urlctl [flags] <command> [arguments]
+
+Commands:
+  shorten <url>          shorten a URL
+  list                   list your links, newest first
+  stats <short code>     show a link's clicks
+  delete <short code>... delete links
+  export                 write all your links as CSV or JSON
+  import <file>          shorten every URL in a CSV or JSON file
+
+Run "urlctl <command> -h" for a command's flags.
+
+Flags:
+`
+
+// command runs one subcommand with its arguments.
+type command func(c *client, out *output, args []string) error
+
+var commands = map[string]command{
+	"shorten": runShorten,
+	"list":    runList,
+	"stats":   runStats,
+	"delete":  runDelete,
+	"export":  runExport,
+	"import":  runImport,
+}
+
+func main() {
+	flags := flag.NewFlagSet("urlctl", flag.ExitOnError)
+	server := flags.String("server", envOr("URLCTL_SERVER", "http://localhost:8080"), "base URL of the API; defaults to $URLCTL_SERVER")
+	apiKey := flags.String("key", os.Getenv("URLCTL_API_KEY"), "API key; defaults to $URLCTL_API_KEY")
+	format := flags.String("output", "table", "output format: table or json")
+	printVersion := flags.Bool("version", false, "print the version and exit")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if *printVersion {
+		fmt.Println("urlctl", version)
+		return
+	}
+	if *format != "table" && *format != "json" {
+		fatalf("-output must be table or json, got %q", *format)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	run, ok := commands[flags.Arg(0)]
+	if !ok {
+		fatalf("unknown command %q; run urlctl -h for the list", flags.Arg(0))
+	}
+
+	out := &output{w: os.Stdout, json: *format == "json"}
+	if err := run(newClient(*server, *apiKey), out, flags.Args()[1:]); err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Status == 401 && *apiKey == "" {
+			fatalf("%v\nSet an API key with -key or URLCTL_API_KEY", err)
+		}
+		fatalf("%v", err)
+	}
+}
+
+// output prints results as tables or as JSON.
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+// table prints rows under header, aligned in columns.
+func (o *output) table(header []string, rows [][]string) {
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// value prints v as indented JSON.
+func (o *output) value(v interface{}) error {
+	encoder := json.NewEncoder(o.w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "urlctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns are the columns export writes. import reads url, short_code
+// and intended_expiry_date from them, so an export can be imported again.
+var csvColumns = []string{"short_code", "url", "status", "created_at", "intended_expiry_date", "short_url"}
+
+func runExport(c *client, out *output, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "csv or json; defaults to the -o file's extension, else csv")
+	path := flags.String("o", "", "file to write; defaults to standard output")
+	flags.Parse(args)
+
+	w := out.w
+	if *path != "" {
+		file, err := os.Create(*path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	kind, err := fileFormat(*format, *path)
+	if err != nil {
+		return err
+	}
+
+	// Links are written a page at a time, so exports of any size stream
+	var writeErr error
+	count := 0
+	switch kind {
+	case "json":
+		fmt.Fprint(w, "[")
+		err = c.listLinks(200, func(page []json.RawMessage) bool {
+			for _, raw := range page {
+				separator := ",\n"
+				if count == 0 {
+					separator = "\n"
+				}
+				if _, writeErr = fmt.Fprintf(w, "%s%s", separator, raw); writeErr != nil {
+					return false
+				}
+				count++
+			}
+			return true
+		})
+		fmt.Fprintln(w, "\n]")
+	case "csv":
+		records := csv.NewWriter(w)
+		records.Write(csvColumns)
+		err = c.listLinks(200, func(page []json.RawMessage) bool {
+			for _, raw := range page {
+				var l link
+				if writeErr = json.Unmarshal(raw, &l); writeErr != nil {
+					return false
+				}
+				expiry := ""
+				if l.IntendedExpiryDate != nil {
+					expiry = l.IntendedExpiryDate.UTC().Format(time.RFC3339)
+				}
+				records.Write([]string{l.ShortCode, l.URL, l.Status, l.CreatedAt.UTC().Format(time.RFC3339), expiry, l.ShortURL})
+				count++
+			}
+			records.Flush()
+			writeErr = records.Error()
+			return writeErr == nil
+		})
+	}
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return err
+	}
+	if *path != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d links to %s\n", count, *path)
+	}
+	return nil
+}
+
+// importRow is one link to create from an import file.
+type importRow struct {
+	Line    int // in the file, for error reports
+	Request shortenRequest
+	Err     error // set when the row couldn't be read
+}
+
+// importResult reports what happened to one row.
+type importResult struct {
+	Line     int    `json:"line"`
+	URL      string `json:"url"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func runImport(c *client, out *output, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "csv or json; defaults to the file's extension")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), `usage: urlctl import [-format csv|json] <file, or - for standard input>
+
+CSV files need a header row naming a url column, and may have alias or
+short_code and expiry or intended_expiry_date columns. JSON files hold an
+array of objects with the same keys. Rows that fail are reported and the
+rest are still imported.`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	path := flags.Arg(0)
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	} else if *format == "" {
+		return fmt.Errorf("-format must be set when importing from standard input")
+	}
+	kind, err := fileFormat(*format, path)
+	if err != nil {
+		return err
+	}
+
+	var rows []importRow
+	if kind == "json" {
+		rows, err = readJSONRows(in)
+	} else {
+		rows, err = readCSVRows(in)
+	}
+	if err != nil {
+		return err
+	}
+
+	results := make([]importResult, 0, len(rows))
+	failed := 0
+	for _, row := range rows {
+		result := importResult{Line: row.Line, URL: row.Request.URL}
+		if row.Err == nil {
+			var resp shortenResponse
+			if resp, row.Err = c.shorten(row.Request); row.Err == nil {
+				result.ShortURL = resp.ShortURL
+			}
+		}
+		if row.Err != nil {
+			result.Error = row.Err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if out.json {
+		if err := out.value(results); err != nil {
+			return err
+		}
+	} else {
+		table := make([][]string, 0, len(results))
+		for _, result := range results {
+			outcome := result.ShortURL
+			if result.Error != "" {
+				outcome = "error: " + result.Error
+			}
+			table = append(table, []string{strconv.Itoa(result.Line), result.URL, outcome})
+		}
+		out.table([]string{"LINE", "URL", "RESULT"}, table)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rows could not be imported", failed, len(rows))
+	}
+	return nil
+}
+
+func readCSVRows(in io.Reader) ([]importRow, error) {
+	records := csv.NewReader(in)
+	records.FieldsPerRecord = -1
+	header, err := records.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the header row: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, fmt.Errorf("the header row has no url column")
+	}
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+
+	var rows []importRow
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := records.FieldPos(0)
+		rows = append(rows, newImportRow(line, field(record, "url"),
+			field(record, "alias", "short_code"), field(record, "expiry", "intended_expiry_date")))
+	}
+}
+
+func readJSONRows(in io.Reader) ([]importRow, error) {
+	var entries []struct {
+		URL                string `json:"url"`
+		Alias              string `json:"alias"`
+		ShortCode          string `json:"short_code"`
+		Expiry             string `json:"expiry"`
+		IntendedExpiryDate string `json:"intended_expiry_date"`
+	}
+	if err := json.NewDecoder(in).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("reading the JSON array: %w", err)
+	}
+
+	rows := make([]importRow, 0, len(entries))
+	for i, entry := range entries {
+		alias, expiry := entry.Alias, entry.Expiry
+		if alias == "" {
+			alias = entry.ShortCode
+		}
+		if expiry == "" {
+			expiry = entry.IntendedExpiryDate
+		}
+		// There are no lines to point at in JSON, so rows count from one
+		rows = append(rows, newImportRow(i+1, entry.URL, alias, expiry))
+	}
+	return rows, nil
+}
+
+func newImportRow(line int, rawURL, alias, expiry string) importRow {
+	row := importRow{Line: line, Request: shortenRequest{URL: rawURL, Alias: alias}}
+	if rawURL == "" {
+		row.Err = fmt.Errorf("url is empty")
+		return row
+	}
+	if expiry != "" {
+		date, err := parseDate(expiry)
+		if err != nil {
+			row.Err = err
+			return row
+		}
+		row.Request.IntendedExpiryDate = &date
+	}
+	return row
+}
+
+// fileFormat works out whether a file is CSV or JSON from the -format flag
+// or, failing that, its extension.
+func fileFormat(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			return "json", nil
+		case ".csv", "":
+			return "csv", nil
+		default:
+			return "", fmt.Errorf("can't tell the format of %s; set -format", path)
+		}
+	}
+	if format != "csv" && format != "json" {
+		return "", fmt.Errorf("-format must be csv or json, got %q", format)
+	}
+	return format, nil
+}